@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"link-preview-api/pkg/server"
 )
 
 // ExampleClient demonstrates how to use the Link Preview API
@@ -26,8 +28,8 @@ func NewExampleClient(baseURL string) *ExampleClient {
 }
 
 // FetchPreview demonstrates fetching a link preview
-func (ec *ExampleClient) FetchPreview(url string) (*LinkPreviewResponse, error) {
-	reqBody := LinkPreviewRequest{URL: url}
+func (ec *ExampleClient) FetchPreview(url string) (*server.LinkPreviewResponse, error) {
+	reqBody := server.LinkPreviewRequest{URL: url}
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
@@ -48,7 +50,7 @@ func (ec *ExampleClient) FetchPreview(url string) (*LinkPreviewResponse, error)
 		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
 
-	var preview LinkPreviewResponse
+	var preview server.LinkPreviewResponse
 	if err := json.Unmarshal(body, &preview); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
 	}
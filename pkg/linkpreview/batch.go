@@ -0,0 +1,63 @@
+package linkpreview
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultBatchParallelism is how many pages PreviewBatch fetches at once when
+// not told otherwise
+const DefaultBatchParallelism = 8
+
+// BatchResult is the outcome of one URL of a PreviewBatch call
+type BatchResult struct {
+	URL     string
+	Preview *Preview // May be set along with Err, as with Preview
+	Err     error
+}
+
+// PreviewBatch previews every URL in urls, fetching at most parallelism pages
+// at once (DefaultBatchParallelism when parallelism <= 0). Results are in the
+// order of urls. Repeated URLs are fetched once. Canceling ctx fails the URLs
+// not yet fetched
+func (c *Client) PreviewBatch(ctx context.Context, urls []string, parallelism int) []BatchResult {
+	if parallelism <= 0 {
+		parallelism = DefaultBatchParallelism
+	}
+
+	results := make([]BatchResult, len(urls))
+	first := make(map[string]int, len(urls)) // Index of the first occurrence of each URL
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, rawURL := range urls {
+		results[i].URL = rawURL
+		if _, seen := first[rawURL]; seen {
+			continue
+		}
+		first[rawURL] = i
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(result *BatchResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result.Preview, result.Err = c.Preview(ctx, result.URL)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	for i := range results {
+		if j := first[results[i].URL]; j != i {
+			results[i].Err = results[j].Err
+			if results[j].Preview != nil {
+				results[i].Preview = results[j].Preview.clone()
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,84 @@
+package linkpreview
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-memory LRU Cache. Entries expire after the TTL, and
+// the least recently used entry is evicted once the cache holds its maximum
+// number of entries. It is safe for concurrent use
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	entries    map[string]*list.Element
+	order      *list.List // Front is the most recently used
+}
+
+// memoryEntry is a cached preview with its expiry
+type memoryEntry struct {
+	url       string
+	preview   *Preview
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates a cache of at most maxEntries previews, each kept for
+// ttl. maxEntries <= 0 means no limit and ttl <= 0 means entries never expire
+func NewMemoryCache(maxEntries int, ttl time.Duration) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get returns the preview cached for url, if it hasn't expired
+func (mc *MemoryCache) Get(url string) (*Preview, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	elem, ok := mc.entries[url]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		mc.remove(elem)
+		return nil, false
+	}
+	mc.order.MoveToFront(elem)
+	return entry.preview, true
+}
+
+// Set caches preview for url, evicting the least recently used entry when full
+func (mc *MemoryCache) Set(url string, preview *Preview) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	var expiresAt time.Time
+	if mc.ttl > 0 {
+		expiresAt = time.Now().Add(mc.ttl)
+	}
+	if elem, ok := mc.entries[url]; ok {
+		elem.Value = &memoryEntry{url: url, preview: preview, expiresAt: expiresAt}
+		mc.order.MoveToFront(elem)
+		return
+	}
+	mc.entries[url] = mc.order.PushFront(&memoryEntry{url: url, preview: preview, expiresAt: expiresAt})
+	for mc.maxEntries > 0 && mc.order.Len() > mc.maxEntries {
+		mc.remove(mc.order.Back())
+	}
+}
+
+// Len returns the number of cached previews, including expired ones not yet evicted
+func (mc *MemoryCache) Len() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.order.Len()
+}
+
+func (mc *MemoryCache) remove(elem *list.Element) {
+	mc.order.Remove(elem)
+	delete(mc.entries, elem.Value.(*memoryEntry).url)
+}
@@ -0,0 +1,68 @@
+package linkpreview
+
+import "regexp"
+
+// consentPhrases are the phrases of the titles, headings and notices of
+// cookie and consent walls, in the languages they are most often met in
+const consentPhrases = `accept (?:all )?cookies|cookie (?:consent|wall|notice|banner)|consent to (?:the use of )?cookies|` +
+	`(?:we|this (?:web)?site) uses? cookies|before you continue|we value your privacy|` +
+	`your privacy (?:choices|matters|is important to us)|privacy (?:preference|consent) cent(?:er|re)|` +
+	`manage (?:your )?(?:cookie|consent|privacy) (?:preferences|settings|choices)|` +
+	`store and/or access information on a device|` +
+	`bevor sie (?:fortfahren|zu google weitergehen)|zustimmung erforderlich|` +
+	`avant d'accéder|avant de continuer|antes de continuar|antes de ir a|` +
+	`prima di continuare|voordat je verdergaat`
+
+var (
+	// consentPattern finds consent wall phrases anywhere in a text
+	consentPattern = regexp.MustCompile(`(?i)\b(?:` + consentPhrases + `)`)
+	// consentTitlePattern matches a title that opens with one: walls are
+	// titled by the phrase, while pages about cookies mention it further on
+	consentTitlePattern = regexp.MustCompile(`(?i)^\W*(?:` + consentPhrases + `)`)
+	// titleSeparators split a title such as "Example | We value your privacy"
+	titleSeparators = regexp.MustCompile(`\s+[|\-–—:·]\s+`)
+)
+
+// maxConsentText is how much of a text is searched for consent wall
+// phrases; walls state them up front, while pages about cookies may
+// mention them further on
+const maxConsentText = 200
+
+// ConsentText reports whether s, a title, heading or description, is that
+// of a cookie or consent wall, such as "Before you continue" or "We value
+// your privacy", rather than of the page behind it
+func ConsentText(s string) bool {
+	if len(s) > maxConsentText {
+		s = s[:maxConsentText]
+	}
+	return consentPattern.MatchString(s)
+}
+
+// consentTitle reports whether title, or one of its parts around separators
+// such as " | ", opens with a consent wall phrase
+func consentTitle(title string) bool {
+	for _, part := range titleSeparators.Split(title, -1) {
+		if consentTitlePattern.MatchString(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConsentWall reports whether the page is a cookie or consent wall: its
+// title opens with a consent wall phrase or, lacking a title, its
+// description does
+func (d *Document) ConsentWall() bool {
+	title := d.Title
+	if title == "" {
+		title = d.MetaValue("og:title")
+	}
+	if title != "" {
+		return consentTitle(title)
+	}
+	description := d.MetaValue("description")
+	if description == "" {
+		description = d.MetaValue("og:description")
+	}
+	return consentTitle(description)
+}
@@ -0,0 +1,103 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+)
+
+// ErrorCode is a machine-readable error category. It implements error, so
+// errors.Is(err, ErrCodeTimeout) reports whether err is in that category
+type ErrorCode string
+
+// Error codes returned by Client.Preview, and by the service in error_code
+const (
+	ErrCodeDNS         ErrorCode = "ERR_DNS"          // The host could not be resolved
+	ErrCodeTimeout     ErrorCode = "ERR_TIMEOUT"      // The fetch or the whole call took too long
+	ErrCodeBlocked     ErrorCode = "ERR_BLOCKED"      // A policy or hook refused the URL
+	ErrCodeNotHTML     ErrorCode = "ERR_NOT_HTML"     // The page isn't HTML (e.g. an image or PDF)
+	ErrCodeTooLarge    ErrorCode = "ERR_TOO_LARGE"    // The body limit was reached before the end of the page's head
+	ErrCodeSSRFBlocked ErrorCode = "ERR_SSRF_BLOCKED" // The host resolves to an internal address
+	ErrCodeFetch       ErrorCode = "ERR_FETCH"        // Any other failure to retrieve the page
+)
+
+func (c ErrorCode) Error() string {
+	return string(c)
+}
+
+// Error is a failure with a machine-readable code
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+// NewError returns an *Error with code wrapping err
+func NewError(code ErrorCode, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return string(e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is e's code, so errors.Is(err, ErrCodeDNS) works
+func (e *Error) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && code == e.Code
+}
+
+// CodeOf returns the code of err: the code of the first *Error it wraps, else
+// ErrCodeDNS or ErrCodeTimeout for resolver and deadline errors, else "". A
+// *StatusError has no code; callers check for it separately
+func CodeOf(err error) ErrorCode {
+	var codedErr *Error
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &codedErr):
+		return codedErr.Code
+	case errors.As(err, &dnsErr):
+		return ErrCodeDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrCodeTimeout
+	}
+	return ""
+}
+
+// classify wraps a fetch error in an *Error with its code
+func classify(err error) error {
+	var codedErr *Error
+	if errors.As(err, &codedErr) {
+		return err
+	}
+	code := CodeOf(err)
+	if code == "" {
+		code = ErrCodeFetch
+	}
+	return NewError(code, err)
+}
+
+// CheckContentType returns an error with ErrCodeNotHTML unless contentType,
+// a Content-Type header value, is HTML or XHTML. A missing or malformed header
+// passes, since many servers omit or garble it on HTML pages
+func CheckContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		return nil
+	}
+	return NewError(ErrCodeNotHTML, fmt.Errorf("unsupported content type %q", mediaType))
+}
@@ -0,0 +1,70 @@
+package linkpreview
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// Fetcher retrieves pages for a Client. The default, HTTPFetcher, sends a GET
+// request; other implementations can render pages in a headless browser, read
+// them from an archive, or serve canned pages in tests
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (*Response, error)
+}
+
+// FetcherFunc adapts a function to the Fetcher interface
+type FetcherFunc func(ctx context.Context, url string) (*Response, error)
+
+// Fetch calls f(ctx, url)
+func (f FetcherFunc) Fetch(ctx context.Context, url string) (*Response, error) {
+	return f(ctx, url)
+}
+
+// Response is a fetched page. The Client closes Body
+type Response struct {
+	URL        string // Final URL, after any redirects; empty means the requested URL
+	StatusCode int    // 0 is treated as 200 OK, for fetchers without status codes
+	Header     http.Header
+	Body       io.ReadCloser
+}
+
+// HTTPFetcher fetches pages with an HTTP GET request
+type HTTPFetcher struct {
+	Client    *http.Client // nil means the client shared by every Client
+	UserAgent string       // Empty means DefaultUserAgent
+	Prepare   RequestHook  // Optional; adjusts each request before it is sent
+}
+
+// Fetch sends a GET request for url
+func (f *HTTPFetcher) Fetch(ctx context.Context, url string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := f.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if f.Prepare != nil {
+		if err := f.Prepare(req); err != nil {
+			return nil, err
+		}
+	}
+
+	client := f.Client
+	if client == nil {
+		client = sharedClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       resp.Body,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package linkpreview
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Hooks let callers take part in each Preview call without replacing the
+// fetcher or the parsers: to rewrite or veto URLs, add credentials to
+// requests, inspect responses, or post-process and record results. Hooks of
+// the same kind run in the order they were added; the first error stops the
+// call and is returned from Preview
+
+// BeforeFetchHook runs before a URL is looked up in the cache or fetched. It
+// may rewrite target in place; returning an error vetoes the URL, and Preview
+// returns it as an *Error with ErrCodeBlocked unless it already has a code
+type BeforeFetchHook func(ctx context.Context, target *url.URL) error
+
+// RequestHook adjusts each HTTP request the default fetcher sends, e.g. to add
+// an Authorization header. It has no effect with WithFetcher
+type RequestHook func(req *http.Request) error
+
+// AfterFetchHook runs when a page has been fetched, before its status is
+// checked. It may replace resp.Body, e.g. to count the bytes read; closing the
+// replacement must close the original
+type AfterFetchHook func(ctx context.Context, resp *Response) error
+
+// AfterParseHook runs when a preview has been extracted, before it is cached.
+// It may modify preview; cache hits don't run it again
+type AfterParseHook func(ctx context.Context, preview *Preview) error
+
+// hooks holds the hooks of a Client
+type hooks struct {
+	beforeFetch []BeforeFetchHook
+	request     []RequestHook
+	afterFetch  []AfterFetchHook
+	afterParse  []AfterParseHook
+}
+
+func (h *hooks) runBeforeFetch(ctx context.Context, target *url.URL) error {
+	for _, hook := range h.beforeFetch {
+		if err := hook(ctx, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepare returns the request hooks combined into one, or nil when there are none
+func (h *hooks) prepare() RequestHook {
+	if len(h.request) == 0 {
+		return nil
+	}
+	return func(req *http.Request) error {
+		for _, hook := range h.request {
+			if err := hook(req); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (h *hooks) runAfterFetch(ctx context.Context, resp *Response) error {
+	for _, hook := range h.afterFetch {
+		if err := hook(ctx, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *hooks) runAfterParse(ctx context.Context, preview *Preview) error {
+	for _, hook := range h.afterParse {
+		if err := hook(ctx, preview); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package linkpreview
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// BodyImage is an <img> element of the page body, a candidate for the preview
+// image of pages that declare none
+type BodyImage struct {
+	Src    string // src, or the data-src of lazy-loaded images
+	Srcset string // srcset, or data-srcset
+	Width  int    // width attribute in pixels, 0 if missing
+	Height int    // height attribute in pixels, 0 if missing
+	Alt    string
+	Class  string // class and id, which often name logos and icons
+}
+
+// maxBodyImages is how many <img> elements are read from the body; a hero
+// image sits near the top of a page
+const maxBodyImages = 10
+
+// heroImageWidth is the width srcset candidates are chosen for: that of a
+// large card on a high-density screen
+const heroImageWidth = 1200
+
+// Hints below which an image is taken for an icon, pixel or banner
+const (
+	minHeroSide   = 100
+	maxHeroAspect = 4.0
+)
+
+// unknownImageArea is the area assumed for an image without size hints
+const unknownImageArea = 300 * 200
+
+// decorativeMarkers in an image's URL, class or id mark it as page chrome
+var decorativeMarkers = []string{
+	"logo", "icon", "avatar", "gravatar", "sprite", "spacer", "pixel",
+	"badge", "emoji", "placeholder", "loading", "blank.gif",
+}
+
+// heroImage returns the URL of the image most likely to be the page's hero:
+// the largest by its size hints, favouring images nearer the top, and skipping
+// icons, logos, tracking pixels and banners. It returns "" if none qualifies
+func heroImage(images []BodyImage) string {
+	var best string
+	var bestScore float64
+	for position, img := range images {
+		url, score := img.choose(), img.score()
+		// Each image further down counts for less
+		score /= 1 + 0.5*float64(position)
+		if url != "" && score > bestScore {
+			best, bestScore = url, score
+		}
+	}
+	return best
+}
+
+// score rates how likely img is a hero image by its size hints, or 0 when it
+// looks decorative
+func (img BodyImage) score() float64 {
+	src := strings.ToLower(img.Src)
+	if strings.HasSuffix(strings.SplitN(src, "?", 2)[0], ".svg") {
+		return 0
+	}
+	chrome := strings.ToLower(src + " " + img.Class)
+	for _, marker := range decorativeMarkers {
+		if strings.Contains(chrome, marker) {
+			return 0
+		}
+	}
+	width, height := float64(img.Width), float64(img.Height)
+	if (width > 0 && width < minHeroSide) || (height > 0 && height < minHeroSide) {
+		return 0
+	}
+	switch {
+	case width > 0 && height > 0:
+		if width/height > maxHeroAspect || height/width > maxHeroAspect {
+			return 0
+		}
+		return width * height
+	case width > 0:
+		return width * width * 9 / 16
+	}
+	if widest := widestCandidate(parseSrcset(img.Srcset)); widest > 0 {
+		return float64(widest*widest) * 9 / 16
+	}
+	return unknownImageArea
+}
+
+// choose returns the srcset candidate best suited to a large card, else src.
+// Data URIs, usually placeholders of lazy loading, are never chosen
+func (img BodyImage) choose() string {
+	url := img.Src
+	if candidates := parseSrcset(img.Srcset); len(candidates) > 0 {
+		// Density descriptors are relative to the width attribute, or to half
+		// the target width when there is none
+		base := img.Width
+		if base == 0 {
+			base = heroImageWidth / 2
+		}
+		var best srcsetCandidate
+		for _, c := range candidates {
+			if c.width == 0 {
+				c.width = int(c.density * float64(base))
+			}
+			// Prefer the smallest candidate at least heroImageWidth wide, else the widest
+			if best.url == "" || (best.width < heroImageWidth && c.width > best.width) ||
+				(c.width >= heroImageWidth && c.width < best.width) {
+				best = c
+			}
+		}
+		url = best.url
+	}
+	if strings.HasPrefix(strings.ToLower(url), "data:") {
+		return ""
+	}
+	return url
+}
+
+// srcsetCandidate is an image URL of a srcset with its width or pixel density descriptor
+type srcsetCandidate struct {
+	url     string
+	width   int     // w descriptor, 0 if absent
+	density float64 // x descriptor, 1 if absent
+}
+
+// parseSrcset parses a srcset attribute, e.g. "a.jpg 640w, b.jpg 1280w" or
+// "a.jpg, b.jpg 2x", skipping malformed candidates: those with an unknown,
+// repeated or unparsable descriptor, with both a width and a density, or
+// with a height but no width
+func parseSrcset(srcset string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	for rest := strings.TrimSpace(srcset); rest != ""; rest = strings.TrimLeft(rest, " \t\n\r\f,") {
+		// The URL runs to the next whitespace; commas ending it separate candidates
+		end := strings.IndexAny(rest, " \t\n\r\f")
+		if end < 0 {
+			end = len(rest)
+		}
+		url := rest[:end]
+		rest = rest[end:]
+		descriptor := ""
+		if trimmed := strings.TrimRight(url, ","); trimmed != url {
+			url = trimmed
+		} else {
+			descriptor, rest, _ = strings.Cut(rest, ",")
+		}
+		if url == "" {
+			continue
+		}
+		c := srcsetCandidate{url: url, density: 1}
+		valid, hasDensity, hasHeight := true, false, false
+		for _, d := range strings.Fields(descriptor) {
+			value := d[:len(d)-1]
+			switch d[len(d)-1] {
+			case 'w':
+				n, err := strconv.Atoi(value)
+				valid = valid && err == nil && n > 0 && value[0] != '+' && c.width == 0 && !hasDensity
+				c.width = n
+			case 'x':
+				n, err := strconv.ParseFloat(value, 64)
+				valid = valid && err == nil && n > 0 && !math.IsInf(n, 0) && !hasDensity && c.width == 0
+				c.density, hasDensity = n, true
+			case 'h':
+				// A height hint, only valid alongside a width, is not used
+				n, err := strconv.Atoi(value)
+				valid = valid && err == nil && n > 0 && value[0] != '+' && !hasHeight
+				hasHeight = true
+			default:
+				valid = false
+			}
+		}
+		if valid && (!hasHeight || c.width > 0) {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+// widestCandidate returns the largest w descriptor of candidates, or 0
+func widestCandidate(candidates []srcsetCandidate) int {
+	widest := 0
+	for _, c := range candidates {
+		widest = max(widest, c.width)
+	}
+	return widest
+}
+
+// imgAttributes reads the current <img> tag
+func imgAttributes(z *html.Tokenizer) BodyImage {
+	var img BodyImage
+	var lazySrc, lazySrcset string
+	for {
+		attr, val, more := z.TagAttr()
+		value := strings.TrimSpace(string(val))
+		switch string(attr) {
+		case "src":
+			img.Src = value
+		case "data-src", "data-lazy-src", "data-original":
+			lazySrc = value
+		case "srcset":
+			img.Srcset = value
+		case "data-srcset", "data-lazy-srcset":
+			lazySrcset = value
+		case "width":
+			img.Width = pixels(value)
+		case "height":
+			img.Height = pixels(value)
+		case "alt":
+			img.Alt = value
+		case "class", "id":
+			img.Class = strings.TrimSpace(img.Class + " " + value)
+		}
+		if !more {
+			break
+		}
+	}
+	// Lazy loading keeps the real image in a data attribute until it is in view
+	if lazySrc != "" && (img.Src == "" || strings.HasPrefix(strings.ToLower(img.Src), "data:")) {
+		img.Src = lazySrc
+	}
+	if img.Srcset == "" {
+		img.Srcset = lazySrcset
+	}
+	return img
+}
+
+// pixels parses a width or height attribute such as "640" or "640px", or
+// returns 0 for anything else, e.g. a percentage
+func pixels(value string) int {
+	n, err := strconv.Atoi(strings.TrimSuffix(value, "px"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,114 @@
+package linkpreview
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset string
+		want   []srcsetCandidate
+	}{
+		{"", nil},
+		{"a.jpg", []srcsetCandidate{{"a.jpg", 0, 1}}},
+		{"a.jpg 640w, b.jpg 1280w", []srcsetCandidate{{"a.jpg", 640, 1}, {"b.jpg", 1280, 1}}},
+		{"a.jpg, b.jpg 2x", []srcsetCandidate{{"a.jpg", 0, 1}, {"b.jpg", 0, 2}}},
+		{"a.jpg 1.5x,b.jpg 3x", []srcsetCandidate{{"a.jpg", 0, 1.5}, {"b.jpg", 0, 3}}},
+		{"  a.jpg   640w ,\n b.jpg\t1280w  ", []srcsetCandidate{{"a.jpg", 640, 1}, {"b.jpg", 1280, 1}}},
+		{"a.jpg,, ,b.jpg 2x", []srcsetCandidate{{"a.jpg", 0, 1}, {"b.jpg", 0, 2}}},
+		{"https://cdn.example/i.jpg?w=640,h=480 640w", []srcsetCandidate{{"https://cdn.example/i.jpg?w=640,h=480", 640, 1}}},
+
+		// malformed descriptors drop their candidate only
+		{"a.jpg w, b.jpg 640w", []srcsetCandidate{{"b.jpg", 640, 1}}},
+		{"a.jpg 0w, b.jpg 640w", []srcsetCandidate{{"b.jpg", 640, 1}}},
+		{"a.jpg -640w, b.jpg 640w", []srcsetCandidate{{"b.jpg", 640, 1}}},
+		{"a.jpg +640w, b.jpg 640w", []srcsetCandidate{{"b.jpg", 640, 1}}},
+		{"a.jpg 640.5w, b.jpg 640w", []srcsetCandidate{{"b.jpg", 640, 1}}},
+		{"a.jpg 0x, b.jpg 2x", []srcsetCandidate{{"b.jpg", 0, 2}}},
+		{"a.jpg -1x, b.jpg 2x", []srcsetCandidate{{"b.jpg", 0, 2}}},
+		{"a.jpg Infx, b.jpg 2x", []srcsetCandidate{{"b.jpg", 0, 2}}},
+		{"a.jpg NaNx, b.jpg 2x", []srcsetCandidate{{"b.jpg", 0, 2}}},
+		{"a.jpg 640w 2x, b.jpg 2x", []srcsetCandidate{{"b.jpg", 0, 2}}},
+		{"a.jpg 640w 800w, b.jpg 640w", []srcsetCandidate{{"b.jpg", 640, 1}}},
+		{"a.jpg 1x 2x, b.jpg 2x", []srcsetCandidate{{"b.jpg", 0, 2}}},
+		{"a.jpg 640q, b.jpg 640w", []srcsetCandidate{{"b.jpg", 640, 1}}},
+		{"a.jpg big, b.jpg 640w", []srcsetCandidate{{"b.jpg", 640, 1}}},
+		{"a.jpg 640w 480h", []srcsetCandidate{{"a.jpg", 640, 1}}},
+		{"a.jpg 480h, b.jpg 2x 480h", nil},
+		{"a.jpg 640w 480h 480h", nil},
+	}
+	for _, tt := range tests {
+		if got := parseSrcset(tt.srcset); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSrcset(%q) = %+v, want %+v", tt.srcset, got, tt.want)
+		}
+	}
+}
+
+func TestPixels(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"640", 640},
+		{"640px", 640},
+		{"0", 0},
+		{"", 0},
+		{"50%", 0},
+		{"-10", 0},
+		{"12.5", 0},
+		{"auto", 0},
+	}
+	for _, tt := range tests {
+		if got := pixels(tt.value); got != tt.want {
+			t.Errorf("pixels(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestHeroImage(t *testing.T) {
+	tests := []struct {
+		name   string
+		images []BodyImage
+		want   string
+	}{
+		{"none", nil, ""},
+		{"only chrome", []BodyImage{
+			{Src: "/logo.png", Width: 400, Height: 400},
+			{Src: "/a.jpg", Class: "avatar", Width: 400, Height: 400},
+			{Src: "/b.svg", Width: 800, Height: 600},
+		}, ""},
+		{"largest wins", []BodyImage{
+			{Src: "/small.jpg", Width: 200, Height: 150},
+			{Src: "/large.jpg", Width: 1200, Height: 800},
+		}, "/large.jpg"},
+		{"icons, pixels and banners skipped", []BodyImage{
+			{Src: "/tiny.jpg", Width: 50, Height: 50},
+			{Src: "/track.gif", Width: 1, Height: 1},
+			{Src: "/banner.jpg", Width: 1200, Height: 100},
+			{Src: "/photo.jpg"},
+		}, "/photo.jpg"},
+		{"earlier favoured at equal size", []BodyImage{
+			{Src: "/first.jpg", Width: 800, Height: 600},
+			{Src: "/second.jpg", Width: 800, Height: 600},
+		}, "/first.jpg"},
+		{"data URI placeholder skipped", []BodyImage{
+			{Src: "data:image/gif;base64,R0lGOD", Width: 800, Height: 600},
+			{Src: "/real.jpg", Width: 400, Height: 300},
+		}, "/real.jpg"},
+		{"srcset width chosen", []BodyImage{
+			{Src: "/a-640.jpg", Srcset: "/a-640.jpg 640w, /a-1280.jpg 1280w, /a-2560.jpg 2560w"},
+		}, "/a-1280.jpg"},
+		{"srcset density chosen", []BodyImage{
+			{Src: "/a.jpg", Srcset: "/a.jpg 1x, /a@2x.jpg 2x", Width: 600, Height: 400},
+		}, "/a@2x.jpg"},
+		{"malformed srcset falls back to src", []BodyImage{
+			{Src: "/a.jpg", Srcset: "/a-big.jpg 1280w 2x, /a-huge.jpg Infx", Width: 600, Height: 400},
+		}, "/a.jpg"},
+	}
+	for _, tt := range tests {
+		if got := heroImage(tt.images); got != tt.want {
+			t.Errorf("%s: heroImage = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Package linkpreview fetches web pages and extracts link previews from them:
+// the title, description, image and site name found in the page's Open Graph
+// and Twitter card tags, JSON-LD, <title> and meta description, or failing
+// those in its first heading and paragraph.
+//
+//	client := linkpreview.NewClient(linkpreview.WithTimeout(10 * time.Second))
+//	preview, err := client.Preview(ctx, "https://go.dev")
+package linkpreview
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultUserAgent mimics a desktop browser, since some sites refuse requests without one
+const DefaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
+// UserAgents are named user agents for WithUserAgent. Many sites serve their
+// richest Open Graph tags only to the crawlers of the big networks
+var UserAgents = map[string]string{
+	"googlebot":           "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+	"facebookexternalhit": "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+	"twitterbot":          "Twitterbot/1.0",
+	"slackbot":            "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+	"desktop-chrome":      DefaultUserAgent,
+	"mobile-safari":       "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+}
+
+// DefaultMaxBodySize is how much of a page is read when looking for metadata
+const DefaultMaxBodySize = 1024 * 1024
+
+// sharedClient sends the requests of every Client without WithHTTPClient, so
+// they share one pool of connections. Its transport keeps more idle connections
+// per host than http.DefaultTransport, since previews often hit the same sites
+var sharedClient = &http.Client{Transport: newSharedTransport()}
+
+func newSharedTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 256
+	transport.MaxIdleConnsPerHost = 16
+	return transport
+}
+
+// Preview is the metadata extracted from a page
+type Preview struct {
+	URL         string `json:"url"`                // Page URL, after any redirects; relative URLs resolve against it
+	Title       string `json:"title"`              // Page title (og:title, twitter:title, JSON-LD, else <title>)
+	Description string `json:"description"`        // Page description (og:description, twitter:description, JSON-LD, else meta description)
+	Image       string `json:"image"`              // Preview image URL (og:image, twitter:image, else JSON-LD)
+	SiteName    string `json:"site_name"`          // Site name (og:site_name, else the JSON-LD publisher)
+	Language    string `json:"language,omitempty"` // Content language the page declares, e.g. "en-US"
+
+	// The page is a cookie or consent wall; its own title and description
+	// were skipped in favour of whatever the markup under it declares
+	ConsentWall bool `json:"consent_wall,omitempty"`
+
+	// Every <meta> content by lowercased name or property, and every <link>
+	// href as "link:" plus its rel, for fields the struct doesn't model
+	RawMeta map[string][]string `json:"raw_meta,omitempty"`
+
+	// The source of each field that was found, e.g. "title": "og"
+	Sources map[string]string `json:"sources,omitempty"`
+
+	QualityScore float64 `json:"quality_score,omitempty"` // Score, as of extraction
+
+	order FieldOrder // Ranks the sources while the pipeline runs
+}
+
+// Set fills field (FieldTitle, FieldDescription, FieldImage or FieldSiteName)
+// with value from source, recording the source in Sources. An empty value is
+// ignored, as are the wall's own title and description on a page that is a
+// consent wall. By default only an empty field is filled; when the pipeline
+// ranks the field's sources, a value replaces one from a lower ranked source
+// and values from unranked sources are ignored
+func (p *Preview) Set(field, source, value string) {
+	value = strings.TrimSpace(value)
+	current := p.field(field)
+	if current == nil || value == "" {
+		return
+	}
+	if p.ConsentWall && (field == FieldTitle || field == FieldDescription) && ConsentText(value) {
+		return
+	}
+	if ranked, ok := p.order[field]; ok {
+		rank := slices.Index(ranked, source)
+		if rank < 0 {
+			return
+		}
+		if *current != "" {
+			if currentRank := slices.Index(ranked, p.Sources[field]); currentRank >= 0 && currentRank <= rank {
+				return
+			}
+		}
+	} else if *current != "" {
+		return
+	}
+	*current = value
+	if p.Sources == nil {
+		p.Sources = make(map[string]string)
+	}
+	p.Sources[field] = source
+}
+
+// Get returns the value of field (FieldTitle, FieldDescription, FieldImage or
+// FieldSiteName), or "" for unknown fields
+func (p *Preview) Get(field string) string {
+	if value := p.field(field); value != nil {
+		return *value
+	}
+	return ""
+}
+
+// field returns a pointer to the named field, or nil for unknown names
+func (p *Preview) field(name string) *string {
+	switch name {
+	case FieldTitle:
+		return &p.Title
+	case FieldDescription:
+		return &p.Description
+	case FieldImage:
+		return &p.Image
+	case FieldSiteName:
+		return &p.SiteName
+	}
+	return nil
+}
+
+// clone returns a copy of p that shares no maps or slices with it
+func (p *Preview) clone() *Preview {
+	c := *p
+	if p.RawMeta != nil {
+		c.RawMeta = make(map[string][]string, len(p.RawMeta))
+		for key, values := range p.RawMeta {
+			c.RawMeta[key] = append([]string(nil), values...)
+		}
+	}
+	if p.Sources != nil {
+		c.Sources = make(map[string]string, len(p.Sources))
+		for field, source := range p.Sources {
+			c.Sources[field] = source
+		}
+	}
+	return &c
+}
+
+// Client fetches pages and extracts their previews. Create one with NewClient;
+// the zero value is also ready to use with the defaults. A Client is safe for
+// concurrent use
+type Client struct {
+	fetcher     Fetcher       // nil means an HTTPFetcher built from the settings below
+	httpClient  *http.Client  // nil means sharedClient
+	userAgent   string        // Empty means DefaultUserAgent
+	maxBodySize int64         // 0 means DefaultMaxBodySize
+	timeout     time.Duration // Bounds each Preview call; 0 means no limit beyond the context
+	cache       Cache         // nil disables caching
+	proxy       func(*http.Request) (*url.URL, error)
+	parsers     Pipeline   // nil means DefaultParsers
+	fieldOrder  FieldOrder // nil keeps the first value found for each field
+	hooks       hooks
+}
+
+// Cache stores previews by URL for a Client. Implementations must be safe for concurrent use
+type Cache interface {
+	Get(url string) (*Preview, bool)
+	Set(url string, preview *Preview)
+}
+
+// StatusError reports a page that answered with a status other than 200 OK
+type StatusError struct {
+	StatusCode int
+	Status     string // e.g. "404 Not Found"
+}
+
+func (e *StatusError) Error() string {
+	return "HTTP error: " + e.Status
+}
+
+// Preview fetches rawURL and extracts its preview. URLs without a scheme are
+// fetched over https. Failures are a *StatusError for pages that answer with
+// an error status, else usually an *Error whose Code says what went wrong.
+// With ErrCodeTooLarge, the preview found before the body limit is returned too
+func (c *Client) Preview(ctx context.Context, rawURL string) (*Preview, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	if target.Scheme == "" {
+		target, err = url.Parse("https://" + rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL: %v", err)
+		}
+	}
+	if err := c.hooks.runBeforeFetch(ctx, target); err != nil {
+		if CodeOf(err) == "" {
+			err = NewError(ErrCodeBlocked, err)
+		}
+		return nil, err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", target.Scheme)
+	}
+
+	if c.cache != nil {
+		if cached, ok := c.cache.Get(target.String()); ok {
+			return cached.clone(), nil
+		}
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	resp, err := c.fetcherOrDefault().Fetch(ctx, target.String())
+	if err != nil {
+		return nil, classify(err)
+	}
+	defer func() { resp.Body.Close() }() // AfterFetch hooks may replace the body
+	if err := c.hooks.runAfterFetch(ctx, resp); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 0 && resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))}
+	}
+	if err := CheckContentType(resp.Header.Get("Content-Type")); err != nil {
+		return nil, err
+	}
+
+	doc, err := ReadDocumentLimited(resp.Body, c.maxBodySizeOrDefault())
+	// Relative URLs in the page resolve against where it was fetched from, after redirects
+	doc.URL = target.String()
+	if resp.URL != "" {
+		doc.URL = resp.URL
+	}
+	preview := c.parsersOrDefault().ApplyOrder(doc, c.fieldOrder)
+	if err != nil && CodeOf(err) != ErrCodeTooLarge {
+		return preview, classify(fmt.Errorf("failed to read response body: %w", err))
+	}
+	// Partial previews of pages over the body limit go through the hooks too
+	if err := c.hooks.runAfterParse(ctx, preview); err != nil {
+		return nil, err
+	}
+	preview.QualityScore = preview.Score()
+	if err != nil {
+		// Only complete previews are cached
+		return preview, err
+	}
+	if c.cache != nil {
+		c.cache.Set(target.String(), preview.clone())
+	}
+	return preview, nil
+}
+
+func (c *Client) fetcherOrDefault() Fetcher {
+	if c.fetcher != nil {
+		return c.fetcher
+	}
+	return &HTTPFetcher{Client: c.client(), UserAgent: c.userAgent, Prepare: c.hooks.prepare()}
+}
+
+func (c *Client) parsersOrDefault() Pipeline {
+	if c.parsers != nil {
+		return c.parsers
+	}
+	return DefaultParsers()
+}
+
+func (c *Client) client() *http.Client {
+	if c.httpClient != nil {
+		return c.httpClient
+	}
+	return sharedClient
+}
+
+func (c *Client) maxBodySizeOrDefault() int64 {
+	if c.maxBodySize > 0 {
+		return c.maxBodySize
+	}
+	return DefaultMaxBodySize
+}
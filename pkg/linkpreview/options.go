@@ -0,0 +1,110 @@
+package linkpreview
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures a Client created by NewClient
+type Option func(*Client)
+
+// NewClient creates a Client configured by opts
+func NewClient(opts ...Option) *Client {
+	c := &Client{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	// The proxy is applied last so it works with any WithHTTPClient, whichever comes first
+	if c.proxy != nil {
+		c.httpClient = withProxy(c.client(), c.proxy)
+	}
+	return c
+}
+
+// WithFetcher retrieves pages with fetcher instead of an HTTPFetcher. The HTTP
+// client, user agent and proxy options then have no effect
+func WithFetcher(fetcher Fetcher) Option {
+	return func(c *Client) { c.fetcher = fetcher }
+}
+
+// WithHTTPClient sends requests with client instead of the client shared by
+// every Client, whose transport pools connections
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) { c.httpClient = client }
+}
+
+// WithTimeout bounds each Preview call, from sending the request to parsing the page
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) { c.timeout = timeout }
+}
+
+// WithUserAgent sends userAgent instead of DefaultUserAgent
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// WithMaxBodySize reads at most size bytes of each page instead of DefaultMaxBodySize
+func WithMaxBodySize(size int64) Option {
+	return func(c *Client) { c.maxBodySize = size }
+}
+
+// WithCache looks previews up in cache before fetching and stores fetched previews in it
+func WithCache(cache Cache) Option {
+	return func(c *Client) { c.cache = cache }
+}
+
+// WithParsers extracts previews with the given pipeline stages, in order,
+// instead of DefaultParsers
+func WithParsers(parsers ...Parser) Option {
+	return func(c *Client) { c.parsers = Pipeline(parsers) }
+}
+
+// WithBeforeFetch adds a hook run before each URL is looked up in the cache or
+// fetched; it can rewrite or veto the URL
+func WithBeforeFetch(hook BeforeFetchHook) Option {
+	return func(c *Client) { c.hooks.beforeFetch = append(c.hooks.beforeFetch, hook) }
+}
+
+// WithRequestHook adds a hook that adjusts each HTTP request before it is sent
+func WithRequestHook(hook RequestHook) Option {
+	return func(c *Client) { c.hooks.request = append(c.hooks.request, hook) }
+}
+
+// WithAfterFetch adds a hook run on each fetched page
+func WithAfterFetch(hook AfterFetchHook) Option {
+	return func(c *Client) { c.hooks.afterFetch = append(c.hooks.afterFetch, hook) }
+}
+
+// WithAfterParse adds a hook run on each extracted preview
+func WithAfterParse(hook AfterParseHook) Option {
+	return func(c *Client) { c.hooks.afterParse = append(c.hooks.afterParse, hook) }
+}
+
+// WithFieldOrder ranks the sources of each field, e.g. to prefer JSON-LD
+// titles over Open Graph ones or to never take images from Twitter cards
+func WithFieldOrder(order FieldOrder) Option {
+	return func(c *Client) { c.fieldOrder = order }
+}
+
+// WithProxy sends requests through the proxy chosen by proxy, e.g.
+// http.ProxyURL(u) or http.ProxyFromEnvironment. It applies to the HTTP
+// client's transport when that is an *http.Transport, else to a copy of
+// http.DefaultTransport
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(c *Client) { c.proxy = proxy }
+}
+
+// withProxy returns a copy of client whose transport uses proxy
+func withProxy(client *http.Client, proxy func(*http.Request) (*url.URL, error)) *http.Client {
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	transport.Proxy = proxy
+
+	proxied := *client
+	proxied.Transport = transport
+	return &proxied
+}
@@ -0,0 +1,418 @@
+package linkpreview
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// maxTokenBytes caps the tokenizer's buffer, and so the size of any single
+// tag or text run; parsing stops at the first token larger than this
+const maxTokenBytes = 256 * 1024
+
+// readerPool recycles the read buffers used to stream page bodies into the tokenizer
+var readerPool = sync.Pool{
+	New: func() interface{} { return bufio.NewReaderSize(nil, 32*1024) },
+}
+
+// Document is what a page's head contains, as read by the tokenizer. It is the
+// input of every Parser stage. Tag and attribute names, and the names of meta
+// tags, are matched in any case; contents keep the case and characters of the page
+type Document struct {
+	URL    string              // Page URL, when known
+	Lang   string              // lang of <html>, else the first <meta http-equiv="content-language">
+	Title  string              // Text of the first <title>
+	Meta   map[string][]string // Non-empty <meta> contents by lowercased name or property, in page order
+	Links  map[string][]string // <link> hrefs by lowercased rel, in page order
+	JSONLD []string            // Contents of <script type="application/ld+json"> blocks
+
+	// Read from the body only when the head declares no title, description or image
+	Heading   string      // Text of the first <h1>
+	Paragraph string      // Text of the first substantive paragraph outside navigation, headers and footers
+	Images    []BodyImage // The first <img> elements outside navigation, headers and footers
+
+	// Where the page sends browsers instead of answering with an HTTP redirect,
+	// as written in the page, so possibly relative
+	Refresh        string // URL of the first <meta http-equiv="refresh"> naming one
+	ScriptRedirect string // URL the first inline script assigning location leads to
+
+	complete bool // The end of the head was reached
+}
+
+// MetaValue returns the first content of the <meta> tags named key, trimmed
+func (d *Document) MetaValue(key string) string {
+	if values := d.Meta[key]; len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// Parse reads the preview metadata of an HTML page from r with the default
+// parsers: the title, description, image and site name. Reading stops at the
+// end of the head unless it lacks a title, description or image, and then at
+// the first <h1>, paragraph and images the heuristics need, so most of the
+// page is never read. Callers bound how much of r may be read. On error, Parse returns
+// what it found before the error along with it
+func Parse(r io.Reader) (*Preview, error) {
+	doc, err := ReadDocument(r)
+	return DefaultParsers().Apply(doc), err
+}
+
+// ParseLimited is Parse reading at most limit bytes of r. It returns an error
+// with ErrCodeTooLarge, along with what it found, when the limit is reached
+// before the end of the head
+func ParseLimited(r io.Reader, limit int64) (*Preview, error) {
+	doc, err := ReadDocumentLimited(r, limit)
+	return DefaultParsers().Apply(doc), err
+}
+
+// ReadDocumentLimited is ReadDocument reading at most limit bytes of r. Like
+// ParseLimited, it returns an error with ErrCodeTooLarge when the limit is
+// reached before the end of the head
+func ReadDocumentLimited(r io.Reader, limit int64) (*Document, error) {
+	lr := &io.LimitedReader{R: r, N: limit}
+	doc, err := ReadDocument(lr)
+	if err == nil && !doc.complete && lr.N <= 0 {
+		err = NewError(ErrCodeTooLarge, fmt.Errorf("page head exceeds %d bytes", limit))
+	}
+	return doc, err
+}
+
+// ReadDocument tokenizes the head of an HTML page from r. On error, it returns
+// what it read before the error along with it
+func ReadDocument(r io.Reader) (*Document, error) {
+	br := readerPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	defer func() {
+		br.Reset(nil)
+		readerPool.Put(br)
+	}()
+
+	doc := &Document{Meta: make(map[string][]string), Links: make(map[string][]string)}
+	err := readHead(br, doc)
+	return doc, err
+}
+
+// readHead tokenizes HTML from r and collects the title, meta tags and JSON-LD blocks of its head
+func readHead(r io.Reader, doc *Document) error {
+	z := html.NewTokenizer(r)
+	z.SetMaxBuf(maxTokenBytes)
+
+	var (
+		title     strings.Builder
+		inTitle   bool
+		seenTitle bool
+		jsonLD    strings.Builder
+		inJSONLD  bool
+		inScript  bool // In an inline script other than JSON-LD
+		readErr   error
+	)
+
+scan:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			switch err := z.Err(); {
+			case errors.Is(err, html.ErrBufferExceeded):
+				readErr = NewError(ErrCodeTooLarge, fmt.Errorf("a tag or text run in the page head exceeds %d bytes", maxTokenBytes))
+			case err != io.EOF:
+				readErr = err
+			}
+			break scan
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "html":
+				if hasAttr {
+					doc.Lang = langAttribute(z)
+				}
+			case "title":
+				inTitle = tt == html.StartTagToken && !seenTitle
+			case "meta":
+				if hasAttr {
+					key, content, equiv := metaAttributes(z)
+					if key != "" && strings.TrimSpace(content) != "" {
+						doc.Meta[key] = append(doc.Meta[key], content)
+					}
+					switch {
+					case equiv == "refresh" && doc.Refresh == "":
+						doc.Refresh = refreshURL(content)
+					case equiv == "content-language" && doc.Lang == "":
+						doc.Lang, _, _ = strings.Cut(strings.TrimSpace(content), ",")
+					}
+				}
+			case "link":
+				if hasAttr {
+					rels, href := linkAttributes(z)
+					for _, rel := range rels {
+						doc.Links[rel] = append(doc.Links[rel], href)
+					}
+				}
+			case "script":
+				inJSONLD = tt == html.StartTagToken && hasAttr && isJSONLDScript(z)
+				inScript = tt == html.StartTagToken && !inJSONLD
+				jsonLD.Reset()
+			case "body":
+				doc.complete = true
+				break scan
+			}
+
+		case html.TextToken:
+			switch {
+			case inTitle:
+				title.Write(z.Text())
+			case inJSONLD:
+				jsonLD.Write(z.Text())
+			case inScript && doc.ScriptRedirect == "":
+				doc.ScriptRedirect = scriptRedirect(string(z.Text()))
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				if inTitle {
+					inTitle = false
+					seenTitle = true
+				}
+			case "script":
+				inScript = false
+				if inJSONLD {
+					inJSONLD = false
+					doc.JSONLD = append(doc.JSONLD, jsonLD.String())
+				}
+			case "head":
+				doc.complete = true
+				break scan
+			}
+		}
+	}
+
+	doc.Title = strings.TrimSpace(title.String())
+	if readErr == nil && doc.complete && (doc.needsTitle() || doc.needsDescription() || doc.needsImage()) {
+		readErr = readBody(z, doc)
+	}
+	return readErr
+}
+
+// needsTitle reports whether the head declares no title, other than that of a consent wall
+func (d *Document) needsTitle() bool {
+	return d.pageText(d.Title) == "" && d.pageText(d.MetaValue("og:title")) == "" && d.pageText(d.MetaValue("twitter:title")) == ""
+}
+
+// needsDescription reports whether the head declares no description, other than that of a consent wall
+func (d *Document) needsDescription() bool {
+	return d.pageText(d.MetaValue("description")) == "" && d.pageText(d.MetaValue("og:description")) == "" && d.pageText(d.MetaValue("twitter:description")) == ""
+}
+
+// pageText returns s, or "" when the page is a consent wall and s its text
+func (d *Document) pageText(s string) string {
+	if d.ConsentWall() && ConsentText(s) {
+		return ""
+	}
+	return s
+}
+
+// needsImage reports whether the head declares no image
+func (d *Document) needsImage() bool {
+	if d.MetaValue("og:image") != "" || d.MetaValue("twitter:image") != "" || d.MetaValue("twitter:image:src") != "" {
+		return false
+	}
+	for _, block := range d.JSONLD {
+		if strings.Contains(block, `"image"`) {
+			return false
+		}
+	}
+	return true
+}
+
+// minParagraphWords is how many words a paragraph needs to make a description,
+// which skips bylines, captions and cookie notices
+const minParagraphWords = 12
+
+// boilerplateTags hold navigation and page chrome rather than content
+var boilerplateTags = map[string]bool{
+	"nav": true, "header": true, "footer": true, "aside": true, "form": true,
+	"script": true, "style": true, "noscript": true, "template": true, "figcaption": true,
+}
+
+// readBody continues tokenizing into the body for the first <h1>, the first
+// substantive paragraph and the first images, stopping once it has what the
+// head lacked
+func readBody(z *html.Tokenizer, doc *Document) error {
+	wantHeading, wantParagraph, wantImages := doc.needsTitle(), doc.needsDescription(), doc.needsImage()
+	var (
+		text        strings.Builder
+		inHeading   bool
+		inParagraph bool
+		inScript    bool
+		boilerplate int // Depth of open boilerplate elements
+	)
+	for wantHeading || wantParagraph || wantImages {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF && !errors.Is(err, html.ErrBufferExceeded) {
+				return err
+			}
+			return nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			switch {
+			case tag == "img":
+				if wantImages && hasAttr && boilerplate == 0 {
+					doc.Images = append(doc.Images, imgAttributes(z))
+					wantImages = len(doc.Images) < maxBodyImages
+				}
+			case tt == html.SelfClosingTagToken:
+			case boilerplateTags[tag]:
+				boilerplate++
+				inScript = tag == "script"
+			case boilerplate > 0:
+			case tag == "h1" && wantHeading:
+				inHeading = true
+				text.Reset()
+			case tag == "p" && wantParagraph && !inHeading:
+				inParagraph = true
+				text.Reset()
+			}
+
+		case html.TextToken:
+			switch {
+			case inScript && doc.ScriptRedirect == "":
+				doc.ScriptRedirect = scriptRedirect(string(z.Text()))
+			case (inHeading || inParagraph) && boilerplate == 0:
+				text.Write(z.Text())
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			switch {
+			case boilerplateTags[tag]:
+				inScript = false
+				if boilerplate > 0 {
+					boilerplate--
+				}
+			case tag == "h1" && inHeading:
+				inHeading = false
+				if heading := collapseSpace(text.String()); heading != "" && doc.pageText(heading) != "" {
+					doc.Heading = heading
+					wantHeading = false
+				}
+			case tag == "p" && inParagraph:
+				inParagraph = false
+				if paragraph := collapseSpace(text.String()); len(strings.Fields(paragraph)) >= minParagraphWords && doc.pageText(paragraph) != "" {
+					doc.Paragraph = paragraph
+					wantParagraph = false
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// collapseSpace trims s and collapses its runs of whitespace into single spaces
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// isJSONLDScript reports whether the current <script> tag holds JSON-LD
+func isJSONLDScript(z *html.Tokenizer) bool {
+	for {
+		attr, val, more := z.TagAttr()
+		if string(attr) == "type" {
+			return strings.EqualFold(strings.TrimSpace(string(val)), "application/ld+json")
+		}
+		if !more {
+			return false
+		}
+	}
+}
+
+// langAttribute returns the lang of the current tag
+func langAttribute(z *html.Tokenizer) string {
+	for {
+		attr, val, more := z.TagAttr()
+		if string(attr) == "lang" {
+			return strings.TrimSpace(string(val))
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// Language returns the language the page declares its content is in, e.g.
+// "en-US": the lang of <html>, else its content-language or og:locale
+func (d *Document) Language() string {
+	lang := d.Lang
+	if lang == "" {
+		lang = strings.ReplaceAll(d.MetaValue("og:locale"), "_", "-")
+	}
+	return strings.TrimSpace(lang)
+}
+
+// linkAttributes returns the lowercased rel tokens and the href of the current
+// <link> tag, or no rels when either is missing
+func linkAttributes(z *html.Tokenizer) (rels []string, href string) {
+	var rel string
+	for {
+		attr, val, more := z.TagAttr()
+		switch string(attr) {
+		case "rel":
+			rel = strings.ToLower(string(val))
+		case "href":
+			href = strings.TrimSpace(string(val))
+		}
+		if !more {
+			break
+		}
+	}
+	if href == "" {
+		return nil, ""
+	}
+	return strings.Fields(rel), href
+}
+
+// metaAttributes returns the lowercased name (or property), the content as
+// written and the lowercased http-equiv of the current <meta> tag
+func metaAttributes(z *html.Tokenizer) (key, content, equiv string) {
+	for {
+		attr, val, more := z.TagAttr()
+		switch string(attr) {
+		case "name", "property":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(string(val)))
+			}
+		case "content":
+			content = string(val)
+		case "http-equiv":
+			equiv = strings.ToLower(strings.TrimSpace(string(val)))
+		}
+		if !more {
+			return key, content, equiv
+		}
+	}
+}
+
+// rawMeta returns the document's meta tags and links as Preview.RawMeta
+func (d *Document) rawMeta() map[string][]string {
+	raw := make(map[string][]string, len(d.Meta)+len(d.Links))
+	for key, values := range d.Meta {
+		raw[key] = append([]string(nil), values...)
+	}
+	for rel, hrefs := range d.Links {
+		raw["link:"+rel] = append([]string(nil), hrefs...)
+	}
+	return raw
+}
@@ -0,0 +1,196 @@
+package linkpreview
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// Extraction runs as a pipeline of Parser stages over a Document. Each stage
+// fills in what it can with Preview.Set, which by default keeps the first
+// value found, so the order of the stages sets the precedence of the sources.
+// Callers reorder, drop or insert stages with WithParsers, e.g. to read a
+// site-specific tag, or rank the sources of each field with WithFieldOrder
+
+// The fields of a Preview filled by the pipeline
+const (
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldImage       = "image"
+	FieldSiteName    = "site_name"
+)
+
+// The sources of the built-in stages, as reported in Preview.Sources
+const (
+	SourceOpenGraph = "og"
+	SourceTwitter   = "twitter"
+	SourceJSONLD    = "json-ld"
+	SourceHTML      = "html"
+
+	// SourceHeuristic marks values inferred from the page content, e.g. a
+	// description taken from the first paragraph, rather than declared by the
+	// page. They count for less in the quality score
+	SourceHeuristic = "heuristic"
+)
+
+// FieldOrder lists, by field, the sources allowed to fill it, highest priority
+// first, e.g. FieldOrder{FieldTitle: {SourceJSONLD, SourceOpenGraph, SourceHTML}}.
+// Sources missing from a field's list never fill it; fields without a list
+// keep the first value found
+type FieldOrder map[string][]string
+
+// Parser is a stage of the extraction pipeline: it enriches preview from doc
+type Parser interface {
+	Parse(doc *Document, preview *Preview)
+}
+
+// ParserFunc adapts a function to the Parser interface
+type ParserFunc func(doc *Document, preview *Preview)
+
+// Parse calls f(doc, preview)
+func (f ParserFunc) Parse(doc *Document, preview *Preview) {
+	f(doc, preview)
+}
+
+// Pipeline is an ordered list of Parser stages
+type Pipeline []Parser
+
+// Apply runs every stage in order over doc and returns the preview they built
+func (p Pipeline) Apply(doc *Document) *Preview {
+	return p.ApplyOrder(doc, nil)
+}
+
+// ApplyOrder is Apply with the sources of each field ranked by order
+func (p Pipeline) ApplyOrder(doc *Document, order FieldOrder) *Preview {
+	preview := &Preview{URL: doc.URL, Language: doc.Language(), ConsentWall: doc.ConsentWall(), RawMeta: doc.rawMeta(), order: order}
+	for _, parser := range p {
+		parser.Parse(doc, preview)
+	}
+	preview.order = nil
+	preview.QualityScore = preview.Score()
+	return preview
+}
+
+// The built-in stages
+var (
+	// OpenGraph reads og:title, og:description, og:image and og:site_name
+	OpenGraph Parser = ParserFunc(parseOpenGraph)
+	// TwitterCard reads twitter:title, twitter:description and twitter:image
+	TwitterCard Parser = ParserFunc(parseTwitterCard)
+	// JSONLD reads schema.org JSON-LD: headline or name, description, image and publisher name
+	JSONLD Parser = ParserFunc(parseJSONLD)
+	// HTMLMeta reads the <title> and the description meta tag
+	HTMLMeta Parser = ParserFunc(parseHTMLMeta)
+	// Heuristics falls back to the first <h1> for the title, the first
+	// substantive paragraph of the body for the description and the most
+	// prominent <img> near the top of the body for the image
+	Heuristics Parser = ParserFunc(parseHeuristics)
+)
+
+// DefaultParsers returns the default pipeline: Open Graph, Twitter cards,
+// JSON-LD, plain HTML, then heuristics. The slice is new on every call, so
+// callers may modify it
+func DefaultParsers() Pipeline {
+	return Pipeline{OpenGraph, TwitterCard, JSONLD, HTMLMeta, Heuristics}
+}
+
+func parseOpenGraph(doc *Document, preview *Preview) {
+	preview.Set(FieldTitle, SourceOpenGraph, doc.MetaValue("og:title"))
+	preview.Set(FieldDescription, SourceOpenGraph, doc.MetaValue("og:description"))
+	preview.Set(FieldImage, SourceOpenGraph, doc.MetaValue("og:image"))
+	preview.Set(FieldSiteName, SourceOpenGraph, doc.MetaValue("og:site_name"))
+}
+
+func parseTwitterCard(doc *Document, preview *Preview) {
+	preview.Set(FieldTitle, SourceTwitter, doc.MetaValue("twitter:title"))
+	preview.Set(FieldDescription, SourceTwitter, doc.MetaValue("twitter:description"))
+	preview.Set(FieldImage, SourceTwitter, doc.MetaValue("twitter:image"))
+	preview.Set(FieldImage, SourceTwitter, doc.MetaValue("twitter:image:src"))
+}
+
+func parseHTMLMeta(doc *Document, preview *Preview) {
+	preview.Set(FieldTitle, SourceHTML, doc.Title)
+	preview.Set(FieldDescription, SourceHTML, doc.MetaValue("description"))
+}
+
+// maxHeuristicDescription is the length at which paragraphs used as descriptions are cut
+const maxHeuristicDescription = 300
+
+func parseHeuristics(doc *Document, preview *Preview) {
+	preview.Set(FieldTitle, SourceHeuristic, doc.Heading)
+	preview.Set(FieldDescription, SourceHeuristic, truncateWords(doc.Paragraph, maxHeuristicDescription))
+	preview.Set(FieldImage, SourceHeuristic, heroImage(doc.Images))
+}
+
+// truncateWords cuts s to at most max bytes at a word boundary, marking the cut with an ellipsis
+func truncateWords(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := strings.LastIndex(s[:max], " ")
+	if cut <= 0 {
+		for cut = max; cut > 0 && !utf8.RuneStart(s[cut]); cut-- {
+		}
+	}
+	return strings.TrimRight(s[:cut], " ,;:-") + "…"
+}
+
+func parseJSONLD(doc *Document, preview *Preview) {
+	for _, block := range doc.JSONLD {
+		var data any
+		if err := json.Unmarshal([]byte(block), &data); err != nil {
+			// Malformed blocks are common; the other sources still apply
+			continue
+		}
+		for _, node := range jsonLDNodes(data) {
+			title, _ := node["headline"].(string)
+			if title == "" {
+				title, _ = node["name"].(string)
+			}
+			preview.Set(FieldTitle, SourceJSONLD, title)
+			description, _ := node["description"].(string)
+			preview.Set(FieldDescription, SourceJSONLD, description)
+			preview.Set(FieldImage, SourceJSONLD, jsonLDURL(node["image"]))
+			if publisher, ok := node["publisher"].(map[string]any); ok {
+				name, _ := publisher["name"].(string)
+				preview.Set(FieldSiteName, SourceJSONLD, name)
+			}
+		}
+	}
+}
+
+// jsonLDNodes flattens a JSON-LD value, including arrays and @graph lists, into its objects
+func jsonLDNodes(data any) []map[string]any {
+	switch v := data.(type) {
+	case []any:
+		var nodes []map[string]any
+		for _, item := range v {
+			nodes = append(nodes, jsonLDNodes(item)...)
+		}
+		return nodes
+	case map[string]any:
+		if graph, ok := v["@graph"]; ok {
+			return append([]map[string]any{v}, jsonLDNodes(graph)...)
+		}
+		return []map[string]any{v}
+	}
+	return nil
+}
+
+// jsonLDURL returns the URL of a JSON-LD image: a string, an ImageObject or the first of a list
+func jsonLDURL(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]any:
+		url, _ := v["url"].(string)
+		return url
+	case []any:
+		for _, item := range v {
+			if url := jsonLDURL(item); url != "" {
+				return url
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package linkpreview
+
+import (
+	"math"
+	"net/url"
+)
+
+// How much each field contributes to the quality score
+var qualityWeights = map[string]float64{
+	FieldTitle:       0.35,
+	FieldDescription: 0.25,
+	FieldImage:       0.3,
+	FieldSiteName:    0.1,
+}
+
+// Score rates how complete and trustworthy p is, from 0 (nothing found) to 1
+// (every field declared by the page, with a usable image URL), so clients can
+// choose between a rich card and a minimal one. Heuristic values count half
+func (p *Preview) Score() float64 {
+	var score float64
+	for field, weight := range qualityWeights {
+		value := *p.field(field)
+		if value == "" || (field == FieldImage && !p.validImage()) {
+			continue
+		}
+		if p.Sources[field] == SourceHeuristic {
+			weight /= 2
+		}
+		score += weight
+	}
+	return math.Round(score*100) / 100
+}
+
+// validImage reports whether Image is an http(s) URL, or a path that resolves
+// to one against URL
+func (p *Preview) validImage() bool {
+	image, err := url.Parse(p.Image)
+	if err != nil {
+		return false
+	}
+	if !image.IsAbs() {
+		base, err := url.Parse(p.URL)
+		if err != nil || !base.IsAbs() {
+			return false
+		}
+		image = base.ResolveReference(image)
+	}
+	return (image.Scheme == "http" || image.Scheme == "https") && image.Host != ""
+}
@@ -0,0 +1,96 @@
+package linkpreview
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// scriptRedirects match the simple ways inline scripts send browsers on:
+// assigning location or location.href, and location.replace or assign
+var scriptRedirects = []*regexp.Regexp{
+	regexp.MustCompile(`\b(?:(?:window|document|top|self)\.)?location(?:\.href)?\s*=\s*(["'])([^"'\s]+)["']`),
+	regexp.MustCompile(`\b(?:(?:window|document|top|self)\.)?location\.(?:replace|assign)\(\s*(["'])([^"'\s]+)["']\s*\)`),
+}
+
+// maxRefreshDelay is the longest delay, in seconds, of a meta refresh taken
+// for a redirect; pages refreshing later are shown to the reader first
+const maxRefreshDelay = 5
+
+// refreshURL returns the URL of the content of a <meta http-equiv="refresh">
+// tag, such as "0; url=https://example.com/", or "" when it only reloads the
+// page or waits longer than maxRefreshDelay
+func refreshURL(content string) string {
+	delay, target, ok := strings.Cut(content, ";")
+	if !ok {
+		if delay, target, ok = strings.Cut(content, ","); !ok {
+			return ""
+		}
+	}
+	if seconds, err := strconv.ParseFloat(strings.TrimSpace(delay), 64); err != nil || seconds < 0 || seconds > maxRefreshDelay {
+		return ""
+	}
+	target = strings.TrimSpace(target)
+	if len(target) >= 3 && strings.EqualFold(target[:3], "url") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(target[3:]), "="); ok {
+			target = strings.TrimSpace(rest)
+		}
+	}
+	return strings.TrimSpace(strings.Trim(target, `"'`))
+}
+
+// scriptRedirect returns the URL an inline script sends browsers to as soon
+// as it runs, or "". Only top-level statements count: assignments inside
+// functions, handlers or conditions, and variables named location, don't
+func scriptRedirect(script string) string {
+	top := topLevel(script)
+	for _, pattern := range scriptRedirects {
+		for _, match := range pattern.FindAllStringSubmatchIndex(script, -1) {
+			if top[match[0]] && statementStart(script, match[0]) {
+				return script[match[4]:match[5]]
+			}
+		}
+	}
+	return ""
+}
+
+// topLevel reports, for each byte of script, whether it is code outside any
+// block, string or comment
+func topLevel(script string) []bool {
+	top := make([]bool, len(script))
+	depth := 0
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '"' || c == '\'' || c == '`':
+			for i++; i < len(script) && script[i] != c; i++ {
+				if script[i] == '\\' {
+					i++
+				}
+			}
+		case c == '/' && i+1 < len(script) && script[i+1] == '/':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				return top
+			}
+			i += end + 3
+		case c == '{' || c == '(':
+			depth++
+		case c == '}' || c == ')':
+			depth = max(depth-1, 0)
+		default:
+			top[i] = depth == 0
+		}
+	}
+	return top
+}
+
+// statementStart reports whether the statement of script starting at i
+// starts there: after the start of the script, a newline, ";" or "}"
+func statementStart(script string, i int) bool {
+	before := strings.TrimRight(script[:i], " \t\r")
+	return before == "" || strings.HasSuffix(before, "\n") || strings.HasSuffix(before, ";") || strings.HasSuffix(before, "}")
+}
@@ -0,0 +1,57 @@
+package linkpreview
+
+import "testing"
+
+func TestRefreshURL(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"0; url=https://example.com/", "https://example.com/"},
+		{"0;URL='/next'", "/next"},
+		{`3, url="https://example.com/a"`, "https://example.com/a"},
+		{"5; https://example.com/", "https://example.com/"},
+		{"0.5; url=/soon", "/soon"},
+		{"300; url=/", ""},
+		{"6; url=/late", ""},
+		{"-1; url=/", ""},
+		{"soon; url=/", ""},
+		{"0", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := refreshURL(tt.content); got != tt.want {
+			t.Errorf("refreshURL(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestScriptRedirect(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"assignment", `location = "https://example.com/"`, "https://example.com/"},
+		{"href", `window.location.href = '/next';`, "/next"},
+		{"replace", `document.location.replace("/next")`, "/next"},
+		{"assign", `top.location.assign('/next');`, "/next"},
+		{"after statements", "var a = 1;\nlocation.href = '/next'", "/next"},
+		{"after function", "function f() { return 1 }\nlocation.href = '/next'", "/next"},
+		{"inside function", `function go() { location.href = "/next" }`, ""},
+		{"click handler", `button.onclick = function () { location.href = "/next" };`, ""},
+		{"arrow handler", `el.addEventListener("click", () => location.assign("/next"))`, ""},
+		{"condition", `if (old) location.href = "/next";`, ""},
+		{"variable", `var location = "/next";`, ""},
+		{"property", `config.location = "/next";`, ""},
+		{"string", `console.log("location.href = '/next'")`, ""},
+		{"comment", "// location.href = '/next'\nrun()", ""},
+		{"block comment", "/* location.href = '/next' */", ""},
+		{"none", `console.log("hi")`, ""},
+	}
+	for _, tt := range tests {
+		if got := scriptRedirect(tt.script); got != tt.want {
+			t.Errorf("%s: scriptRedirect(%q) = %q, want %q", tt.name, tt.script, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Access log formats
+const (
+	AccessLogCommon   = "common"   // NCSA Common Log Format
+	AccessLogCombined = "combined" // Common Log Format plus referer and user agent
+	AccessLogJSON     = "json"     // One JSON object per request
+)
+
+// AccessLogRotation controls when a file access log is rotated and how many old files are kept
+type AccessLogRotation struct {
+	MaxSizeMB  int  // Rotate once the file reaches this size
+	MaxBackups int  // Rotated files to keep, 0 for all
+	MaxAgeDays int  // Delete rotated files older than this, 0 to keep them regardless of age
+	Compress   bool // Gzip rotated files
+}
+
+// AccessLogger writes one line per request in a web-server style format, for
+// deployments without a reverse proxy producing access logs
+type AccessLogger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format string
+}
+
+// accessLogEntry is the JSON access log record
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	ClientIP   string    `json:"client_ip"`
+	User       string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Protocol   string    `json:"protocol"`
+	Status     int       `json:"status"`
+	Bytes      int       `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Domain     string    `json:"domain,omitempty"`
+	Outcome    string    `json:"outcome,omitempty"`
+}
+
+// NewAccessLogger creates an access logger writing format lines to destination,
+// which is "stdout" or a file path rotated according to rotation. Returns nil
+// when destination is empty, meaning requests are logged through slog instead
+func NewAccessLogger(destination, format string, rotation AccessLogRotation) (*AccessLogger, error) {
+	switch format {
+	case AccessLogCommon, AccessLogCombined, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q (want common, combined or json)", format)
+	}
+
+	switch destination {
+	case "":
+		return nil, nil
+	case "stdout":
+		return &AccessLogger{out: os.Stdout, format: format}, nil
+	default:
+		// Fail early on an unwritable path rather than on the first request
+		f, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open access log: %v", err)
+		}
+		f.Close()
+		return &AccessLogger{
+			out: &lumberjack.Logger{
+				Filename:   destination,
+				MaxSize:    rotation.MaxSizeMB,
+				MaxBackups: rotation.MaxBackups,
+				MaxAge:     rotation.MaxAgeDays,
+				Compress:   rotation.Compress,
+			},
+			format: format,
+		}, nil
+	}
+}
+
+// Middleware writes an access log line after each request
+func (al *AccessLogger) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		al.write(c, start)
+	}
+}
+
+func (al *AccessLogger) write(c *gin.Context, start time.Time) {
+	bytes := c.Writer.Size()
+	if bytes < 0 {
+		bytes = 0
+	}
+	user := c.GetString("jwt_subject")
+
+	var line []byte
+	if al.format == AccessLogJSON {
+		entry := accessLogEntry{
+			Time:       start.UTC(),
+			RequestID:  c.GetString("request_id"),
+			ClientIP:   c.ClientIP(),
+			User:       user,
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.RequestURI(),
+			Protocol:   c.Request.Proto,
+			Status:     c.Writer.Status(),
+			Bytes:      bytes,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			Referer:    c.Request.Referer(),
+			UserAgent:  c.Request.UserAgent(),
+			Domain:     c.GetString("preview_domain"),
+			Outcome:    c.GetString("preview_outcome"),
+		}
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			return
+		}
+	} else {
+		// %h %l %u %t "%r" %>s %b, with "-" for unknown fields and empty bodies
+		size := "-"
+		if bytes > 0 {
+			size = strconv.Itoa(bytes)
+		}
+		if user == "" {
+			user = "-"
+		}
+		line = fmt.Appendf(nil, "%s - %s [%s] \"%s %s %s\" %d %s",
+			c.ClientIP(), user, start.Format("02/Jan/2006:15:04:05 -0700"),
+			c.Request.Method, c.Request.URL.RequestURI(), c.Request.Proto, c.Writer.Status(), size)
+		if al.format == AccessLogCombined {
+			line = fmt.Appendf(line, " %s %s", quoteOrDash(c.Request.Referer()), quoteOrDash(c.Request.UserAgent()))
+		}
+	}
+	line = append(line, '\n')
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if _, err := al.out.Write(line); err != nil {
+		slog.Error("Failed to write access log", "error", err)
+	}
+}
+
+// quoteOrDash quotes a header value for the combined format, or returns "-" when it is empty
+func quoteOrDash(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerAdminRoutes mounts the operational endpoints and the admin UI under
+// /admin, and /export and /import. Every admin route requires the admin token
+// and a client IP from ADMIN_ALLOWED_IPS
+func registerAdminRoutes(router *gin.Engine, service *PreviewService, config *Config, keys *APIKeyStore, stats *ServiceStats, live *LiveConfig) {
+	admin := router.Group("/admin", requireAdminIP(config.AdminAllowedIPs), requireAdminToken(config))
+
+	admin.GET("/", handleAdminUI())
+	admin.GET("/errors", handleRecentErrors(stats))
+	admin.GET("/config", handleConfig(live))
+	admin.GET("/debugger", handleDebug(service))
+	admin.GET("/cache/stats", handleCacheStats(service.cache))
+	admin.GET("/cache/entries", handleCacheEntries(service.cache))
+	admin.POST("/cache/warm", handleCacheWarm(service))
+	admin.DELETE("/cache", handleCachePurge(service.cache))
+	admin.GET("/circuits", handleCircuitStats(service.extractor.breaker))
+	admin.GET("/cooldowns", handleCooldowns(service.extractor.cooldowns))
+	admin.GET("/domains", handleDomainReport(service.extractor.domains))
+	admin.GET("/usage", handleUsage(service.usage))
+	registerDebugRoutes(admin)
+
+	if service.store != nil {
+		// API keys and tenants managed at runtime, kept in the preview store
+		registerKeyRoutes(admin, keys, service.store)
+
+		// Bulk export and import of the preview store, for moving it between deployments
+		operator := router.Group("", requireAdminIP(config.AdminAllowedIPs), requireAdminToken(config))
+		operator.GET("/export", handleExport(service.store))
+		operator.POST("/import", handleImport(service.store))
+	}
+}
+
+// requireAdminIP rejects admin requests from client IPs outside the allowlist
+// An empty allowlist allows every IP (the admin token is still required)
+func requireAdminIP(allowed []string) gin.HandlerFunc {
+	var nets []*net.IPNet
+	for _, entry := range allowed {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			slog.Warn("Ignoring invalid ADMIN_ALLOWED_IPS entry", "entry", entry, "error", err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return func(c *gin.Context) {
+		if len(allowed) == 0 {
+			c.Next()
+			return
+		}
+
+		ip := net.ParseIP(c.ClientIP())
+		for _, ipNet := range nets {
+			if ip != nil && ipNet.Contains(ip) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Admin endpoints are not available from this address",
+		})
+	}
+}
+
+// handleCacheStats reports cache usage so operators can size the cache correctly
+func handleCacheStats(cache *PreviewCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, cache.Stats(10))
+	}
+}
+
+// CacheWarmRequest represents the body of a cache pre-warm request
+type CacheWarmRequest struct {
+	URLs []string `json:"urls" binding:"required"` // URLs to fetch and cache
+}
+
+// maxWarmURLs caps how many URLs a single pre-warm request may enqueue
+const maxWarmURLs = 100
+
+// handleCacheWarm accepts a list of URLs and caches their previews asynchronously
+func handleCacheWarm(service *PreviewService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CacheWarmRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request format. Expected JSON with 'urls' array.",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		// Drop blanks and duplicates, however spelled, so each URL is fetched once
+		seen := make(map[string]bool, len(req.URLs))
+		urls := make([]string, 0, len(req.URLs))
+		for _, u := range req.URLs {
+			u = strings.TrimSpace(u)
+			if u == "" || seen[normalizeURL(u)] {
+				continue
+			}
+			seen[normalizeURL(u)] = true
+			urls = append(urls, u)
+		}
+
+		if len(urls) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "At least one URL is required",
+			})
+			return
+		}
+		if len(urls) > maxWarmURLs {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Too many URLs: at most %d per request", maxWarmURLs),
+			})
+			return
+		}
+		for _, u := range urls {
+			if _, err := validateURL(u); err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error":      fmt.Sprintf("Invalid URL %s: %v", u, err),
+					"error_code": ErrCodeInvalidURL,
+				})
+				return
+			}
+		}
+
+		service.Warm(urls, 4, service.handlerTimeout)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":   "accepted",
+			"accepted": len(urls),
+		})
+	}
+}
+
+// handleCachePurge removes a single URL (?url=..., in the cache namespace
+// ?namespace=...), as fetched with any user agent profile or Accept-Language,
+// or every entry from the cache
+func handleCachePurge(cache *PreviewCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if target := strings.TrimSpace(c.Query("url")); target != "" {
+			removed := cache.DeleteVariants(namespacedKey(c.Query("namespace"), normalizeURL(target)))
+			c.JSON(http.StatusOK, gin.H{
+				"purged": removed,
+				"url":    target,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"purged": cache.Clear(),
+		})
+	}
+}
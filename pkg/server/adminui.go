@@ -0,0 +1,198 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCacheEntriesListed caps how many cache entries /admin/cache/entries returns
+const maxCacheEntriesListed = 1000
+
+// handleAdminUI serves the admin page: live stats, cache contents, recent
+// errors and a form running the debugger, all read from the admin API.
+// Browsers ask for the admin token as the password of the page
+func handleAdminUI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Security-Policy", "default-src 'self'; img-src * data:; style-src 'unsafe-inline'; script-src 'unsafe-inline'")
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(adminPage))
+	}
+}
+
+// handleRecentErrors lists the last failed preview requests, newest first
+func handleRecentErrors(stats *ServiceStats) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"errors": stats.RecentErrors()})
+	}
+}
+
+// handleCacheEntries lists cached previews, most recently used first, at
+// most ?limit= of them (100 by default)
+func handleCacheEntries(cache *PreviewCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > maxCacheEntriesListed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'limit' must be between 1 and " + strconv.Itoa(maxCacheEntriesListed)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"entries": cache.Entries(limit)})
+	}
+}
+
+const adminPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link Preview Admin</title>
+<style>
+body { font: 15px/1.5 system-ui, sans-serif; max-width: 1100px; margin: 2em auto; padding: 0 1em; color: #222; }
+input[type=url] { width: 70%; padding: .4em; } button { padding: .4em 1em; }
+table { border-collapse: collapse; width: 100%; margin: 1em 0; } td, th { border: 1px solid #ddd; padding: .3em .5em; text-align: left; vertical-align: top; word-break: break-all; }
+.tiles { display: flex; flex-wrap: wrap; gap: .8em; } .tile { border: 1px solid #ddd; border-radius: 8px; padding: .5em .9em; min-width: 9em; }
+.tile b { display: block; font-size: 1.4em; } .tile span { color: #666; font-size: 13px; }
+.won { font-weight: bold; } .warn { color: #8a5a00; } .error { color: #b00020; } .muted { color: #666; }
+.card { border: 1px solid #ddd; border-radius: 8px; overflow: hidden; max-width: 500px; } .card img { width: 100%; display: block; } .card div { padding: .6em .8em; }
+</style>
+</head>
+<body>
+<h1>Link Preview Admin</h1>
+<p class="muted">Refreshed every 5 seconds. <span id="updated"></span> <span id="failure" class="error"></span></p>
+
+<h2>Stats</h2>
+<div id="stats" class="tiles"></div>
+<h3>Top domains</h3>
+<table id="domains"></table>
+
+<h2>Test a URL</h2>
+<form id="test">
+<input type="url" name="url" placeholder="https://example.com/article" required>
+<button type="submit">Debug</button>
+</form>
+<div id="report"></div>
+
+<h2>Recent errors</h2>
+<table id="errors"></table>
+
+<h2>Cache</h2>
+<table id="cache"></table>
+
+<script>
+"use strict";
+
+function el(tag, text, cls) {
+  const e = document.createElement(tag);
+  if (text !== undefined && text !== null) e.textContent = String(text);
+  if (cls) e.className = cls;
+  return e;
+}
+
+function fill(table, headers, rows) {
+  table.replaceChildren();
+  const head = el("tr");
+  headers.forEach(h => head.append(el("th", h)));
+  table.append(head);
+  if (rows.length === 0) {
+    const tr = el("tr"), td = el("td", "None.", "muted");
+    td.colSpan = headers.length;
+    tr.append(td);
+    table.append(tr);
+  }
+  rows.forEach(row => {
+    const tr = el("tr");
+    row.forEach(cell => tr.append(cell instanceof Node ? cell : el("td", cell)));
+    table.append(tr);
+  });
+}
+
+function tile(label, value) {
+  const t = el("div", null, "tile");
+  t.append(el("b", value), el("span", label));
+  return t;
+}
+
+const percent = r => (100 * r).toFixed(1) + "%";
+const when = t => new Date(t).toLocaleString();
+
+async function get(path) {
+  const res = await fetch(path, {headers: {Accept: "application/json"}});
+  const body = await res.json();
+  if (!res.ok) throw new Error(body.error || res.statusText);
+  return body;
+}
+
+async function refresh() {
+  try {
+    const [stats, cache, errors, entries] = await Promise.all([
+      get("../stats"), get("cache/stats"), get("errors"), get("cache/entries?limit=100"),
+    ]);
+    document.getElementById("stats").replaceChildren(
+      tile("previews served", stats.previews_served),
+      tile("success", percent(stats.success_ratio)),
+      tile("cache hits", percent(stats.cache_hit_ratio)),
+      tile("average latency", stats.average_latency_ms.toFixed(0) + " ms"),
+      tile("cached previews", cache.entries + " / " + cache.max_entries),
+      tile("cache memory", (cache.memory_bytes / 1048576).toFixed(1) + " MB"),
+      tile("uptime", (stats.uptime_seconds / 3600).toFixed(1) + " h"),
+    );
+    fill(document.getElementById("domains"), ["Domain", "Requests"],
+      stats.top_domains.map(d => [d.domain, d.requests]));
+    fill(document.getElementById("errors"), ["Time", "URL", "Outcome", "Error"],
+      errors.errors.map(e => [when(e.time), e.url, e.outcome, [e.error_code, e.error].filter(Boolean).join(": ")]));
+    fill(document.getElementById("cache"), ["Key", "Title", "Hits", "Expires"],
+      entries.entries.map(e => [e.key, e.title, e.hits, when(e.expires_at)]));
+    document.getElementById("updated").textContent = "Last update " + new Date().toLocaleTimeString() + ".";
+    document.getElementById("failure").textContent = "";
+  } catch (err) {
+    document.getElementById("failure").textContent = "Update failed: " + err.message;
+  }
+}
+
+function showReport(report) {
+  const out = document.getElementById("report");
+  out.replaceChildren();
+  const p = report.preview, card = el("div", null, "card"), text = el("div");
+  if (p.image) {
+    const img = el("img");
+    img.src = new URL(p.image, p.final_url || p.url).href;
+    img.alt = "";
+    card.append(img);
+  }
+  text.append(el("strong", p.title), el("br"), p.description || "", el("br"),
+    el("small", [p.site_name, "quality " + p.quality_score, p.error].filter(Boolean).join(" · "), p.error ? "error" : ""));
+  card.append(text);
+  out.append(el("h3", "Preview"), card, el("h3", "Warnings"));
+  if (report.warnings.length === 0) out.append(el("p", "None."));
+  const warnings = el("ul");
+  report.warnings.forEach(w => warnings.append(el("li", w, "warn")));
+  out.append(warnings, el("h3", "Fields"));
+  const fields = el("table");
+  fill(fields, ["Field", "Source", "Candidates"], report.fields.map(f => {
+    const td = el("td");
+    f.candidates.forEach(c => td.append(el("div", c.source + ": " + c.value, c.won ? "won" : "")));
+    return [f.field, f.source, td];
+  }));
+  out.append(fields);
+}
+
+document.getElementById("test").addEventListener("submit", async event => {
+  event.preventDefault();
+  const out = document.getElementById("report");
+  const target = new FormData(event.target).get("url");
+  out.replaceChildren(el("p", "Fetching " + target + "…", "muted"));
+  try {
+    showReport(await get("debugger?format=json&url=" + encodeURIComponent(target)));
+  } catch (err) {
+    out.replaceChildren(el("p", err.message, "error"));
+  }
+});
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdmissionController bounds how many requests are processed at once and how
+// many may wait for a slot, so overload turns into queueing delay and then fast
+// 503s rather than unbounded goroutines and memory
+type AdmissionController struct {
+	slots   chan struct{} // One token per request being processed
+	depth   int64         // Maximum requests waiting for a slot
+	timeout time.Duration // Maximum time a request waits for a slot
+	waiting atomic.Int64
+}
+
+// NewAdmissionController admits maxInFlight concurrent requests with up to depth waiting
+// for at most timeout each. Returns nil when maxInFlight <= 0, meaning admission is unlimited
+func NewAdmissionController(maxInFlight, depth int, timeout time.Duration) *AdmissionController {
+	if maxInFlight <= 0 {
+		return nil
+	}
+	return &AdmissionController{
+		slots:   make(chan struct{}, maxInFlight),
+		depth:   int64(depth),
+		timeout: timeout,
+	}
+}
+
+// Middleware admits requests to the handlers that follow, answering 503 with
+// Retry-After when the queue is full or the wait exceeds the queue timeout
+func (ac *AdmissionController) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ac == nil {
+			c.Next()
+			return
+		}
+
+		// Fast path: a slot is free
+		select {
+		case ac.slots <- struct{}{}:
+			defer func() { <-ac.slots }()
+			c.Next()
+			return
+		default:
+		}
+
+		if ac.waiting.Add(1) > ac.depth {
+			ac.waiting.Add(-1)
+			abortOverloaded(c, "Server is at capacity and the request queue is full", time.Second)
+			return
+		}
+
+		timer := time.NewTimer(ac.timeout)
+		defer timer.Stop()
+		select {
+		case ac.slots <- struct{}{}:
+			ac.waiting.Add(-1)
+			defer func() { <-ac.slots }()
+			c.Next()
+		case <-timer.C:
+			ac.waiting.Add(-1)
+			abortOverloaded(c, "Timed out waiting in the request queue", ac.timeout)
+		case <-c.Request.Context().Done():
+			// Client went away while queued
+			ac.waiting.Add(-1)
+			c.Abort()
+		}
+	}
+}
+
+// Stats returns the number of requests in flight and waiting
+func (ac *AdmissionController) Stats() (inFlight, waiting int) {
+	if ac == nil {
+		return 0, 0
+	}
+	return len(ac.slots), int(ac.waiting.Load())
+}
+
+// abortOverloaded responds with 503 and a Retry-After header
+func abortOverloaded(c *gin.Context, message string, retryAfter time.Duration) {
+	seconds := int(math.Max(1, math.Ceil(retryAfter.Seconds())))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+		"error":       message,
+		"retry_after": seconds,
+		"request_id":  c.GetString("request_id"),
+	})
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Bounds on Wayback Machine lookups
+const (
+	archiveLookupTimeout = 5 * time.Second
+	maxArchiveResponse   = 64 << 10
+)
+
+// ArchiveFallback builds previews of dead links from their latest Wayback
+// Machine snapshot
+type ArchiveFallback struct {
+	client *http.Client
+	apiURL string // Wayback Machine availability API
+}
+
+// ArchiveSnapshot is a page as captured by the Wayback Machine
+type ArchiveSnapshot struct {
+	URL        string    // Snapshot page, e.g. https://web.archive.org/web/20240102030405/https://example.com/
+	CapturedAt time.Time // When the page was captured
+	prefix     string    // Snapshot URL up to and including the timestamp
+}
+
+// NewArchiveFallback creates a fallback querying the availability API at
+// ARCHIVE_API_URL, or returns nil unless ARCHIVE_FALLBACK is set. Lookups go
+// through the SSRF guard of extractor
+func NewArchiveFallback(extractor *MetaExtractor, config *Config) *ArchiveFallback {
+	if !config.ArchiveFallback {
+		return nil
+	}
+	return &ArchiveFallback{
+		client: &http.Client{
+			Timeout:   archiveLookupTimeout,
+			Transport: newTransport(config.Transport, extractor.guard.DialContext, nil),
+		},
+		apiURL: config.ArchiveAPIURL,
+	}
+}
+
+// deadLink reports whether result is a page that no longer exists: it
+// answered 404 or 410, or its host doesn't resolve
+func deadLink(result *LinkPreviewResponse) bool {
+	return result.StatusCode == http.StatusNotFound || result.StatusCode == http.StatusGone || result.ErrorCode == ErrCodeDNS
+}
+
+// waybackSnapshot matches the timestamp of a snapshot URL
+var waybackSnapshot = regexp.MustCompile(`^(.*/web/)(\d{14})/`)
+
+// Snapshot returns the latest snapshot of targetURL, or nil when the Wayback
+// Machine has none
+func (af *ArchiveFallback) Snapshot(ctx context.Context, targetURL string) (*ArchiveSnapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, af.apiURL+"?url="+url.QueryEscape(targetURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "link-preview-api")
+	resp, err := af.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("availability API answered %d", resp.StatusCode)
+	}
+	var availability struct {
+		ArchivedSnapshots struct {
+			Closest *struct {
+				Available bool   `json:"available"`
+				URL       string `json:"url"`
+				Timestamp string `json:"timestamp"`
+				Status    string `json:"status"`
+			} `json:"closest"`
+		} `json:"archived_snapshots"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxArchiveResponse)).Decode(&availability); err != nil {
+		return nil, fmt.Errorf("decoding availability API response: %w", err)
+	}
+	closest := availability.ArchivedSnapshots.Closest
+	if closest == nil || !closest.Available || closest.Status != "200" {
+		return nil, nil
+	}
+	match := waybackSnapshot.FindStringSubmatch(closest.URL)
+	if match == nil {
+		return nil, fmt.Errorf("unexpected snapshot URL %q", closest.URL)
+	}
+	capturedAt, err := time.Parse("20060102150405", match[2])
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveSnapshot{URL: closest.URL, CapturedAt: capturedAt, prefix: match[1] + match[2]}, nil
+}
+
+// raw returns the URL of the snapshot's page as captured, without the
+// Wayback Machine's banner and rewritten links
+func (s *ArchiveSnapshot) raw(original string) string {
+	return s.prefix + "id_/" + original
+}
+
+// image returns the archived copy of an image of the snapshot's page
+func (s *ArchiveSnapshot) image(imageURL string) string {
+	return s.prefix + "im_/" + imageURL
+}
+
+// archivedPreview replaces result, a dead link to targetURL, with a preview
+// built from the page's latest snapshot. result is left as it is when there
+// is no usable snapshot
+func (ps *PreviewService) archivedPreview(ctx context.Context, targetURL string, result *LinkPreviewResponse) {
+	ctx, span := tracer.Start(ctx, "archive.fallback")
+	defer span.End()
+
+	snapshot, err := ps.archive.Snapshot(ctx, result.URL)
+	if err != nil {
+		slog.WarnContext(ctx, "Wayback Machine lookup failed", "url", targetURL, "error", err)
+		return
+	}
+	span.SetAttributes(attribute.Bool("archive.found", snapshot != nil))
+	if snapshot == nil {
+		return
+	}
+
+	archivedChan := make(chan LinkPreviewResponse, 1)
+	if err := ps.pool.Submit(func() {
+		ps.extractor.FetchLinkPreview(ctx, snapshot.raw(result.URL), archivedChan)
+	}); err != nil {
+		return
+	}
+	var archived LinkPreviewResponse
+	select {
+	case archived = <-archivedChan:
+	case <-ctx.Done():
+		return
+	}
+	if archived.Error != "" {
+		slog.WarnContext(ctx, "Wayback Machine snapshot could not be read", "url", targetURL, "snapshot", snapshot.URL, "error", archived.Error)
+		return
+	}
+
+	// The preview is of the original page; its images are served by the archive
+	archived.URL, archived.FinalURL = result.URL, result.FinalURL
+	archived.Redirects = result.Redirects
+	if archived.Image != "" {
+		archived.Image = snapshot.image(resolveURL(result.URL, archived.Image))
+	}
+	capturedAt := snapshot.CapturedAt
+	archived.Archived = true
+	archived.ArchivedAt = &capturedAt
+	archived.ArchiveURL = snapshot.URL
+	*result = archived
+}
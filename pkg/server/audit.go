@@ -0,0 +1,89 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord is one structured audit log entry for a preview request
+type AuditRecord struct {
+	Time         time.Time `json:"time"`
+	RequestID    string    `json:"request_id,omitempty"`
+	ClientIP     string    `json:"client_ip"`
+	APIKey       string    `json:"api_key,omitempty"` // Fingerprint, never the key itself
+	Subject      string    `json:"subject,omitempty"` // JWT subject
+	Tenant       string    `json:"tenant,omitempty"`
+	URL          string    `json:"url"`
+	Outcome      string    `json:"outcome"` // "success", "error" or "timeout"
+	Error        string    `json:"error,omitempty"`
+	ErrorCode    string    `json:"error_code,omitempty"`
+	CacheHit     bool      `json:"cache_hit"`
+	BytesFetched int64     `json:"bytes_fetched"`
+	DurationMS   int64     `json:"duration_ms"`
+}
+
+// AuditLogger writes audit records as JSON lines to a file, stdout or syslog
+type AuditLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewAuditLogger creates a logger for destination, which is a file path, "stdout"
+// or "syslog" (optionally "syslog://host:port" for a remote UDP syslog server)
+// Returns nil when destination is empty, meaning audit logging is disabled
+func NewAuditLogger(destination string) (*AuditLogger, error) {
+	switch {
+	case destination == "":
+		return nil, nil
+	case destination == "stdout":
+		return &AuditLogger{out: os.Stdout}, nil
+	case destination == "syslog" || strings.HasPrefix(destination, "syslog://"):
+		w, err := newSyslogWriter(strings.TrimPrefix(strings.TrimPrefix(destination, "syslog"), "://"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %v", err)
+		}
+		return &AuditLogger{out: w}, nil
+	default:
+		f, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %v", err)
+		}
+		return &AuditLogger{out: f}, nil
+	}
+}
+
+// Log writes a record; a nil logger discards it
+func (al *AuditLogger) Log(record AuditRecord) {
+	if al == nil {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if _, err := al.out.Write(line); err != nil {
+		slog.Error("Failed to write audit record", "error", err)
+	}
+}
+
+// keyFingerprint identifies an API key in logs without revealing it
+func keyFingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:12]
+}
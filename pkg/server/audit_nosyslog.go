@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package server
+
+import (
+	"errors"
+	"io"
+)
+
+// newSyslogWriter is unavailable on platforms without log/syslog
+func newSyslogWriter(addr string) (io.Writer, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,16 @@
+//go:build !windows && !plan9
+
+package server
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// newSyslogWriter connects to the local syslog daemon, or to addr over UDP when set
+func newSyslogWriter(addr string) (io.Writer, error) {
+	if addr == "" {
+		return syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, "link-preview-api")
+	}
+	return syslog.Dial("udp", addr, syslog.LOG_INFO|syslog.LOG_AUTH, "link-preview-api")
+}
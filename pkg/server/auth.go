@@ -0,0 +1,321 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeySyncInterval is how often keys and tenants managed through the admin
+// API are reloaded, picking up changes made on other instances
+const apiKeySyncInterval = 30 * time.Second
+
+// APIKeyStore holds the API keys accepted by the public endpoints and the
+// tenant each belongs to. Keys are stored as SHA-256 digests so lookups don't
+// leak timing information about the keys. Keys and tenants from the
+// environment and config file are fixed; those managed through the admin API
+// are kept in the preview store and reloaded when they change
+type APIKeyStore struct {
+	static        map[[sha256.Size]byte]apiKeyEntry // From the environment and config file
+	configTenants map[string]*Tenant
+	store         PreviewStore            // nil when keys can't be managed at runtime
+	onChange      func(tenants []*Tenant) // Called after keys and tenants are reloaded
+	stop          chan struct{}
+	stopOnce      sync.Once
+
+	mu      sync.RWMutex
+	keys    map[[sha256.Size]byte]apiKeyEntry
+	tenants map[string]*Tenant // By name
+	issued  bool               // Whether keys were ever issued through the admin API
+}
+
+// apiKeyEntry is what an accepted key grants
+type apiKeyEntry struct {
+	tenant    *Tenant   // nil for keys of no tenant
+	expiresAt time.Time // Zero for keys that don't expire
+}
+
+// NewAPIKeyStore creates a store from a list of plain-text keys and the keys
+// of tenants, adding the keys and tenants managed through the admin API in
+// store, if any
+func NewAPIKeyStore(keys []string, tenants []*Tenant, store PreviewStore) *APIKeyStore {
+	s := &APIKeyStore{
+		static:        make(map[[sha256.Size]byte]apiKeyEntry),
+		configTenants: make(map[string]*Tenant),
+		store:         store,
+		stop:          make(chan struct{}),
+	}
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			s.static[sha256.Sum256([]byte(key))] = apiKeyEntry{}
+		}
+	}
+	for _, tenant := range tenants {
+		tenant.init(nil)
+		s.configTenants[tenant.Name] = tenant
+		for _, key := range tenant.Keys {
+			if key = strings.TrimSpace(key); key != "" {
+				s.static[sha256.Sum256([]byte(key))] = apiKeyEntry{tenant: tenant}
+			}
+		}
+	}
+	s.keys, s.tenants = maps.Clone(s.static), maps.Clone(s.configTenants)
+	if store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), storeWriteTimeout)
+		defer cancel()
+		if err := s.Sync(ctx); err != nil {
+			slog.Warn("Could not load API keys from the preview store", "error", err)
+		}
+	}
+	return s
+}
+
+// Sync reloads the keys and tenants managed through the admin API from the
+// store. Tenants keep their rate limiters' usage across reloads. Tenants of
+// the config file take precedence over stored ones of the same name
+func (s *APIKeyStore) Sync(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+	stored, err := s.store.ListTenants(ctx)
+	if err != nil {
+		return err
+	}
+	issued, err := s.store.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	tenants := maps.Clone(s.configTenants)
+	for _, tenant := range stored {
+		if _, ok := tenants[tenant.Name]; ok {
+			continue
+		}
+		tenant.init(s.tenants[tenant.Name])
+		tenants[tenant.Name] = tenant
+	}
+	keys := maps.Clone(s.static)
+	now := time.Now()
+	for _, key := range issued {
+		digest, err := hex.DecodeString(key.Hash)
+		if key.Expired(now) || err != nil || len(digest) != sha256.Size {
+			continue
+		}
+		entry := apiKeyEntry{}
+		if key.ExpiresAt != nil {
+			entry.expiresAt = *key.ExpiresAt
+		}
+		if key.Tenant != "" {
+			if entry.tenant = tenants[key.Tenant]; entry.tenant == nil {
+				continue
+			}
+		}
+		keys[[sha256.Size]byte(digest)] = entry
+	}
+	s.keys, s.tenants, s.issued = keys, tenants, len(issued) > 0
+	s.mu.Unlock()
+
+	if s.onChange != nil {
+		s.onChange(s.Tenants())
+	}
+	return nil
+}
+
+// syncAfterChange reloads the keys after the admin API changed them, so the
+// change takes effect on this instance at once
+func (s *APIKeyStore) syncAfterChange(c *gin.Context) {
+	if err := s.Sync(c.Request.Context()); err != nil {
+		slog.WarnContext(c.Request.Context(), "Could not reload API keys; the change takes effect at the next sync", "error", err)
+	}
+}
+
+// OnChange registers fn to be called with the tenants whenever they are reloaded
+func (s *APIKeyStore) OnChange(fn func(tenants []*Tenant)) {
+	s.onChange = fn
+}
+
+// Run reloads the keys every apiKeySyncInterval until Stop, when they can
+// be managed at runtime
+func (s *APIKeyStore) Run() {
+	if s.store == nil {
+		return
+	}
+	ticker := time.NewTicker(apiKeySyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), storeWriteTimeout)
+			if err := s.Sync(ctx); err != nil {
+				slog.Warn("Could not reload API keys from the preview store", "error", err)
+			}
+			cancel()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stop ends Run
+func (s *APIKeyStore) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// Tenants returns every tenant, by name
+func (s *APIKeyStore) Tenants() []*Tenant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tenants := make([]*Tenant, 0, len(s.tenants))
+	for _, name := range slices.Sorted(maps.Keys(s.tenants)) {
+		tenants = append(tenants, s.tenants[name])
+	}
+	return tenants
+}
+
+// Tenant returns the tenant called name, or nil
+func (s *APIKeyStore) Tenant(name string) *Tenant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tenants[name]
+}
+
+// configTenant reports whether the tenant called name is from the config file
+func (s *APIKeyStore) configTenant(name string) bool {
+	_, ok := s.configTenants[name]
+	return ok
+}
+
+// Enabled reports whether any keys are configured
+// When no keys are configured the public endpoints stay open; revoking every
+// key issued through the admin API doesn't open them again
+func (s *APIKeyStore) Enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys) > 0 || s.issued
+}
+
+// Valid reports whether key is one of the configured API keys
+func (s *APIKeyStore) Valid(key string) bool {
+	_, ok := s.Lookup(key)
+	return ok
+}
+
+// Lookup reports whether key is one of the configured API keys, and returns
+// its tenant, if any
+func (s *APIKeyStore) Lookup(key string) (*Tenant, bool) {
+	if key == "" {
+		return nil, false
+	}
+	s.mu.RLock()
+	entry, ok := s.keys[sha256.Sum256([]byte(key))]
+	s.mu.RUnlock()
+	if !ok || (!entry.expiresAt.IsZero() && !time.Now().Before(entry.expiresAt)) {
+		return nil, false
+	}
+	return entry.tenant, true
+}
+
+// apiKeyFromRequest extracts the API key from the X-API-Key header or a bearer token
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// requireAuth rejects requests without a valid API key or JWT when either is configured
+// The accepted key is stored in the context under "api_key" and a JWT's subject
+// under "jwt_subject" for downstream handlers. A key's tenant is attached to
+// the request context and its name stored under "tenant"; browser requests
+// from origins the tenant doesn't allow are refused
+func requireAuth(store *APIKeyStore, validator *JWTValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !store.Enabled() && validator == nil {
+			c.Next()
+			return
+		}
+
+		credential := apiKeyFromRequest(c)
+		if tenant, ok := store.Lookup(credential); ok {
+			if tenant != nil {
+				if !tenant.OriginAllowed(c.GetHeader("Origin")) {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+						"error": "This API key may not be used from origin " + c.GetHeader("Origin"),
+					})
+					return
+				}
+				c.Set("tenant", tenant.Name)
+				c.Request = c.Request.WithContext(WithTenant(c.Request.Context(), tenant))
+			}
+			c.Set("api_key", credential)
+			c.Next()
+			return
+		}
+
+		// Bearer tokens that aren't API keys may be JWTs from the configured issuer
+		if validator != nil && credential != "" && c.GetHeader("X-API-Key") == "" {
+			subject, err := validator.Validate(c.Request.Context(), credential)
+			if err == nil {
+				c.Set("jwt_subject", subject)
+				c.Next()
+				return
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="link-preview-api", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Invalid bearer token",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.Header("WWW-Authenticate", `Bearer realm="link-preview-api"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid or missing credentials. Send an API key in the X-API-Key header or a bearer token.",
+		})
+	}
+}
+
+// requireAdminToken protects operational endpoints with the configured admin token
+// The token is accepted as a bearer token, in the X-Admin-Token header or, for
+// browsers opening the admin UI, as the password of HTTP basic authentication
+func requireAdminToken(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.AdminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Admin endpoints are disabled. Set ADMIN_TOKEN to enable them.",
+			})
+			return
+		}
+
+		token := c.GetHeader("X-Admin-Token")
+		if token == "" {
+			token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+		if _, password, ok := c.Request.BasicAuth(); ok && c.GetHeader("X-Admin-Token") == "" {
+			token = password
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+			c.Header("WWW-Authenticate", `Basic realm="link-preview-api admin", charset="UTF-8"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or missing admin token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
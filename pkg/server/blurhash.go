@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"net/url"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// BlurHash components along each axis: enough for a recognizable blur in a
+// 20-30 character hash
+const (
+	blurHashComponentsX = 4
+	blurHashComponentsY = 3
+)
+
+// blurHashSampleSize is the width or height images are shrunk to before
+// hashing; the hash only keeps the lowest frequencies, so more pixels would
+// only cost time
+const blurHashSampleSize = 64
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurHashImage downloads the preview image and returns its BlurHash, a short
+// string clients decode into a blurred placeholder shown while the image loads
+func (me *MetaExtractor) blurHashImage(ctx context.Context, pageURL, imageURL string) (string, error) {
+	target, err := resolveImageURL(pageURL, imageURL)
+	if err != nil {
+		return "", err
+	}
+	data, _, err := me.fetchImage(ctx, target, maxProxiedImageBytes)
+	if err != nil {
+		return "", err
+	}
+	return blurHashData(data)
+}
+
+// blurHashData decodes the image data and returns its BlurHash, refusing
+// images declaring more than maxDecodePixels before decoding them
+func blurHashData(data []byte) (string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("unsupported image: %v", err)
+	}
+	if config.Width*config.Height > maxDecodePixels {
+		return "", errors.New("image dimensions are too large to decode")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %v", err)
+	}
+	return blurHash(img, blurHashComponentsX, blurHashComponentsY), nil
+}
+
+// resolveImageURL resolves imageURL against pageURL
+func resolveImageURL(pageURL, imageURL string) (*url.URL, error) {
+	target, err := url.Parse(resolveURL(pageURL, imageURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image URL: %v", err)
+	}
+	return target, nil
+}
+
+// blurHash encodes img with componentsX x componentsY components, each from 1
+// to 9, following https://github.com/woltapp/blurhash
+func blurHash(img image.Image, componentsX, componentsY int) string {
+	// Shrink the image first: the hash only keeps its lowest frequencies
+	bounds := img.Bounds()
+	width, height := fitWithin(bounds.Dx(), bounds.Dy(), blurHashSampleSize, blurHashSampleSize)
+	small := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, bounds, draw.Src, nil)
+
+	// Convert every pixel to linear RGB once
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := small.NRGBAAt(x, y)
+			linear[y*width+x] = [3]float64{srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					pixel := linear[y*width+x]
+					factor[0] += basis * pixel[0]
+					factor[1] += basis * pixel[1]
+					factor[2] += basis * pixel[2]
+				}
+			}
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	encodeBase83(&hash, (componentsX-1)+(componentsY-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		encodeBase83(&hash, quantisedMax, 1)
+	} else {
+		encodeBase83(&hash, 0, 1)
+	}
+
+	encodeBase83(&hash, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+	for _, f := range ac {
+		quantise := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		encodeBase83(&hash, quantise(f[0])*19*19+quantise(f[1])*19+quantise(f[2]), 2)
+	}
+	return hash.String()
+}
+
+// encodeBase83 appends value as length base-83 digits
+func encodeBase83(sb *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		sb.WriteByte(base83Chars[digit])
+	}
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
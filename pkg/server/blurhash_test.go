@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// oversizedGIF returns the header of a GIF declaring a width x height screen,
+// with no image data: enough for image.DecodeConfig
+func oversizedGIF(width, height uint16) []byte {
+	header := []byte("GIF89a")
+	header = binary.LittleEndian.AppendUint16(header, width)
+	header = binary.LittleEndian.AppendUint16(header, height)
+	return append(header, 0, 0, 0)
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func filledImage(width, height int, fill func(x, y int) color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, fill(x, y))
+		}
+	}
+	return img
+}
+
+func TestBlurHash(t *testing.T) {
+	tests := []struct {
+		name string
+		fill func(x, y int) color.NRGBA
+		want string
+	}{
+		{"white", func(x, y int) color.NRGBA {
+			return color.NRGBA{255, 255, 255, 255}
+		}, "L~TSUA-;fQ-;~qt7fQt7fQfQfQfQ"},
+		{"red and blue halves", func(x, y int) color.NRGBA {
+			if x < 4 {
+				return color.NRGBA{255, 0, 0, 255}
+			}
+			return color.NRGBA{0, 0, 255, 255}
+		}, "L~LjfL|T,SST,e,TsRWtfQfQfQfQ"},
+		{"gradient", func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 32), uint8(y * 64), 128, 255}
+		}, "LjF=XW3Ba|xu*?NefQnmd_e;fQe;"},
+	}
+	for _, tt := range tests {
+		data := encodePNG(t, filledImage(8, 4, tt.fill))
+		got, err := blurHashData(data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: blurHash = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBlurHashRefusesOversizedImages(t *testing.T) {
+	_, err := blurHashData(oversizedGIF(10000, 10000))
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("blurHashData of a 10000x10000 header = %v, want a too large error", err)
+	}
+}
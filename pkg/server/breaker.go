@@ -0,0 +1,146 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrCodeCircuitOpen is reported in error_code when a host's circuit breaker is open
+const ErrCodeCircuitOpen = "ERR_CIRCUIT_OPEN"
+
+// CircuitBreaker stops fetching from hosts that keep failing
+//
+// After threshold consecutive transient failures (timeouts, resets, 5xx) a host's
+// circuit opens and fetches fail fast for cooldown. Then a single probe request is
+// let through: success closes the circuit, failure opens it for another cooldown
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+// circuit is the breaker state of one host
+type circuit struct {
+	failures  int       // Consecutive failures
+	openUntil time.Time // Zero while closed
+	probeAt   time.Time // When the current half-open probe was let through
+}
+
+// CircuitStatus describes a host whose circuit is open or recovering
+type CircuitStatus struct {
+	Host      string    `json:"host"`
+	Failures  int       `json:"consecutive_failures"`
+	State     string    `json:"state"` // "open" or "half_open"
+	OpenUntil time.Time `json:"open_until"`
+}
+
+// NewCircuitBreaker creates a breaker opening after threshold consecutive failures
+// Returns nil when threshold <= 0, meaning circuit breaking is disabled
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		hosts:     make(map[string]*circuit),
+	}
+}
+
+// Allow reports whether a fetch from host may proceed and, if not, how long until it may
+func (cb *CircuitBreaker) Allow(host string) (bool, time.Duration) {
+	if cb == nil {
+		return true, 0
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.hosts[strings.ToLower(host)]
+	if !ok || c.openUntil.IsZero() {
+		return true, 0
+	}
+	if wait := time.Until(c.openUntil); wait > 0 {
+		return false, wait
+	}
+	// Cooldown is over: let one probe through to test the host. A probe that never
+	// reports back is abandoned after another cooldown
+	if !c.probeAt.IsZero() && time.Since(c.probeAt) < cb.cooldown {
+		return false, cb.cooldown - time.Since(c.probeAt)
+	}
+	c.probeAt = time.Now()
+	return true, 0
+}
+
+// Record updates host's circuit with the outcome of a fetch
+// Only transient failures count against a host; permanent errors such as 404s say
+// nothing about whether the host is up and are recorded as successes
+func (cb *CircuitBreaker) Record(host string, failed bool) {
+	if cb == nil {
+		return
+	}
+	host = strings.ToLower(host)
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.hosts[host]
+	if !failed {
+		if ok {
+			delete(cb.hosts, host)
+		}
+		return
+	}
+	if !ok {
+		c = &circuit{}
+		cb.hosts[host] = c
+	}
+
+	c.failures++
+	if !c.probeAt.IsZero() || c.failures >= cb.threshold {
+		c.openUntil = time.Now().Add(cb.cooldown)
+	}
+	c.probeAt = time.Time{}
+}
+
+// Open returns the hosts whose circuit is currently open or half-open
+func (cb *CircuitBreaker) Open() []CircuitStatus {
+	statuses := []CircuitStatus{}
+	if cb == nil {
+		return statuses
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	for host, c := range cb.hosts {
+		if c.openUntil.IsZero() {
+			continue
+		}
+		state := "open"
+		if !now.Before(c.openUntil) {
+			state = "half_open"
+		}
+		statuses = append(statuses, CircuitStatus{Host: host, Failures: c.failures, State: state, OpenUntil: c.openUntil})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Host < statuses[j].Host })
+	return statuses
+}
+
+// circuitOpenError describes a fetch refused because host's circuit is open
+func circuitOpenError(host string, retryAfter time.Duration) string {
+	return fmt.Sprintf("Host %s is failing repeatedly; not fetching for another %s", host, retryAfter.Round(time.Second))
+}
+
+// handleCircuitStats lists the hosts currently short-circuited by the breaker
+func handleCircuitStats(breaker *CircuitBreaker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"circuits": breaker.Open()})
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// BrowserPool keeps warm headless Chromium instances for the renderer. It caps
+// the pages open at once across all of them, spreads pages over the least busy
+// instance, and retires an instance once it has rendered RENDER_RECYCLE_AFTER
+// pages, reached RENDER_BROWSER_MAX_AGE or crashed, so a leaking browser can't
+// grow without bound. Retired instances are closed once their last page is done
+type BrowserPool struct {
+	allocCtx     context.Context
+	slots        chan struct{} // One per page allowed open at once
+	recycleAfter int           // Pages rendered before an instance is replaced; 0 means never
+	maxAge       time.Duration // Lifetime of an instance; 0 means unlimited
+
+	mu        sync.Mutex
+	instances []*browserInstance // Fixed size; nil entries are started on demand
+	closed    bool
+}
+
+// browserInstance is one Chromium process of the pool
+type browserInstance struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	startMu sync.Mutex
+	browser atomic.Pointer[chromedp.Browser] // Set once the browser is running
+	started time.Time
+	pages   int  // Pages rendered, including those still open
+	active  int  // Pages open
+	retired bool // No longer given pages; closed when active drops to 0
+}
+
+// NewBrowserPool creates a pool of size browsers allocated from allocCtx, with
+// at most maxPages pages open at once, and starts the browsers in the background
+func NewBrowserPool(allocCtx context.Context, size, maxPages, recycleAfter int, maxAge time.Duration) *BrowserPool {
+	if size <= 0 {
+		size = 1
+	}
+	if maxPages < size {
+		maxPages = size
+	}
+	pool := &BrowserPool{
+		allocCtx:     allocCtx,
+		slots:        make(chan struct{}, maxPages),
+		recycleAfter: recycleAfter,
+		maxAge:       maxAge,
+		instances:    make([]*browserInstance, size),
+	}
+	go pool.warm()
+	return pool
+}
+
+// warm starts every browser so the first renders don't pay for it
+func (p *BrowserPool) warm() {
+	p.mu.Lock()
+	var starting []*browserInstance
+	for i, inst := range p.instances {
+		if inst == nil && !p.closed {
+			p.instances[i] = p.newInstance()
+			starting = append(starting, p.instances[i])
+		}
+	}
+	p.mu.Unlock()
+
+	for _, inst := range starting {
+		if err := inst.start(); err != nil {
+			slog.Warn("Could not start headless browser; rendering will retry on demand", "error", err)
+			return
+		}
+	}
+}
+
+// acquire waits for a free page slot and returns the browser to open the page in
+func (p *BrowserPool) acquire(ctx context.Context) (*browserInstance, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		<-p.slots
+		return nil, context.Canceled
+	}
+	var best *browserInstance
+	for i, inst := range p.instances {
+		if inst != nil && !inst.retired && (inst.ctx.Err() != nil || inst.exited()) {
+			// The browser crashed or was killed; replace it
+			p.retire(inst)
+			inst = nil
+		}
+		if inst == nil {
+			inst = p.newInstance()
+			p.instances[i] = inst
+		}
+		if best == nil || inst.active < best.active {
+			best = inst
+		}
+	}
+	best.active++
+	best.pages++
+	return best, nil
+}
+
+// release returns the page slot taken for inst, recycling inst if it is due
+func (p *BrowserPool) release(inst *browserInstance) {
+	p.mu.Lock()
+	inst.active--
+	if !inst.retired && ((p.recycleAfter > 0 && inst.pages >= p.recycleAfter) ||
+		(p.maxAge > 0 && time.Since(inst.started) >= p.maxAge)) {
+		slog.Debug("Recycling headless browser", "pages", inst.pages, "age", time.Since(inst.started).Round(time.Second))
+		for i := range p.instances {
+			if p.instances[i] == inst {
+				p.instances[i] = nil
+			}
+		}
+		p.retire(inst)
+	} else if inst.retired && inst.active == 0 {
+		inst.cancel()
+	}
+	p.mu.Unlock()
+	<-p.slots
+}
+
+// retire stops giving pages to inst and closes it once its pages are done.
+// The caller holds p.mu
+func (p *BrowserPool) retire(inst *browserInstance) {
+	inst.retired = true
+	if inst.active == 0 {
+		inst.cancel()
+	}
+}
+
+// start launches the browser if it isn't running yet. Tabs must only be opened
+// once it is, or each would launch a browser of its own
+func (inst *browserInstance) start() error {
+	inst.startMu.Lock()
+	defer inst.startMu.Unlock()
+	if inst.browser.Load() != nil {
+		return nil
+	}
+	// Running no actions just launches the browser
+	if err := chromedp.Run(inst.ctx); err != nil {
+		return err
+	}
+	inst.browser.Store(chromedp.FromContext(inst.ctx).Browser)
+	return nil
+}
+
+// exited reports whether the browser was started and has since exited
+func (inst *browserInstance) exited() bool {
+	browser := inst.browser.Load()
+	if browser == nil {
+		return false
+	}
+	select {
+	case <-browser.LostConnection:
+		return true
+	default:
+		return false
+	}
+}
+
+// newInstance creates a browser context; the browser starts with its first page.
+// The caller holds p.mu
+func (p *BrowserPool) newInstance() *browserInstance {
+	ctx, cancel := chromedp.NewContext(p.allocCtx)
+	return &browserInstance{ctx: ctx, cancel: cancel, started: time.Now()}
+}
+
+// Close stops every browser, including those with pages still open
+func (p *BrowserPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for i, inst := range p.instances {
+		if inst != nil {
+			inst.cancel()
+			p.instances[i] = nil
+		}
+	}
+}
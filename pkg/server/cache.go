@@ -0,0 +1,266 @@
+package server
+
+import (
+	"container/list"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a single cached preview together with its bookkeeping data
+type cacheEntry struct {
+	key       string
+	value     LinkPreviewResponse
+	expiresAt time.Time
+	hits      int64
+	size      int64
+}
+
+// PreviewCache is an in-memory LRU cache of successful link previews
+// Entries expire after the configured TTL and the least recently used entry
+// is evicted once the cache reaches its maximum size
+type PreviewCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // Front is most recently used
+
+	hits      int64
+	misses    int64
+	evictions int64
+	memory    int64
+}
+
+// CacheStats is a point-in-time snapshot of the cache counters
+type CacheStats struct {
+	Entries     int            `json:"entries"`
+	MaxEntries  int            `json:"max_entries"`
+	TTLSeconds  float64        `json:"ttl_seconds"`
+	Hits        int64          `json:"hits"`
+	Misses      int64          `json:"misses"`
+	HitRate     float64        `json:"hit_rate"`
+	Evictions   int64          `json:"evictions"`
+	MemoryBytes int64          `json:"memory_bytes"`
+	HottestURLs []CacheHotItem `json:"hottest_urls"`
+}
+
+// CacheHotItem describes a frequently served cache entry
+type CacheHotItem struct {
+	URL  string `json:"url"`
+	Hits int64  `json:"hits"`
+}
+
+// CacheEntryInfo describes a cached preview for the admin UI
+type CacheEntryInfo struct {
+	Key       string    `json:"key"` // Normalized URL, with its cache namespace and user agent profile, if any
+	Title     string    `json:"title"`
+	Hits      int64     `json:"hits"`
+	Size      int64     `json:"size_bytes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewPreviewCache creates a cache holding at most maxEntries previews for ttl each
+func NewPreviewCache(maxEntries int, ttl time.Duration) *PreviewCache {
+	return &PreviewCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get returns the cached preview for key, if present and not expired
+func (pc *PreviewCache) Get(key string) (LinkPreviewResponse, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	elem, ok := pc.entries[key]
+	if !ok {
+		pc.misses++
+		return LinkPreviewResponse{}, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		// Expired entries are dropped lazily on access
+		pc.removeElement(elem)
+		pc.misses++
+		return LinkPreviewResponse{}, false
+	}
+
+	entry.hits++
+	pc.hits++
+	pc.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// SetTTL changes how long newly stored previews stay cached
+// Entries already cached keep their original expiry
+func (pc *PreviewCache) SetTTL(ttl time.Duration) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.ttl = ttl
+}
+
+// Set stores a preview under key, evicting the least recently used entries if needed
+func (pc *PreviewCache) Set(key string, value LinkPreviewResponse) {
+	pc.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL stores a preview under key for ttl, or the cache's TTL when ttl is 0
+func (pc *PreviewCache) SetWithTTL(key string, value LinkPreviewResponse, ttl time.Duration) {
+	if pc.maxEntries <= 0 {
+		return
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if elem, ok := pc.entries[key]; ok {
+		pc.removeElement(elem)
+	}
+
+	if ttl <= 0 {
+		ttl = pc.ttl
+	}
+	entry := &cacheEntry{
+		key:       key,
+		value:     value,
+		expiresAt: time.Now().Add(ttl),
+		size:      estimateEntrySize(key, value),
+	}
+	pc.entries[key] = pc.order.PushFront(entry)
+	pc.memory += entry.size
+
+	for pc.order.Len() > pc.maxEntries {
+		pc.removeElement(pc.order.Back())
+		pc.evictions++
+	}
+}
+
+// Delete removes the entry for key and reports how many entries were removed (0 or 1)
+func (pc *PreviewCache) Delete(key string) int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	elem, ok := pc.entries[key]
+	if !ok {
+		return 0
+	}
+	pc.removeElement(elem)
+	return 1
+}
+
+// DeleteVariants removes the entry for key and those of the same preview
+// fetched with a requested user agent profile or Accept-Language, and
+// returns how many were removed
+func (pc *PreviewCache) DeleteVariants(key string) int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	removed := 0
+	for entryKey, elem := range pc.entries {
+		if entryKey == key || strings.HasPrefix(entryKey, key+"#") {
+			pc.removeElement(elem)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Clear removes every entry and returns how many were removed
+func (pc *PreviewCache) Clear() int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	n := pc.order.Len()
+	pc.entries = make(map[string]*list.Element)
+	pc.order.Init()
+	pc.memory = 0
+	return n
+}
+
+// Stats returns a snapshot of the cache counters and the topN most hit entries
+func (pc *PreviewCache) Stats(topN int) CacheStats {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	hot := make([]CacheHotItem, 0, len(pc.entries))
+	for elem := pc.order.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*cacheEntry)
+		if entry.hits > 0 {
+			hot = append(hot, CacheHotItem{URL: entry.key, Hits: entry.hits})
+		}
+	}
+	sort.SliceStable(hot, func(i, j int) bool { return hot[i].Hits > hot[j].Hits })
+	if len(hot) > topN {
+		hot = hot[:topN]
+	}
+
+	var hitRate float64
+	if total := pc.hits + pc.misses; total > 0 {
+		hitRate = float64(pc.hits) / float64(total)
+	}
+
+	return CacheStats{
+		Entries:     pc.order.Len(),
+		MaxEntries:  pc.maxEntries,
+		TTLSeconds:  pc.ttl.Seconds(),
+		Hits:        pc.hits,
+		Misses:      pc.misses,
+		HitRate:     hitRate,
+		Evictions:   pc.evictions,
+		MemoryBytes: pc.memory,
+		HottestURLs: hot,
+	}
+}
+
+// Entries lists at most limit unexpired entries, most recently used first
+func (pc *PreviewCache) Entries(limit int) []CacheEntryInfo {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	now := time.Now()
+	entries := make([]CacheEntryInfo, 0, min(limit, pc.order.Len()))
+	for elem := pc.order.Front(); elem != nil && len(entries) < limit; elem = elem.Next() {
+		entry := elem.Value.(*cacheEntry)
+		if now.After(entry.expiresAt) {
+			continue
+		}
+		entries = append(entries, CacheEntryInfo{
+			Key:       entry.key,
+			Title:     entry.value.Title,
+			Hits:      entry.hits,
+			Size:      entry.size,
+			ExpiresAt: entry.expiresAt.UTC(),
+		})
+	}
+	return entries
+}
+
+// removeElement unlinks an entry from both the list and the index
+// Callers must hold pc.mu
+func (pc *PreviewCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	pc.order.Remove(elem)
+	delete(pc.entries, entry.key)
+	pc.memory -= entry.size
+}
+
+// estimateEntrySize approximates the memory held by a cache entry
+// Only string payloads are counted, plus a fixed overhead for the bookkeeping structs
+func estimateEntrySize(key string, value LinkPreviewResponse) int64 {
+	const overhead = 256
+	size := overhead + len(key) + len(value.URL) + len(value.Title) +
+		len(value.Description) + len(value.Image) + len(value.SiteName) + len(value.Language) + len(value.ImageType) + len(value.BlurHash) +
+		len(value.ImageData) + len(value.FaviconData)
+	for name, values := range value.RawMeta {
+		size += len(name)
+		for _, v := range values {
+			size += len(v)
+		}
+	}
+	return int64(size)
+}
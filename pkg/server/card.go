@@ -0,0 +1,277 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Layout of fallback cards, in pixels. The size is the 1.91:1 of og:image
+const (
+	cardWidth      = 1200
+	cardHeight     = 630
+	cardMargin     = 80
+	cardIconSize   = 96
+	cardTitleSize  = 64
+	cardTitleLines = 4
+	cardSiteSize   = 36
+)
+
+// maxCardIconBytes caps the favicon downloaded for a card
+const maxCardIconBytes = 1 << 20
+
+// maxCardTitle is the longest title, in runes, a card request may carry
+const maxCardTitle = 300
+
+// CardRenderer draws fallback preview images for pages without a usable one:
+// the page title over a background coloured after its domain, under the
+// site's favicon and name
+type CardRenderer struct {
+	extractor *MetaExtractor
+	titleFont *opentype.Font
+	siteFont  *opentype.Font
+}
+
+// NewCardRenderer creates a renderer fetching favicons through extractor, or
+// returns nil when fallback cards are disabled
+func NewCardRenderer(enabled bool, extractor *MetaExtractor) *CardRenderer {
+	if !enabled {
+		return nil
+	}
+	titleFont, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		slog.Warn("Fallback cards disabled", "error", err)
+		return nil
+	}
+	siteFont, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		slog.Warn("Fallback cards disabled", "error", err)
+		return nil
+	}
+	return &CardRenderer{extractor: extractor, titleFont: titleFont, siteFont: siteFont}
+}
+
+// fallbackCardURL returns a signed /card path drawing a fallback image for
+// result, or "" when signing is disabled
+func fallbackCardURL(signer *URLSigner, result *LinkPreviewResponse) string {
+	if signer == nil {
+		return ""
+	}
+	page, err := url.Parse(result.baseURL())
+	if err != nil || page.Host == "" {
+		return ""
+	}
+	site := result.SiteName
+	if site == "" {
+		site = strings.TrimPrefix(page.Hostname(), "www.")
+	}
+	title := result.Title
+	if utf8.RuneCountInString(title) > maxCardTitle {
+		title = string([]rune(title)[:maxCardTitle])
+	}
+	query := url.Values{
+		"title": {title},
+		"site":  {site},
+		"host":  {page.Hostname()},
+		"icon":  {resolveURL(result.baseURL(), faviconURL(result))},
+	}
+	return signer.Sign("/card", query, 0)
+}
+
+// handleCard serves a fallback card PNG for the "title", "site", "host" and
+// "icon" query parameters of a signed /card URL. store, which may be nil,
+// keeps the cards drawn and redirects to them
+func handleCard(cards *CardRenderer, store *MediaStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		title, site := c.Query("title"), c.Query("site")
+		if utf8.RuneCountInString(title) > maxCardTitle || utf8.RuneCountInString(site) > maxCardTitle {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameters 'title' and 'site' are too long"})
+			return
+		}
+		key := store.Key("card", title, site, c.Query("host"), c.Query("icon"))
+		if store.Redirect(c, key, 0) {
+			return
+		}
+		data, err := cards.Render(c.Request.Context(), title, site, c.Query("host"), c.Query("icon"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to draw card: %v", err)})
+			return
+		}
+		store.Save(key, data, "image/png")
+		c.Header("Cache-Control", "public, max-age=604800, immutable")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Data(http.StatusOK, "image/png", data)
+	}
+}
+
+// Render draws a card for a page titled title on site, coloured after host,
+// and encodes it as PNG. The favicon at iconURL is left out if it can't be
+// fetched or decoded; ICO files, which Go can't decode, always are
+func (cr *CardRenderer) Render(ctx context.Context, title, site, host, iconURL string) ([]byte, error) {
+	// Faces hold glyph buffers, so each card gets its own
+	titleFace, err := opentype.NewFace(cr.titleFont, &opentype.FaceOptions{Size: cardTitleSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer titleFace.Close()
+	siteFace, err := opentype.NewFace(cr.siteFont, &opentype.FaceOptions{Size: cardSiteSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer siteFace.Close()
+
+	card := image.NewRGBA(image.Rect(0, 0, cardWidth, cardHeight))
+	draw.Draw(card, card.Bounds(), image.NewUniform(cardColor(host)), image.Point{}, draw.Src)
+
+	// The favicon and site name share the top line
+	siteX := cardMargin
+	if icon := cr.icon(ctx, iconURL); icon != nil {
+		rect := image.Rect(cardMargin, cardMargin, cardMargin+cardIconSize, cardMargin+cardIconSize)
+		draw.CatmullRom.Scale(card, rect, icon, icon.Bounds(), draw.Over, nil)
+		siteX += cardIconSize + 32
+	}
+	siteBaseline := cardMargin + cardIconSize/2 + cardSiteSize/3
+	drawText(card, siteFace, color.NRGBA{255, 255, 255, 200}, siteX, siteBaseline,
+		fitLine(siteFace, site, cardWidth-cardMargin-siteX))
+
+	// The title fills the rest, wrapped, ending with an ellipsis if it doesn't fit
+	lineHeight := cardTitleSize * 5 / 4
+	y := cardMargin + cardIconSize + 64 + cardTitleSize
+	for _, line := range wrapText(titleFace, title, cardWidth-2*cardMargin, cardTitleLines) {
+		drawText(card, titleFace, color.White, cardMargin, y, line)
+		y += lineHeight
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, card); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// icon downloads and decodes the favicon at iconURL, or returns nil
+func (cr *CardRenderer) icon(ctx context.Context, iconURL string) image.Image {
+	target, err := url.Parse(iconURL)
+	if err != nil || iconURL == "" {
+		return nil
+	}
+	data, _, err := cr.extractor.fetchImage(ctx, target, maxCardIconBytes)
+	if err != nil {
+		slog.DebugContext(ctx, "Card drawn without favicon", "icon", iconURL, "error", err)
+		return nil
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxDecodePixels {
+		return nil
+	}
+	icon, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	return icon
+}
+
+// cardColor picks a dark, saturated background for host, the same on every card of a site
+func cardColor(host string) color.Color {
+	h := fnv.New32a()
+	h.Write([]byte(strings.TrimPrefix(strings.ToLower(host), "www.")))
+	hue := float64(h.Sum32()%360) / 360
+	return hslToRGB(hue, 0.55, 0.32)
+}
+
+// hslToRGB converts a hue, saturation and lightness, each from 0 to 1, to RGB
+func hslToRGB(h, s, l float64) color.RGBA {
+	q := l + s - l*s
+	if l < 0.5 {
+		q = l * (1 + s)
+	}
+	p := 2*l - q
+	channel := func(t float64) uint8 {
+		t -= math.Floor(t)
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(math.Round(v * 255))
+	}
+	return color.RGBA{channel(h + 1.0/3), channel(h), channel(h - 1.0/3), 255}
+}
+
+// wrapText breaks text into at most maxLines lines of at most width pixels,
+// cutting the last one with an ellipsis when text doesn't fit
+func wrapText(face font.Face, text string, width, maxLines int) []string {
+	var lines []string
+	var line string
+	words := strings.Fields(text)
+	for i, word := range words {
+		candidate := strings.TrimSpace(line + " " + word)
+		if line != "" && font.MeasureString(face, candidate).Ceil() > width {
+			if len(lines) == maxLines-1 {
+				return append(lines, fitLine(face, strings.Join(append([]string{line}, words[i:]...), " ")+"…", width))
+			}
+			lines = append(lines, fitLine(face, line, width))
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, fitLine(face, line, width))
+	}
+	return lines
+}
+
+// fitLine cuts text to width pixels, marking the cut with an ellipsis. It
+// cuts between words, unless the first word alone is too wide
+func fitLine(face font.Face, text string, width int) string {
+	if font.MeasureString(face, text).Ceil() <= width {
+		return text
+	}
+	text = strings.TrimSuffix(text, "…")
+	for words := strings.Fields(text); len(words) > 1; {
+		words = words[:len(words)-1]
+		cut := strings.TrimRight(strings.Join(words, " "), " ,;:-") + "…"
+		if font.MeasureString(face, cut).Ceil() <= width {
+			return cut
+		}
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		cut := strings.TrimRight(string(runes), " ,;:-") + "…"
+		if font.MeasureString(face, cut).Ceil() <= width {
+			return cut
+		}
+	}
+	return ""
+}
+
+// drawText draws text with its baseline starting at x, y
+func drawText(dst draw.Image, face font.Face, c color.Color, x, y int, text string) {
+	d := font.Drawer{Dst: dst, Src: image.NewUniform(c), Face: face, Dot: fixed.P(x, y)}
+	d.DrawString(text)
+}
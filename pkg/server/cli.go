@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// RunFetch implements "fetch": it previews each URL once with the configured
+// extractor and prints the results as JSON to stdout, without starting the server.
+// Logs go to stderr so the output can be piped. It returns the process exit code:
+// 0 when every preview succeeded, 1 when any failed and 2 on usage errors
+func RunFetch(name string, args []string) int {
+	config, urls := LoadSettings(name+" fetch", args, os.Stderr)
+	if len(urls) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s fetch [flags] <url>...\n", name)
+		return 2
+	}
+
+	// Nothing is reused between runs, so previews are never cached
+	extractor := NewMetaExtractor(config)
+	service := NewPreviewService(extractor, NewPreviewCache(0, 0), config)
+	defer service.reporter.Flush(2 * time.Second)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	status := 0
+	for _, targetURL := range urls {
+		ctx, cancel := context.WithTimeout(context.Background(), config.FetchTimeout)
+		result, _, err := service.Preview(ctx, targetURL)
+		cancel()
+
+		if err != nil {
+			result = LinkPreviewResponse{Preview: linkpreview.Preview{URL: targetURL}, Error: fmt.Sprintf("Preview failed: %v", err), ErrorCode: string(linkpreview.CodeOf(err))}
+		}
+		if result.Error != "" {
+			status = 1
+		}
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return status
+}
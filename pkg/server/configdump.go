@@ -0,0 +1,204 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redacted replaces the values of secrets in the configuration dump
+const redacted = "[redacted]"
+
+// Credentials embedded in otherwise harmless settings: the password of a URL
+// such as a postgres:// DSN or proxy, and key=value DSN passwords
+var (
+	urlPassword = regexp.MustCompile(`(://[^:/@\s]*):[^@/\s]*@`)
+	dsnPassword = regexp.MustCompile(`(?i)\b(password=)('[^']*'|\S+)`)
+)
+
+// secretSetting reports whether the setting, Config field or header called
+// name holds a secret, such as ADMIN_TOKEN, MediaStoreSecretKey or Cookie
+func secretSetting(name string) bool {
+	name = strings.ToUpper(strings.NewReplacer("_", "", "-", "").Replace(name))
+	for _, word := range []string{"TOKEN", "SECRET", "PASSWORD", "COOKIE", "AUTHORIZATION", "SENTRYDSN"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return strings.HasSuffix(name, "KEY") || strings.HasSuffix(name, "KEYS")
+}
+
+// redactCredentials hides the passwords embedded in value
+func redactCredentials(value string) string {
+	value = urlPassword.ReplaceAllString(value, "${1}:xxxxx@")
+	return dsnPassword.ReplaceAllString(value, "${1}xxxxx")
+}
+
+// SettingSource is a setting given explicitly, and where it came from
+type SettingSource struct {
+	Value  string `json:"value"`
+	Source string `json:"source"` // "flag", "env" or "file"
+}
+
+// settingSource returns where setting key is given, without marking a file
+// setting as used, or false when it has its default value
+func settingSource(key string) (SettingSource, bool) {
+	if value, ok := flagSettings[key]; ok {
+		return SettingSource{value, "flag"}, true
+	}
+	if env, ok := os.LookupEnv(key); ok && strings.TrimSpace(env) != "" {
+		return SettingSource{env, "env"}, true
+	}
+	fileSettings.Lock()
+	defer fileSettings.Unlock()
+	if value, ok := fileSettings.values[key]; ok {
+		return SettingSource{value, "file"}, true
+	}
+	return SettingSource{}, false
+}
+
+// settingSources lists the documented settings that are given explicitly,
+// with secrets redacted
+func settingSources() map[string]SettingSource {
+	sources := make(map[string]SettingSource)
+	for _, doc := range settingDocs {
+		for _, key := range doc.keys {
+			source, ok := settingSource(key)
+			if !ok {
+				continue
+			}
+			if secretSetting(key) {
+				source.Value = redacted
+			} else {
+				source.Value = redactCredentials(source.Value)
+			}
+			sources[key] = source
+		}
+	}
+	return sources
+}
+
+// ConfigDump is the JSON body of GET /admin/config
+type ConfigDump struct {
+	ConfigFile string                   `json:"config_file,omitempty"`
+	Started    time.Time                `json:"started"`
+	Reloaded   *time.Time               `json:"reloaded,omitempty"` // Last time the configuration was reloaded
+	Settings   map[string]SettingSource `json:"settings"`           // Settings not left at their default
+	Config     any                      `json:"config"`             // Every field of the configuration in effect
+}
+
+// LiveConfig is the configuration in effect: the one the server started
+// with, and the settings that change without a restart as last reloaded
+type LiveConfig struct {
+	mu       sync.Mutex
+	config   Config
+	settings map[string]SettingSource
+	started  time.Time
+	reloaded *time.Time
+}
+
+// NewLiveConfig tracks the configuration in effect, starting with config
+func NewLiveConfig(config *Config) *LiveConfig {
+	return &LiveConfig{config: *config, settings: settingSources(), started: time.Now().UTC()}
+}
+
+// Reloaded records the settings of a reloaded configuration that took
+// effect, which must match the reload hook of setupRoutes
+func (lc *LiveConfig) Reloaded(config *Config) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.config.AllowedOrigins = config.AllowedOrigins
+	lc.config.KeyRateLimit, lc.config.KeyRateBurst, lc.config.KeyDailyQuota = config.KeyRateLimit, config.KeyRateBurst, config.KeyDailyQuota
+	lc.config.IPRateLimit, lc.config.IPRateBurst = config.IPRateLimit, config.IPRateBurst
+	lc.config.AllowedDomains, lc.config.BlockedDomains = config.AllowedDomains, config.BlockedDomains
+	lc.config.CacheTTL = config.CacheTTL
+	lc.settings = settingSources()
+	now := time.Now().UTC()
+	lc.reloaded = &now
+}
+
+// Dump returns the configuration in effect with secrets redacted
+func (lc *LiveConfig) Dump() ConfigDump {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return ConfigDump{
+		ConfigFile: setting("CONFIG_FILE"),
+		Started:    lc.started,
+		Reloaded:   lc.reloaded,
+		Settings:   lc.settings,
+		Config:     dumpValue("", reflect.ValueOf(lc.config)),
+	}
+}
+
+// dumpValue converts the value of the field or map entry called name to
+// something JSON shows readably: durations as "30s", structs as objects of
+// their exported fields, secrets redacted
+func dumpValue(name string, v reflect.Value) any {
+	if secretSetting(name) {
+		if v.IsZero() || (v.Kind() == reflect.Slice && v.Len() == 0) {
+			return nil
+		}
+		return redacted
+	}
+	switch v.Type() {
+	case reflect.TypeFor[time.Duration]():
+		return time.Duration(v.Int()).String()
+	case reflect.TypeFor[os.FileMode]():
+		return fmt.Sprintf("%#o", v.Uint())
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return redactCredentials(v.String())
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return dumpValue(name, v.Elem())
+	case reflect.Struct:
+		fields := make(map[string]any)
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if key == "-" {
+				continue
+			}
+			if key == "" {
+				key = field.Name
+			}
+			fields[key] = dumpValue(field.Name, v.Field(i))
+		}
+		return fields
+	case reflect.Slice, reflect.Array:
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = dumpValue("", v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		entries := make(map[string]any, v.Len())
+		for _, key := range v.MapKeys() {
+			entries[fmt.Sprint(key)] = dumpValue(fmt.Sprint(key), v.MapIndex(key))
+		}
+		return entries
+	default:
+		return v.Interface()
+	}
+}
+
+// handleConfig reports the configuration in effect, so operators can check
+// what the server actually uses
+func handleConfig(live *LiveConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, live.Dump())
+	}
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/net/http/httpguts"
+	"gopkg.in/yaml.v3"
+)
+
+// fileSettings holds the settings loaded from the configuration file, keyed by
+// the name of the environment variable they stand in for. Environment variables
+// always take precedence over the file
+var fileSettings = struct {
+	sync.Mutex
+	values  map[string]string
+	used    map[string]bool
+	domains []DomainOverride
+	tenants []*Tenant
+}{}
+
+// DomainOverride customizes how pages on matching domains are fetched and parsed.
+// Pattern uses the same syntax as ALLOWED_DOMAINS: "example.com" matches the
+// domain and its subdomains, "*.example.com" subdomains only
+type DomainOverride struct {
+	Pattern string         `json:"pattern"`
+	Timeout time.Duration  `json:"timeout,omitempty"` // Per-attempt fetch timeout, replacing the adaptive timeout
+	Rules   []SelectorRule `json:"rules,omitempty"`   // Fields extracted with CSS selectors
+	Render  *RenderOptions `json:"render,omitempty"`  // Headless rendering settings; the domain is rendered when its preview is thin
+
+	UserAgent  string            `json:"user_agent,omitempty"`  // Sent instead of the default User-Agent when fetching and rendering pages
+	Headers    map[string]string `json:"headers,omitempty"`     // Extra request headers, e.g. Accept-Language or Cookie
+	CacheTTL   time.Duration     `json:"cache_ttl,omitempty"`   // How long previews stay cached, replacing CACHE_TTL
+	RenderMode string            `json:"render_mode,omitempty"` // When pages are rendered: auto (thin previews, by default), always or never
+}
+
+// Render modes of a domain entry
+const (
+	RenderAuto   = "auto"
+	RenderAlways = "always"
+	RenderNever  = "never"
+)
+
+// loadConfigFile reads settings from a YAML, TOML or JSON file, chosen by extension
+// Keys are the environment variable names in lower or upper case, and nested
+// sections are joined with underscores, so
+//
+//	cache:
+//	  ttl: 30m
+//
+// sets CACHE_TTL. Lists are joined with commas. The optional "domains" section
+// holds per-domain overrides, and "tenants" the tenants sharing the
+// deployment. An empty path loads nothing
+func loadConfigFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	raw := make(map[string]any)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return fmt.Errorf("unsupported config file extension %q (want .yaml, .yml, .toml or .json)", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	var domains []DomainOverride
+	var tenants []*Tenant
+	for key, value := range raw {
+		if strings.EqualFold(key, "domains") {
+			if domains, err = parseDomainOverrides(value); err != nil {
+				return fmt.Errorf("invalid domains section in %s: %v", path, err)
+			}
+			delete(raw, key)
+		}
+		if strings.EqualFold(key, "tenants") {
+			if tenants, err = parseTenants(value); err != nil {
+				return fmt.Errorf("invalid tenants section in %s: %v", path, err)
+			}
+			delete(raw, key)
+		}
+	}
+
+	values := make(map[string]string)
+	if err := flattenSettings("", raw, values); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	fileSettings.Lock()
+	defer fileSettings.Unlock()
+	fileSettings.values = values
+	fileSettings.used = make(map[string]bool)
+	fileSettings.domains = domains
+	fileSettings.tenants = tenants
+	return nil
+}
+
+// flattenSettings turns nested sections into underscore-joined upper-case keys
+func flattenSettings(prefix string, section map[string]any, out map[string]string) error {
+	for key, value := range section {
+		name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		if nested, ok := value.(map[string]any); ok {
+			if err := flattenSettings(name, nested, out); err != nil {
+				return err
+			}
+			continue
+		}
+		s, err := settingString(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		out[name] = s
+	}
+	return nil
+}
+
+// settingString renders a decoded scalar or list the way it would be written in the environment
+func settingString(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := settingString(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// parseDomainOverrides decodes the "domains" section, a list of tables with a
+// pattern and the settings to override
+func parseDomainOverrides(value any) ([]DomainOverride, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of domain entries")
+	}
+	overrides := make([]DomainOverride, 0, len(list))
+	for i, item := range list {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("entry %d is not a table", i+1)
+		}
+		var override DomainOverride
+		for key, value := range entry {
+			if strings.EqualFold(key, "rules") {
+				rules, err := parseSelectorRules(value)
+				if err != nil {
+					return nil, fmt.Errorf("entry %d: rules: %v", i+1, err)
+				}
+				override.Rules = rules
+				continue
+			}
+			if strings.EqualFold(key, "render") {
+				render, err := parseRenderOptions(value)
+				if err != nil {
+					return nil, fmt.Errorf("entry %d: render: %v", i+1, err)
+				}
+				override.Render = render
+				continue
+			}
+			if strings.EqualFold(key, "headers") {
+				headers, err := parseHeaders(value)
+				if err != nil {
+					return nil, fmt.Errorf("entry %d: headers: %v", i+1, err)
+				}
+				override.Headers = headers
+				continue
+			}
+			s, err := settingString(value)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %s: %v", i+1, key, err)
+			}
+			switch strings.ToLower(strings.ReplaceAll(key, "-", "_")) {
+			case "pattern":
+				override.Pattern = normalizeDomain(s)
+			case "timeout":
+				if override.Timeout, err = time.ParseDuration(s); err != nil {
+					return nil, fmt.Errorf("entry %d: timeout: %v", i+1, err)
+				}
+			case "user_agent":
+				override.UserAgent = resolveUserAgent(s)
+			case "cache_ttl":
+				if override.CacheTTL, err = time.ParseDuration(s); err != nil || override.CacheTTL <= 0 {
+					return nil, fmt.Errorf("entry %d: cache_ttl: expected a positive duration, got %q", i+1, s)
+				}
+			case "render_mode":
+				override.RenderMode = strings.ToLower(strings.TrimSpace(s))
+				if override.RenderMode != RenderAuto && override.RenderMode != RenderAlways && override.RenderMode != RenderNever {
+					return nil, fmt.Errorf("entry %d: render_mode: expected auto, always or never, got %q", i+1, s)
+				}
+			default:
+				return nil, fmt.Errorf("entry %d: unknown setting %q", i+1, key)
+			}
+		}
+		if override.Pattern == "" {
+			return nil, fmt.Errorf("entry %d has no pattern", i+1)
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+// parseHeaders decodes the headers table of a domain entry
+func parseHeaders(value any) (map[string]string, error) {
+	table, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a table of header names and values")
+	}
+	headers := make(map[string]string, len(table))
+	for name, value := range table {
+		s, err := settingString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if !httpguts.ValidHeaderFieldName(name) || !httpguts.ValidHeaderFieldValue(s) {
+			return nil, fmt.Errorf("invalid header %q", name)
+		}
+		headers[http.CanonicalHeaderKey(name)] = s
+	}
+	return headers, nil
+}
+
+// setting returns the value of setting key: from the command-line flag if given,
+// else the environment variable, else the config file
+func setting(key string) string {
+	fileSettings.Lock()
+	defer fileSettings.Unlock()
+	value, inFile := fileSettings.values[key]
+	if inFile {
+		fileSettings.used[key] = true
+	}
+	if flagValue, ok := flagSettings[key]; ok {
+		return flagValue
+	}
+	if env, ok := os.LookupEnv(key); ok && strings.TrimSpace(env) != "" {
+		return env
+	}
+	return value
+}
+
+// unusedFileSettings lists config file keys that no setting read, which are usually typos
+func unusedFileSettings() []string {
+	fileSettings.Lock()
+	defer fileSettings.Unlock()
+	var unused []string
+	for key := range fileSettings.values {
+		if !fileSettings.used[key] {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// configFileDomainOverrides returns the per-domain overrides from the config file
+func configFileDomainOverrides() DomainOverrides {
+	fileSettings.Lock()
+	defer fileSettings.Unlock()
+	return fileSettings.domains
+}
+
+// configFileTenants returns the tenants from the config file
+func configFileTenants() []*Tenant {
+	fileSettings.Lock()
+	defer fileSettings.Unlock()
+	return fileSettings.tenants
+}
+
+// DomainOverrides finds the override for a target host
+type DomainOverrides []DomainOverride
+
+// Lookup returns the first override whose pattern matches host, or nil
+func (do DomainOverrides) Lookup(host string) *DomainOverride {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for i := range do {
+		if matchDomain(do[i].Pattern, host) {
+			return &do[i]
+		}
+	}
+	return nil
+}
+
+// CacheTTL returns how long previews of pages on host stay cached, or 0 for CACHE_TTL
+func (do DomainOverrides) CacheTTL(host string) time.Duration {
+	if override := do.Lookup(host); override != nil {
+		return override.CacheTTL
+	}
+	return 0
+}
+
+// setHeaders sets the extra headers of the override on header
+func (override *DomainOverride) setHeaders(header http.Header) {
+	for name, value := range override.Headers {
+		header.Set(name, value)
+	}
+}
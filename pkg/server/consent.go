@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// consentParams are the query parameters in which consent walls hosted apart
+// from the site, such as consent.google.com, keep the page they stand in for
+var consentParams = []string{"continue", "done", "redirect", "redirect_url", "redirectUrl", "returnUrl", "return_url", "dest", "destination"}
+
+// consentCookies are cookies that record consent to the walls that check
+// for them, such as those of Google and YouTube; other sites ignore them
+var consentCookies = []*http.Cookie{
+	{Name: "CONSENT", Value: "YES+cb", Path: "/"},
+	{Name: "SOCS", Value: "CAI", Path: "/"},
+}
+
+// consentHost reports whether host serves consent walls rather than pages,
+// as consent.google.com, consent.youtube.com and guce.yahoo.com do
+func consentHost(host string) bool {
+	label, _, _ := strings.Cut(strings.ToLower(host), ".")
+	return label == "consent" || label == "guce" || strings.HasPrefix(strings.ToLower(host), "myprivacy.dpgmedia.")
+}
+
+// consentBypassKey is the context key marking the fetch of a page behind a consent wall
+type consentBypassKey struct{}
+
+// consentTarget returns the page behind the consent wall result was
+// fetched from, targetURL having been requested, when it's worth fetching
+// once more: the page named by the wall's continue parameter, else
+// targetURL itself. Walls are detected by their text, or by being served
+// from a consent host after a redirect
+func (me *MetaExtractor) consentTarget(ctx context.Context, result *LinkPreviewResponse, targetURL string) (string, bool) {
+	final, err := url.Parse(result.FinalURL)
+	if err != nil {
+		return "", false
+	}
+	if consentHost(final.Hostname()) {
+		result.ConsentWall = true
+	}
+	if !me.consentBypass || !result.ConsentWall || ctx.Value(consentBypassKey{}) != nil {
+		return "", false
+	}
+	if consentHost(final.Hostname()) {
+		query := final.Query()
+		for _, param := range consentParams {
+			if page, err := url.Parse(query.Get(param)); err == nil && (page.Scheme == "http" || page.Scheme == "https") && page.Host != "" && !consentHost(page.Hostname()) {
+				return page.String(), true
+			}
+		}
+	}
+	return targetURL, true
+}
+
+// withConsentBypass returns a context whose fetch of target, a page behind
+// a consent wall, sends cookies recording consent, in a new jar. The user
+// agent stays the one configured or asked for. It is made once; a wall met
+// again is previewed as it is
+func withConsentBypass(ctx context.Context, target string) context.Context {
+	ctx = context.WithValue(ctx, consentBypassKey{}, true)
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if page, err := url.Parse(target); err == nil {
+		jar.SetCookies(page, consentCookies)
+	}
+	return context.WithValue(ctx, cookieJarKey{}, http.CookieJar(jar))
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// cookieJarKey is the context key of the cookie jar of a fetch
+type cookieJarKey struct{}
+
+// withCookieJar returns a context whose fetches keep their cookies in a new
+// jar, unless ctx already has one, as the fetch of a page a meta refresh or
+// script redirect leads to does
+func withCookieJar(ctx context.Context) context.Context {
+	if cookieJarFrom(ctx) != nil {
+		return ctx
+	}
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return context.WithValue(ctx, cookieJarKey{}, http.CookieJar(jar))
+}
+
+// cookieJarFrom returns the cookie jar of ctx, or nil
+func cookieJarFrom(ctx context.Context) http.CookieJar {
+	jar, _ := ctx.Value(cookieJarKey{}).(http.CookieJar)
+	return jar
+}
+
+// clientFor returns the extractor's client, keeping cookies in the jar of
+// ctx if it has one. Jars live as long as a fetch, so sites that set a
+// cookie and redirect, such as consent walls and geo gates, get it back
+// along the redirect chain, while no cookie outlives the fetch
+func (me *MetaExtractor) clientFor(ctx context.Context) *http.Client {
+	jar := cookieJarFrom(ctx)
+	if jar == nil {
+		return me.client
+	}
+	client := *me.client
+	client.Jar = jar
+	return &client
+}
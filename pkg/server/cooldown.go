@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrCodeRateLimited is reported in error_code when a host asked us to slow
+// down, with 429 or 503 and Retry-After, and the time it asked for isn't up
+const ErrCodeRateLimited = "ERR_RATE_LIMITED"
+
+// HostCooldowns keeps the hosts that answered 429 or 503 with a Retry-After
+// header from being fetched again before the time they asked for is up
+type HostCooldowns struct {
+	max time.Duration // Longest cooldown honored, however long a host asks for
+
+	mu    sync.Mutex
+	hosts map[string]time.Time // Host → end of its cooldown
+}
+
+// HostCooldown is a host not fetched until Until
+type HostCooldown struct {
+	Host  string    `json:"host"`
+	Until time.Time `json:"until"`
+}
+
+// NewHostCooldowns creates cooldowns honoring Retry-After up to max
+// Returns nil when max <= 0, meaning Retry-After is ignored
+func NewHostCooldowns(max time.Duration) *HostCooldowns {
+	if max <= 0 {
+		return nil
+	}
+	return &HostCooldowns{max: max, hosts: make(map[string]time.Time)}
+}
+
+// Wait returns how long host is still cooling down, or 0 when it may be fetched
+func (hc *HostCooldowns) Wait(host string) time.Duration {
+	if hc == nil {
+		return 0
+	}
+	host = strings.ToLower(host)
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	until, ok := hc.hosts[host]
+	if !ok {
+		return 0
+	}
+	wait := time.Until(until)
+	if wait <= 0 {
+		delete(hc.hosts, host)
+		return 0
+	}
+	return wait
+}
+
+// Record starts a cooldown of the host that answered resp when it is a 429
+// or 503 with Retry-After, and returns how long it lasts, or 0
+func (hc *HostCooldowns) Record(resp *http.Response) time.Duration {
+	wait := hc.requested(resp)
+	if wait <= 0 {
+		return 0
+	}
+	host := strings.ToLower(resp.Request.URL.Hostname())
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if until := time.Now().Add(wait); until.After(hc.hosts[host]) {
+		hc.hosts[host] = until
+	}
+	return wait
+}
+
+// requested returns how long resp, a 429 or 503 with Retry-After, asks us
+// to wait, up to the longest cooldown honored, or 0
+func (hc *HostCooldowns) requested(resp *http.Response) time.Duration {
+	if hc == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0
+	}
+	return min(parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()), hc.max)
+}
+
+// Active returns the hosts cooling down, by name
+func (hc *HostCooldowns) Active() []HostCooldown {
+	cooldowns := []HostCooldown{}
+	if hc == nil {
+		return cooldowns
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	now := time.Now()
+	for host, until := range hc.hosts {
+		if until.After(now) {
+			cooldowns = append(cooldowns, HostCooldown{Host: host, Until: until})
+		}
+	}
+	sort.Slice(cooldowns, func(i, j int) bool { return cooldowns[i].Host < cooldowns[j].Host })
+	return cooldowns
+}
+
+// parseRetryAfter reads a Retry-After header, either seconds or an HTTP date,
+// as a duration from now, or 0 when it is missing or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// cooldownError describes a fetch refused because host is cooling down for another wait
+func cooldownError(host string, wait time.Duration) string {
+	return fmt.Sprintf("Host %s asked us to slow down; not fetching for another %s", host, wait.Round(time.Second))
+}
+
+// retryAfterSeconds is wait as a whole number of seconds, at least 1
+func retryAfterSeconds(wait time.Duration) int {
+	return int(max(time.Second, wait+time.Second-1) / time.Second)
+}
+
+// handleCooldowns lists the hosts not fetched until the time they asked for is up
+func handleCooldowns(cooldowns *HostCooldowns) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"cooldowns": cooldowns.Active()})
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OriginList holds the CORS allowed origins, which can change on configuration
+// reload, and those of tenants, which change when tenants are edited
+type OriginList struct {
+	mu      sync.RWMutex
+	origins []string
+	tenants []string
+}
+
+// NewOriginList creates a list allowing origins; "*" allows any origin
+func NewOriginList(origins []string) *OriginList {
+	return &OriginList{origins: origins}
+}
+
+// Set replaces the allowed origins
+func (ol *OriginList) Set(origins []string) {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+	ol.origins = origins
+}
+
+// SetTenantOrigins replaces the origins allowed for tenants
+func (ol *OriginList) SetTenantOrigins(origins []string) {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+	ol.tenants = origins
+}
+
+// Allowed checks if the given origin is in the allowed list or allowed for a tenant
+func (ol *OriginList) Allowed(origin string) bool {
+	ol.mu.RLock()
+	defer ol.mu.RUnlock()
+	for _, allowed := range ol.origins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return slices.Contains(ol.tenants, origin)
+}
+
+// Wildcard reports whether the list is exactly "*"
+func (ol *OriginList) Wildcard() bool {
+	ol.mu.RLock()
+	defer ol.mu.RUnlock()
+	return len(ol.origins) == 1 && ol.origins[0] == "*"
+}
+
+// corsMiddleware adds CORS headers for the allowed origins and answers preflight requests
+func corsMiddleware(origins *OriginList) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.Request.Header.Get("Origin")
+
+		// Set CORS headers based on configuration
+		if origin != "" {
+			if origins.Allowed(origin) {
+				// Allow specific origin (required when credentials are used)
+				c.Header("Access-Control-Allow-Origin", origin)
+				c.Header("Access-Control-Allow-Credentials", "true")
+			} else if origins.Wildcard() {
+				// Only use wildcard if no specific origin is provided and wildcard is allowed
+				c.Header("Access-Control-Allow-Origin", "*")
+			}
+		} else if origins.Wildcard() {
+			// No origin header, use wildcard if configured
+			c.Header("Access-Control-Allow-Origin", "*")
+		}
+
+		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		c.Header("Access-Control-Expose-Headers", "X-Request-ID")
+
+		// Handle preflight requests
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"expvar"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+}
+
+// registerDebugRoutes mounts the pprof profiles and expvar variables on group,
+// so memory and goroutine leaks can be diagnosed in production
+func registerDebugRoutes(group *gin.RouterGroup) {
+	group.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+
+	// The index links to the profiles relative to its own path, so it works under any prefix
+	group.GET("/debug/pprof/", gin.WrapF(pprof.Index))
+	group.GET("/debug/pprof/:profile", handlePprof)
+	group.POST("/debug/pprof/symbol", gin.WrapF(pprof.Symbol))
+}
+
+// handlePprof serves a single pprof profile by name
+func handlePprof(c *gin.Context) {
+	switch name := c.Param("profile"); name {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		// Named runtime profiles: heap, goroutine, allocs, block, mutex, threadcreate
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+	}
+}
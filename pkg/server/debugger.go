@@ -0,0 +1,339 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// maxDebugHeadBytes caps the raw page shown by the debugger
+const maxDebugHeadBytes = 256 * 1024
+
+// debugCapture collects what a fetch read, for the debugger
+type debugCapture struct {
+	raw bytes.Buffer          // Page bytes read by the parser
+	doc *linkpreview.Document // What the parser found
+}
+
+type debugCaptureKey struct{}
+
+// withDebugCapture makes fetches under ctx record what they read in capture
+func withDebugCapture(ctx context.Context, capture *debugCapture) context.Context {
+	return context.WithValue(ctx, debugCaptureKey{}, capture)
+}
+
+// debugCaptureFrom returns the capture of ctx, or nil
+func debugCaptureFrom(ctx context.Context) *debugCapture {
+	capture, _ := ctx.Value(debugCaptureKey{}).(*debugCapture)
+	return capture
+}
+
+// DebugReport is the debugger's account of how a preview was built
+type DebugReport struct {
+	Preview  LinkPreviewResponse `json:"preview"`
+	Fields   []DebugField        `json:"fields"`
+	Tags     []DebugTag          `json:"tags"`              // Every <meta> and <link> of the head, by name
+	JSONLD   []string            `json:"json_ld,omitempty"` // JSON-LD blocks
+	Warnings []string            `json:"warnings"`
+	Head     string              `json:"head"` // The page as read, up to the end of its head
+}
+
+// DebugField is a preview field with the value each extractor stage found for it
+type DebugField struct {
+	Field      string           `json:"field"`
+	Value      string           `json:"value"`
+	Source     string           `json:"source,omitempty"`
+	Candidates []DebugCandidate `json:"candidates"`
+}
+
+// DebugCandidate is the value one stage found for a field
+type DebugCandidate struct {
+	Source string `json:"source"`
+	Value  string `json:"value"`
+	Won    bool   `json:"won,omitempty"`
+}
+
+// DebugTag is a <meta> tag, or a <link> as "link:" plus its rel
+type DebugTag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// debugStages are the built-in extractor stages, run one at a time to list the candidates
+var debugStages = []struct {
+	source string
+	parser linkpreview.Parser
+}{
+	{linkpreview.SourceOpenGraph, linkpreview.OpenGraph},
+	{linkpreview.SourceTwitter, linkpreview.TwitterCard},
+	{linkpreview.SourceJSONLD, linkpreview.JSONLD},
+	{linkpreview.SourceHTML, linkpreview.HTMLMeta},
+	{linkpreview.SourceHeuristic, linkpreview.Heuristics},
+}
+
+var debugFields = []string{linkpreview.FieldTitle, linkpreview.FieldDescription, linkpreview.FieldImage, linkpreview.FieldSiteName}
+
+// handleDebug serves GET /debug: the preview of the "url" query parameter,
+// fetched afresh, with the page's head, every tag found, the value each
+// extractor stage proposed for each field and what sharing it would warn
+// about. Browsers get an HTML page, other clients JSON
+func handleDebug(service *PreviewService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		html := c.Query("format") == "html" ||
+			(c.Query("format") == "" && c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML)
+		target := strings.TrimSpace(c.Query("url"))
+		if target == "" {
+			if html {
+				renderDebugPage(c, http.StatusOK, "", nil, "")
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'url' is required"})
+			return
+		}
+		if _, err := validateURL(target); err != nil {
+			if html {
+				renderDebugPage(c, http.StatusUnprocessableEntity, target, nil, "Invalid URL: "+err.Error())
+				return
+			}
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid URL: " + err.Error(), "error_code": ErrCodeInvalidURL})
+			return
+		}
+
+		report, err := service.Debug(c.Request.Context(), target)
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusRequestTimeout
+			if errors.Is(err, ErrPoolSaturated) {
+				status = http.StatusServiceUnavailable
+			}
+		}
+		if html {
+			message := ""
+			if err != nil {
+				message = err.Error()
+			}
+			renderDebugPage(c, status, target, report, message)
+			return
+		}
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// Debug fetches targetURL, bypassing the cache, and reports how its preview was built
+func (ps *PreviewService) Debug(ctx context.Context, targetURL string) (*DebugReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.handlerTimeout)
+	defer cancel()
+
+	capture := &debugCapture{}
+	resultChan := make(chan LinkPreviewResponse, 1)
+	err := ps.pool.Submit(func() {
+		ps.extractor.FetchLinkPreview(withDebugCapture(ctx, capture), targetURL, resultChan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case result := <-resultChan:
+		return newDebugReport(result, capture), nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("timed out fetching %s", targetURL)
+	}
+}
+
+// newDebugReport explains result from what its fetch captured
+func newDebugReport(result LinkPreviewResponse, capture *debugCapture) *DebugReport {
+	report := &DebugReport{Preview: result, Head: debugHead(capture.raw.Bytes())}
+	report.Preview.RawMeta = nil
+	doc := capture.doc
+	if doc == nil {
+		// The page was never parsed, e.g. it was blocked or failed to load
+		report.Warnings = []string{"The page could not be read: " + result.Error}
+		return report
+	}
+
+	candidates := make(map[string][]DebugCandidate)
+	for _, stage := range debugStages {
+		preview := linkpreview.Pipeline{stage.parser}.Apply(doc)
+		for _, field := range debugFields {
+			if value := preview.Get(field); value != "" {
+				candidates[field] = append(candidates[field], DebugCandidate{Source: stage.source, Value: value})
+			}
+		}
+	}
+	for _, field := range debugFields {
+		value, source := result.Get(field), result.Sources[field]
+		fieldCandidates := append([]DebugCandidate{}, candidates[field]...)
+		if source == sourceSelector {
+			fieldCandidates = append(fieldCandidates, DebugCandidate{Source: sourceSelector, Value: value})
+		}
+		for i := range fieldCandidates {
+			fieldCandidates[i].Won = fieldCandidates[i].Source == source && fieldCandidates[i].Value == value
+		}
+		report.Fields = append(report.Fields, DebugField{Field: field, Value: value, Source: source, Candidates: fieldCandidates})
+	}
+
+	for name, values := range doc.Meta {
+		for _, value := range values {
+			report.Tags = append(report.Tags, DebugTag{Name: name, Value: value})
+		}
+	}
+	for rel, hrefs := range doc.Links {
+		for _, href := range hrefs {
+			report.Tags = append(report.Tags, DebugTag{Name: "link:" + rel, Value: href})
+		}
+	}
+	sort.SliceStable(report.Tags, func(i, j int) bool { return report.Tags[i].Name < report.Tags[j].Name })
+	report.JSONLD = doc.JSONLD
+	report.Warnings = debugWarnings(result, doc)
+	return report
+}
+
+// debugHead returns raw cut after its </head>, and to maxDebugHeadBytes
+func debugHead(raw []byte) string {
+	if end := indexFold(raw, "</head>"); end >= 0 {
+		raw = raw[:end+len("</head>")]
+	}
+	if len(raw) > maxDebugHeadBytes {
+		raw = raw[:maxDebugHeadBytes]
+	}
+	return strings.ToValidUTF8(string(raw), "�")
+}
+
+// indexFold returns the index in raw of the first occurrence of sep, an
+// ASCII string, in any case, or -1. Lowercasing raw to search it instead
+// would shift the indexes of pages with characters whose lowercase is longer
+func indexFold(raw []byte, sep string) int {
+	for i := 0; i+len(sep) <= len(raw); i++ {
+		if bytes.EqualFold(raw[i:i+len(sep)], []byte(sep)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// debugWarnings lists what sharing the page would go wrong on, in the spirit
+// of the sharing debuggers of the big social networks
+func debugWarnings(result LinkPreviewResponse, doc *linkpreview.Document) []string {
+	warnings := []string{}
+	if result.Error != "" {
+		warnings = append(warnings, "The preview failed: "+result.Error)
+	}
+	for _, tag := range []string{"og:title", "og:description", "og:image", "og:url", "og:type"} {
+		if doc.MetaValue(tag) == "" {
+			warnings = append(warnings, fmt.Sprintf("Missing %s; platforms that read only Open Graph will fall back to guesses", tag))
+		}
+	}
+	if doc.MetaValue("twitter:card") == "" {
+		warnings = append(warnings, "Missing twitter:card; X shows a plain link without it")
+	}
+	for _, tag := range []string{"og:title", "og:description", "og:url", "og:type"} {
+		if n := len(doc.Meta[tag]); n > 1 {
+			warnings = append(warnings, fmt.Sprintf("%s is declared %d times; only the first is used", tag, n))
+		}
+	}
+	for _, tag := range []string{"og:image", "og:image:url", "og:image:secure_url", "og:url", "twitter:image"} {
+		for _, value := range doc.Meta[tag] {
+			if parsed, err := url.Parse(strings.TrimSpace(value)); err != nil || !parsed.IsAbs() {
+				warnings = append(warnings, fmt.Sprintf("%s %q is not an absolute URL; most crawlers won't resolve it", tag, value))
+			}
+		}
+	}
+	if image := doc.MetaValue("og:image"); image != "" {
+		if result.Image != image {
+			warnings = append(warnings, fmt.Sprintf("og:image %q was not used; it failed validation or a higher ranked source won", image))
+		}
+		if doc.MetaValue("og:image:width") == "" || doc.MetaValue("og:image:height") == "" {
+			warnings = append(warnings, "og:image:width and og:image:height are missing; some platforms won't show the image on the first share")
+		}
+	}
+	if result.Image == "" {
+		warnings = append(warnings, "No usable image was found; cards will be text only")
+	}
+	return warnings
+}
+
+// renderDebugPage serves the debugger's HTML page
+func renderDebugPage(c *gin.Context, status int, target string, report *DebugReport, message string) {
+	// The image is shown from its absolute URL, not relative to this service
+	image := ""
+	if report != nil && report.Preview.Image != "" {
+		image = resolveURL(report.Preview.baseURL(), report.Preview.Image)
+	}
+	var buf bytes.Buffer
+	err := debugPage.Execute(&buf, struct {
+		URL     string
+		Report  *DebugReport
+		Image   string
+		Message string
+	}{target, report, image, message})
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to render page: %v", err)
+		return
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
+
+var debugPage = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link Preview Debugger</title>
+<style>
+body { font: 15px/1.5 system-ui, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; }
+input[type=url] { width: 70%; padding: .4em; } button { padding: .4em 1em; }
+table { border-collapse: collapse; width: 100%; margin: 1em 0; } td, th { border: 1px solid #ddd; padding: .3em .5em; text-align: left; vertical-align: top; word-break: break-all; }
+.won { font-weight: bold; } .warn { color: #8a5a00; } .error { color: #b00020; }
+.card { border: 1px solid #ddd; border-radius: 8px; overflow: hidden; max-width: 500px; } .card img { width: 100%; display: block; } .card div { padding: .6em .8em; }
+pre { background: #f6f6f6; padding: 1em; overflow: auto; max-height: 30em; font-size: 13px; }
+</style>
+</head>
+<body>
+<h1>Link Preview Debugger</h1>
+<form method="get" action="">
+<input type="url" name="url" value="{{.URL}}" placeholder="https://example.com/article" required autofocus>
+<input type="hidden" name="format" value="html">
+<button type="submit">Debug</button>
+</form>
+{{with .Message}}<p class="error">{{.}}</p>{{end}}
+{{with .Report}}
+<h2>Preview</h2>
+<div class="card">
+{{with $.Image}}<img src="{{.}}" alt="">{{end}}
+<div><strong>{{.Preview.Title}}</strong><br>{{.Preview.Description}}<br><small>{{.Preview.SiteName}} · quality {{.Preview.QualityScore}}{{if .Preview.Rendered}} · rendered{{end}}</small></div>
+</div>
+<h2>Warnings</h2>
+{{if .Warnings}}<ul>{{range .Warnings}}<li class="warn">{{.}}</li>{{end}}</ul>{{else}}<p>None.</p>{{end}}
+<h2>Fields</h2>
+<table>
+<tr><th>Field</th><th>Source</th><th>Candidates</th></tr>
+{{range .Fields}}<tr><td>{{.Field}}</td><td>{{.Source}}</td><td>{{range .Candidates}}<div{{if .Won}} class="won"{{end}}>{{.Source}}: {{.Value}}</div>{{else}}none{{end}}</td></tr>
+{{end}}
+</table>
+<h2>Tags</h2>
+<table>
+{{range .Tags}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}
+</table>
+{{range .JSONLD}}<h3>JSON-LD</h3><pre>{{.}}</pre>{{end}}
+<h2>Raw head</h2>
+<pre>{{.Head}}</pre>
+{{end}}
+</body>
+</html>
+`))
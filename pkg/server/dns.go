@@ -0,0 +1,232 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/sync/singleflight"
+)
+
+// DNSResolver resolves target hostnames through the system resolver, custom DNS
+// servers or DNS-over-HTTPS, caching answers in process
+type DNSResolver struct {
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+	ttl    time.Duration // How long answers are cached; <= 0 disables caching
+
+	mu        sync.Mutex
+	entries   map[string]dnsEntry
+	group     singleflight.Group // Coalesces concurrent lookups of the same host
+	lastSweep time.Time
+}
+
+// dnsEntry is a cached lookup result
+type dnsEntry struct {
+	addrs     []net.IPAddr
+	err       error
+	expiresAt time.Time
+}
+
+// dnsNegativeTTL is how long failed lookups are cached, kept short so outages recover quickly
+const dnsNegativeTTL = 5 * time.Second
+
+// NewDNSResolver creates a resolver using dohURL when set, otherwise the given
+// DNS servers ("host" or "host:port"), otherwise the system resolver
+func NewDNSResolver(servers []string, dohURL string, ttl time.Duration) *DNSResolver {
+	r := &DNSResolver{
+		ttl:       ttl,
+		entries:   make(map[string]dnsEntry),
+		lastSweep: time.Now(),
+	}
+
+	switch {
+	case dohURL != "":
+		doh := &dohClient{endpoint: dohURL, client: &http.Client{Timeout: 5 * time.Second}}
+		r.lookup = doh.LookupIPAddr
+	case len(servers) > 0:
+		r.lookup = newServerResolver(servers).LookupIPAddr
+	default:
+		r.lookup = net.DefaultResolver.LookupIPAddr
+	}
+	return r
+}
+
+// LookupIPAddr returns the addresses of host, serving cached answers while they are fresh
+func (r *DNSResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if r.ttl <= 0 {
+		return r.lookup(ctx, host)
+	}
+
+	r.mu.Lock()
+	entry, ok := r.entries[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.addrs, entry.err
+	}
+
+	v, err, _ := r.group.Do(host, func() (interface{}, error) {
+		addrs, err := r.lookup(ctx, host)
+		// Don't cache failures caused by the caller giving up
+		if ctx.Err() != nil {
+			return addrs, err
+		}
+
+		expiresAt := time.Now().Add(r.ttl)
+		if err != nil {
+			expiresAt = time.Now().Add(dnsNegativeTTL)
+		}
+		r.mu.Lock()
+		r.sweep()
+		r.entries[host] = dnsEntry{addrs: addrs, err: err, expiresAt: expiresAt}
+		r.mu.Unlock()
+		return addrs, err
+	})
+	addrs, _ := v.([]net.IPAddr)
+	return addrs, err
+}
+
+// sweep drops expired entries once a minute
+// Callers must hold r.mu
+func (r *DNSResolver) sweep() {
+	now := time.Now()
+	if now.Sub(r.lastSweep) < time.Minute {
+		return
+	}
+	r.lastSweep = now
+	for host, entry := range r.entries {
+		if now.After(entry.expiresAt) {
+			delete(r.entries, host)
+		}
+	}
+}
+
+// newServerResolver returns a Go resolver that sends queries to the given DNS servers in turn
+func newServerResolver(servers []string) *net.Resolver {
+	addrs := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		addrs = append(addrs, server)
+	}
+
+	var mu sync.Mutex
+	next := 0
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			mu.Lock()
+			server := addrs[next%len(addrs)]
+			next++
+			mu.Unlock()
+
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// dohClient resolves hostnames with DNS-over-HTTPS (RFC 8484)
+type dohClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+// LookupIPAddr queries the A and AAAA records of host concurrently
+func (d *dohClient) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	type answer struct {
+		addrs []net.IPAddr
+		err   error
+	}
+	results := make(chan answer, 2)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		go func(qtype dnsmessage.Type) {
+			addrs, err := d.query(ctx, host, qtype)
+			results <- answer{addrs, err}
+		}(qtype)
+	}
+
+	var addrs []net.IPAddr
+	var errs []error
+	for i := 0; i < 2; i++ {
+		res := <-results
+		addrs = append(addrs, res.addrs...)
+		if res.err != nil {
+			errs = append(errs, res.err)
+		}
+	}
+	if len(addrs) == 0 {
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+// query sends a single DNS question to the DoH endpoint
+func (d *dohClient) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]net.IPAddr, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", d.endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DNS-over-HTTPS query failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS query failed: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	var reply dnsmessage.Message
+	if err := reply.Unpack(body); err != nil {
+		return nil, fmt.Errorf("invalid DNS-over-HTTPS response: %v", err)
+	}
+	if reply.RCode == dnsmessage.RCodeNameError {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	if reply.RCode != dnsmessage.RCodeSuccess {
+		return nil, &net.DNSError{Err: reply.RCode.String(), Name: host, IsTemporary: true}
+	}
+
+	var addrs []net.IPAddr
+	for _, rr := range reply.Answers {
+		switch res := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, net.IPAddr{IP: net.IP(res.A[:])})
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, net.IPAddr{IP: net.IP(res.AAAA[:])})
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DomainReport tracks fetch outcomes and latency per target domain, so operators
+// can see which sites fail most often and why
+type DomainReport struct {
+	mu      sync.Mutex
+	domains map[string]*domainRecord
+}
+
+type domainRecord struct {
+	fetches      int64
+	failures     map[string]int64 // By failureReason
+	latencyTotal time.Duration
+	latencyMax   time.Duration
+	lastFailure  time.Time
+}
+
+// DomainSummary is one domain's row in the report
+type DomainSummary struct {
+	Domain       string           `json:"domain"`
+	Fetches      int64            `json:"fetches"`
+	Failures     int64            `json:"failures"`
+	FailureRate  float64          `json:"failure_rate"`
+	Reasons      map[string]int64 `json:"reasons,omitempty"`
+	AvgLatencyMS float64          `json:"avg_latency_ms"`
+	MaxLatencyMS float64          `json:"max_latency_ms"`
+	LastFailure  *time.Time       `json:"last_failure,omitempty"`
+}
+
+// NewDomainReport creates an empty per-domain report
+func NewDomainReport() *DomainReport {
+	return &DomainReport{domains: make(map[string]*domainRecord)}
+}
+
+// Record counts one fetch of host. Domains are bounded like the metric labels,
+// so domains seen after the limit are reported together as "other"
+func (dr *DomainReport) Record(host string, elapsed time.Duration, result *LinkPreviewResponse) {
+	domain := domainLabel(host)
+	reason := failureReason(result)
+
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	rec, ok := dr.domains[domain]
+	if !ok {
+		rec = &domainRecord{failures: make(map[string]int64)}
+		dr.domains[domain] = rec
+	}
+	rec.fetches++
+	rec.latencyTotal += elapsed
+	if elapsed > rec.latencyMax {
+		rec.latencyMax = elapsed
+	}
+	if reason != "" {
+		rec.failures[reason]++
+		rec.lastFailure = time.Now().UTC()
+	}
+}
+
+// Worst returns up to limit domains ordered by failure count, then failure rate
+func (dr *DomainReport) Worst(limit int) []DomainSummary {
+	dr.mu.Lock()
+	summaries := make([]DomainSummary, 0, len(dr.domains))
+	for domain, rec := range dr.domains {
+		summary := DomainSummary{
+			Domain:       domain,
+			Fetches:      rec.fetches,
+			AvgLatencyMS: float64(rec.latencyTotal.Microseconds()) / 1000 / float64(rec.fetches),
+			MaxLatencyMS: float64(rec.latencyMax.Microseconds()) / 1000,
+		}
+		if len(rec.failures) > 0 {
+			summary.Reasons = make(map[string]int64, len(rec.failures))
+			for reason, n := range rec.failures {
+				summary.Reasons[reason] = n
+				summary.Failures += n
+			}
+			lastFailure := rec.lastFailure
+			summary.LastFailure = &lastFailure
+		}
+		summary.FailureRate = float64(summary.Failures) / float64(rec.fetches)
+		summaries = append(summaries, summary)
+	}
+	dr.mu.Unlock()
+
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		if a.FailureRate != b.FailureRate {
+			return a.FailureRate > b.FailureRate
+		}
+		return a.Domain < b.Domain
+	})
+	if len(summaries) > limit {
+		summaries = summaries[:limit]
+	}
+	return summaries
+}
+
+// failureReason classifies a failed or empty preview more finely than errorClass:
+// HTTP errors keep their status code, timeouts are separated from other fetch
+// errors, and pages that parsed but yielded no title or description count as
+// "empty" since they are candidates for a site-specific extractor
+func failureReason(result *LinkPreviewResponse) string {
+	if result.Error == "" {
+		if result.Title == "" && result.Description == "" {
+			return "empty"
+		}
+		return ""
+	}
+
+	if strings.HasPrefix(result.Error, "HTTP error: ") {
+		code, _, _ := strings.Cut(strings.TrimPrefix(result.Error, "HTTP error: "), " ")
+		if _, err := strconv.Atoi(code); err == nil {
+			return "http_" + code
+		}
+	}
+	lower := strings.ToLower(result.Error)
+	if result.ErrorCode == ErrCodeTimeout || strings.Contains(lower, "timeout") || strings.Contains(lower, "deadline exceeded") || strings.Contains(lower, "did not respond within") {
+		return "timeout"
+	}
+	if strings.HasPrefix(result.Error, "Failed to read response body") {
+		return "parse"
+	}
+	return errorClass(result)
+}
+
+// handleDomainReport lists the target domains that fail most often, with the
+// reasons and latency, so operators know where site-specific extractors would help
+func handleDomainReport(report *DomainReport) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit <= 0 {
+			limit = 20
+		}
+		c.JSON(http.StatusOK, gin.H{"domains": report.Worst(limit)})
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// maxFailureStreaks bounds how many domains' failure streaks are tracked at once
+const maxFailureStreaks = 10000
+
+// ErrorReporter sends panics and repeated extraction failures to Sentry, so
+// crashes and sites that stopped previewing are noticed without user reports
+type ErrorReporter struct {
+	hub       *sentry.Hub
+	threshold int // Consecutive failures of a domain before it is reported
+
+	mu       sync.Mutex
+	failures map[string]int // Consecutive failures by domain
+}
+
+// NewErrorReporter creates a reporter for the Sentry project at dsn, reporting a domain
+// after threshold consecutive extraction failures. Returns nil when dsn is empty
+func NewErrorReporter(dsn, environment string, threshold int) (*ErrorReporter, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: %v", err)
+	}
+	return &ErrorReporter{
+		hub:       sentry.NewHub(client, sentry.NewScope()),
+		threshold: threshold,
+		failures:  make(map[string]int),
+	}, nil
+}
+
+// CapturePanic reports a panic recovered while handling req
+func (er *ErrorReporter) CapturePanic(ctx context.Context, recovered any, req *http.Request) {
+	if er == nil {
+		return
+	}
+	hub := er.hub.Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetRequest(req)
+		if id := requestIDFrom(ctx); id != "" {
+			scope.SetTag("request_id", id)
+		}
+		hub.RecoverWithContext(ctx, recovered)
+	})
+}
+
+// RecordResult tracks the outcome of a fetch and reports the domain once it has
+// failed threshold times in a row. Policy refusals (blocked, robots.txt, open
+// circuit) are expected outcomes and neither count nor reset the streak
+func (er *ErrorReporter) RecordResult(ctx context.Context, result *LinkPreviewResponse) {
+	if er == nil || er.threshold <= 0 {
+		return
+	}
+	parsed, err := url.Parse(result.URL)
+	if err != nil || parsed.Hostname() == "" {
+		return
+	}
+	domain := parsed.Hostname()
+
+	reason := failureReason(result)
+	switch reason {
+	case "blocked", "robots", "circuit_open":
+		return
+	}
+
+	er.mu.Lock()
+	if reason == "" {
+		delete(er.failures, domain)
+		er.mu.Unlock()
+		return
+	}
+	if _, tracked := er.failures[domain]; !tracked && len(er.failures) >= maxFailureStreaks {
+		er.mu.Unlock()
+		return
+	}
+	er.failures[domain]++
+	streak := er.failures[domain]
+	if streak >= er.threshold {
+		// Start counting again so a persistently broken site is reported once per streak
+		delete(er.failures, domain)
+	}
+	er.mu.Unlock()
+
+	if streak < er.threshold {
+		return
+	}
+
+	hub := er.hub.Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("domain", domain)
+		scope.SetTag("reason", reason)
+		if result.ErrorCode != "" {
+			scope.SetTag("error_code", result.ErrorCode)
+		}
+		if id := requestIDFrom(ctx); id != "" {
+			scope.SetTag("request_id", id)
+		}
+		scope.SetContext("preview", sentry.Context{
+			"url":      result.URL,
+			"error":    result.Error,
+			"failures": streak,
+		})
+		// Group events by domain and reason rather than by the exact error text
+		scope.SetFingerprint([]string{"extraction-failure", domain, reason})
+		scope.SetLevel(sentry.LevelWarning)
+		hub.CaptureMessage(fmt.Sprintf("Previews of %s failed %d times in a row (%s)", domain, streak, reason))
+	})
+}
+
+// Flush waits up to timeout for buffered events to be sent
+func (er *ErrorReporter) Flush(timeout time.Duration) {
+	if er == nil {
+		return
+	}
+	er.hub.Flush(timeout)
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds on imports
+const (
+	importBatchSize   = 500     // Previews saved per transaction
+	maxImportLine     = 4 << 20 // Longest JSONL line, in bytes
+	maxImportErrors   = 20      // Skipped records reported back
+	exportFlushPeriod = 100     // Rows written between flushes
+)
+
+// exportColumns are the CSV columns of an export, and those an import reads
+var exportColumns = []string{"id", "url", "fetched_at", "title", "description", "image", "site_name", "error", "error_code", "data"}
+
+// ImportResult reports how an import went
+type ImportResult struct {
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Errors   []string `json:"errors,omitempty"` // Why the first maxImportErrors records were skipped
+}
+
+// handleExport streams the stored previews matching the "host", "since" and
+// "until" (RFC 3339) and "successful" query parameters as JSON Lines, or as
+// CSV with format=csv
+func handleExport(store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := PreviewFilter{Host: c.Query("host"), SuccessfulOnly: c.Query("successful") == "true"}
+		for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+			if raw := c.Query(name); raw != "" {
+				parsed, err := time.Parse(time.RFC3339, raw)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Query parameter '%s' must be an RFC 3339 time", name)})
+					return
+				}
+				*t = parsed
+			}
+		}
+		format := c.DefaultQuery("format", "jsonl")
+		if format != "jsonl" && format != "csv" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'format' must be jsonl or csv"})
+			return
+		}
+
+		// Headers go out with the first row, so a failure before it can still be reported
+		var csvWriter *csv.Writer
+		encoder := json.NewEncoder(c.Writer)
+		started := false
+		start := func() {
+			if started {
+				return
+			}
+			started = true
+			contentType := "application/jsonl"
+			if format == "csv" {
+				contentType = "text/csv; charset=utf-8"
+			}
+			c.Header("Content-Type", contentType)
+			c.Header("Content-Disposition", `attachment; filename="previews.`+format+`"`)
+			c.Status(http.StatusOK)
+			if format == "csv" {
+				csvWriter = csv.NewWriter(c.Writer)
+				csvWriter.Write(exportColumns)
+			}
+		}
+		flush := func() error {
+			if csvWriter != nil {
+				csvWriter.Flush()
+				if err := csvWriter.Error(); err != nil {
+					return err
+				}
+			}
+			c.Writer.Flush()
+			return nil
+		}
+
+		rows := 0
+		err := store.Export(c.Request.Context(), filter, func(p *StoredPreview) error {
+			start()
+			if csvWriter == nil {
+				if err := encoder.Encode(p); err != nil {
+					return err
+				}
+			} else {
+				data, err := json.Marshal(p.Preview)
+				if err != nil {
+					return err
+				}
+				err = csvWriter.Write([]string{strconv.FormatInt(p.ID, 10), p.URL, p.FetchedAt.UTC().Format(time.RFC3339Nano),
+					p.Preview.Title, p.Preview.Description, p.Preview.Image, p.Preview.SiteName,
+					p.Preview.Error, p.Preview.ErrorCode, string(data)})
+				if err != nil {
+					return err
+				}
+			}
+			if rows++; rows%exportFlushPeriod == 0 {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil && !started {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Export failed: " + err.Error()})
+			return
+		}
+		if err != nil {
+			// The status is already sent; all that's left is to log the export was cut short
+			slog.WarnContext(c.Request.Context(), "Export cut short", "rows", rows, "error", err)
+			return
+		}
+		start()
+		flush()
+	}
+}
+
+// handleImport stores previews from the request body, as JSON Lines in the
+// format of an export, or as CSV with a header row naming at least the "url"
+// column. A CSV "data" column holds the whole preview as JSON; without it,
+// the preview is built from the "title", "description", "image" and
+// "site_name" columns. Previews without fetched_at are dated now. Invalid
+// records are skipped and reported
+func handleImport(store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.Query("format")
+		if format == "" {
+			format = "jsonl"
+			if strings.HasPrefix(c.ContentType(), "text/csv") {
+				format = "csv"
+			}
+		}
+		var next func() (*StoredPreview, error)
+		switch format {
+		case "jsonl":
+			next = jsonlImporter(c.Request.Body)
+		case "csv":
+			var err error
+			if next, err = csvImporter(c.Request.Body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV: " + err.Error()})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'format' must be jsonl or csv"})
+			return
+		}
+
+		result := ImportResult{}
+		batch := make([]StoredPreview, 0, importBatchSize)
+		save := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if err := store.Save(c.Request.Context(), batch); err != nil {
+				return err
+			}
+			result.Imported += len(batch)
+			batch = batch[:0]
+			return nil
+		}
+		for record := 1; ; record++ {
+			preview, err := next()
+			if err == io.EOF {
+				break
+			}
+			var recordErr *importRecordError
+			if errors.As(err, &recordErr) {
+				result.Skipped++
+				if len(result.Errors) < maxImportErrors {
+					result.Errors = append(result.Errors, fmt.Sprintf("record %d: %v", record, recordErr.err))
+				}
+				continue
+			}
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Reading record %d: %v", record, err), "imported": result.Imported})
+				return
+			}
+			batch = append(batch, *preview)
+			if len(batch) == importBatchSize {
+				if err := save(); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Import failed: " + err.Error(), "imported": result.Imported})
+					return
+				}
+			}
+		}
+		if err := save(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Import failed: " + err.Error(), "imported": result.Imported})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// importRecordError is why a record of an import is skipped
+type importRecordError struct {
+	err error
+}
+
+func (e *importRecordError) Error() string { return e.err.Error() }
+
+// jsonlImporter reads stored previews, one JSON object per line
+func jsonlImporter(body io.Reader) func() (*StoredPreview, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), maxImportLine)
+	return func() (*StoredPreview, error) {
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			var preview StoredPreview
+			if err := json.Unmarshal([]byte(line), &preview); err != nil {
+				return nil, &importRecordError{err}
+			}
+			return importedPreview(&preview)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+// csvImporter reads stored previews from CSV records, after the header
+func csvImporter(body io.Reader) (func() (*StoredPreview, error), error) {
+	r := csv.NewReader(bufio.NewReaderSize(body, 64<<10))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("no url column")
+	}
+	return func() (*StoredPreview, error) {
+		record, err := r.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, &importRecordError{err}
+			}
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		var preview StoredPreview
+		preview.URL = field("url")
+		if raw := field("fetched_at"); raw != "" {
+			if preview.FetchedAt, err = time.Parse(time.RFC3339, raw); err != nil {
+				return nil, &importRecordError{fmt.Errorf("invalid fetched_at: %v", err)}
+			}
+		}
+		if data := field("data"); data != "" {
+			if err := json.Unmarshal([]byte(data), &preview.Preview); err != nil {
+				return nil, &importRecordError{fmt.Errorf("invalid data: %v", err)}
+			}
+		} else {
+			preview.Preview.Title = field("title")
+			preview.Preview.Description = field("description")
+			preview.Preview.Image = field("image")
+			preview.Preview.SiteName = field("site_name")
+			preview.Preview.Error = field("error")
+			preview.Preview.ErrorCode = field("error_code")
+		}
+		return importedPreview(&preview)
+	}, nil
+}
+
+// importedPreview checks and completes a preview read by an importer
+func importedPreview(preview *StoredPreview) (*StoredPreview, error) {
+	if strings.TrimSpace(preview.URL) == "" {
+		return nil, &importRecordError{errors.New("no url")}
+	}
+	preview.URL = normalizeURL(preview.URL)
+	if preview.Preview.URL == "" {
+		preview.Preview.URL = preview.URL
+	}
+	if preview.FetchedAt.IsZero() {
+		preview.FetchedAt = time.Now()
+	}
+	return preview, nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+
+	"golang.org/x/net/html"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// readMetadata streams at most MAX_BODY_BYTES of body into the parser and fills
+// result with the extracted metadata. It returns the document read and the
+// number of bytes read
+func (me *MetaExtractor) readMetadata(ctx context.Context, body io.Reader, result *LinkPreviewResponse) (*linkpreview.Document, int64, error) {
+	capture := debugCaptureFrom(ctx)
+	if capture != nil {
+		capture.raw.Reset()
+		body = io.TeeReader(body, &capture.raw)
+	}
+	counter := &countingReader{r: body}
+	var doc *linkpreview.Document
+	var err error
+	// Relative URLs resolve against the page fetched, but url stays the one requested
+	requested, base := result.URL, result.baseURL()
+	if rules := me.selectorRules(base); len(rules) > 0 {
+		doc, err = me.readWithRules(counter, rules, base, result)
+	} else {
+		doc, err = linkpreview.ReadDocumentLimited(counter, me.maxBody)
+		doc.URL = base
+		result.Preview = *linkpreview.DefaultParsers().ApplyOrder(doc, me.order)
+	}
+	result.URL = requested
+	if capture != nil {
+		capture.doc = doc
+	}
+	return doc, counter.n, err
+}
+
+// selectorRules returns the config file's selector rules for the domain of pageURL
+func (me *MetaExtractor) selectorRules(pageURL string) []SelectorRule {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	if override := me.overrides.Lookup(parsed.Hostname()); override != nil {
+		return override.Rules
+	}
+	return nil
+}
+
+// readWithRules parses the whole page at pageURL, not just its head, since selector
+// rules usually target the body, then lets the rules override the extracted fields
+func (me *MetaExtractor) readWithRules(counter *countingReader, rules []SelectorRule, pageURL string, result *LinkPreviewResponse) (*linkpreview.Document, error) {
+	data, err := io.ReadAll(io.LimitReader(counter, me.maxBody))
+	doc, parseErr := linkpreview.ReadDocumentLimited(bytes.NewReader(data), me.maxBody)
+	doc.URL = pageURL
+	preview := linkpreview.DefaultParsers().ApplyOrder(doc, me.order)
+	if page, perr := html.Parse(bytes.NewReader(data)); perr == nil {
+		applySelectorRules(rules, page, preview)
+		preview.QualityScore = preview.Score()
+	}
+	result.Preview = *preview
+	if err == nil {
+		err = parseErr
+	}
+	return doc, err
+}
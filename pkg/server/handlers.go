@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// The API endpoints are plain net/http handlers, so they can be mounted in any
+// router (chi, echo, the standard library's ServeMux). The Gin routes wrap them
+// with ginHandler, which passes along what the middleware learned about the request
+
+// RequestInfo describes a request to the handlers. Routers set it with
+// WithRequestInfo; without one, handlers fall back to the request itself
+// (X-Request-ID header, remote address). The preview handler fills in Domain
+// and Outcome for request logging
+type RequestInfo struct {
+	ID       string // Request ID echoed in error bodies
+	ClientIP string
+	APIKey   string // Authenticated API key, if any
+	Subject  string // Authenticated JWT subject, if any
+	Tenant   string // Tenant of the API key, if any
+
+	Domain  string // Target domain of a preview request
+	Outcome string // Preview outcome: success, error, timeout or rejected
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo attaches info to ctx for the handlers
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// requestInfo returns the RequestInfo of r, building one from the request when the router set none
+func requestInfo(r *http.Request) *RequestInfo {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*RequestInfo); ok {
+		return info
+	}
+	info := &RequestInfo{ID: requestIDFrom(r.Context())}
+	if info.ID == "" && validRequestID(r.Header.Get(RequestIDHeader)) {
+		info.ID = r.Header.Get(RequestIDHeader)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		info.ClientIP = host
+	}
+	return info
+}
+
+// ginHandler adapts a net/http handler to Gin, passing the request ID, client IP
+// and credentials established by the middleware, and returning the preview
+// domain and outcome to the request loggers
+func ginHandler(h http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info := &RequestInfo{
+			ID:       c.GetString("request_id"),
+			ClientIP: c.ClientIP(),
+			APIKey:   c.GetString("api_key"),
+			Subject:  c.GetString("jwt_subject"),
+			Tenant:   c.GetString("tenant"),
+		}
+		h.ServeHTTP(c.Writer, c.Request.WithContext(WithRequestInfo(c.Request.Context(), info)))
+		if info.Domain != "" {
+			c.Set("preview_domain", info.Domain)
+		}
+		if info.Outcome != "" {
+			c.Set("preview_outcome", info.Outcome)
+		}
+	}
+}
+
+// writeJSON writes v as the JSON response body with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writeOverloaded responds with 503 and a Retry-After header
+func writeOverloaded(w http.ResponseWriter, requestID, message string, retryAfter time.Duration) {
+	seconds := int(math.Max(1, math.Ceil(retryAfter.Seconds())))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeJSON(w, http.StatusServiceUnavailable, map[string]any{
+		"error":       message,
+		"retry_after": seconds,
+		"request_id":  requestID,
+	})
+}
+
+// PreviewHandler serves POST /preview: it fetches the preview of the URL in the
+// JSON body. signer, audit and stats are optional
+func PreviewHandler(service *PreviewService, signer *URLSigner, audit *AuditLogger, stats *ServiceStats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := requestInfo(r)
+
+		// Parse JSON request body
+		var req LinkPreviewRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err == nil && req.URL == "" {
+			err = errors.New("url is required")
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"error":      "Invalid request format. Expected JSON with 'url' field.",
+				"details":    err.Error(),
+				"request_id": info.ID,
+			})
+			return
+		}
+
+		// Validate that URL is not empty
+		if strings.TrimSpace(req.URL) == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"error":      "URL cannot be empty",
+				"request_id": info.ID,
+			})
+			return
+		}
+
+		// Refuse URLs that can't be previewed before anything is fetched
+		if _, err := validateURL(strings.TrimSpace(req.URL)); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+				"error":      "Invalid URL: " + err.Error(),
+				"error_code": ErrCodeInvalidURL,
+				"request_id": info.ID,
+			})
+			return
+		}
+		profile := strings.ToLower(strings.TrimSpace(req.UserAgent))
+		if _, ok := linkpreview.UserAgents[profile]; profile != "" && !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"error":      "Unknown user_agent profile " + req.UserAgent + "; known profiles are " + userAgentProfiles(),
+				"request_id": info.ID,
+			})
+			return
+		}
+
+		language, err := normalizeAcceptLanguage(req.AcceptLanguage)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"error":      "Invalid accept_language: " + err.Error(),
+				"request_id": info.ID,
+			})
+			return
+		}
+
+		// Create context with timeout for the goroutine
+		// This ensures that long-running requests don't hang indefinitely
+		ctx, cancel := context.WithTimeout(r.Context(), service.handlerTimeout)
+		defer cancel()
+		if profile != "" {
+			ctx = WithUserAgentProfile(ctx, profile)
+		}
+		if language != "" {
+			ctx = WithAcceptLanguage(ctx, language)
+		}
+
+		result, cached, err := service.Preview(ctx, strings.TrimSpace(req.URL))
+
+		// Record who requested which URL and what happened
+		record := AuditRecord{
+			Time:         start.UTC(),
+			RequestID:    info.ID,
+			ClientIP:     info.ClientIP,
+			APIKey:       keyFingerprint(info.APIKey),
+			Subject:      info.Subject,
+			Tenant:       info.Tenant,
+			URL:          strings.TrimSpace(req.URL),
+			Outcome:      "success",
+			Error:        result.Error,
+			ErrorCode:    result.ErrorCode,
+			CacheHit:     cached,
+			BytesFetched: result.BytesFetched,
+			DurationMS:   time.Since(start).Milliseconds(),
+		}
+		switch {
+		case errors.Is(err, ErrPoolSaturated):
+			record.Outcome = "rejected"
+		case err != nil:
+			record.Outcome = "timeout"
+		case result.Error != "":
+			record.Outcome = "error"
+		}
+		if cached {
+			record.BytesFetched = 0
+		}
+		audit.Log(record)
+		service.usage.Record(record.APIKey, record.Tenant, record.Outcome, cached, record.BytesFetched)
+
+		// Surface the target and outcome in the request log line
+		if parsed, perr := url.Parse(record.URL); perr == nil {
+			info.Domain = parsed.Hostname()
+		}
+		info.Outcome = record.Outcome
+		stats.Record(info.Domain, record.Outcome, cached, time.Since(start))
+		if record.Outcome != "success" {
+			failure := RecentError{Time: record.Time, RequestID: info.ID, URL: record.URL, Outcome: record.Outcome, Error: record.Error, ErrorCode: record.ErrorCode}
+			if err != nil {
+				failure.Error = err.Error()
+			}
+			stats.RecordError(failure)
+		}
+
+		if errors.Is(err, ErrPoolSaturated) {
+			// Every worker is busy; ask the client to back off instead of queueing unboundedly
+			writeOverloaded(w, info.ID, "Server is busy fetching other previews. Please retry shortly.", time.Second)
+			return
+		}
+		if err != nil {
+			// Request timed out or was cancelled
+			status := http.StatusRequestTimeout
+			if service.errorStatuses {
+				status = http.StatusGatewayTimeout
+			}
+			writeJSON(w, status, map[string]any{
+				"error":      "Request timed out while fetching link preview",
+				"error_code": ErrCodeTimeout,
+				"url":        req.URL,
+				"request_id": info.ID,
+			})
+			return
+		}
+
+		if cached {
+			w.Header().Set("X-Cache", "HIT")
+		} else {
+			w.Header().Set("X-Cache", "MISS")
+		}
+
+		// Signed proxy and card URLs are added per response rather than cached with the preview
+		if result.Error == "" && result.Image == "" && service.fallbackCards {
+			result.Image = fallbackCardURL(signer, &result)
+			result.ImageGenerated = result.Image != ""
+		}
+		// Pages often name their image relative to themselves, as in "/img/og.png"
+		image := result.Image
+		if image != "" && !result.ImageGenerated {
+			image = resolveURL(result.baseURL(), image)
+		}
+		result.ImageProxy = signedImageURL(signer, image)
+		if req.ThumbnailWidth > 0 || req.ThumbnailHeight > 0 {
+			result.Thumbnail = signedThumbnailURL(signer, image, req.ThumbnailWidth, req.ThumbnailHeight)
+		}
+		if !req.RawMeta {
+			result.RawMeta = nil
+		}
+
+		status := http.StatusOK
+		if result.Error != "" {
+			// Failed previews are answered with 200, as the request itself was
+			// processed, unless ERROR_STATUS_CODES asks for a status matching the error
+			result.RequestID = info.ID
+			if service.errorStatuses {
+				status = errorStatus(&result)
+				if result.RetryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(result.RetryAfter))
+				}
+			}
+		} else {
+			// Return successful preview data
+			w.Header().Set("Cache-Control", "public, max-age=3600, s-maxage=3600, stale-while-revalidate=86400")
+		}
+		writeJSON(w, status, result)
+	})
+}
+
+// errorStatus is the HTTP status answering a failed preview with ERROR_STATUS_CODES
+func errorStatus(result *LinkPreviewResponse) int {
+	switch result.ErrorCode {
+	case ErrCodeInvalidURL, ErrCodeNotHTML:
+		return http.StatusUnprocessableEntity
+	case ErrCodeNotFound:
+		return http.StatusNotFound
+	case ErrCodeDNS:
+		// Hosts that don't exist, as opposed to resolvers that failed
+		if !result.Retryable {
+			return http.StatusNotFound
+		}
+		return http.StatusBadGateway
+	case ErrCodeBlocked, ErrCodeSSRFBlocked, ErrCodeRobotsDisallowed:
+		return http.StatusForbidden
+	case ErrCodeTimeout:
+		return http.StatusGatewayTimeout
+	case ErrCodeCircuitOpen, ErrCodeRateLimited:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// HealthHandler serves GET /health
+func HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":    "healthy",
+			"service":   "link-preview-api",
+			"timestamp": time.Now().UTC(),
+		})
+	})
+}
+
+// StatsHandler serves GET /stats: uptime, preview outcomes, latency and the most requested domains
+func StatsHandler(stats *ServiceStats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, stats.Snapshot(10))
+	})
+}
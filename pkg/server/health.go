@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout bounds how long all readiness checks may take together
+const readinessTimeout = 3 * time.Second
+
+// readinessCheck is one dependency verified by /readyz
+// check returns nil when the dependency is usable
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of one readiness check
+type CheckResult struct {
+	Status string `json:"status"` // "ok" or "error"
+	Error  string `json:"error,omitempty"`
+}
+
+// LivenessHandler serves GET /healthz: it reports that the process is up and serving
+// requests and checks nothing else, so a dependency outage never gets the pod restarted
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+	})
+}
+
+// ReadinessHandler serves GET /readyz: it runs every readiness check and answers 503
+// if any fails, so traffic is only routed to instances that can actually fetch previews
+func ReadinessHandler(service *PreviewService, config *Config) http.Handler {
+	checks := []readinessCheck{
+		{name: "cache", check: func(context.Context) error {
+			// The cache is in process; reading its stats confirms it isn't wedged
+			service.cache.Stats(0)
+			return nil
+		}},
+	}
+	if service.store != nil {
+		checks = append(checks, readinessCheck{name: "store", check: service.store.Ping})
+	}
+	if config.ReadinessDNSHost != "" {
+		checks = append(checks, readinessCheck{name: "dns", check: func(ctx context.Context) error {
+			_, err := service.extractor.guard.resolver.LookupIPAddr(ctx, config.ReadinessDNSHost)
+			return err
+		}})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		ready := true
+		results := make(map[string]CheckResult, len(checks))
+		for _, rc := range checks {
+			if err := rc.check(ctx); err != nil {
+				ready = false
+				results[rc.name] = CheckResult{Status: "error", Error: err.Error()}
+			} else {
+				results[rc.name] = CheckResult{Status: "ok"}
+			}
+		}
+
+		status, code := "ready", http.StatusOK
+		if !ready {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, map[string]any{"status": status, "checks": results})
+	})
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds on history queries
+const (
+	defaultHistoryVersions = 20
+	maxHistoryVersions     = 100
+	historyScanLimit       = 1000 // Stored previews read to find the versions
+	maxDiffTokens          = 400  // Longer texts are diffed as a whole
+)
+
+// PreviewHistory is how a URL's preview changed over time
+type PreviewHistory struct {
+	URL      string           `json:"url"`
+	Versions []PreviewVersion `json:"versions"` // Most recent first
+}
+
+// PreviewVersion is a preview that stayed the same over one or more fetches
+type PreviewVersion struct {
+	FirstSeen   time.Time     `json:"first_seen"`
+	LastSeen    time.Time     `json:"last_seen"`
+	Fetches     int           `json:"fetches"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Image       string        `json:"image"`
+	SiteName    string        `json:"site_name"`
+	Changes     []FieldChange `json:"changes,omitempty"` // What differs from the version before
+}
+
+// FieldChange is a preview field that changed between two versions
+type FieldChange struct {
+	Field string        `json:"field"`
+	Old   string        `json:"old"`
+	New   string        `json:"new"`
+	Diff  []DiffSegment `json:"diff,omitempty"` // Word by word, for text fields
+}
+
+// DiffSegment is a run of text kept, removed or added between two versions
+type DiffSegment struct {
+	Op   string `json:"op"` // "equal", "delete" or "insert"
+	Text string `json:"text"`
+}
+
+// handleHistory serves the versions of the preview of the "url" query
+// parameter as JSON, or as an HTML diff view for browsers and format=html
+func handleHistory(service *PreviewService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		html := c.Query("format") == "html" ||
+			(c.Query("format") == "" && c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML)
+		target := strings.TrimSpace(c.Query("url"))
+		if target == "" {
+			if html {
+				renderHistoryPage(c, http.StatusOK, "", nil, "")
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'url' is required"})
+			return
+		}
+		limit := defaultHistoryVersions
+		if raw := c.Query("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > maxHistoryVersions {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'limit' must be between 1 and " + strconv.Itoa(maxHistoryVersions)})
+				return
+			}
+			limit = n
+		}
+
+		history, err := service.History(c.Request.Context(), target, limit)
+		status, message := http.StatusOK, ""
+		switch {
+		case err != nil:
+			status, message = http.StatusInternalServerError, "Failed to read history: "+err.Error()
+		case len(history.Versions) == 0:
+			status, message = http.StatusNotFound, "No preview of this URL has been recorded"
+		}
+		if html {
+			renderHistoryPage(c, status, target, history, message)
+			return
+		}
+		if message != "" {
+			c.JSON(status, gin.H{"error": message})
+			return
+		}
+		c.JSON(http.StatusOK, history)
+	}
+}
+
+// History returns up to limit versions of the preview of targetURL from the
+// store, most recent first, each with its changes from the one before
+func (ps *PreviewService) History(ctx context.Context, targetURL string, limit int) (*PreviewHistory, error) {
+	ctx, span := tracer.Start(ctx, "store.history")
+	defer span.End()
+
+	key := normalizeURL(targetURL)
+	stored, err := ps.store.History(ctx, key, historyScanLimit)
+	if err != nil {
+		return nil, err
+	}
+	history := &PreviewHistory{URL: key, Versions: []PreviewVersion{}}
+	// Walk from the oldest fetch, starting a version whenever a field changes
+	var versions []PreviewVersion
+	for i := len(stored) - 1; i >= 0; i-- {
+		p := stored[i].Preview
+		if n := len(versions); n > 0 && sameVersion(versions[n-1], p) {
+			versions[n-1].LastSeen = stored[i].FetchedAt
+			versions[n-1].Fetches++
+			continue
+		}
+		version := newPreviewVersion(p, stored[i].FetchedAt)
+		if n := len(versions); n > 0 {
+			version.Changes = versionChanges(versions[n-1], version)
+		}
+		versions = append(versions, version)
+	}
+	for i := len(versions) - 1; i >= 0 && len(history.Versions) < limit; i-- {
+		history.Versions = append(history.Versions, versions[i])
+	}
+	return history, nil
+}
+
+// newPreviewVersion starts a version with the fields of p, fetched at
+func newPreviewVersion(p LinkPreviewResponse, at time.Time) PreviewVersion {
+	return PreviewVersion{
+		FirstSeen:   at,
+		LastSeen:    at,
+		Fetches:     1,
+		Title:       p.Title,
+		Description: p.Description,
+		Image:       p.Image,
+		SiteName:    p.SiteName,
+	}
+}
+
+// sameVersion reports whether p has the fields of version
+func sameVersion(version PreviewVersion, p LinkPreviewResponse) bool {
+	return version.Title == p.Title && version.Description == p.Description &&
+		version.Image == p.Image && version.SiteName == p.SiteName
+}
+
+// versionChanges lists the fields that differ from before to after
+func versionChanges(before, after PreviewVersion) []FieldChange {
+	var changes []FieldChange
+	add := func(field, from, to string, text bool) {
+		if from == to {
+			return
+		}
+		change := FieldChange{Field: field, Old: from, New: to}
+		if text {
+			change.Diff = diffWords(from, to)
+		}
+		changes = append(changes, change)
+	}
+	add("title", before.Title, after.Title, true)
+	add("description", before.Description, after.Description, true)
+	add("image", before.Image, after.Image, false)
+	add("site_name", before.SiteName, after.SiteName, true)
+	return changes
+}
+
+// diffTokens splits text into words and the whitespace between them
+var diffTokens = regexp.MustCompile(`\s+|\S+`)
+
+// diffWords diffs from and to word by word, from their longest common subsequence
+func diffWords(from, to string) []DiffSegment {
+	a, b := diffTokens.FindAllString(from, -1), diffTokens.FindAllString(to, -1)
+	if len(a) > maxDiffTokens || len(b) > maxDiffTokens {
+		return appendSegment(appendSegment(nil, "delete", from), "insert", to)
+	}
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var segments []DiffSegment
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			segments = appendSegment(segments, "equal", a[i])
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			segments = appendSegment(segments, "delete", a[i])
+			i++
+		default:
+			segments = appendSegment(segments, "insert", b[j])
+			j++
+		}
+	}
+	return segments
+}
+
+// appendSegment adds text to segments, merging it into the last one when it has the same op
+func appendSegment(segments []DiffSegment, op, text string) []DiffSegment {
+	if text == "" {
+		return segments
+	}
+	if n := len(segments); n > 0 && segments[n-1].Op == op {
+		segments[n-1].Text += text
+		return segments
+	}
+	return append(segments, DiffSegment{Op: op, Text: text})
+}
+
+// renderHistoryPage writes the HTML diff view of history, with a form to look up a URL
+func renderHistoryPage(c *gin.Context, status int, target string, history *PreviewHistory, message string) {
+	var buf bytes.Buffer
+	err := historyPage.Execute(&buf, struct {
+		URL     string
+		History *PreviewHistory
+		Message string
+	}{target, history, message})
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to render page: %v", err)
+		return
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
+
+var historyPage = template.Must(template.New("history").Funcs(template.FuncMap{
+	"image": func(pageURL, image string) string { return resolveURL(pageURL, image) },
+	"when":  func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link Preview History</title>
+<style>
+body { font: 15px/1.5 system-ui, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; }
+input[type=url] { width: 70%; padding: .4em; } button { padding: .4em 1em; }
+table { border-collapse: collapse; width: 100%; margin: .5em 0 1.5em; } td, th { border: 1px solid #ddd; padding: .3em .5em; text-align: left; vertical-align: top; word-break: break-word; }
+del { background: #fdd; color: #900; } ins { background: #dfd; color: #060; text-decoration: none; }
+.error { color: #b00020; } .muted { color: #777; } img { max-width: 240px; display: block; }
+</style>
+</head>
+<body>
+<h1>Link Preview History</h1>
+<form method="get" action="">
+<input type="url" name="url" value="{{.URL}}" placeholder="https://example.com/article" required autofocus>
+<input type="hidden" name="format" value="html">
+<button type="submit">Show history</button>
+</form>
+{{with .Message}}<p class="error">{{.}}</p>{{end}}
+{{with .History}}{{$url := .URL}}
+{{range .Versions}}
+<h2>{{when .FirstSeen}}{{if gt .Fetches 1}} – {{when .LastSeen}}{{end}}</h2>
+<p class="muted">Seen in {{.Fetches}} fetch{{if ne .Fetches 1}}es{{end}}</p>
+{{if .Changes}}<table>
+<tr><th>Field</th><th>Change</th></tr>
+{{range .Changes}}<tr><td>{{.Field}}</td><td>{{if .Diff}}{{range .Diff}}{{if eq .Op "delete"}}<del>{{.Text}}</del>{{else if eq .Op "insert"}}<ins>{{.Text}}</ins>{{else}}{{.Text}}{{end}}{{end}}{{else if eq .Field "image"}}{{with .Old}}<del>{{.}}</del><img src="{{image $url .}}" alt="">{{end}}{{with .New}}<ins>{{.}}</ins><img src="{{image $url .}}" alt="">{{end}}{{else}}<del>{{.Old}}</del> <ins>{{.New}}</ins>{{end}}</td></tr>
+{{end}}
+</table>{{else}}<table>
+<tr><td>title</td><td>{{.Title}}</td></tr>
+<tr><td>description</td><td>{{.Description}}</td></tr>
+<tr><td>image</td><td>{{with .Image}}{{.}}<img src="{{image $url .}}" alt="">{{end}}</td></tr>
+<tr><td>site_name</td><td>{{.SiteName}}</td></tr>
+</table>{{end}}
+{{end}}
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// asciiHost returns host, a hostname or host:port, with an internationalized
+// domain name converted to punycode and lowercased, e.g. "Bücher.example"
+// becomes "xn--bcher-kva.example". IP literals, and names IDNA rejects, are
+// only lowercased
+func asciiHost(host string) string {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, ""
+	}
+	if strings.HasPrefix(name, "[") || net.ParseIP(name) != nil {
+		return strings.ToLower(host)
+	}
+	ascii, err := idna.Lookup.ToASCII(name)
+	if err != nil {
+		ascii = name
+	}
+	ascii = strings.ToLower(ascii)
+	if port != "" {
+		return net.JoinHostPort(ascii, port)
+	}
+	return ascii
+}
+
+// normalizeDomain lowercases a domain pattern such as "*.example.com" and
+// converts it to punycode, so patterns written in unicode match the hosts
+// fetched
+func normalizeDomain(pattern string) string {
+	pattern = strings.TrimSuffix(strings.TrimSpace(pattern), ".")
+	if name, ok := strings.CutPrefix(pattern, "*."); ok {
+		return "*." + asciiHost(name)
+	}
+	return asciiHost(pattern)
+}
+
+// normalizeEscapes rewrites the escaped path or query s in the form RFC 3986
+// calls normalized: unreserved characters unescaped, other escapes in upper
+// case, and bytes that must be escaped, such as spaces and UTF-8, escaped.
+// URLs differing only in how they are escaped then share a cache key
+func normalizeEscapes(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if unreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(hex[decoded>>4])
+				b.WriteByte(hex[decoded&15])
+			}
+			i += 2
+		case c <= ' ' || c >= 0x7f || c == '"' || c == '<' || c == '>' || c == '\\' || c == '^' || c == '`' || c == '{' || c == '|' || c == '}':
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unreserved reports whether c may appear unescaped anywhere in a URL
+func unreserved(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
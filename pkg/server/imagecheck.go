@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// ImageValidator checks that preview images exist, are images and are under a
+// size cap before they are returned, so broken og:image URLs don't end up as
+// broken cards. Each image is checked with a HEAD request, or the first bytes
+// of a ranged GET when the origin doesn't answer HEAD usefully, through the
+// extractor's client so the SSRF and domain checks apply
+type ImageValidator struct {
+	extractor *MetaExtractor
+	maxBytes  int64         // Images larger than this are rejected; 0 means no limit
+	timeout   time.Duration // Budget for checking all the candidates of one preview
+}
+
+// errImageNotFound is returned for images the origin says don't exist, which
+// aren't worth retrying with a GET
+var errImageNotFound = errors.New("image not found")
+
+// imageSniffBytes is how much of an image a ranged GET asks for
+const imageSniffBytes = 512
+
+// imageCandidates are the meta tags a preview image can come from, in the
+// order they are tried when the chosen image is broken
+var imageCandidates = []struct{ key, source string }{
+	{"og:image", linkpreview.SourceOpenGraph},
+	{"og:image:url", linkpreview.SourceOpenGraph},
+	{"og:image:secure_url", linkpreview.SourceOpenGraph},
+	{"twitter:image", linkpreview.SourceTwitter},
+	{"twitter:image:src", linkpreview.SourceTwitter},
+	{"link:image_src", linkpreview.SourceHTML},
+}
+
+// NewImageValidator creates a validator rejecting images over maxBytes, or
+// returns nil when validation is disabled
+func NewImageValidator(enabled bool, maxBytes int64, timeout time.Duration, extractor *MetaExtractor) *ImageValidator {
+	if !enabled {
+		return nil
+	}
+	return &ImageValidator{extractor: extractor, maxBytes: maxBytes, timeout: timeout}
+}
+
+// Validate checks the image of result. A broken image is replaced by the next
+// image the page declares that passes the check, or dropped if none does
+func (iv *ImageValidator) Validate(ctx context.Context, result *LinkPreviewResponse) {
+	if iv == nil || result.Image == "" {
+		return
+	}
+	ctx, span := tracer.Start(ctx, "image.validate")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, iv.timeout)
+	defer cancel()
+
+	err := iv.Check(ctx, result.baseURL(), result.Image)
+	if err == nil {
+		return
+	}
+	slog.DebugContext(ctx, "Preview image failed validation", "url", result.URL, "image", result.Image, "error", err)
+
+	tried := map[string]bool{result.Image: true}
+	result.Image = ""
+	delete(result.Sources, linkpreview.FieldImage)
+	for _, candidate := range imageCandidates {
+		for _, image := range result.RawMeta[candidate.key] {
+			if tried[image] || ctx.Err() != nil {
+				continue
+			}
+			tried[image] = true
+			if err := iv.Check(ctx, result.baseURL(), image); err != nil {
+				slog.DebugContext(ctx, "Preview image failed validation", "url", result.URL, "image", image, "error", err)
+				continue
+			}
+			result.Image = image
+			if result.Sources != nil {
+				result.Sources[linkpreview.FieldImage] = candidate.source
+			}
+			result.QualityScore = result.Score()
+			return
+		}
+	}
+	result.QualityScore = result.Score()
+}
+
+// Check verifies that imageURL, resolved against pageURL, is an image of at
+// most maxBytes
+func (iv *ImageValidator) Check(ctx context.Context, pageURL, imageURL string) error {
+	target, err := url.Parse(resolveURL(pageURL, imageURL))
+	if err != nil {
+		return fmt.Errorf("invalid image URL: %v", err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("unsupported image URL scheme %q", target.Scheme)
+	}
+	if err := iv.extractor.checkTarget(ctx, target); err != nil {
+		return fmt.Errorf("blocked image URL: %v", err)
+	}
+
+	contentType, size, err := iv.head(ctx, target)
+	if err != nil && !errors.Is(err, errImageNotFound) {
+		contentType, size, err = iv.sniff(ctx, target)
+	}
+	if err != nil {
+		return err
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); !strings.HasPrefix(mediaType, "image/") {
+		return fmt.Errorf("not an image (Content-Type %q)", contentType)
+	}
+	if iv.maxBytes > 0 && size > iv.maxBytes {
+		return fmt.Errorf("image is %d bytes, over the %d byte limit", size, iv.maxBytes)
+	}
+	return nil
+}
+
+// head returns the content type and size, or -1 if unknown, from a HEAD request.
+// Origins that refuse HEAD or answer it without a content type are reported as
+// errors so the caller falls back to a ranged GET
+func (iv *ImageValidator) head(ctx context.Context, target *url.URL) (string, int64, error) {
+	resp, err := iv.request(ctx, http.MethodHead, target)
+	if err != nil {
+		return "", 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return "", 0, fmt.Errorf("%w: %s", errImageNotFound, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("HEAD answered %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || strings.HasPrefix(contentType, "application/octet-stream") {
+		return "", 0, fmt.Errorf("HEAD answered without an image content type")
+	}
+	return contentType, resp.ContentLength, nil
+}
+
+// sniff fetches the first bytes of target and returns its content type, sniffed
+// when the origin doesn't declare a useful one, and its full size, or -1 if unknown
+func (iv *ImageValidator) sniff(ctx context.Context, target *url.URL) (string, int64, error) {
+	resp, err := iv.request(ctx, http.MethodGet, target)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to fetch image: %v", err)
+	}
+	defer resp.Body.Close()
+
+	size := resp.ContentLength
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPartialContent:
+		// Content-Range is "bytes 0-511/123456", or ".../*" when the size is unknown
+		size = -1
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			if n, err := strconv.ParseInt(total, 10, 64); err == nil {
+				size = n
+			}
+		}
+	default:
+		return "", 0, fmt.Errorf("failed to fetch image: %s", resp.Status)
+	}
+
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, imageSniffBytes))
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || strings.HasPrefix(contentType, "application/octet-stream") {
+		contentType = http.DetectContentType(head)
+	}
+	return contentType, size, nil
+}
+
+// request sends a HEAD or ranged GET for target through the extractor's client
+func (iv *ImageValidator) request(ctx context.Context, method string, target *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", linkpreview.DefaultUserAgent)
+	req.Header.Set("Accept", "image/*")
+	if method == http.MethodGet {
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", imageSniffBytes-1))
+	}
+	return iv.extractor.client.Do(req)
+}
+
+// fetchImage downloads an image of at most maxBytes through the guarded client
+func (me *MetaExtractor) fetchImage(ctx context.Context, target *url.URL, maxBytes int64) ([]byte, string, error) {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, "", fmt.Errorf("unsupported image URL scheme %q", target.Scheme)
+	}
+	if err := me.checkTarget(ctx, target); err != nil {
+		return nil, "", fmt.Errorf("blocked image URL: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := me.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch image: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to fetch image: %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); !strings.HasPrefix(mediaType, "image/") {
+		return nil, "", fmt.Errorf("preview image is not an image (Content-Type %q)", contentType)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read image: %v", err)
+	}
+	if int64(len(image)) > maxBytes {
+		return nil, "", fmt.Errorf("image exceeds the %d byte limit", maxBytes)
+	}
+	return image, contentType, nil
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imageConvertTimeout bounds one run of an image encoder
+const imageConvertTimeout = 10 * time.Second
+
+// imageFormat is an output format of the image proxy and the command-line
+// encoder producing it from a JPEG or PNG file
+type imageFormat struct {
+	mediaType string
+	command   string
+	args      func(in, out string) []string
+}
+
+// imageFormats are the formats IMAGE_FORMATS may list, with the encoders of
+// libwebp (cwebp) and libavif (avifenc)
+var imageFormats = map[string]imageFormat{
+	"webp": {mediaType: "image/webp", command: "cwebp", args: func(in, out string) []string {
+		return []string{"-quiet", "-q", "80", in, "-o", out}
+	}},
+	"avif": {mediaType: "image/avif", command: "avifenc", args: func(in, out string) []string {
+		return []string{"-q", "60", "-s", "8", in, out}
+	}},
+}
+
+// ImageConverter re-encodes proxied images as WebP or AVIF for clients that
+// accept them, cutting the bandwidth of card-heavy feeds
+type ImageConverter struct {
+	formats []imageFormat // In order of preference, with command resolved to a path
+}
+
+// NewImageConverter creates a converter offering names, in order of
+// preference, or returns nil when none of them can be produced. Formats whose
+// encoder isn't installed are skipped with a warning
+func NewImageConverter(names []string) *ImageConverter {
+	var formats []imageFormat
+	for _, name := range names {
+		format, ok := imageFormats[strings.ToLower(name)]
+		if !ok {
+			slog.Warn("Ignoring unknown image format", "format", name, "supported", "webp, avif")
+			continue
+		}
+		path, err := exec.LookPath(format.command)
+		if err != nil {
+			slog.Warn("Image format disabled: encoder not found", "format", name, "command", format.command)
+			continue
+		}
+		format.command = path
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		return nil
+	}
+	return &ImageConverter{formats: formats}
+}
+
+// Negotiate returns the preferred format the Accept header explicitly allows,
+// or nil. Wildcards don't count: "image/*" doesn't mean a client decodes AVIF
+func (ic *ImageConverter) Negotiate(accept string) *imageFormat {
+	if ic == nil {
+		return nil
+	}
+	for i, format := range ic.formats {
+		if acceptsMediaType(accept, format.mediaType) {
+			return &ic.formats[i]
+		}
+	}
+	return nil
+}
+
+// acceptsMediaType reports whether the Accept header lists mediaType with a non-zero quality
+func acceptsMediaType(accept, mediaType string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		listed, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || listed != mediaType {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+		return true
+	}
+	return false
+}
+
+// Convert encodes data, a JPEG or PNG image, as format
+func (ic *ImageConverter) Convert(ctx context.Context, data []byte, contentType string, format *imageFormat) ([]byte, error) {
+	ext := ".png"
+	if contentType == "image/jpeg" {
+		ext = ".jpg"
+	}
+	dir, err := os.MkdirTemp("", "linkpreview-image-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in"+ext), filepath.Join(dir, "out")
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, imageConvertTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, format.command, format.args(in, out)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", filepath.Base(format.command), err, strings.TrimSpace(string(output)))
+	}
+	return os.ReadFile(out)
+}
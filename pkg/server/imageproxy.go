@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxProxiedImageBytes caps the size of images served through the image proxy
+const maxProxiedImageBytes = 10 * 1024 * 1024
+
+// imageProxyCSP keeps proxied images from running anything on this service's
+// origin: SVGs may carry scripts, and a page previewed may name any SVG as its image
+const imageProxyCSP = "default-src 'none'; style-src 'unsafe-inline'; sandbox"
+
+// handleImageProxy serves the image at the "url" query parameter through this service,
+// applying the same domain policy and SSRF checks as preview fetches. With "w"
+// or "h" the image is scaled down to fit within that size. converter, which may
+// be nil, re-encodes images in a format the client's Accept header asks for.
+// store, which may be nil, keeps every variant served and redirects to it
+func handleImageProxy(extractor *MetaExtractor, resizer *ImageResizer, converter *ImageConverter, store *MediaStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Security-Policy", imageProxyCSP)
+		imageURL, err := url.Parse(c.Query("url"))
+		if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") || imageURL.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Query parameter 'url' must be an absolute http(s) URL",
+			})
+			return
+		}
+		width, height, err := resizer.Size(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := extractor.checkTarget(c.Request.Context(), imageURL); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("Blocked URL: %v", err),
+			})
+			return
+		}
+
+		var format *imageFormat
+		variant := ""
+		if converter != nil {
+			c.Header("Vary", "Accept")
+			if format = converter.Negotiate(c.GetHeader("Accept")); format != nil {
+				variant = format.mediaType
+			}
+		}
+		key := store.Key("image", imageURL.String(), strconv.Itoa(width), strconv.Itoa(height), variant)
+		if store.Redirect(c, key, 0) {
+			return
+		}
+
+		req, err := http.NewRequestWithContext(c.Request.Context(), "GET", imageURL.String(), nil)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to create request: %v", err)})
+			return
+		}
+		req.Header.Set("Accept", "image/*")
+
+		resp, err := extractor.client.Do(req)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to fetch image: %v", err)})
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("HTTP error: %d %s", resp.StatusCode, resp.Status)})
+			return
+		}
+
+		contentType := resp.Header.Get("Content-Type")
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if !strings.HasPrefix(mediaType, "image/") {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": fmt.Sprintf("Target is not an image (Content-Type %q)", contentType)})
+			return
+		}
+		if resp.ContentLength > maxProxiedImageBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image exceeds the proxy size limit"})
+			return
+		}
+
+		// Vector images scale by themselves, and re-encoding animated GIFs would freeze them
+		raster := mediaType != "image/svg+xml" && mediaType != "image/gif"
+		if !raster {
+			format = nil
+		}
+		if raster && (width > 0 || height > 0 || format != nil) {
+			serveTransformed(c, resp.Body, contentType, resizer, width, height, converter, format, store, key)
+			return
+		}
+		if store != nil {
+			// The image is read whole so it can be uploaded once served
+			serveTransformed(c, resp.Body, contentType, resizer, 0, 0, nil, nil, store, key)
+			return
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("Cache-Control", "public, max-age=86400")
+		c.Header("X-Content-Type-Options", "nosniff")
+		if resp.ContentLength > 0 {
+			c.Header("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		}
+		c.Status(http.StatusOK)
+		io.Copy(c.Writer, io.LimitReader(resp.Body, maxProxiedImageBytes))
+	}
+}
+
+// serveTransformed reads the image in body and serves it scaled down to fit
+// within width x height, if either is set, and re-encoded as format, if not
+// nil. The result is saved in store, if not nil, as key
+func serveTransformed(c *gin.Context, body io.Reader, contentType string, resizer *ImageResizer, width, height int, converter *ImageConverter, format *imageFormat, store *MediaStore, key string) {
+	data, err := io.ReadAll(io.LimitReader(body, maxProxiedImageBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to read image: %v", err)})
+		return
+	}
+	if len(data) > maxProxiedImageBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image exceeds the proxy size limit"})
+		return
+	}
+	if width > 0 || height > 0 {
+		resized, resizedType, err := resizer.Resize(data, width, height)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Failed to resize image: %v", err)})
+			return
+		}
+		if resizedType != "" {
+			data, contentType = resized, resizedType
+		}
+	}
+
+	// The encoders read JPEG and PNG; a failed or larger conversion serves the image as it is
+	if mediaType, _, _ := mime.ParseMediaType(contentType); format != nil && (mediaType == "image/jpeg" || mediaType == "image/png") {
+		converted, err := converter.Convert(c.Request.Context(), data, mediaType, format)
+		switch {
+		case err != nil:
+			slog.WarnContext(c.Request.Context(), "Image conversion failed", "format", format.mediaType, "error", err)
+		case len(converted) < len(data):
+			data, contentType = converted, format.mediaType
+		}
+	}
+
+	store.Save(key, data, contentType)
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// signedImageURL returns a signed image proxy path for imageURL, or "" when signing is disabled
+func signedImageURL(signer *URLSigner, imageURL string) string {
+	return signedThumbnailURL(signer, imageURL, 0, 0)
+}
+
+// signedThumbnailURL returns a signed image proxy path for imageURL scaled to
+// fit within width x height (zero for no limit), or "" when signing is disabled
+func signedThumbnailURL(signer *URLSigner, imageURL string, width, height int) string {
+	if signer == nil {
+		return ""
+	}
+	// Only absolute http(s) image URLs can be proxied
+	parsed, err := url.Parse(imageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ""
+	}
+	query := url.Values{"url": {imageURL}}
+	if width > 0 {
+		query.Set("w", strconv.Itoa(width))
+	}
+	if height > 0 {
+		query.Set("h", strconv.Itoa(height))
+	}
+	return signer.Sign("/image", query, 0)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// imageProbeBytes is the most of an image read to find its dimensions. PNG and
+// GIF headers sit in the first bytes, but a JPEG's frame header follows its
+// EXIF and ICC segments, which can run to tens of kilobytes
+const imageProbeBytes = 64 << 10
+
+// imageDimensions sets the width, height and type of the preview image of
+// result from its og:image:width, og:image:height and og:image:type tags, or,
+// when they are missing and probing is enabled, from the image's header
+func (ps *PreviewService) imageDimensions(ctx context.Context, result *LinkPreviewResponse) {
+	if declaredImageSize(result) || !ps.imageProbe {
+		return
+	}
+	ctx, span := tracer.Start(ctx, "image.probe")
+	defer span.End()
+
+	target, err := resolveImageURL(result.baseURL(), result.Image)
+	if err == nil {
+		var config image.Config
+		var format string
+		if config, format, err = ps.extractor.probeImage(ctx, target); err == nil {
+			result.ImageWidth, result.ImageHeight = config.Width, config.Height
+			result.ImageType = "image/" + format
+			return
+		}
+	}
+	slog.DebugContext(ctx, "Could not probe preview image", "image", result.Image, "error", err)
+}
+
+// declaredImageSize fills the image dimensions of result from its Open Graph
+// tags and reports whether both were declared. The tags describe the first
+// og:image only, so they are ignored for an image from anywhere else
+func declaredImageSize(result *LinkPreviewResponse) bool {
+	if firstMeta(result.RawMeta, "og:image") != result.Image {
+		return false
+	}
+	width, _ := strconv.Atoi(firstMeta(result.RawMeta, "og:image:width"))
+	height, _ := strconv.Atoi(firstMeta(result.RawMeta, "og:image:height"))
+	if width <= 0 || height <= 0 {
+		return false
+	}
+	result.ImageWidth, result.ImageHeight = width, height
+	if mediaType, _, err := mime.ParseMediaType(firstMeta(result.RawMeta, "og:image:type")); err == nil && strings.HasPrefix(mediaType, "image/") {
+		result.ImageType = mediaType
+	}
+	return true
+}
+
+// firstMeta returns the first value of a meta tag, or ""
+func firstMeta(meta map[string][]string, key string) string {
+	if values := meta[key]; len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// probeImage reads the dimensions and format of an image from its first bytes
+// through the guarded client. The range is a hint: origins ignoring it still
+// have the download cut off once the header is decoded
+func (me *MetaExtractor) probeImage(ctx context.Context, target *url.URL) (image.Config, string, error) {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return image.Config{}, "", fmt.Errorf("unsupported image URL scheme %q", target.Scheme)
+	}
+	if err := me.checkTarget(ctx, target); err != nil {
+		return image.Config{}, "", fmt.Errorf("blocked image URL: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	req.Header.Set("User-Agent", linkpreview.DefaultUserAgent)
+	req.Header.Set("Accept", "image/*")
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", imageProbeBytes-1))
+
+	resp, err := me.client.Do(req)
+	if err != nil {
+		return image.Config{}, "", fmt.Errorf("failed to fetch image: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return image.Config{}, "", fmt.Errorf("failed to fetch image: %s", resp.Status)
+	}
+
+	config, format, err := image.DecodeConfig(io.LimitReader(resp.Body, imageProbeBytes))
+	if err != nil {
+		return image.Config{}, "", fmt.Errorf("unsupported image: %v", err)
+	}
+	return config, format, nil
+}
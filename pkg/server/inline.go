@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"mime"
+	"net/url"
+)
+
+// faviconRels are the <link> rels a favicon can come from, in order of
+// preference; without any, /favicon.ico is tried
+var faviconRels = []string{"link:icon", "link:apple-touch-icon"}
+
+// inlineImages sets the data URIs of the preview image and favicon of result
+// when they are at most ps.inlineMaxBytes, saving clients a request per card
+func (ps *PreviewService) inlineImages(ctx context.Context, result *LinkPreviewResponse) {
+	if ps.inlineMaxBytes <= 0 {
+		return
+	}
+	ctx, span := tracer.Start(ctx, "image.inline")
+	defer span.End()
+
+	if result.Image != "" {
+		result.ImageData = ps.inlineImage(ctx, result.baseURL(), result.Image)
+	}
+	result.FaviconData = ps.inlineImage(ctx, result.baseURL(), faviconURL(result))
+}
+
+// inlineImage returns imageURL, resolved against pageURL, as a data URI, or ""
+// when it is too large or can't be fetched
+func (ps *PreviewService) inlineImage(ctx context.Context, pageURL, imageURL string) string {
+	target, err := resolveImageURL(pageURL, imageURL)
+	if err == nil {
+		var data string
+		if data, err = ps.extractor.dataURI(ctx, target, ps.inlineMaxBytes); err == nil {
+			return data
+		}
+	}
+	slog.DebugContext(ctx, "Image not inlined", "image", imageURL, "error", err)
+	return ""
+}
+
+// faviconURL returns the favicon the page declares, or /favicon.ico
+func faviconURL(result *LinkPreviewResponse) string {
+	for _, rel := range faviconRels {
+		if icons := result.RawMeta[rel]; len(icons) > 0 && icons[0] != "" {
+			return icons[0]
+		}
+	}
+	return "/favicon.ico"
+}
+
+// dataURI downloads an image of at most maxBytes and encodes it as a base64
+// data URI
+func (me *MetaExtractor) dataURI(ctx context.Context, target *url.URL, maxBytes int64) (string, error) {
+	data, contentType, err := me.fetchImage(ctx, target, maxBytes)
+	if err != nil {
+		return "", err
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
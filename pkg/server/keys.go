@@ -0,0 +1,272 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyPrefixLength is how much of an issued key is kept in the clear, to tell keys apart
+const apiKeyPrefixLength = 10
+
+// APIKey is an API key issued through the admin API. Only its digest is
+// stored; the key itself is returned once, when it is issued
+type APIKey struct {
+	ID          int64      `json:"id"`
+	Tenant      string     `json:"tenant,omitempty"` // "" for keys of no tenant
+	Label       string     `json:"label,omitempty"`
+	Prefix      string     `json:"prefix"`      // First characters of the key
+	Fingerprint string     `json:"fingerprint"` // Identifies the key in the audit log and usage reports
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // Revoked and rotated keys stop working then
+	Hash        string     `json:"-"`                    // Hex SHA-256 digest of the key
+}
+
+// Expired reports whether the key no longer works at now
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// newAPIKey generates a key, returning it and its record
+func newAPIKey() (string, *APIKey) {
+	secret := make([]byte, 24)
+	rand.Read(secret)
+	key := "lp_" + hex.EncodeToString(secret)
+	sum := sha256.Sum256([]byte(key))
+	return key, &APIKey{Prefix: key[:apiKeyPrefixLength], Fingerprint: keyFingerprint(key), CreatedAt: time.Now().UTC(), Hash: hex.EncodeToString(sum[:])}
+}
+
+// issuedAPIKey is the response to issuing a key, the only one holding the key
+type issuedAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyRequest is the body of a request issuing an API key
+type APIKeyRequest struct {
+	Tenant    string     `json:"tenant"` // Tenant the key belongs to; empty for none
+	Label     string     `json:"label"`  // What the key is for
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// RotateRequest is the optional body of a key rotation
+type RotateRequest struct {
+	Grace string `json:"grace"` // How long the old key keeps working, e.g. "24h"; it stops at once by default
+}
+
+// tenantInfo is a tenant and where it is defined: tenants from the config
+// file can't be edited at runtime
+type tenantInfo struct {
+	*Tenant
+	Source string `json:"source"` // "config" or "admin"
+}
+
+// registerKeyRoutes mounts the management of API keys and tenants on admin
+func registerKeyRoutes(admin *gin.RouterGroup, keys *APIKeyStore, store PreviewStore) {
+	admin.GET("/tenants", handleListTenants(keys))
+	admin.PUT("/tenants/:name", handleSaveTenant(keys, store))
+	admin.DELETE("/tenants/:name", handleDeleteTenant(keys, store))
+	admin.GET("/keys", handleListKeys(store))
+	admin.POST("/keys", handleIssueKey(keys, store))
+	admin.POST("/keys/:id/rotate", handleRotateKey(keys, store))
+	admin.DELETE("/keys/:id", handleRevokeKey(keys, store))
+}
+
+// handleListTenants lists the tenants from the config file and the admin API
+func handleListTenants(keys *APIKeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenants := []tenantInfo{}
+		for _, tenant := range keys.Tenants() {
+			source := "admin"
+			if keys.configTenant(tenant.Name) {
+				source = "config"
+			}
+			tenants = append(tenants, tenantInfo{tenant, source})
+		}
+		c.JSON(http.StatusOK, gin.H{"tenants": tenants})
+	}
+}
+
+// handleSaveTenant creates the tenant named in the path or replaces its
+// settings with those of the body, taking effect at once
+func handleSaveTenant(keys *APIKeyStore, store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var tenant Tenant
+		if err := c.ShouldBindJSON(&tenant); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		tenant.Name = strings.TrimSpace(c.Param("name"))
+		if err := tenant.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant: " + err.Error()})
+			return
+		}
+		if keys.configTenant(tenant.Name) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tenant " + tenant.Name + " is defined in the config file; edit it there"})
+			return
+		}
+		if err := store.SaveTenant(c.Request.Context(), &tenant); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tenant: " + err.Error()})
+			return
+		}
+		keys.syncAfterChange(c)
+		c.JSON(http.StatusOK, tenantInfo{&tenant, "admin"})
+	}
+}
+
+// handleDeleteTenant removes a tenant and revokes its keys
+func handleDeleteTenant(keys *APIKeyStore, store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		if keys.configTenant(name) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tenant " + name + " is defined in the config file; remove it there"})
+			return
+		}
+		existed, err := store.DeleteTenant(c.Request.Context(), name, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tenant: " + err.Error()})
+			return
+		}
+		if !existed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No such tenant"})
+			return
+		}
+		keys.syncAfterChange(c)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// handleListKeys lists the keys issued through the admin API, of the tenant
+// ?tenant= if given. Expired keys are left out unless ?expired=true
+func handleListKeys(store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		all, err := store.ListAPIKeys(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read keys: " + err.Error()})
+			return
+		}
+		tenant, hasTenant := c.GetQuery("tenant")
+		now := time.Now()
+		keys := []APIKey{}
+		for _, key := range all {
+			if (hasTenant && key.Tenant != tenant) || (key.Expired(now) && c.Query("expired") != "true") {
+				continue
+			}
+			keys = append(keys, key)
+		}
+		c.JSON(http.StatusOK, gin.H{"keys": keys})
+	}
+}
+
+// handleIssueKey generates a key for a tenant, or for none. The key is only
+// ever returned here
+func handleIssueKey(keys *APIKeyStore, store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req APIKeyRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+				return
+			}
+		}
+		req.Tenant = strings.TrimSpace(req.Tenant)
+		if req.Tenant != "" && keys.Tenant(req.Tenant) == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No such tenant: " + req.Tenant})
+			return
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "'expires_at' must be in the future"})
+			return
+		}
+		key, record := newAPIKey()
+		record.Tenant, record.Label, record.ExpiresAt = req.Tenant, strings.TrimSpace(req.Label), req.ExpiresAt
+		if err := store.AddAPIKey(c.Request.Context(), record); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save key: " + err.Error()})
+			return
+		}
+		keys.syncAfterChange(c)
+		c.JSON(http.StatusCreated, issuedAPIKey{record, key})
+	}
+}
+
+// handleRotateKey issues a successor to a key, for the same tenant, and
+// revokes the old key once the requested grace period is over
+func handleRotateKey(keys *APIKeyStore, store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+			return
+		}
+		var req RotateRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+				return
+			}
+		}
+		var grace time.Duration
+		if req.Grace != "" {
+			if grace, err = time.ParseDuration(req.Grace); err != nil || grace < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "'grace' must be a duration such as 24h"})
+				return
+			}
+		}
+		key, record := newAPIKey()
+		rotated, err := store.RotateAPIKey(c.Request.Context(), id, record, time.Now().Add(grace))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate key: " + err.Error()})
+			return
+		}
+		if !rotated {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No such key, or it has expired"})
+			return
+		}
+		keys.syncAfterChange(c)
+		c.JSON(http.StatusCreated, issuedAPIKey{record, key})
+	}
+}
+
+// handleRevokeKey makes a key stop working at once
+func handleRevokeKey(keys *APIKeyStore, store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+			return
+		}
+		existed, err := store.ExpireAPIKey(c.Request.Context(), id, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke key: " + err.Error()})
+			return
+		}
+		if !existed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No such key"})
+			return
+		}
+		keys.syncAfterChange(c)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// validate checks the settings of a tenant managed through the admin API
+func (t *Tenant) validate() error {
+	if t.Name == "" {
+		return errors.New("a name is required")
+	}
+	if t.RateLimit < 0 || t.RateBurst < 0 || t.DailyQuota < 0 {
+		return errors.New("limits can't be negative")
+	}
+	if strings.Contains(t.Name, "|") || strings.Contains(t.CacheNamespace, "|") {
+		return fmt.Errorf("names and cache namespaces can't contain %q", "|")
+	}
+	return nil
+}
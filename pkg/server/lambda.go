@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// RunningOnLambda reports whether the process was started by the AWS Lambda runtime
+func RunningOnLambda() bool {
+	return os.Getenv("AWS_LAMBDA_RUNTIME_API") != ""
+}
+
+// ServeLambda answers API Gateway (REST and HTTP APIs), Lambda function URL and
+// ALB events with handler. It never returns
+func ServeLambda(handler http.Handler) {
+	lambda.Start(func(ctx context.Context, event json.RawMessage) (any, error) {
+		var probe struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(event, &probe); err != nil {
+			return nil, err
+		}
+
+		// HTTP APIs and function URLs send payload format 2.0, REST APIs and ALBs 1.0
+		if probe.Version == "2.0" {
+			var request events.APIGatewayV2HTTPRequest
+			if err := json.Unmarshal(event, &request); err != nil {
+				return nil, err
+			}
+			return serveLambdaV2(ctx, handler, request)
+		}
+		var request events.APIGatewayProxyRequest
+		if err := json.Unmarshal(event, &request); err != nil {
+			return nil, err
+		}
+		return serveLambdaV1(ctx, handler, request)
+	})
+}
+
+// LazyHandler returns a handler that builds the server from the environment on
+// its first request, for platforms that import a handler rather than run a
+// binary (e.g. Google Cloud Functions). Nothing is set up until it is needed,
+// which keeps cold starts short
+func LazyHandler() http.Handler {
+	var once sync.Once
+	var server *Server
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			config, _ := LoadSettings("link-preview-api", nil, os.Stderr)
+			server = New(config)
+		})
+		server.Handler().ServeHTTP(w, r)
+	})
+}
+
+func serveLambdaV2(ctx context.Context, handler http.Handler, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	path := event.RawPath
+	// Routes are mounted at the root; a named stage prefixes the path with its name
+	if stage := event.RequestContext.Stage; stage != "" && stage != "$default" {
+		path = strings.TrimPrefix(path, "/"+stage)
+	}
+
+	header := make(http.Header, len(event.Headers))
+	for name, value := range event.Headers {
+		header.Set(name, value)
+	}
+	if len(event.Cookies) > 0 {
+		header.Set("Cookie", strings.Join(event.Cookies, "; "))
+	}
+
+	r, err := newLambdaRequest(ctx, event.RequestContext.HTTP.Method, path, event.RawQueryString, header, event.Body, event.IsBase64Encoded)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	r.RemoteAddr = event.RequestContext.HTTP.SourceIP + ":0"
+
+	w := newLambdaResponse()
+	handler.ServeHTTP(w, r)
+	body, encoded := w.encodedBody()
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:        w.status,
+		MultiValueHeaders: w.header,
+		Body:              body,
+		IsBase64Encoded:   encoded,
+	}, nil
+}
+
+func serveLambdaV1(ctx context.Context, handler http.Handler, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	header := make(http.Header, len(event.MultiValueHeaders))
+	for name, values := range event.MultiValueHeaders {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+	for name, value := range event.Headers {
+		if header.Get(name) == "" {
+			header.Set(name, value)
+		}
+	}
+
+	query := url.Values(event.MultiValueQueryStringParameters)
+	for name, value := range event.QueryStringParameters {
+		if !query.Has(name) {
+			if query == nil {
+				query = url.Values{}
+			}
+			query.Set(name, value)
+		}
+	}
+
+	r, err := newLambdaRequest(ctx, event.HTTPMethod, event.Path, query.Encode(), header, event.Body, event.IsBase64Encoded)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	r.RemoteAddr = event.RequestContext.Identity.SourceIP + ":0"
+
+	w := newLambdaResponse()
+	handler.ServeHTTP(w, r)
+	body, encoded := w.encodedBody()
+	return events.APIGatewayProxyResponse{
+		StatusCode:        w.status,
+		MultiValueHeaders: w.header,
+		Body:              body,
+		IsBase64Encoded:   encoded,
+	}, nil
+}
+
+// newLambdaRequest builds the http.Request described by an event
+func newLambdaRequest(ctx context.Context, method, path, rawQuery string, header http.Header, body string, base64Body bool) (*http.Request, error) {
+	payload := []byte(body)
+	if base64Body {
+		decoded, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = decoded
+	}
+
+	target := path
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+	r, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	r.Header = header
+	r.Host = header.Get("Host")
+	r.RequestURI = target
+	return r, nil
+}
+
+// lambdaResponse buffers a response so it can be returned as an event
+type lambdaResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newLambdaResponse() *lambdaResponse {
+	return &lambdaResponse{header: make(http.Header)}
+}
+
+func (lr *lambdaResponse) Header() http.Header {
+	return lr.header
+}
+
+func (lr *lambdaResponse) Write(p []byte) (int, error) {
+	if lr.status == 0 {
+		lr.WriteHeader(http.StatusOK)
+	}
+	return lr.body.Write(p)
+}
+
+func (lr *lambdaResponse) WriteHeader(status int) {
+	if lr.status == 0 {
+		lr.status = status
+	}
+}
+
+// encodedBody returns the body as text, or base64 encoded when it isn't textual (e.g. proxied images)
+func (lr *lambdaResponse) encodedBody() (string, bool) {
+	if lr.status == 0 {
+		lr.status = http.StatusOK
+	}
+	mediaType, _, _ := mime.ParseMediaType(lr.header.Get("Content-Type"))
+	if lr.body.Len() == 0 || strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") || mediaType == "application/javascript" {
+		return lr.body.String(), false
+	}
+	return base64.StdEncoding.EncodeToString(lr.body.Bytes()), true
+}
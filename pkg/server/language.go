@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxAcceptLanguage caps the length of an Accept-Language sent to origins
+const maxAcceptLanguage = 128
+
+// acceptLanguagePattern matches an Accept-Language value with its spaces
+// removed, e.g. "fr-CH,fr;q=0.9,en;q=0.8"
+var acceptLanguagePattern = regexp.MustCompile(`^(?:[A-Za-z]{1,8}(?:-[A-Za-z0-9]{1,8})*|\*)(?:;q=[01](?:\.[0-9]{0,3})?)?(?:,(?:[A-Za-z]{1,8}(?:-[A-Za-z0-9]{1,8})*|\*)(?:;q=[01](?:\.[0-9]{0,3})?)?)*$`)
+
+// normalizeAcceptLanguage checks an Accept-Language value and returns it
+// without spaces, so requests differing only in spacing share a cache entry
+func normalizeAcceptLanguage(value string) (string, error) {
+	value = strings.Join(strings.Fields(value), "")
+	if value == "" {
+		return "", nil
+	}
+	if len(value) > maxAcceptLanguage || !acceptLanguagePattern.MatchString(value) {
+		return "", fmt.Errorf("invalid Accept-Language %q; expected language tags such as fr-CH,fr;q=0.9,en;q=0.8", value)
+	}
+	return value, nil
+}
+
+// acceptLanguageKey is the context key of the Accept-Language asked for by a request
+type acceptLanguageKey struct{}
+
+// WithAcceptLanguage returns a context whose fetches send Accept-Language
+// language, a value from normalizeAcceptLanguage
+func WithAcceptLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, acceptLanguageKey{}, language)
+}
+
+// acceptLanguageFrom returns the Accept-Language attached to ctx, or ""
+func acceptLanguageFrom(ctx context.Context) string {
+	language, _ := ctx.Value(acceptLanguageKey{}).(string)
+	return language
+}
+
+// languageKey is the cache key of a preview fetched with an Accept-Language
+// asked for by the request; "" is the language of requests that asked for none
+func languageKey(key, language string) string {
+	if language == "" {
+		return key
+	}
+	return key + "#lang=" + strings.ToLower(language)
+}
+
+// contentLanguage returns the first language of a Content-Language header
+func contentLanguage(header string) string {
+	language, _, _ := strings.Cut(header, ",")
+	return strings.TrimSpace(language)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyTracker records recent response times per target host and derives
+// fetch timeouts from them, so slow-but-working hosts get more time while
+// hosts that normally answer quickly are given up on sooner
+type LatencyTracker struct {
+	min, max   time.Duration // Bounds for derived timeouts
+	multiplier float64       // Headroom applied to the p95 latency
+
+	mu    sync.Mutex
+	hosts map[string]*latencyWindow
+}
+
+// latencyWindow is a ring buffer of a host's most recent latencies
+type latencyWindow struct {
+	samples  []time.Duration
+	next     int
+	lastSeen time.Time
+}
+
+const (
+	// latencyWindowSize is how many recent samples are kept per host
+	latencyWindowSize = 50
+	// latencyMinSamples is how many samples are needed before a host gets its own timeout
+	latencyMinSamples = 5
+	// latencyMaxHosts bounds memory; the least recently seen hosts are dropped beyond it
+	latencyMaxHosts = 10000
+)
+
+// NewLatencyTracker creates a tracker deriving timeouts of multiplier × p95 latency, clamped to [min, max]
+func NewLatencyTracker(min, max time.Duration, multiplier float64) *LatencyTracker {
+	return &LatencyTracker{
+		min:        min,
+		max:        max,
+		multiplier: multiplier,
+		hosts:      make(map[string]*latencyWindow),
+	}
+}
+
+// Observe records how long host took to respond
+func (lt *LatencyTracker) Observe(host string, latency time.Duration) {
+	if lt == nil {
+		return
+	}
+	host = strings.ToLower(host)
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	w, ok := lt.hosts[host]
+	if !ok {
+		if len(lt.hosts) >= latencyMaxHosts {
+			lt.evictOldest()
+		}
+		w = &latencyWindow{}
+		lt.hosts[host] = w
+	}
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, latency)
+	} else {
+		w.samples[w.next] = latency
+		w.next = (w.next + 1) % latencyWindowSize
+	}
+	w.lastSeen = time.Now()
+}
+
+// Timeout returns the fetch timeout for host
+// Hosts without enough history get the maximum; nil trackers return 0 (no adaptive limit)
+func (lt *LatencyTracker) Timeout(host string) time.Duration {
+	if lt == nil {
+		return 0
+	}
+	p95, ok := lt.Percentile(host, 0.95)
+	if !ok {
+		return lt.max
+	}
+
+	timeout := time.Duration(float64(p95) * lt.multiplier)
+	if timeout < lt.min {
+		timeout = lt.min
+	}
+	if timeout > lt.max {
+		timeout = lt.max
+	}
+	return timeout
+}
+
+// Percentile returns the p-th percentile (0 to 1) of host's recent latencies
+// ok is false until the host has latencyMinSamples samples
+func (lt *LatencyTracker) Percentile(host string, p float64) (time.Duration, bool) {
+	if lt == nil {
+		return 0, false
+	}
+	lt.mu.Lock()
+	w, ok := lt.hosts[strings.ToLower(host)]
+	if !ok || len(w.samples) < latencyMinSamples {
+		lt.mu.Unlock()
+		return 0, false
+	}
+	samples := append([]time.Duration(nil), w.samples...)
+	lt.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	index := int(p * float64(len(samples)-1))
+	return samples[index], true
+}
+
+// evictOldest drops the least recently seen host
+// Callers must hold lt.mu
+func (lt *LatencyTracker) evictOldest() {
+	var oldestHost string
+	var oldest time.Time
+	for host, w := range lt.hosts {
+		if oldestHost == "" || w.lastSeen.Before(oldest) {
+			oldestHost, oldest = host, w.lastSeen
+		}
+	}
+	delete(lt.hosts, oldestHost)
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Listener roles select which routes a listener serves
+const (
+	RoleAll   = "all"   // Every route
+	RoleAPI   = "api"   // Everything except the operational routes
+	RoleAdmin = "admin" // Only the operational routes and health checks
+	// Redirects plain HTTP to HTTPS, like HTTP_REDIRECT_PORT; only used with TLS
+	RoleRedirect = "redirect"
+)
+
+// ListenerSpec is one address the server listens on
+type ListenerSpec struct {
+	Role    string // RoleAll, RoleAPI, RoleAdmin or RoleRedirect
+	Network string // "tcp" or "unix"
+	Address string // host:port, or a socket path
+}
+
+func (ls ListenerSpec) String() string {
+	if ls.Network == "unix" {
+		return ls.Role + "=unix:" + ls.Address
+	}
+	return ls.Role + "=" + ls.Address
+}
+
+// parseListenSpecs parses LISTEN, a comma-separated list of [role=]address entries
+// where address is host:port, :port, a bare port or unix:/path/to.sock. An empty
+// value listens on port alone, serving every route
+func parseListenSpecs(value, port string) ([]ListenerSpec, error) {
+	if strings.TrimSpace(value) == "" {
+		return []ListenerSpec{{Role: RoleAll, Network: "tcp", Address: port}}, nil
+	}
+
+	var specs []ListenerSpec
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		spec := ListenerSpec{Role: RoleAll, Network: "tcp"}
+		if role, address, ok := strings.Cut(entry, "="); ok {
+			spec.Role = strings.ToLower(strings.TrimSpace(role))
+			entry = strings.TrimSpace(address)
+		}
+		switch spec.Role {
+		case RoleAll, RoleAPI, RoleAdmin, RoleRedirect:
+		default:
+			return nil, fmt.Errorf("unknown listener role %q (want all, api, admin or redirect)", spec.Role)
+		}
+		if path, ok := strings.CutPrefix(entry, "unix:"); ok {
+			spec.Network, spec.Address = "unix", path
+		} else {
+			spec.Address = normalizePort(entry)
+		}
+		if spec.Address == "" {
+			return nil, fmt.Errorf("listener %q has no address", entry)
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no listeners configured")
+	}
+	return specs, nil
+}
+
+// openListeners opens the configured listeners: the sockets passed by systemd
+// when socket activated, otherwise LISTEN (or PORT) plus HTTP_REDIRECT_PORT
+func openListeners(config *Config) ([]ListenerSpec, []net.Listener, error) {
+	specs, listeners, err := systemdListeners()
+	if err != nil || len(listeners) > 0 {
+		return specs, listeners, err
+	}
+
+	if specs, err = parseListenSpecs(config.Listen, config.Port); err != nil {
+		return nil, nil, err
+	}
+	if config.TLSEnabled() && config.HTTPRedirectPort != "" {
+		specs = append(specs, ListenerSpec{Role: RoleRedirect, Network: "tcp", Address: config.HTTPRedirectPort})
+	}
+
+	// Open every listener before serving, so a bad address fails startup cleanly
+	listeners = make([]net.Listener, 0, len(specs))
+	for _, spec := range specs {
+		listener, err := spec.listen(config.ListenSocketMode)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, nil, fmt.Errorf("failed to listen on %s: %v", spec, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return specs, listeners, nil
+}
+
+// systemdListeners returns the sockets passed by systemd socket activation
+// (LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES), or none when the process wasn't
+// socket activated. A socket's FileDescriptorName= selects its role; other
+// names serve every route
+func systemdListeners() ([]ListenerSpec, []net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// The variables are meant for this process only, not anything it starts
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	specs := make([]ListenerSpec, 0, count)
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		// Passed descriptors start at 3, after stdin, stdout and stderr
+		file := os.NewFile(uintptr(systemdFirstFD+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, nil, fmt.Errorf("systemd socket %d (%s) is not a listening socket: %v", i+1, name, err)
+		}
+
+		spec := ListenerSpec{Role: RoleAll, Network: listener.Addr().Network(), Address: listener.Addr().String()}
+		switch role := strings.ToLower(name); role {
+		case RoleAPI, RoleAdmin, RoleRedirect:
+			spec.Role = role
+		}
+		specs = append(specs, spec)
+		listeners = append(listeners, listener)
+	}
+	return specs, listeners, nil
+}
+
+// systemdFirstFD is the first file descriptor passed by socket activation
+const systemdFirstFD = 3
+
+// listen opens the listener for spec. A stale socket file left by a previous run
+// is removed first, and new sockets get socketMode permissions
+func (ls ListenerSpec) listen(socketMode os.FileMode) (net.Listener, error) {
+	if ls.Network != "unix" {
+		return net.Listen("tcp", ls.Address)
+	}
+	if info, err := os.Stat(ls.Address); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(ls.Address)
+	}
+	listener, err := net.Listen("unix", ls.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(ls.Address, socketMode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// isAdminPath reports whether path belongs to the operational routes
+func isAdminPath(path string) bool {
+	return path == "/admin" || strings.HasPrefix(path, "/admin/") || path == "/metrics" || path == "/stats"
+}
+
+// restrictToRole wraps handler so a listener only serves the routes of its role
+// Health checks are served by every listener so each can be probed
+func restrictToRole(role string, handler http.Handler) http.Handler {
+	if role == RoleAll {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		allowed := probePaths[path]
+		switch role {
+		case RoleAPI:
+			allowed = allowed || !isAdminPath(path)
+		case RoleAdmin:
+			allowed = allowed || isAdminPath(path)
+		}
+		if !allowed {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
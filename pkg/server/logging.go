@@ -0,0 +1,88 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupLogging installs the default slog logger writing to out, tagging records
+// logged with a request's context with its request ID
+// LOG_FORMAT selects "json" (default) or "text" output and LOG_LEVEL the minimum
+// level (debug, info, warn, error). It reads those settings directly because it
+// runs before the configuration is built, so config warnings are structured too
+func setupLogging(out io.Writer) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if logFormatText() {
+		handler = slog.NewTextHandler(out, options)
+	} else {
+		handler = slog.NewJSONHandler(out, options)
+	}
+	slog.SetDefault(slog.New(requestIDHandler{handler}))
+}
+
+// logFormatText reports whether human-readable text logs were requested
+func logFormatText() bool {
+	return strings.EqualFold(getEnv("LOG_FORMAT", "json"), "text")
+}
+
+// probePaths are the health check endpoints polled by load balancers and orchestrators
+var probePaths = map[string]bool{"/health": true, "/healthz": true, "/readyz": true}
+
+// requestLogger logs one record per request with its status, latency and, for
+// previews, the target domain and outcome set by the handler
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if domain := c.GetString("preview_domain"); domain != "" {
+			attrs = append(attrs, slog.String("domain", domain))
+		}
+		if outcome := c.GetString("preview_outcome"); outcome != "" {
+			attrs = append(attrs, slog.String("outcome", outcome))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		case probePaths[c.Request.URL.Path]:
+			// Health probes arrive every few seconds; keep successful ones out of the default log
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// recoveryLogger turns handler panics into 500 responses, logs them and sends them to reporter
+func recoveryLogger(reporter *ErrorReporter) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		slog.ErrorContext(c.Request.Context(), "panic while handling request", "path", c.Request.URL.Path, "error", err)
+		reporter.CapturePanic(c.Request.Context(), err, c.Request)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
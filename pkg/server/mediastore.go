@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Bounds on background uploads to the media store
+const (
+	mediaUploadTimeout    = 30 * time.Second
+	maxConcurrentUploads  = 16
+	mediaStoreLookupLimit = 2 * time.Second
+)
+
+// MediaStore keeps proxied and resized images, fallback cards and PDF captures
+// in S3-compatible object storage (AWS S3, Google Cloud Storage through its
+// XML API, MinIO, R2...), so every node of a deployment serves a capture made
+// by any of them. Media found in the store is served by redirecting to a
+// presigned URL, or to MEDIA_STORE_PUBLIC_URL when the bucket sits behind a CDN;
+// new media is uploaded in the background after it is served
+type MediaStore struct {
+	client    *minio.Client
+	bucket    string
+	prefix    string        // Prepended to every object key
+	publicURL string        // Base URL objects are served from; empty to presign
+	urlTTL    time.Duration // Lifetime of presigned URLs
+	uploads   chan struct{} // One per upload in flight
+}
+
+// NewMediaStore connects to the bucket named by MEDIA_STORE_BUCKET, or returns
+// nil when no bucket is configured. Without an access key, credentials come
+// from the AWS_* or MINIO_* environment variables or the instance role
+func NewMediaStore(config *Config) (*MediaStore, error) {
+	if config.MediaStoreBucket == "" {
+		return nil, nil
+	}
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+	})
+	if config.MediaStoreAccessKey != "" {
+		creds = credentials.NewStaticV4(config.MediaStoreAccessKey, config.MediaStoreSecretKey, "")
+	}
+	// The region is set so presigning never has to look up the bucket's location
+	client, err := minio.New(config.MediaStoreEndpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !config.MediaStoreInsecure,
+		Region: config.MediaStoreRegion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid media store endpoint: %v", err)
+	}
+	return &MediaStore{
+		client:    client,
+		bucket:    config.MediaStoreBucket,
+		prefix:    config.MediaStorePrefix,
+		publicURL: strings.TrimSuffix(config.MediaStorePublicURL, "/"),
+		urlTTL:    config.MediaStoreURLTTL,
+		uploads:   make(chan struct{}, maxConcurrentUploads),
+	}, nil
+}
+
+// Key returns the object key of a kind of media ("image", "card", "pdf")
+// produced from parts, e.g. a source URL and the size it is scaled to
+func (ms *MediaStore) Key(kind string, parts ...string) string {
+	if ms == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return ms.prefix + kind + "/" + hex.EncodeToString(sum[:])
+}
+
+// Redirect sends the client to the stored object key and reports whether it
+// did. Objects older than maxAge, if non-zero, are treated as missing so they
+// are captured again. Lookup failures are logged and the media produced anew
+func (ms *MediaStore) Redirect(c *gin.Context, key string, maxAge time.Duration) bool {
+	if ms == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), mediaStoreLookupLimit)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "media.lookup")
+	defer span.End()
+
+	info, err := ms.client.StatObject(ctx, ms.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			slog.WarnContext(ctx, "Media store lookup failed", "key", key, "error", err)
+		}
+		return false
+	}
+	if maxAge > 0 && time.Since(info.LastModified) > maxAge {
+		return false
+	}
+	location, err := ms.location(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "Could not sign media URL", "key", key, "error", err)
+		return false
+	}
+	// Clients may reuse the redirect while the presigned URL is still valid
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ms.urlTTL.Seconds())/2))
+	c.Redirect(http.StatusFound, location)
+	return true
+}
+
+// location returns the URL the object key is served from
+func (ms *MediaStore) location(ctx context.Context, key string) (string, error) {
+	if ms.publicURL != "" {
+		return ms.publicURL + "/" + key, nil
+	}
+	signed, err := ms.client.PresignedGetObject(ctx, ms.bucket, key, ms.urlTTL, url.Values{})
+	if err != nil {
+		return "", err
+	}
+	return signed.String(), nil
+}
+
+// Save uploads data as the object key in the background. Uploads beyond
+// maxConcurrentUploads are skipped; the media is stored the next time it is
+// produced instead
+func (ms *MediaStore) Save(key string, data []byte, contentType string) {
+	if ms == nil {
+		return
+	}
+	select {
+	case ms.uploads <- struct{}{}:
+	default:
+		slog.Debug("Media upload skipped: too many in flight", "key", key)
+		return
+	}
+	go func() {
+		defer func() { <-ms.uploads }()
+		ctx, cancel := context.WithTimeout(context.Background(), mediaUploadTimeout)
+		defer cancel()
+		_, err := ms.client.PutObject(ctx, ms.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+			ContentType:  contentType,
+			CacheControl: "public, max-age=86400",
+		})
+		if err != nil {
+			slog.Warn("Media upload failed", "key", key, "error", err)
+		}
+	}()
+}
+
+// Check verifies the bucket exists and the credentials can reach it
+func (ms *MediaStore) Check(ctx context.Context) error {
+	exists, err := ms.client.BucketExists(ctx, ms.bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("bucket " + ms.bucket + " does not exist")
+	}
+	return nil
+}
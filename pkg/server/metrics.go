@@ -0,0 +1,177 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Request and fetch metrics are process-wide and registered with the default registry
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "linkpreview_http_requests_total",
+		Help: "HTTP requests served, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "linkpreview_http_request_duration_seconds",
+		Help:    "Time spent serving HTTP requests, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "linkpreview_upstream_fetch_duration_seconds",
+		Help:    "Time spent fetching and parsing target pages, by target domain.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 15},
+	}, []string{"domain"})
+
+	fetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "linkpreview_fetch_errors_total",
+		Help: "Failed preview fetches, by error class.",
+	}, []string{"class"})
+
+	domainFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "linkpreview_domain_fetch_failures_total",
+		Help: "Failed or empty preview fetches, by target domain and reason (timeout, http_403, parse, empty, ...).",
+	}, []string{"domain", "reason"})
+)
+
+// maxDomainLabels bounds the cardinality of the per-domain fetch histogram;
+// domains seen after the limit is reached are reported as "other"
+const maxDomainLabels = 200
+
+var domainLabels = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: make(map[string]bool)}
+
+// domainLabel returns the metric label for host
+func domainLabel(host string) string {
+	host = strings.ToLower(host)
+	domainLabels.Lock()
+	defer domainLabels.Unlock()
+	if domainLabels.seen[host] {
+		return host
+	}
+	if len(domainLabels.seen) >= maxDomainLabels {
+		return "other"
+	}
+	domainLabels.seen[host] = true
+	return host
+}
+
+// observeFetch records the duration and outcome of a preview fetch
+func observeFetch(host string, elapsed time.Duration, result *LinkPreviewResponse) {
+	domain := domainLabel(host)
+	fetchDuration.WithLabelValues(domain).Observe(elapsed.Seconds())
+	if result.Error != "" {
+		fetchErrors.WithLabelValues(errorClass(result)).Inc()
+	}
+	if reason := failureReason(result); reason != "" {
+		domainFailures.WithLabelValues(domain, reason).Inc()
+	}
+}
+
+// errorClass groups a failed preview into a coarse, low-cardinality error class
+func errorClass(result *LinkPreviewResponse) string {
+	switch {
+	case result.ErrorCode == ErrCodeBlocked || result.ErrorCode == ErrCodeSSRFBlocked || strings.HasPrefix(result.Error, "Blocked URL"):
+		return "blocked"
+	case result.ErrorCode == ErrCodeNotHTML:
+		return "not_html"
+	case result.ErrorCode == ErrCodeTooLarge:
+		return "too_large"
+	case result.ErrorCode == ErrCodeRobotsDisallowed:
+		return "robots"
+	case result.ErrorCode == ErrCodeCircuitOpen:
+		return "circuit_open"
+	case strings.HasPrefix(result.Error, "HTTP error: 4"):
+		return "http_4xx"
+	case strings.HasPrefix(result.Error, "HTTP error: 5"):
+		return "http_5xx"
+	case strings.HasPrefix(result.Error, "HTTP error"):
+		return "http_other"
+	case result.ErrorCode == ErrCodeRateLimited:
+		return "cooldown"
+	case result.Retryable:
+		return "transient"
+	case strings.HasPrefix(result.Error, "Failed to read response body"):
+		return "read"
+	default:
+		return "fetch"
+	}
+}
+
+// metricsMiddleware counts requests and records their latency by route
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// handleMetrics serves the Prometheus metrics, including gauges read from the
+// service's cache, worker pool and admission queue at scrape time
+func handleMetrics(service *PreviewService, admission *AdmissionController) gin.HandlerFunc {
+	registry := prometheus.NewRegistry()
+	cacheStat := func(read func(CacheStats) float64) func() float64 {
+		return func() float64 { return read(service.cache.Stats(0)) }
+	}
+
+	registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "linkpreview_cache_hits_total", Help: "Preview cache hits.",
+		}, cacheStat(func(s CacheStats) float64 { return float64(s.Hits) })),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "linkpreview_cache_misses_total", Help: "Preview cache misses.",
+		}, cacheStat(func(s CacheStats) float64 { return float64(s.Misses) })),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "linkpreview_cache_evictions_total", Help: "Preview cache evictions.",
+		}, cacheStat(func(s CacheStats) float64 { return float64(s.Evictions) })),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "linkpreview_cache_hit_ratio", Help: "Preview cache hit ratio since startup.",
+		}, cacheStat(func(s CacheStats) float64 { return s.HitRate })),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "linkpreview_cache_entries", Help: "Previews currently cached.",
+		}, cacheStat(func(s CacheStats) float64 { return float64(s.Entries) })),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "linkpreview_cache_memory_bytes", Help: "Estimated memory held by cached previews.",
+		}, cacheStat(func(s CacheStats) float64 { return float64(s.MemoryBytes) })),
+
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "linkpreview_worker_pool_workers", Help: "Fetch workers.",
+		}, func() float64 { return float64(service.pool.Stats().Workers) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "linkpreview_worker_pool_active", Help: "Fetch workers currently busy.",
+		}, func() float64 { return float64(service.pool.Stats().Active) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "linkpreview_worker_pool_queued", Help: "Fetches waiting for a worker.",
+		}, func() float64 { return float64(service.pool.Stats().Queued) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "linkpreview_worker_pool_queue_capacity", Help: "Maximum fetches that may wait for a worker.",
+		}, func() float64 { return float64(service.pool.Stats().QueueCapacity) }),
+
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "linkpreview_admission_in_flight", Help: "Requests currently admitted.",
+		}, func() float64 { inFlight, _ := admission.Stats(); return float64(inFlight) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "linkpreview_admission_waiting", Help: "Requests waiting in the admission queue.",
+		}, func() float64 { _, waiting := admission.Stats(); return float64(waiting) }),
+	)
+
+	handler := promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, registry}, promhttp.HandlerOpts{})
+	return gin.WrapH(handler)
+}
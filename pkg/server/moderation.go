@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ImageModerator scores preview images with an external NSFW classification API
+//
+// The image is downloaded by this service (so the SSRF and domain checks apply)
+// and POSTed as the raw request body to the moderation endpoint, which must
+// answer with JSON containing a score between 0 and 1 in "nsfw_score" or "score"
+type ImageModerator struct {
+	endpoint  string
+	apiKey    string
+	extractor *MetaExtractor
+	client    *http.Client
+}
+
+// maxModeratedImageBytes caps the size of images sent for classification
+const maxModeratedImageBytes = 5 * 1024 * 1024
+
+// NewImageModerator creates a moderator posting images to endpoint
+// Returns nil when endpoint is empty, meaning NSFW detection is disabled
+func NewImageModerator(endpoint, apiKey string, extractor *MetaExtractor) *ImageModerator {
+	if endpoint == "" {
+		return nil
+	}
+	return &ImageModerator{
+		endpoint:  endpoint,
+		apiKey:    apiKey,
+		extractor: extractor,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Score downloads imageURL (resolved against pageURL) and returns its NSFW score
+func (im *ImageModerator) Score(ctx context.Context, pageURL, imageURL string) (float64, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return 0, err
+	}
+	target, err := base.Parse(imageURL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid image URL: %v", err)
+	}
+
+	image, contentType, err := im.extractor.fetchImage(ctx, target, maxModeratedImageBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", im.endpoint, bytes.NewReader(image))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Image-URL", target.String())
+	if im.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+im.apiKey)
+	}
+
+	resp, err := im.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("moderation request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("moderation request failed: %s", resp.Status)
+	}
+
+	var result struct {
+		NSFWScore *float64 `json:"nsfw_score"`
+		Score     *float64 `json:"score"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("invalid moderation response: %v", err)
+	}
+	switch {
+	case result.NSFWScore != nil:
+		return *result.NSFWScore, nil
+	case result.Score != nil:
+		return *result.Score, nil
+	}
+	return 0, fmt.Errorf("moderation response has no score")
+}
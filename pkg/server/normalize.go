@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// trackingParams are query parameters that only tell analytics where a
+// visitor came from, never which page to serve; parameters starting with
+// "utm_" are tracking parameters too
+var trackingParams = map[string]bool{
+	"fbclid":      true, // Facebook
+	"gclid":       true, // Google Ads
+	"gbraid":      true,
+	"wbraid":      true,
+	"dclid":       true, // Google Display & Video
+	"msclkid":     true, // Microsoft Ads
+	"yclid":       true, // Yandex
+	"twclid":      true, // X
+	"ttclid":      true, // TikTok
+	"igshid":      true, // Instagram
+	"li_fat_id":   true, // LinkedIn
+	"mc_cid":      true, // Mailchimp
+	"mc_eid":      true,
+	"_hsenc":      true, // HubSpot
+	"_hsmi":       true,
+	"mkt_tok":     true, // Marketo
+	"_ga":         true, // Google Analytics cross-domain linking
+	"_gl":         true,
+	"oly_anon_id": true, // Omeda
+	"oly_enc_id":  true,
+	"vero_id":     true, // Vero
+}
+
+// normalizeURL returns the canonical form of a target URL, which identifies
+// it in the cache, for request coalescing, in the preview store and
+// wherever else URLs are compared: scheme defaulted to https, scheme and
+// host lowercased, internationalized hosts in punycode, default ports
+// removed, an empty path as "/", escapes normalized, tracking parameters
+// removed, the query sorted by parameter name and the fragment removed
+func normalizeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if parsed.Scheme == "" {
+		parsed, err = url.Parse("https://" + rawURL)
+		if err != nil {
+			return rawURL
+		}
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = asciiHost(parsed.Host)
+	if port := parsed.Port(); (parsed.Scheme == "https" && port == "443") || (parsed.Scheme == "http" && port == "80") {
+		parsed.Host = strings.TrimSuffix(parsed.Host, ":"+port)
+	}
+	parsed.RawPath = normalizeEscapes(parsed.EscapedPath())
+	if parsed.RawPath == "" && parsed.Host != "" {
+		parsed.RawPath = "/"
+	}
+	parsed.Path, _ = url.PathUnescape(parsed.RawPath)
+	parsed.RawQuery = normalizeQuery(normalizeEscapes(parsed.RawQuery))
+	parsed.ForceQuery = false
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	return parsed.String()
+}
+
+// normalizeQuery removes the tracking parameters and empty pairs of the
+// escaped query rawQuery and sorts the rest by name. Parameters repeated
+// keep their order, which may matter to the page
+func normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	pairs := strings.Split(rawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		if pair != "" && !trackingParam(queryName(pair)) {
+			kept = append(kept, pair)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return queryName(kept[i]) < queryName(kept[j]) })
+	return strings.Join(kept, "&")
+}
+
+// queryName returns the escaped name of the query parameter pair "name=value"
+func queryName(pair string) string {
+	name, _, _ := strings.Cut(pair, "=")
+	return name
+}
+
+// trackingParam reports whether the escaped query parameter name is a
+// tracking parameter
+func trackingParam(name string) bool {
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		name = unescaped
+	}
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
@@ -0,0 +1,82 @@
+package server
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		// scheme and host
+		{"example.com", "https://example.com/"},
+		{"  https://example.com/a  ", "https://example.com/a"},
+		{"HTTPS://Example.COM/Path", "https://example.com/Path"},
+
+		// default ports
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"http://example.com:80/a", "http://example.com/a"},
+		{"http://example.com:443/a", "http://example.com:443/a"},
+		{"https://example.com:8443/a", "https://example.com:8443/a"},
+
+		// trailing slashes: only an empty path becomes "/"
+		{"https://example.com", "https://example.com/"},
+		{"https://example.com?a=1", "https://example.com/?a=1"},
+		{"https://example.com/a/", "https://example.com/a/"},
+		{"https://example.com/a", "https://example.com/a"},
+
+		// tracking parameters
+		{"https://example.com/?utm_source=x&utm_medium=y", "https://example.com/"},
+		{"https://example.com/?id=1&UTM_Campaign=z&fbclid=abc", "https://example.com/?id=1"},
+		{"https://example.com/?gclid=1&q=go&_ga=2", "https://example.com/?q=go"},
+		{"https://example.com/?utm%5Fsource=x&q=1", "https://example.com/?q=1"},
+
+		// query order
+		{"https://example.com/?b=2&a=1", "https://example.com/?a=1&b=2"},
+		{"https://example.com/?b=2&a=1&b=1", "https://example.com/?a=1&b=2&b=1"},
+		{"https://example.com/?&a=1&&", "https://example.com/?a=1"},
+		{"https://example.com/?", "https://example.com/"},
+
+		// IDN hosts
+		{"https://Bücher.example/", "https://xn--bcher-kva.example/"},
+		{"https://bücher.example:443/", "https://xn--bcher-kva.example/"},
+		{"https://xn--bcher-kva.example/", "https://xn--bcher-kva.example/"},
+		{"https://[2001:DB8::1]:443/", "https://[2001:db8::1]/"},
+
+		// fragments
+		{"https://example.com/a#section", "https://example.com/a"},
+		{"https://example.com/a?b=1#", "https://example.com/a?b=1"},
+
+		// escapes
+		{"https://example.com/%7euser", "https://example.com/~user"},
+		{"https://example.com/a%2fb", "https://example.com/a%2Fb"},
+		{"https://example.com/caf%c3%a9", "https://example.com/caf%C3%A9"},
+	}
+	for _, tt := range tests {
+		if got := normalizeURL(tt.raw); got != tt.want {
+			t.Errorf("normalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"a=1", "a=1"},
+		{"c=3&a=1&b=2", "a=1&b=2&c=3"},
+		{"tag=z&tag=a&id=1", "id=1&tag=z&tag=a"},
+		{"utm_source=news&id=1", "id=1"},
+		{"id=1&Fbclid=x&msclkid=y", "id=1"},
+		{"utm_source=a&fbclid=b", ""},
+		{"a=1&&b=2&", "a=1&b=2"},
+		{"flag&a=1", "a=1&flag"},
+		{"utm=1", "utm=1"},
+	}
+	for _, tt := range tests {
+		if got := normalizeQuery(tt.raw); got != tt.want {
+			t.Errorf("normalizeQuery(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTValidator validates bearer JWTs issued by a configured OIDC provider
+// Signing keys are fetched from the provider's JWKS endpoint and cached
+type JWTValidator struct {
+	issuer   string
+	audience string
+	jwksURL  string
+	client   *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]interface{} // Public keys by kid
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+const (
+	// jwksRefreshInterval is how long fetched signing keys are trusted before refetching
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefetch limits how often an unknown kid can trigger a refetch
+	jwksMinRefetch = time.Minute
+)
+
+// NewJWTValidator creates a validator for tokens from issuer
+// When jwksURL is empty it is discovered from the issuer's OpenID configuration.
+// Returns nil when issuer is empty, meaning JWT authentication is disabled
+func NewJWTValidator(issuer, audience, jwksURL string) *JWTValidator {
+	if issuer == "" {
+		return nil
+	}
+	return &JWTValidator{
+		issuer:   issuer,
+		audience: audience,
+		jwksURL:  jwksURL,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		keys:     make(map[string]interface{}),
+	}
+}
+
+// Validate verifies the token signature and its iss, aud and exp claims
+// and returns the token's subject
+func (v *JWTValidator) Validate(ctx context.Context, tokenString string) (string, error) {
+	options := []jwt.ParserOption{
+		jwt.WithIssuer(v.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+	}
+	if v.audience != "" {
+		options = append(options, jwt.WithAudience(v.audience))
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.key(ctx, kid)
+	}, options...)
+	if err != nil {
+		return "", err
+	}
+
+	return token.Claims.GetSubject()
+}
+
+// key returns the signing key for kid, refreshing the JWKS when it is stale or the kid is unknown
+func (v *JWTValidator) key(ctx context.Context, kid string) (interface{}, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	fresh := time.Since(v.fetchedAt) < jwksRefreshInterval
+	canRefetch := time.Since(v.lastAttempt) >= jwksMinRefetch
+	v.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+	if !fresh || canRefetch {
+		if err := v.refresh(ctx); err != nil && !ok {
+			return nil, err
+		}
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// refresh fetches the JWKS (discovering its URL first if needed) and replaces the cached keys
+func (v *JWTValidator) refresh(ctx context.Context) error {
+	v.mu.Lock()
+	v.lastAttempt = time.Now()
+	jwksURL := v.jwksURL
+	v.mu.Unlock()
+
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		wellKnown := strings.TrimSuffix(v.issuer, "/") + "/.well-known/openid-configuration"
+		if err := v.getJSON(ctx, wellKnown, &discovery); err != nil {
+			return fmt.Errorf("OIDC discovery failed: %v", err)
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("OIDC discovery document has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.getJSON(ctx, jwksURL, &jwks); err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	v.mu.Lock()
+	v.jwksURL = jwksURL
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+// getJSON fetches url and decodes the JSON response into out
+func (v *JWTValidator) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jsonWebKey is the subset of RFC 7517 needed for RSA and EC signature keys
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts the JWK into an *rsa.PublicKey or *ecdsa.PublicKey
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url-encoded big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
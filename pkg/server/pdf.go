@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handlePDF serves GET /pdf: the page at the "url" query parameter rendered in
+// headless Chromium and printed to a PDF, for archiving shared links. The page
+// URL goes through the same domain policy and SSRF checks as preview fetches,
+// and the domain's render options apply. store, which may be nil, keeps the
+// captures and redirects to one younger than maxAge instead of rendering again
+func handlePDF(extractor *MetaExtractor, timeout time.Duration, store *MediaStore, maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pageURL, err := url.Parse(c.Query("url"))
+		if err != nil || (pageURL.Scheme != "http" && pageURL.Scheme != "https") || pageURL.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Query parameter 'url' must be an absolute http(s) URL",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		if err := extractor.checkTarget(ctx, pageURL); err != nil {
+			status, code := http.StatusForbidden, fetchErrorCode(err)
+			if code == ErrCodeDNS {
+				status = http.StatusBadGateway
+			}
+			c.JSON(status, gin.H{"error": fmt.Sprintf("Blocked URL: %v", err), "error_code": code})
+			return
+		}
+
+		key := store.Key("pdf", pageURL.String())
+		if store.Redirect(c, key, maxAge) {
+			return
+		}
+
+		ctx, span := tracer.Start(ctx, "pdf")
+		pdf, err := extractor.renderer.PDF(ctx, pageURL.String(), extractor.renderOptions(ctx, pageURL.String()))
+		span.End()
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Timed out rendering the page", "error_code": ErrCodeTimeout})
+			return
+		}
+		if err != nil {
+			slog.Warn("PDF capture failed", "url", pageURL.String(), "error", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to render page: %v", err)})
+			return
+		}
+
+		store.Save(key, pdf, "application/pdf")
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", pageURL.Hostname()+".pdf"))
+		c.Header("Content-Length", strconv.Itoa(len(pdf)))
+		c.Data(http.StatusOK, "application/pdf", pdf)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// ErrCodeBlocked is reported in error_code when a URL is refused by the domain or redirect policy
+const ErrCodeBlocked = string(linkpreview.ErrCodeBlocked)
+
+// PolicyError describes why a domain was refused by the DomainPolicy
+type PolicyError struct {
+	Domain string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("domain %q is %s", e.Domain, e.Reason)
+}
+
+// DomainPolicy decides which target domains may be previewed
+// Patterns like "example.com" match the domain and all of its subdomains,
+// while "*.example.com" matches subdomains only. Blocked patterns win over allowed ones,
+// and an empty allowlist allows every domain that isn't blocked
+type DomainPolicy struct {
+	mu      sync.RWMutex
+	allowed []string
+	blocked []string
+}
+
+// NewDomainPolicy creates a policy from allowed and blocked domain patterns
+func NewDomainPolicy(allowed, blocked []string) *DomainPolicy {
+	return &DomainPolicy{
+		allowed: normalizePatterns(allowed),
+		blocked: normalizePatterns(blocked),
+	}
+}
+
+// Update replaces the allowed and blocked domain patterns
+func (dp *DomainPolicy) Update(allowed, blocked []string) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	dp.allowed = normalizePatterns(allowed)
+	dp.blocked = normalizePatterns(blocked)
+}
+
+// Check returns a *PolicyError if host may not be previewed
+func (dp *DomainPolicy) Check(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	dp.mu.RLock()
+	defer dp.mu.RUnlock()
+
+	for _, pattern := range dp.blocked {
+		if matchDomain(pattern, host) {
+			return &PolicyError{Domain: host, Reason: "blocked by policy"}
+		}
+	}
+
+	if len(dp.allowed) == 0 {
+		return nil
+	}
+	for _, pattern := range dp.allowed {
+		if matchDomain(pattern, host) {
+			return nil
+		}
+	}
+	return &PolicyError{Domain: host, Reason: "not in the allowed domains list"}
+}
+
+// matchDomain reports whether host matches a normalized domain pattern
+func matchDomain(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
+
+// normalizePatterns lowercases patterns, converts them to punycode and drops empty entries
+func normalizePatterns(patterns []string) []string {
+	var normalized []string
+	for _, p := range patterns {
+		p = normalizeDomain(p)
+		if p != "" {
+			normalized = append(normalized, p)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostLimiter keeps outbound traffic to any single host polite by capping
+// concurrent requests and spacing request starts to a maximum rate
+type HostLimiter struct {
+	maxConcurrent int     // Simultaneous requests per host; <= 0 means unlimited
+	perSecond     float64 // Request starts per second per host; <= 0 means unlimited
+
+	mu        sync.Mutex
+	hosts     map[string]*hostSlot
+	lastSweep time.Time
+}
+
+// hostSlot is the politeness state of one host
+type hostSlot struct {
+	sem      chan struct{} // Holds one token per in-flight request
+	next     time.Time     // Earliest time the next request may start
+	lastUsed time.Time
+}
+
+// NewHostLimiter creates a limiter allowing maxConcurrent requests and perSecond request starts per host
+// Returns nil when both limits are disabled
+func NewHostLimiter(maxConcurrent int, perSecond float64) *HostLimiter {
+	if maxConcurrent <= 0 && perSecond <= 0 {
+		return nil
+	}
+	return &HostLimiter{
+		maxConcurrent: maxConcurrent,
+		perSecond:     perSecond,
+		hosts:         make(map[string]*hostSlot),
+		lastSweep:     time.Now(),
+	}
+}
+
+// Acquire waits until a request to host may start and returns a func that must be
+// called when the request is finished. It fails only when ctx is done first
+func (hl *HostLimiter) Acquire(ctx context.Context, host string) (func(), error) {
+	slot, wait := hl.reserve(strings.ToLower(host))
+
+	// Honor the rate limit first so a waiting request doesn't hold a concurrency slot
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	if slot.sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case slot.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { <-slot.sem }) }, nil
+}
+
+// reserve claims the next start time for host and returns its slot and how long to wait
+func (hl *HostLimiter) reserve(host string) (*hostSlot, time.Duration) {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	now := time.Now()
+	hl.sweep(now)
+
+	slot, ok := hl.hosts[host]
+	if !ok {
+		slot = &hostSlot{}
+		if hl.maxConcurrent > 0 {
+			slot.sem = make(chan struct{}, hl.maxConcurrent)
+		}
+		hl.hosts[host] = slot
+	}
+	slot.lastUsed = now
+
+	if hl.perSecond <= 0 {
+		return slot, 0
+	}
+	start := now
+	if slot.next.After(now) {
+		start = slot.next
+	}
+	slot.next = start.Add(time.Duration(float64(time.Second) / hl.perSecond))
+	return slot, start.Sub(now)
+}
+
+// sweep drops idle hosts so the map doesn't grow without bound
+// Callers must hold hl.mu
+func (hl *HostLimiter) sweep(now time.Time) {
+	if now.Sub(hl.lastSweep) < time.Minute {
+		return
+	}
+	hl.lastSweep = now
+	for host, slot := range hl.hosts {
+		if len(slot.sem) == 0 && now.Sub(slot.lastUsed) > time.Minute && now.After(slot.next) {
+			delete(hl.hosts, host)
+		}
+	}
+}
+
+// politeTransport applies a HostLimiter to every request sent through next,
+// including redirects and robots.txt fetches
+type politeTransport struct {
+	next    http.RoundTripper
+	limiter *HostLimiter
+}
+
+// RoundTrip waits for the target host's limiter before sending req
+// The concurrency slot is held until the response body is closed
+func (pt *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := pt.limiter.Acquire(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := pt.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody releases a host slot when the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
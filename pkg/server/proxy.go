@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxySelector picks the outbound proxy for each fetch
+// Per-domain rules are checked in order before falling back to the default proxy
+type ProxySelector struct {
+	defaultProxy *url.URL // nil means direct (or the environment's HTTP_PROXY settings)
+	useEnv       bool
+	rules        []proxyRule
+}
+
+// proxyRule routes hosts matching pattern through proxy (nil means direct)
+type proxyRule struct {
+	pattern string
+	proxy   *url.URL
+}
+
+// NewProxySelector creates a selector from the default proxy URL and a list of
+// "pattern=proxy-url" rules where proxy-url may be "direct"
+// Supported proxy schemes are http, https and socks5
+func NewProxySelector(defaultProxy string, rules []string) (*ProxySelector, error) {
+	ps := &ProxySelector{useEnv: defaultProxy == ""}
+
+	if defaultProxy != "" && defaultProxy != "direct" {
+		proxyURL, err := parseProxyURL(defaultProxy)
+		if err != nil {
+			return nil, err
+		}
+		ps.defaultProxy = proxyURL
+	}
+
+	for _, rule := range rules {
+		pattern, target, ok := strings.Cut(rule, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid proxy rule %q, expected pattern=proxy-url", rule)
+		}
+		r := proxyRule{pattern: strings.ToLower(strings.TrimSpace(pattern))}
+		if target = strings.TrimSpace(target); target != "direct" {
+			proxyURL, err := parseProxyURL(target)
+			if err != nil {
+				return nil, err
+			}
+			r.proxy = proxyURL
+		}
+		ps.rules = append(ps.rules, r)
+	}
+
+	return ps, nil
+}
+
+// Proxy implements http.Transport.Proxy
+func (ps *ProxySelector) Proxy(req *http.Request) (*url.URL, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	for _, rule := range ps.rules {
+		if matchDomain(rule.pattern, host) {
+			return rule.proxy, nil
+		}
+	}
+	if ps.useEnv {
+		return http.ProxyFromEnvironment(req)
+	}
+	return ps.defaultProxy, nil
+}
+
+// Hosts returns the hostnames of every configured proxy
+// The SSRF guard must allow dialing these even when they live on a private network
+func (ps *ProxySelector) Hosts() []string {
+	var hosts []string
+	if ps.defaultProxy != nil {
+		hosts = append(hosts, ps.defaultProxy.Hostname())
+	}
+	for _, rule := range ps.rules {
+		if rule.proxy != nil {
+			hosts = append(hosts, rule.proxy.Hostname())
+		}
+	}
+	return hosts
+}
+
+// parseProxyURL validates an outbound proxy URL
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %v", raw, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q in %q", proxyURL.Scheme, raw)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", raw)
+	}
+	return proxyURL, nil
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimiter enforces a token-bucket rate limit and an optional daily quota per client identity
+type RateLimiter struct {
+	mu         sync.Mutex
+	perMinute  int // Sustained requests per minute; <= 0 disables the rate limit
+	burst      int // Bucket capacity
+	dailyQuota int // Requests per UTC day; <= 0 disables the quota
+	clients    map[string]*clientUsage
+	lastSweep  time.Time
+}
+
+// clientUsage is the rate-limit state tracked for one identity
+type clientUsage struct {
+	tokens   float64
+	last     time.Time
+	day      string
+	dayCount int
+}
+
+// RateLimitDecision is the outcome of a rate-limit check
+type RateLimitDecision struct {
+	Allowed        bool
+	Reason         string // "rate_limit" or "daily_quota" when not allowed
+	Limit          int
+	Remaining      int
+	Reset          time.Time // When the bucket is full again
+	RetryAfter     time.Duration
+	QuotaLimit     int
+	QuotaUsed      int
+	QuotaRemaining int
+	QuotaReset     time.Time
+}
+
+// clientIdleTTL is how long an idle identity's state is kept before being swept
+const clientIdleTTL = 24 * time.Hour
+
+// NewRateLimiter creates a limiter allowing perMinute requests per minute with the given burst
+// and at most dailyQuota requests per UTC day
+func NewRateLimiter(perMinute, burst, dailyQuota int) *RateLimiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &RateLimiter{
+		perMinute:  perMinute,
+		burst:      burst,
+		dailyQuota: dailyQuota,
+		clients:    make(map[string]*clientUsage),
+		lastSweep:  time.Now(),
+	}
+}
+
+// Enabled reports whether the limiter enforces anything
+func (rl *RateLimiter) Enabled() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.perMinute > 0 || rl.dailyQuota > 0
+}
+
+// SetLimits changes the rate limit, burst and daily quota, keeping each client's
+// usage so far. Buckets holding more tokens than the new burst are trimmed to it
+func (rl *RateLimiter) SetLimits(perMinute, burst, dailyQuota int) {
+	if burst <= 0 {
+		burst = perMinute
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.perMinute = perMinute
+	rl.burst = burst
+	rl.dailyQuota = dailyQuota
+	for _, usage := range rl.clients {
+		usage.tokens = math.Min(usage.tokens, float64(burst))
+	}
+}
+
+// Allow consumes one request for identity if the rate limit and quota permit it
+func (rl *RateLimiter) Allow(identity string) RateLimitDecision {
+	return rl.check(identity, true)
+}
+
+// Peek reports the current allowance for identity without consuming anything
+func (rl *RateLimiter) Peek(identity string) RateLimitDecision {
+	return rl.check(identity, false)
+}
+
+func (rl *RateLimiter) check(identity string, consume bool) RateLimitDecision {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.sweep(now)
+
+	usage, ok := rl.clients[identity]
+	if !ok {
+		usage = &clientUsage{tokens: float64(rl.burst), last: now}
+		rl.clients[identity] = usage
+	}
+
+	// Refill the bucket for the time elapsed since the last request
+	ratePerSec := float64(rl.perMinute) / 60
+	if rl.perMinute > 0 {
+		usage.tokens = math.Min(float64(rl.burst), usage.tokens+now.Sub(usage.last).Seconds()*ratePerSec)
+	}
+	usage.last = now
+
+	// Reset the daily counter at UTC midnight
+	today := now.UTC().Format("2006-01-02")
+	if usage.day != today {
+		usage.day = today
+		usage.dayCount = 0
+	}
+	year, month, day := now.UTC().Date()
+	midnight := time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+
+	decision := RateLimitDecision{
+		Allowed:    true,
+		Limit:      rl.perMinute,
+		QuotaLimit: rl.dailyQuota,
+		QuotaReset: midnight,
+	}
+
+	switch {
+	case rl.dailyQuota > 0 && usage.dayCount >= rl.dailyQuota:
+		decision.Allowed = false
+		decision.Reason = "daily_quota"
+		decision.RetryAfter = midnight.Sub(now)
+	case rl.perMinute > 0 && usage.tokens < 1:
+		decision.Allowed = false
+		decision.Reason = "rate_limit"
+		decision.RetryAfter = time.Duration((1 - usage.tokens) / ratePerSec * float64(time.Second))
+	case consume:
+		if rl.perMinute > 0 {
+			usage.tokens--
+		}
+		usage.dayCount++
+	}
+
+	decision.Remaining = int(usage.tokens)
+	if rl.perMinute > 0 {
+		decision.Reset = now.Add(time.Duration((float64(rl.burst) - usage.tokens) / ratePerSec * float64(time.Second)))
+	}
+	decision.QuotaUsed = usage.dayCount
+	if rl.dailyQuota > 0 {
+		decision.QuotaRemaining = rl.dailyQuota - usage.dayCount
+	}
+	return decision
+}
+
+// sweep drops state for identities that have been idle for clientIdleTTL
+// Callers must hold rl.mu
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < time.Hour {
+		return
+	}
+	rl.lastSweep = now
+	for identity, usage := range rl.clients {
+		if now.Sub(usage.last) > clientIdleTTL {
+			delete(rl.clients, identity)
+		}
+	}
+}
+
+// setRateLimitHeaders writes the X-RateLimit-* headers describing a decision
+func setRateLimitHeaders(c *gin.Context, d RateLimitDecision) {
+	if d.Limit > 0 {
+		c.Header("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(d.Reset.Unix(), 10))
+	}
+	if d.QuotaLimit > 0 {
+		c.Header("X-RateLimit-Quota-Limit", strconv.Itoa(d.QuotaLimit))
+		c.Header("X-RateLimit-Quota-Remaining", strconv.Itoa(d.QuotaRemaining))
+		c.Header("X-RateLimit-Quota-Reset", strconv.FormatInt(d.QuotaReset.Unix(), 10))
+	}
+}
+
+// abortRateLimited responds with 429 and a Retry-After header
+func abortRateLimited(c *gin.Context, d RateLimitDecision) {
+	retryAfter := int(math.Ceil(d.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+	message := "Rate limit exceeded"
+	if d.Reason == "daily_quota" {
+		message = "Daily quota exceeded"
+	}
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       fmt.Sprintf("%s. Retry after %d seconds.", message, retryAfter),
+		"reason":      d.Reason,
+		"retry_after": retryAfter,
+		"request_id":  c.GetString("request_id"),
+	})
+}
+
+// clientIdentity returns the authenticated identity set by requireAuth, if any
+func clientIdentity(c *gin.Context) string {
+	if key := c.GetString("api_key"); key != "" {
+		return "key:" + key
+	}
+	if subject := c.GetString("jwt_subject"); subject != "" {
+		return "sub:" + subject
+	}
+	return ""
+}
+
+// keyLimiter returns the limiter of the tenant of the request, if it has its
+// own limits, else limiter
+func keyLimiter(c *gin.Context, limiter *RateLimiter) *RateLimiter {
+	if tenant := TenantFrom(c.Request.Context()); tenant != nil && tenant.limiter != nil {
+		return tenant.limiter
+	}
+	return limiter
+}
+
+// rateLimitByAPIKey applies the per-key rate limit and daily quota to authenticated requests,
+// those of the key's tenant when it has its own. It must run after requireAuth;
+// unauthenticated requests pass through untouched
+func rateLimitByAPIKey(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := clientIdentity(c)
+		limiter := keyLimiter(c, limiter)
+		if identity == "" || !limiter.Enabled() {
+			c.Next()
+			return
+		}
+
+		decision := limiter.Allow(identity)
+		setRateLimitHeaders(c, decision)
+		if !decision.Allowed {
+			abortRateLimited(c, decision)
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitByIP applies the per-client-IP rate limit to anonymous requests
+// Client IPs come from gin's ClientIP, which only honors X-Forwarded-For and
+// X-Real-IP when the request arrives from a configured trusted proxy.
+// Authenticated requests are limited per API key instead
+func rateLimitByIP(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limiter.Enabled() || clientIdentity(c) != "" {
+			c.Next()
+			return
+		}
+
+		decision := limiter.Allow("ip:" + c.ClientIP())
+		setRateLimitHeaders(c, decision)
+		if !decision.Allowed {
+			abortRateLimited(c, decision)
+			return
+		}
+		c.Next()
+	}
+}
+
+// handleQuota reports the caller's remaining rate-limit allowance and daily quota
+func handleQuota(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := clientIdentity(c)
+		if identity == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Quotas are tracked per API key. Authenticate to see your allowance.",
+			})
+			return
+		}
+
+		d := keyLimiter(c, limiter).Peek(identity)
+		setRateLimitHeaders(c, d)
+
+		response := gin.H{}
+		if d.Limit > 0 {
+			response["rate_limit"] = gin.H{
+				"limit_per_minute": d.Limit,
+				"remaining":        d.Remaining,
+				"reset":            d.Reset.UTC().Truncate(time.Second),
+			}
+		}
+		if d.QuotaLimit > 0 {
+			response["daily_quota"] = gin.H{
+				"limit":     d.QuotaLimit,
+				"used":      d.QuotaUsed,
+				"remaining": d.QuotaRemaining,
+				"reset":     d.QuotaReset,
+			}
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
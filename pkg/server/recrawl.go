@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Recrawler refreshes stored previews on a schedule, most requested URLs
+// first, so they stay fresh without a user waiting for the fetch, and
+// notifies webhooks of the previews that changed
+type Recrawler struct {
+	service     *PreviewService
+	webhooks    *WebhookNotifier
+	schedule    cron.Schedule
+	batch       int           // URLs refreshed per run at most
+	minAge      time.Duration // Previews fetched more recently are left alone
+	maxIdle     time.Duration // URLs not requested for this long are left alone
+	concurrency int
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewRecrawler creates a recrawler running on the cron schedule of
+// RECRAWL_SCHEDULE, or returns nil when none is set or there is no preview
+// store to find URLs in
+func NewRecrawler(service *PreviewService, config *Config) (*Recrawler, error) {
+	if config.RecrawlSchedule == "" {
+		return nil, nil
+	}
+	if service.store == nil {
+		return nil, errors.New("RECRAWL_SCHEDULE needs a preview store (STORE_DSN)")
+	}
+	schedule, err := cron.ParseStandard(config.RecrawlSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RECRAWL_SCHEDULE: %v", err)
+	}
+	return &Recrawler{
+		service:     service,
+		webhooks:    NewWebhookNotifier(service.store, service.extractor, config),
+		schedule:    schedule,
+		batch:       max(config.RecrawlBatch, 1),
+		minAge:      config.RecrawlMinAge,
+		maxIdle:     config.RecrawlMaxIdle,
+		concurrency: max(config.RecrawlConcurrency, 1),
+		stop:        make(chan struct{}),
+	}, nil
+}
+
+// Run refreshes previews at every scheduled time until Stop. A run still
+// going when the next one is due delays it rather than overlapping
+func (r *Recrawler) Run() {
+	if r == nil {
+		return
+	}
+	for {
+		next := r.schedule.Next(time.Now())
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			r.recrawl()
+		case <-r.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Stop ends Run; a run in progress finishes the fetches it started
+func (r *Recrawler) Stop() {
+	if r == nil {
+		return
+	}
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+// recrawl refreshes the URLs due, logging how it went
+func (r *Recrawler) recrawl() {
+	ctx, span := tracer.Start(context.Background(), "recrawl")
+	defer span.End()
+
+	now := time.Now()
+	urls, err := r.service.store.DueForRefresh(ctx, now.Add(-r.minAge), now.Add(-r.maxIdle), r.batch)
+	if err != nil {
+		slog.Warn("Recrawl skipped: could not list stored URLs", "error", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("recrawl.urls", len(urls)))
+	if len(urls) == 0 {
+		return
+	}
+
+	var refreshed, failed atomic.Int64
+	sem := make(chan struct{}, r.concurrency)
+	var wg sync.WaitGroup
+loop:
+	for _, target := range urls {
+		select {
+		case <-r.stop:
+			break loop
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fetchCtx, cancel := context.WithTimeout(ctx, r.service.fetchTimeout)
+			defer cancel()
+			before, err := r.service.store.Latest(fetchCtx, target)
+			if err != nil {
+				slog.Warn("Could not read stored preview", "url", target, "error", err)
+			}
+			result, err := r.service.Refresh(fetchCtx, target)
+			if err != nil || result.Error != "" {
+				failed.Add(1)
+				return
+			}
+			refreshed.Add(1)
+			if before != nil {
+				r.webhooks.Notify(fetchCtx, target, before.Preview, result)
+			}
+		}()
+	}
+	wg.Wait()
+	slog.Info("Recrawl finished", "due", len(urls), "refreshed", refreshed.Load(), "failed", failed.Load(), "duration_ms", time.Since(now).Milliseconds())
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// RedirectPolicy controls which redirects the extractor follows
+type RedirectPolicy struct {
+	MaxRedirects   int  // Maximum number of redirects to follow
+	BlockDowngrade bool // Refuse https → http redirects
+	AllowCrossHost bool // Follow redirects to a different host
+	// Follow the meta refresh and script redirects of pages, which count
+	// against MaxRedirects like HTTP redirects
+	FollowClientRedirects bool
+}
+
+// Kinds of redirects pages make in the browser rather than over HTTP
+const (
+	RedirectMetaRefresh = "meta-refresh"
+	RedirectScript      = "script"
+)
+
+// RedirectHop records one redirect followed while fetching a preview
+type RedirectHop struct {
+	URL       string `json:"url"`              // URL redirected to
+	Status    int    `json:"status,omitempty"` // Redirect status code (301, 302, ...)
+	Type      string `json:"type,omitempty"`   // RedirectMetaRefresh or RedirectScript; empty for HTTP redirects
+	CrossHost bool   `json:"cross_host"`       // Whether the redirect changed host
+}
+
+// RedirectError is returned when a redirect violates the RedirectPolicy
+type RedirectError struct {
+	From   string
+	To     string
+	Reason string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirect from %s to %s refused: %s", e.From, e.To, e.Reason)
+}
+
+// redirectChainKey is the context key under which the redirect chain of a fetch is recorded
+type redirectChainKey struct{}
+
+// withRedirectChain returns a context that records followed redirects into chain
+func withRedirectChain(ctx context.Context, chain *[]RedirectHop) context.Context {
+	return context.WithValue(ctx, redirectChainKey{}, chain)
+}
+
+// check applies the policy to a pending redirect and records it in the request's chain
+func (rp RedirectPolicy) check(req *http.Request, via []*http.Request) error {
+	prev := via[len(via)-1]
+	crossHost, err := rp.allow(TenantFrom(req.Context()), prev.URL, req.URL, clientRedirectsFrom(req.Context())+len(via))
+	if err != nil {
+		return err
+	}
+
+	if chain, ok := req.Context().Value(redirectChainKey{}).(*[]RedirectHop); ok {
+		hop := RedirectHop{URL: req.URL.String(), CrossHost: crossHost}
+		if req.Response != nil {
+			hop.Status = req.Response.StatusCode
+		}
+		*chain = append(*chain, hop)
+	}
+	return nil
+}
+
+// allow applies the policy, and the allowed domains of tenant, which may be
+// nil, to a redirect from one URL to another, followed after hops others,
+// and reports whether it changes host
+func (rp RedirectPolicy) allow(tenant *Tenant, from, to *url.URL, hops int) (bool, error) {
+	if hops > rp.MaxRedirects {
+		return false, &RedirectError{From: from.String(), To: to.String(), Reason: fmt.Sprintf("stopped after %d redirects", rp.MaxRedirects)}
+	}
+	if rp.BlockDowngrade && from.Scheme == "https" && to.Scheme == "http" {
+		return false, &RedirectError{From: from.String(), To: to.String(), Reason: "https to http downgrade"}
+	}
+
+	crossHost := !strings.EqualFold(from.Hostname(), to.Hostname())
+	if crossHost && !rp.AllowCrossHost {
+		return crossHost, &RedirectError{From: from.String(), To: to.String(), Reason: "cross-host redirect"}
+	}
+	if err := tenant.CheckDomain(to.Hostname()); err != nil {
+		return crossHost, &RedirectError{From: from.String(), To: to.String(), Reason: err.Error()}
+	}
+	return crossHost, nil
+}
+
+// clientRedirectsKey is the context key under which the number of redirects
+// followed before a page's meta refresh or script redirect is kept
+type clientRedirectsKey struct{}
+
+// clientRedirectsFrom returns how many redirects were followed before the
+// fetch of ctx was made, to follow a page's meta refresh or script redirect
+func clientRedirectsFrom(ctx context.Context) int {
+	hops, _ := ctx.Value(clientRedirectsKey{}).(int)
+	return hops
+}
+
+// clientRedirect returns the redirect doc, the page fetched as result after
+// the HTTP redirects chain, makes in the browser, if it may be followed: a
+// meta refresh due within a few seconds, or a script redirect of an
+// interstitial. A page reloading itself, or whose redirect the policy
+// refuses, is previewed as it is
+func (rp RedirectPolicy) clientRedirect(ctx context.Context, doc *linkpreview.Document, result *LinkPreviewResponse, chain []RedirectHop) (RedirectHop, bool) {
+	if !rp.FollowClientRedirects || doc == nil {
+		return RedirectHop{}, false
+	}
+	hop := RedirectHop{URL: doc.Refresh, Type: RedirectMetaRefresh}
+	if hop.URL == "" && interstitial(doc) {
+		hop = RedirectHop{URL: doc.ScriptRedirect, Type: RedirectScript}
+	}
+	if hop.URL == "" {
+		return RedirectHop{}, false
+	}
+	from, err := url.Parse(result.baseURL())
+	if err != nil {
+		return RedirectHop{}, false
+	}
+	from.Fragment = ""
+	to, err := from.Parse(hop.URL)
+	if err != nil || (to.Scheme != "http" && to.Scheme != "https") {
+		return RedirectHop{}, false
+	}
+	to.Fragment = ""
+	if to.String() == from.String() {
+		return RedirectHop{}, false
+	}
+	hop.URL = to.String()
+	if hop.CrossHost, err = rp.allow(TenantFrom(ctx), from, to, clientRedirectsFrom(ctx)+len(chain)+1); err != nil {
+		slog.Debug("Not following client-side redirect", "type", hop.Type, "error", err)
+		return RedirectHop{}, false
+	}
+	return hop, true
+}
+
+// interstitial reports whether doc looks like a page that only sends
+// browsers on, rather than one with a preview of its own: it declares no
+// og:title or twitter:title, and either no <title> or no description
+func interstitial(doc *linkpreview.Document) bool {
+	if doc.MetaValue("og:title") != "" || doc.MetaValue("twitter:title") != "" {
+		return false
+	}
+	return doc.Title == "" || (doc.MetaValue("description") == "" && doc.MetaValue("og:description") == "")
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ConfigReloader re-reads the configuration on SIGHUP, or when the config file
+// changes, and hands the new Config to the registered hooks. Hooks apply the
+// settings that can change at runtime, so the process and its cache survive
+type ConfigReloader struct {
+	path     string        // Config file, empty when configured by environment only
+	interval time.Duration // How often the file is checked for changes; <= 0 disables polling
+
+	mu      sync.Mutex
+	hooks   []func(*Config)
+	modTime time.Time
+}
+
+// NewConfigReloader creates a reloader for the config file at path, polling it every interval
+func NewConfigReloader(path string, interval time.Duration) *ConfigReloader {
+	cr := &ConfigReloader{path: path, interval: interval}
+	cr.modTime = cr.fileModTime()
+	return cr
+}
+
+// OnReload registers hook to be called with every reloaded configuration
+func (cr *ConfigReloader) OnReload(hook func(*Config)) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.hooks = append(cr.hooks, hook)
+}
+
+// Reload reads the configuration again and applies it. A config file that fails
+// to parse is reported and the running configuration is kept
+func (cr *ConfigReloader) Reload() error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if err := loadConfigFile(cr.path); err != nil {
+		return err
+	}
+	config := NewConfig()
+	for _, hook := range cr.hooks {
+		hook(config)
+	}
+	return nil
+}
+
+// Watch reloads on SIGHUP and whenever the config file's modification time
+// changes. It never returns
+func (cr *ConfigReloader) Watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if cr.path != "" && cr.interval > 0 {
+		ticker := time.NewTicker(cr.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-hup:
+			cr.reloadAndLog("signal")
+		case <-tick:
+			// Compare against the last seen time rather than checking "newer", so
+			// files replaced by an older copy (e.g. Kubernetes ConfigMap swaps) still reload
+			if modTime := cr.fileModTime(); !modTime.IsZero() && !modTime.Equal(cr.modTime) {
+				cr.modTime = modTime
+				cr.reloadAndLog("file change")
+			}
+		}
+	}
+}
+
+func (cr *ConfigReloader) reloadAndLog(trigger string) {
+	if err := cr.Reload(); err != nil {
+		slog.Error("Configuration reload failed; keeping the current configuration", "trigger", trigger, "error", err)
+		return
+	}
+	slog.Info("Configuration reloaded", "trigger", trigger, "file", cr.path)
+}
+
+// fileModTime returns the config file's modification time, or zero if it can't be read
+func (cr *ConfigReloader) fileModTime() time.Time {
+	if cr.path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(cr.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
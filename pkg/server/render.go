@@ -0,0 +1,334 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/chromedp/chromedp/device"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// renderScoreThreshold is the quality score below which a statically
+// extracted preview is re-extracted from the rendered page. Single-page apps
+// usually ship a bare <title> and nothing else, which scores below it
+const renderScoreThreshold = 0.5
+
+// Renderer loads pages in headless Chromium so previews of JavaScript-heavy
+// sites can be extracted from the rendered DOM. Pages are opened in a
+// BrowserPool of local browsers, or of connections to RENDER_CHROME_URL
+type Renderer struct {
+	domains   []string        // Domain patterns whose pages may be rendered
+	overrides DomainOverrides // Domains with render options may be rendered too
+	timeout   time.Duration   // Budget for loading and running one page
+	wait      time.Duration   // Extra time given to scripts after the load event
+
+	pool        *BrowserPool
+	allocCancel context.CancelFunc
+}
+
+// RenderOptions are the render settings of a domain entry in the config file,
+// for single-page apps that need more than the defaults to show their content
+type RenderOptions struct {
+	WaitFor string        `json:"wait_for,omitempty"` // CSS selector of an element to wait for before reading the page
+	Wait    time.Duration `json:"wait,omitempty"`     // Extra wait after the page loads, replacing RENDER_WAIT
+	Width   int64         `json:"width,omitempty"`    // Viewport size; zero keeps the browser's (or the phone's, with Mobile)
+	Height  int64         `json:"height,omitempty"`
+	Mobile  bool          `json:"mobile,omitempty"` // Emulate a phone: its user agent, touch and screen
+
+	userAgent string            // From the domain entry, replacing the browser's (or the phone's)
+	headers   map[string]string // From the domain entry
+}
+
+// parseRenderOptions decodes the render table of a domain entry
+func parseRenderOptions(value any) (*RenderOptions, error) {
+	table, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a table of render settings")
+	}
+	opts := &RenderOptions{}
+	for key, value := range table {
+		s, err := settingString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		switch strings.ToLower(key) {
+		case "wait_for":
+			opts.WaitFor = strings.TrimSpace(s)
+			if _, err := cascadia.Compile(opts.WaitFor); err != nil {
+				return nil, fmt.Errorf("wait_for: invalid selector %q: %v", opts.WaitFor, err)
+			}
+		case "wait":
+			if opts.Wait, err = time.ParseDuration(s); err != nil {
+				return nil, fmt.Errorf("wait: %v", err)
+			}
+		case "viewport":
+			width, height, ok := strings.Cut(strings.ToLower(s), "x")
+			opts.Width, _ = strconv.ParseInt(strings.TrimSpace(width), 10, 64)
+			opts.Height, _ = strconv.ParseInt(strings.TrimSpace(height), 10, 64)
+			if !ok || opts.Width <= 0 || opts.Height <= 0 {
+				return nil, fmt.Errorf("viewport: expected WIDTHxHEIGHT, e.g. 1280x800, got %q", s)
+			}
+		case "mobile":
+			if opts.Mobile, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("mobile: %v", err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// emulation returns the action setting up the viewport and device of opts, or nil
+func (opts *RenderOptions) emulation() chromedp.Action {
+	switch {
+	case opts.Mobile:
+		phone := device.IPhone13.Device()
+		if opts.Width > 0 {
+			phone.Width, phone.Height = opts.Width, opts.Height
+		}
+		return chromedp.Emulate(phone)
+	case opts.Width > 0:
+		return chromedp.EmulateViewport(opts.Width, opts.Height)
+	}
+	return nil
+}
+
+// NewRenderer creates a renderer for config.RenderDomains, the domains with
+// render options and PDF capture, or returns nil when none is enabled
+func NewRenderer(config *Config) *Renderer {
+	enabled := len(config.RenderDomains) > 0 || config.PDFEnabled
+	for _, override := range config.DomainOverrides {
+		enabled = enabled || override.Render != nil || override.RenderMode == RenderAlways
+	}
+	if !enabled {
+		return nil
+	}
+	r := &Renderer{
+		domains:   normalizePatterns(config.RenderDomains),
+		overrides: config.DomainOverrides,
+		timeout:   config.RenderTimeout,
+		wait:      config.RenderWait,
+	}
+	var allocCtx context.Context
+	if config.RenderChromeURL != "" {
+		allocCtx, r.allocCancel = chromedp.NewRemoteAllocator(context.Background(), config.RenderChromeURL)
+	} else {
+		opts := append(chromedp.DefaultExecAllocatorOptions[:],
+			chromedp.UserAgent(defaultUserAgent(config)),
+			chromedp.Flag("disable-dev-shm-usage", true), // /dev/shm is tiny in containers
+		)
+		if config.RenderMaxMemoryMB > 0 {
+			// Cap the JavaScript heap of each page; a page exceeding it crashes alone
+			opts = append(opts, chromedp.Flag("js-flags", fmt.Sprintf("--max-old-space-size=%d", config.RenderMaxMemoryMB)))
+		}
+		if config.RenderChromePath != "" {
+			opts = append(opts, chromedp.ExecPath(config.RenderChromePath))
+		}
+		if os.Geteuid() == 0 {
+			// Chromium refuses to start its sandbox as root, as in most containers
+			opts = append(opts, chromedp.NoSandbox)
+		}
+		allocCtx, r.allocCancel = chromedp.NewExecAllocator(context.Background(), opts...)
+	}
+	r.pool = NewBrowserPool(allocCtx, config.RenderBrowsers, config.RenderMaxConcurrency,
+		config.RenderRecycleAfter, config.RenderBrowserMaxAge)
+	return r
+}
+
+// Wants reports whether result, a static preview of a page on host, should be
+// re-extracted from the rendered page
+func (r *Renderer) Wants(host string, result *LinkPreviewResponse) bool {
+	if r == nil || result.Error != "" {
+		return false
+	}
+	override := r.overrides.Lookup(host)
+	if override != nil && override.RenderMode != "" && override.RenderMode != RenderAuto {
+		return override.RenderMode == RenderAlways
+	}
+	if result.QualityScore >= renderScoreThreshold {
+		return false
+	}
+	if override != nil && override.Render != nil {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range r.domains {
+		if matchDomain(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render loads url in a new tab and returns the page's HTML once its scripts
+// have had RENDER_WAIT to run, within RENDER_TIMEOUT. opts, which may be nil,
+// adjust the wait and the emulated device. It waits for a free page slot for as
+// long as ctx allows
+func (r *Renderer) Render(ctx context.Context, pageURL string, opts *RenderOptions) (string, error) {
+	var html string
+	err := r.run(ctx, pageURL, opts, chromedp.OuterHTML("html", &html, chromedp.ByQuery))
+	return html, err
+}
+
+// PDF loads url like Render and prints the page to a PDF, backgrounds included
+func (r *Renderer) PDF(ctx context.Context, pageURL string, opts *RenderOptions) ([]byte, error) {
+	var pdf []byte
+	err := r.run(ctx, pageURL, opts, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		pdf, _, err = page.PrintToPDF().WithPrintBackground(true).Do(ctx)
+		return err
+	}))
+	return pdf, err
+}
+
+// run loads url in a new tab, waits as opts say, then runs capture on the page
+func (r *Renderer) run(ctx context.Context, pageURL string, opts *RenderOptions, capture chromedp.Action) error {
+	browser, err := r.pool.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.pool.release(browser)
+	if err := browser.start(); err != nil {
+		return err
+	}
+
+	tabCtx, cancel := chromedp.NewContext(browser.ctx)
+	defer cancel()
+	tabCtx, cancelTimeout := context.WithTimeout(tabCtx, r.timeout)
+	defer cancelTimeout()
+	// Stop rendering when the request is abandoned
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	if opts == nil {
+		opts = &RenderOptions{}
+	}
+	wait := r.wait
+	if opts.Wait > 0 {
+		wait = opts.Wait
+	}
+	var actions []chromedp.Action
+	if emulate := opts.emulation(); emulate != nil {
+		actions = append(actions, emulate)
+	}
+	if opts.userAgent != "" {
+		actions = append(actions, emulation.SetUserAgentOverride(opts.userAgent))
+	}
+	if len(opts.headers) > 0 {
+		headers := make(network.Headers, len(opts.headers))
+		for name, value := range opts.headers {
+			headers[name] = value
+		}
+		actions = append(actions, network.Enable(), network.SetExtraHTTPHeaders(headers))
+	}
+	actions = append(actions, chromedp.Navigate(pageURL))
+	if opts.WaitFor != "" {
+		actions = append(actions, chromedp.WaitReady(opts.WaitFor, chromedp.ByQuery))
+	}
+	actions = append(actions, chromedp.Sleep(wait), capture)
+	err = chromedp.Run(tabCtx, actions...)
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// Close stops the browsers
+func (r *Renderer) Close() {
+	if r == nil {
+		return
+	}
+	r.pool.Close()
+	r.allocCancel()
+}
+
+// renderPreview re-extracts result from the rendered page, keeping the static
+// preview when rendering fails or finds nothing better
+func (me *MetaExtractor) renderPreview(ctx context.Context, result *LinkPreviewResponse) {
+	ctx, span := tracer.Start(ctx, "render")
+	defer span.End()
+
+	start := time.Now()
+	html, err := me.renderer.Render(ctx, result.URL, me.renderOptions(ctx, result.URL))
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			slog.Warn("Rendering failed; keeping the static preview", "url", result.URL, "error", err)
+		}
+		return
+	}
+
+	// The debugger should show the rendered page only if it is the one used
+	capture, renderedCapture := debugCaptureFrom(ctx), &debugCapture{}
+	rendered := LinkPreviewResponse{Preview: linkpreview.Preview{URL: result.URL}, FinalURL: result.FinalURL}
+	if _, _, err := me.readMetadata(withDebugCapture(ctx, renderedCapture), strings.NewReader(html), &rendered); err != nil && rendered.Title == "" {
+		return
+	}
+	slog.Debug("Rendered page", "url", result.URL, "duration_ms", time.Since(start).Milliseconds(),
+		"static_score", result.QualityScore, "rendered_score", rendered.QualityScore)
+	if rendered.QualityScore > result.QualityScore {
+		result.Preview = rendered.Preview
+		result.Rendered = true
+		if capture != nil {
+			*capture = *renderedCapture
+		}
+	}
+}
+
+// renderOptions returns the config file's render options and headers for
+// the domain of pageURL, and the user agent to render it as for ctx
+func (me *MetaExtractor) renderOptions(ctx context.Context, pageURL string) *RenderOptions {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	override := me.overrides.Lookup(parsed.Hostname())
+	userAgent := me.agents.Pick(ctx, override)
+	language := acceptLanguageFrom(ctx)
+	plain := userAgent == me.agents.Default() && language == "" && me.language == ""
+	opts := &RenderOptions{}
+	if override != nil {
+		if plain && len(override.Headers) == 0 {
+			return override.Render
+		}
+		if override.Render != nil {
+			*opts = *override.Render
+		}
+		opts.headers = override.Headers
+	} else if plain {
+		return nil
+	}
+	// The browser already sends the default user agent
+	if userAgent != me.agents.Default() {
+		opts.userAgent = userAgent
+	}
+	// Accept-Language as for fetches: the request's, else the domain's, else ACCEPT_LANGUAGE
+	if language != "" || me.language != "" {
+		headers := make(map[string]string, len(opts.headers)+1)
+		if me.language != "" {
+			headers["Accept-Language"] = me.language
+		}
+		for name, value := range opts.headers {
+			headers[http.CanonicalHeaderKey(name)] = value
+		}
+		if language != "" {
+			headers["Accept-Language"] = language
+		}
+		opts.headers = headers
+	}
+	return opts
+}
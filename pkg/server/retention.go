@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// pruneTimeout bounds one cleanup run
+const pruneTimeout = 10 * time.Minute
+
+// RetentionPolicy bounds what a PreviewStore keeps; zero fields keep everything
+type RetentionPolicy struct {
+	MaxAge         time.Duration // Previews fetched longer ago are deleted
+	MaxRows        int           // Previews kept in all, the most recently fetched
+	MaxRowsPerHost int           // Previews kept for each host, the most recently fetched
+}
+
+// StoreCleaner enforces a RetentionPolicy on the preview store in the
+// background, so the database doesn't grow without bound
+type StoreCleaner struct {
+	store    PreviewStore
+	policy   RetentionPolicy
+	interval time.Duration
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewStoreCleaner creates a cleaner pruning store every STORE_CLEANUP_INTERVAL,
+// or returns nil when there is no store or the policy keeps everything
+func NewStoreCleaner(store PreviewStore, config *Config) *StoreCleaner {
+	policy := RetentionPolicy{
+		MaxAge:         config.StoreRetention,
+		MaxRows:        config.StoreMaxRows,
+		MaxRowsPerHost: config.StoreMaxRowsPerHost,
+	}
+	if store == nil || policy == (RetentionPolicy{}) {
+		return nil
+	}
+	interval := config.StoreCleanupInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &StoreCleaner{store: store, policy: policy, interval: interval, stop: make(chan struct{})}
+}
+
+// Run prunes the store now and then every interval until Stop
+func (sc *StoreCleaner) Run() {
+	if sc == nil {
+		return
+	}
+	ticker := time.NewTicker(sc.interval)
+	defer ticker.Stop()
+	for {
+		sc.prune()
+		select {
+		case <-ticker.C:
+		case <-sc.stop:
+			return
+		}
+	}
+}
+
+// Stop ends Run; a cleanup in progress is cut short
+func (sc *StoreCleaner) Stop() {
+	if sc == nil {
+		return
+	}
+	sc.stopOnce.Do(func() { close(sc.stop) })
+}
+
+// prune deletes what the policy doesn't keep, logging how it went
+func (sc *StoreCleaner) prune() {
+	ctx, cancel := context.WithTimeout(context.Background(), pruneTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-sc.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	ctx, span := tracer.Start(ctx, "store.prune")
+	defer span.End()
+
+	start := time.Now()
+	deleted, err := sc.store.Prune(ctx, sc.policy, start)
+	span.SetAttributes(attribute.Int64("store.pruned", deleted))
+	if err != nil {
+		slog.Warn("Preview store cleanup failed", "deleted", deleted, "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("Preview store cleaned up", "deleted", deleted, "duration_ms", time.Since(start).Milliseconds())
+	}
+}
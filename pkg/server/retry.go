@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how transient upstream failures are retried
+type RetryPolicy struct {
+	MaxRetries int           // Additional attempts after the first; 0 disables retries
+	BaseDelay  time.Duration // Backoff before the first retry, doubled for each further retry
+	MaxDelay   time.Duration // Upper bound for a single backoff
+}
+
+// retryableStatus reports whether an upstream HTTP status is worth retrying
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryableError reports whether a failed request may succeed if tried again
+// Connection resets, truncated responses and timeouts are transient; policy,
+// SSRF and redirect refusals, DNS failures and TLS errors are permanent
+func retryableError(err error) bool {
+	var policyErr *PolicyError
+	var redirectErr *RedirectError
+	if errors.As(err, &policyErr) || errors.As(err, &redirectErr) {
+		return false
+	}
+	var adaptiveErr *adaptiveTimeoutError
+	if errors.As(err, &adaptiveErr) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The caller's own deadline ran out; another attempt can't finish in time
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// backoff returns the jittered delay before retry number attempt (starting at 1)
+// Delays grow exponentially and are drawn uniformly from [d/2, d] so that
+// clients retrying the same failed origin don't do so in lockstep
+func (rp RetryPolicy) backoff(attempt int) time.Duration {
+	delay := rp.BaseDelay << (attempt - 1)
+	if delay <= 0 || (rp.MaxDelay > 0 && delay > rp.MaxDelay) {
+		delay = rp.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// doWithRetry sends req, retrying transient failures according to the extractor's retry policy
+// The redirect chain is reset before each attempt so only the final attempt's hops are reported.
+// Each attempt is bounded by the host's adaptive timeout, which keeps running while the
+// returned body is read and is released when it is closed.
+// It returns the last response or error together with the number of attempts made
+func (me *MetaExtractor) doWithRetry(req *http.Request, redirects *[]RedirectHop) (*http.Response, int, error) {
+	ctx := req.Context()
+	host := req.URL.Hostname()
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(me.retry.backoff(attempt))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, attempt, ctx.Err()
+			}
+		}
+		*redirects = (*redirects)[:0]
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		timeout := me.latency.Timeout(host)
+		if override := me.overrides.Lookup(host); override != nil && override.Timeout > 0 {
+			timeout = override.Timeout
+		}
+		if timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+
+		start := time.Now()
+		resp, err := me.clientFor(ctx).Do(req.Clone(attemptCtx))
+		lastAttempt := attempt >= me.retry.MaxRetries
+		if err == nil {
+			me.latency.Observe(host, time.Since(start))
+		} else if attemptCtx.Err() != nil && ctx.Err() == nil {
+			// The adaptive timeout fired; report it as the timeout it is
+			err = &adaptiveTimeoutError{host: host, timeout: timeout, err: err}
+		}
+
+		switch {
+		case err != nil:
+			cancel()
+			if lastAttempt || !retryableError(err) {
+				return nil, attempt + 1, err
+			}
+		case retryableStatus(resp.StatusCode) && !lastAttempt && me.cooldowns.requested(resp) == 0:
+			// A 503 with Retry-After is left for the host's cooldown rather than retried now
+			// Drain a little of the body so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			cancel()
+		default:
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, attempt + 1, nil
+		}
+	}
+}
+
+// adaptiveTimeoutError reports an attempt cut short by the host's adaptive timeout
+type adaptiveTimeoutError struct {
+	host    string
+	timeout time.Duration
+	err     error
+}
+
+func (e *adaptiveTimeoutError) Error() string {
+	return fmt.Sprintf("%s did not respond within %s: %v", e.host, e.timeout, e.err)
+}
+
+func (e *adaptiveTimeoutError) Unwrap() error { return e.err }
+
+// Timeout marks the error as a timeout so it is retried and counted by the circuit breaker
+func (e *adaptiveTimeoutError) Timeout() bool { return true }
+
+func (e *adaptiveTimeoutError) Temporary() bool { return true }
+
+// cancelOnClose releases an attempt's timeout context once its body has been consumed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
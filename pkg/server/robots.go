@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCodeRobotsDisallowed is reported in error_code when robots.txt disallows a URL
+const ErrCodeRobotsDisallowed = "ERR_ROBOTS_DISALLOWED"
+
+// RobotsChecker fetches, caches and evaluates robots.txt files for target hosts
+type RobotsChecker struct {
+	botName string
+	client  *http.Client
+	ttl     time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+// robotsEntry is the cached robots.txt rule set for one scheme+host
+type robotsEntry struct {
+	rules     []robotsRule // Rules of the group that applies to our bot
+	expiresAt time.Time
+}
+
+// robotsRule is a single Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// NewRobotsChecker creates a checker that evaluates rules for botName
+// robots.txt files are fetched with client and cached for ttl
+func NewRobotsChecker(botName string, client *http.Client, ttl time.Duration) *RobotsChecker {
+	return &RobotsChecker{
+		botName: strings.ToLower(botName),
+		client:  client,
+		ttl:     ttl,
+		hosts:   make(map[string]*robotsEntry),
+	}
+}
+
+// Allowed reports whether robots.txt for target's host permits fetching target
+func (rc *RobotsChecker) Allowed(ctx context.Context, target *url.URL) bool {
+	entry := rc.entry(ctx, target)
+
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+
+	// The longest matching rule wins; Allow wins ties
+	matched := -1
+	allowed := true
+	for _, rule := range entry.rules {
+		if rule.pattern == "" || !rule.re.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > matched || (len(rule.pattern) == matched && rule.allow) {
+			matched = len(rule.pattern)
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+// entry returns the cached rules for target's host, fetching robots.txt when missing or expired
+func (rc *RobotsChecker) entry(ctx context.Context, target *url.URL) *robotsEntry {
+	key := target.Scheme + "://" + strings.ToLower(target.Host)
+
+	rc.mu.Lock()
+	entry, ok := rc.hosts[key]
+	rc.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry
+	}
+
+	entry = rc.fetch(ctx, key+"/robots.txt")
+
+	rc.mu.Lock()
+	// Keep the cache bounded by dropping expired entries when it grows large
+	if len(rc.hosts) > 10000 {
+		now := time.Now()
+		for k, e := range rc.hosts {
+			if now.After(e.expiresAt) {
+				delete(rc.hosts, k)
+			}
+		}
+	}
+	rc.hosts[key] = entry
+	rc.mu.Unlock()
+	return entry
+}
+
+// fetch downloads and parses a robots.txt file
+// A missing robots.txt (4xx) allows everything; server errors disallow everything
+// for a short period, following the conventions used by major crawlers
+func (rc *RobotsChecker) fetch(ctx context.Context, robotsURL string) *robotsEntry {
+	allowAll := &robotsEntry{expiresAt: time.Now().Add(rc.ttl)}
+	disallowAll := &robotsEntry{
+		rules:     []robotsRule{{allow: false, pattern: "/", re: compileRobotsPattern("/")}},
+		expiresAt: time.Now().Add(5 * time.Minute),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return allowAll
+	}
+	req.Header.Set("User-Agent", rc.botName)
+
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return disallowAll
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return disallowAll
+	case resp.StatusCode >= 400:
+		return allowAll
+	case resp.StatusCode != http.StatusOK:
+		return allowAll
+	}
+
+	// robots.txt files larger than 512KB are truncated, as Google does
+	rules := parseRobots(io.LimitReader(resp.Body, 512*1024), rc.botName)
+	return &robotsEntry{rules: rules, expiresAt: time.Now().Add(rc.ttl)}
+}
+
+// parseRobots returns the rules of the group matching botName, falling back to the "*" group
+func parseRobots(r io.Reader, botName string) []robotsRule {
+	var (
+		specific, wildcard []robotsRule
+		foundSpecific      bool
+		agents             []string
+		inRules            bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			rule := robotsRule{allow: field == "allow", pattern: value, re: compileRobotsPattern(value)}
+			for _, agent := range agents {
+				switch {
+				case agent == "*":
+					wildcard = append(wildcard, rule)
+				case agent != "" && strings.Contains(botName, agent):
+					specific = append(specific, rule)
+					foundSpecific = true
+				}
+			}
+		}
+	}
+
+	if foundSpecific {
+		return specific
+	}
+	return wildcard
+}
+
+// compileRobotsPattern turns a robots.txt path pattern with * and $ wildcards into a regexp
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsError describes a URL refused by robots.txt
+func robotsError(botName string, target *url.URL) string {
+	return fmt.Sprintf("Blocked URL: robots.txt for %s disallows %s for %q", target.Host, target.EscapedPath(), botName)
+}
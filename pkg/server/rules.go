@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// SelectorRule extracts one preview field from the page with a CSS selector,
+// for sites whose metadata is missing or wrong. It is written in the config
+// file as "selector" for the element's text or "selector@attr" for an attribute,
+// e.g. "h1.article-title" or "img.hero@src"
+type SelectorRule struct {
+	Field    string // title, description, image or site_name
+	Selector string
+	Attr     string // Empty means the element's text
+	compiled cascadia.Selector
+}
+
+// sourceSelector is reported in sources for fields set by a SelectorRule
+const sourceSelector = "selector"
+
+// ruleFields are the preview fields a SelectorRule can set
+var ruleFields = map[string]func(*linkpreview.Preview) *string{
+	"title":       func(p *linkpreview.Preview) *string { return &p.Title },
+	"description": func(p *linkpreview.Preview) *string { return &p.Description },
+	"image":       func(p *linkpreview.Preview) *string { return &p.Image },
+	"site_name":   func(p *linkpreview.Preview) *string { return &p.SiteName },
+}
+
+// parseSelectorRules decodes the rules table of a domain entry, a map from field to selector
+func parseSelectorRules(value any) ([]SelectorRule, error) {
+	table, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a table of field: selector")
+	}
+	rules := make([]SelectorRule, 0, len(table))
+	for field, spec := range table {
+		field = strings.ToLower(field)
+		if _, ok := ruleFields[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q (want title, description, image or site_name)", field)
+		}
+		s, ok := spec.(string)
+		if !ok || strings.TrimSpace(s) == "" {
+			return nil, fmt.Errorf("%s: expected a selector", field)
+		}
+		rule := SelectorRule{Field: field, Selector: strings.TrimSpace(s)}
+		if at := strings.LastIndex(rule.Selector, "@"); at >= 0 {
+			rule.Selector, rule.Attr = strings.TrimSpace(rule.Selector[:at]), strings.TrimSpace(rule.Selector[at+1:])
+		}
+		compiled, err := cascadia.Compile(rule.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid selector %q: %v", field, rule.Selector, err)
+		}
+		rule.compiled = compiled
+		rules = append(rules, rule)
+	}
+	// Map order is random; keep the rules in a stable order for logs and the admin API
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Field < rules[j].Field })
+	return rules, nil
+}
+
+// applySelectorRules sets the preview fields of the rules that match the page.
+// A matching rule wins over the page's own metadata; rules matching nothing
+// leave the field as it was
+func applySelectorRules(rules []SelectorRule, page *html.Node, preview *linkpreview.Preview) {
+	for _, rule := range rules {
+		node := rule.compiled.MatchFirst(page)
+		if node == nil {
+			continue
+		}
+		value := nodeText(node)
+		if rule.Attr != "" {
+			value = nodeAttr(node, rule.Attr)
+		}
+		value = strings.Join(strings.Fields(value), " ")
+		if value == "" {
+			continue
+		}
+		if rule.Field == "image" {
+			value = resolveURL(preview.URL, value)
+		}
+		*ruleFields[rule.Field](preview) = value
+		if preview.Sources == nil {
+			preview.Sources = make(map[string]string)
+		}
+		preview.Sources[rule.Field] = sourceSelector
+	}
+}
+
+// nodeText returns the text content of node
+func nodeText(node *html.Node) string {
+	var text strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return text.String()
+}
+
+// nodeAttr returns the value of node's attribute name
+func nodeAttr(node *html.Node, name string) string {
+	for _, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// resolveURL resolves ref, e.g. a relative image path, against the page URL
+func resolveURL(base, ref string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
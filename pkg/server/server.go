@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSEnabled reports whether the server terminates HTTPS itself
+func (c *Config) TLSEnabled() bool {
+	return (c.TLSCert != "" && c.TLSKey != "") || len(c.ACMEDomains) > 0
+}
+
+// hstsMiddleware adds a Strict-Transport-Security header to every response
+func hstsMiddleware(maxAge time.Duration) gin.HandlerFunc {
+	value := "max-age=" + strconv.Itoa(int(maxAge.Seconds())) + "; includeSubDomains"
+	return func(c *gin.Context) {
+		c.Header("Strict-Transport-Security", value)
+		c.Next()
+	}
+}
+
+// Server is the link preview HTTP API built from a Config: the extractor,
+// preview cache and routes. Handler mounts it in another program's router;
+// ListenAndServe runs it on the configured listeners
+type Server struct {
+	config    *Config
+	service   *PreviewService
+	router    *gin.Engine
+	reloader  *ConfigReloader
+	recrawler *Recrawler    // nil unless RECRAWL_SCHEDULE is set
+	cleaner   *StoreCleaner // nil unless a store retention limit is set
+	keys      *APIKeyStore
+}
+
+// New creates the server described by config
+func New(config *Config) *Server {
+	service := NewPreviewService(NewMetaExtractor(config), NewPreviewCache(config.CacheMaxEntries, config.CacheTTL), config)
+
+	// Reload runtime-adjustable settings on SIGHUP or when the config file changes
+	reloader := NewConfigReloader(setting("CONFIG_FILE"), config.ConfigReloadInterval)
+
+	recrawler, err := NewRecrawler(service, config)
+	if err != nil {
+		slog.Warn("Scheduled recrawls disabled", "error", err)
+	}
+
+	keys := NewAPIKeyStore(config.APIKeys, config.Tenants, service.store)
+
+	return &Server{
+		config:    config,
+		service:   service,
+		router:    setupRoutes(service, config, reloader, keys),
+		reloader:  reloader,
+		recrawler: recrawler,
+		cleaner:   NewStoreCleaner(service.store, config),
+		keys:      keys,
+	}
+}
+
+// Handler returns the API routes. Mount it under a path prefix with http.StripPrefix
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// Router returns the API routes as a Gin engine, for adding routes or middleware
+func (s *Server) Router() *gin.Engine {
+	return s.router
+}
+
+// Service returns the preview service behind the routes
+func (s *Server) Service() *PreviewService {
+	return s.service
+}
+
+// ListenAndServe watches for configuration reloads, runs scheduled recrawls
+// and store cleanups, reloads API keys managed at runtime, and serves the API on the configured listeners until one of them fails
+func (s *Server) ListenAndServe() error {
+	go s.reloader.Watch()
+	go s.recrawler.Run()
+	go s.cleaner.Run()
+	go s.keys.Run()
+
+	slog.Info("Link Preview API server starting", "port", s.config.Port, "listen", s.config.Listen, "allowed_origins", s.config.AllowedOrigins)
+	if logFormatText() {
+		printBanner(s.config)
+	}
+	return runServer(s.router, s.config)
+}
+
+// Close stops recrawling and store cleanups, flushes pending error reports, usage and stored previews
+// and stops the headless browser
+func (s *Server) Close() {
+	s.recrawler.Stop()
+	s.cleaner.Stop()
+	s.keys.Stop()
+	s.service.reporter.Flush(2 * time.Second)
+	s.service.usage.Close(2 * time.Second)
+	s.service.recorder.Close(2 * time.Second)
+	s.service.extractor.renderer.Close()
+}
+
+// runServer serves router on every listener, over HTTPS when TLS is configured
+// (Unix sockets always serve plain HTTP). With TLS enabled, redirect listeners
+// such as HTTP_REDIRECT_PORT send plain HTTP to HTTPS (and answer ACME HTTP-01
+// challenges when autocert is used). It returns when any listener fails
+func runServer(router http.Handler, config *Config) error {
+	specs, listeners, err := openListeners(config)
+	if err != nil {
+		return err
+	}
+
+	// Plain HTTP is redirected to the port of the first HTTPS listener
+	httpsPort := config.Port
+	for _, spec := range specs {
+		if spec.Network == "tcp" && spec.Role != RoleRedirect {
+			if _, port, err := net.SplitHostPort(spec.Address); err == nil {
+				httpsPort = ":" + port
+			}
+			break
+		}
+	}
+
+	var tlsConfig *tls.Config
+	var redirect http.Handler = http.HandlerFunc(redirectToHTTPS(httpsPort))
+	if config.TLSEnabled() {
+		if len(config.ACMEDomains) > 0 {
+			manager := &autocert.Manager{
+				Prompt:     autocert.AcceptTOS,
+				HostPolicy: autocert.HostWhitelist(config.ACMEDomains...),
+				Cache:      autocert.DirCache(config.ACMECacheDir),
+				Email:      config.ACMEEmail,
+			}
+			tlsConfig = manager.TLSConfig()
+			redirect = manager.HTTPHandler(redirect)
+			slog.Info("Obtaining certificates from Let's Encrypt", "domains", config.ACMEDomains)
+		} else {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+	}
+
+	errs := make(chan error, len(specs))
+	serving := 0
+	for i, spec := range specs {
+		server := &http.Server{
+			Handler:           restrictToRole(spec.Role, router),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		useTLS := tlsConfig != nil && spec.Network == "tcp"
+		switch {
+		case spec.Role == RoleRedirect && tlsConfig == nil:
+			slog.Warn("Ignoring redirect listener because TLS is not configured", "listener", spec.String())
+			listeners[i].Close()
+			continue
+		case spec.Role == RoleRedirect:
+			server.Handler = redirect
+			useTLS = false
+		case useTLS:
+			server.TLSConfig = tlsConfig
+		}
+
+		slog.Info("Listening", "listener", spec.String(), "tls", useTLS)
+		serving++
+		go func(listener net.Listener) {
+			if useTLS {
+				// With autocert the certificate comes from TLSConfig.GetCertificate
+				errs <- server.ServeTLS(listener, config.TLSCert, config.TLSKey)
+			} else {
+				errs <- server.Serve(listener)
+			}
+		}(listeners[i])
+	}
+	if serving == 0 {
+		return fmt.Errorf("no listeners to serve on")
+	}
+
+	return <-errs
+}
+
+// redirectToHTTPS returns a handler that permanently redirects requests to the HTTPS listener
+func redirectToHTTPS(httpsPort string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != ":443" {
+			host += httpsPort
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
+
+// printBanner prints the human-oriented startup summary shown with LOG_FORMAT=text
+func printBanner(config *Config) {
+	fmt.Printf("🚀 Link Preview API server starting on port %s\n", config.Port)
+	fmt.Printf("🌐 Allowed origins: %v\n", config.AllowedOrigins)
+	fmt.Println("📝 API Documentation available at: /")
+	fmt.Println("🏥 Health check available at: /health")
+	fmt.Println("🔗 Preview endpoint: POST /preview")
+	fmt.Println("")
+	fmt.Println("Settings (environment variables, also available as --flags):")
+	printSettings()
+}
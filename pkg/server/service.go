@@ -0,0 +1,1586 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// LinkPreviewRequest represents the incoming request structure
+// Contains the URL for which we want to fetch the preview
+type LinkPreviewRequest struct {
+	URL     string `json:"url" binding:"required"` // The URL to fetch preview for
+	RawMeta bool   `json:"raw_meta,omitempty"`     // Include every meta and link tag in the response
+
+	// User agent profile to fetch the page as, e.g. googlebot; see USER_AGENT
+	UserAgent string `json:"user_agent,omitempty"`
+	// Accept-Language to fetch the page with, e.g. "fr-CH,fr;q=0.9"; see ACCEPT_LANGUAGE
+	AcceptLanguage string `json:"accept_language,omitempty"`
+
+	// Size of the thumbnail URL returned in thumbnail; zero for no limit
+	ThumbnailWidth  int `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int `json:"thumbnail_height,omitempty"`
+}
+
+// LinkPreviewResponse represents the response structure
+// Contains all the metadata extracted from the webpage
+type LinkPreviewResponse struct {
+	linkpreview.Preview
+
+	Error     string `json:"error,omitempty"`      // Error message if any
+	ErrorCode string `json:"error_code,omitempty"` // Machine-readable error code if any
+	Retryable bool   `json:"retryable,omitempty"`  // Error was transient and retrying later may succeed
+	// Seconds until the host may be fetched again, with ERR_RATE_LIMITED
+	RetryAfter int `json:"retry_after,omitempty"`
+
+	ShortURL   string        `json:"short_url,omitempty"`   // Short link requested, when url is the page it expands to
+	FinalURL   string        `json:"final_url,omitempty"`   // Page fetched after following redirects
+	Redirects  []RedirectHop `json:"redirects,omitempty"`   // Redirects followed while fetching
+	ImageProxy string        `json:"image_proxy,omitempty"` // Signed image proxy URL for Image
+	Thumbnail  string        `json:"thumbnail,omitempty"`   // Signed image proxy URL for Image resized to the requested thumbnail size
+
+	ImageGenerated bool `json:"image_generated,omitempty"` // Image is a fallback card drawn by this service
+
+	ImageWidth  int    `json:"image_width,omitempty"`  // Width of Image in pixels, as declared or probed
+	ImageHeight int    `json:"image_height,omitempty"` // Height of Image in pixels, as declared or probed
+	ImageType   string `json:"image_type,omitempty"`   // Media type of Image, as declared or probed
+
+	Unsafe     bool   `json:"unsafe,omitempty"`      // URL is listed by Safe Browsing or the blocklist
+	ThreatType string `json:"threat_type,omitempty"` // Threat category when Unsafe is true
+
+	NSFWScore *float64 `json:"nsfw_score,omitempty"` // Likelihood the preview image is NSFW, from 0 to 1
+	BlurHash  string   `json:"blurhash,omitempty"`   // BlurHash of the preview image, for a placeholder while it loads
+
+	ImageData   string `json:"image_data,omitempty"`   // Preview image as a data URI, when small enough to inline
+	FaviconData string `json:"favicon_data,omitempty"` // Favicon as a data URI, when small enough to inline
+
+	Rendered bool `json:"rendered,omitempty"` // Extracted from the page rendered in headless Chromium
+
+	ConsentBypassed bool `json:"consent_bypassed,omitempty"` // Extracted from the page behind the consent wall met first
+
+	Archived   bool       `json:"archived,omitempty"`    // Built from a Wayback Machine snapshot because the page is gone
+	ArchivedAt *time.Time `json:"archived_at,omitempty"` // When the snapshot was captured
+	ArchiveURL string     `json:"archive_url,omitempty"` // The snapshot
+
+	RequestID string `json:"request_id,omitempty"` // Set on errors so they can be matched with server logs
+
+	BytesFetched int64 `json:"-"` // Size of the fetched body, for audit logging
+	StatusCode   int   `json:"-"` // HTTP status the page answered with, 0 when it wasn't reached
+}
+
+// baseURL is the URL relative URLs of the page resolve against: the page
+// fetched after redirects, else the one requested
+func (r *LinkPreviewResponse) baseURL() string {
+	if r.FinalURL != "" {
+		return r.FinalURL
+	}
+	return r.URL
+}
+
+// Error codes reported in error_code, besides those of the domain policy,
+// SSRF guard, robots.txt and circuit breaker
+const (
+	ErrCodeDNS      = string(linkpreview.ErrCodeDNS)
+	ErrCodeTimeout  = string(linkpreview.ErrCodeTimeout)
+	ErrCodeNotHTML  = string(linkpreview.ErrCodeNotHTML)
+	ErrCodeTooLarge = string(linkpreview.ErrCodeTooLarge)
+	ErrCodeFetch    = string(linkpreview.ErrCodeFetch)
+
+	ErrCodeInvalidURL = "ERR_INVALID_URL" // The URL can't be parsed or fetched
+	ErrCodeNotFound   = "ERR_NOT_FOUND"   // The page answered 404 or 410
+	ErrCodeHTTPStatus = "ERR_HTTP_STATUS" // The page answered another status than 200
+)
+
+// fetchErrorCode returns the error_code of an error from checking or fetching a page
+func fetchErrorCode(err error) string {
+	var policyErr *PolicyError
+	var redirectErr *RedirectError
+	if errors.As(err, &policyErr) || errors.As(err, &redirectErr) {
+		return ErrCodeBlocked
+	}
+	if code := linkpreview.CodeOf(err); code != "" {
+		return string(code)
+	}
+	return ErrCodeFetch
+}
+
+// MetaExtractor handles the extraction of metadata from HTML content
+type MetaExtractor struct {
+	client    *http.Client
+	guard     *SSRFGuard
+	policy    *DomainPolicy
+	redirects RedirectPolicy
+	retry     RetryPolicy
+	breaker   *CircuitBreaker // nil unless circuit breaking is enabled
+	cooldowns *HostCooldowns  // nil when Retry-After is ignored
+	latency   *LatencyTracker // nil unless adaptive timeouts are enabled
+	robots    *RobotsChecker  // nil unless robots.txt compliance is enabled
+	overrides DomainOverrides // Per-domain settings from the config file
+	domains   *DomainReport   // Per-domain failure and latency breakdown
+	maxBody   int64           // Bytes of each page read while looking for metadata
+	order     linkpreview.FieldOrder
+	renderer  *Renderer       // nil unless headless rendering is enabled
+	images    *ImageValidator // nil unless IMAGE_VALIDATION is set
+	agents    *UserAgentPicker
+	language  string // Accept-Language sent unless the request asks for another; "" sends none
+
+	consentBypass bool // Fetch the page behind consent walls again with consent cookies
+}
+
+// NewMetaExtractor creates a new instance of MetaExtractor
+// with a configured HTTP client that has reasonable timeouts
+func NewMetaExtractor(config *Config) *MetaExtractor {
+	proxies, err := NewProxySelector(config.OutboundProxy, config.OutboundProxyRules)
+	if err != nil {
+		slog.Warn("Ignoring outbound proxy configuration", "error", err)
+		proxies, _ = NewProxySelector("", nil)
+	}
+
+	// Configured proxies may live on private networks, so they are exempt from SSRF checks
+	ssrfAllowlist := append(append([]string{}, config.SSRFAllowlist...), proxies.Hosts()...)
+
+	me := &MetaExtractor{
+		guard:     NewSSRFGuard(config.SSRFProtection, ssrfAllowlist, NewDNSResolver(config.DNSServers, config.DNSOverHTTPSURL, config.DNSCacheTTL)),
+		policy:    NewDomainPolicy(config.AllowedDomains, config.BlockedDomains),
+		domains:   NewDomainReport(),
+		overrides: config.DomainOverrides,
+		agents:    NewUserAgentPicker(config),
+		maxBody:   config.MaxBodyBytes,
+		order:     config.FieldOrder,
+		renderer:  NewRenderer(config),
+		redirects: RedirectPolicy{
+			MaxRedirects:   config.MaxRedirects,
+			BlockDowngrade: config.BlockRedirectDowngrade,
+			AllowCrossHost: config.AllowCrossHostRedirects,
+
+			FollowClientRedirects: config.FollowClientRedirects,
+		},
+		retry: RetryPolicy{
+			MaxRetries: config.FetchRetries,
+			BaseDelay:  config.FetchRetryBaseDelay,
+			MaxDelay:   config.FetchRetryMaxDelay,
+		},
+		breaker:   NewCircuitBreaker(config.BreakerFailureThreshold, config.BreakerCooldown),
+		cooldowns: NewHostCooldowns(config.RetryAfterMax),
+
+		consentBypass: config.ConsentBypass,
+	}
+	if me.language, err = normalizeAcceptLanguage(config.AcceptLanguage); err != nil {
+		slog.Warn("Ignoring ACCEPT_LANGUAGE", "error", err)
+	}
+	if config.AdaptiveTimeouts {
+		me.latency = NewLatencyTracker(config.AdaptiveTimeoutMin, config.AdaptiveTimeoutMax, 4)
+	}
+	// Validate every connection at dial time so DNS rebinding can't bypass the SSRF checks
+	transport := newTransport(config.Transport, me.guard.DialContext, proxies.Proxy)
+
+	// Throttle requests per target host so bursts don't get our IP banned by origins
+	var roundTripper http.RoundTripper = transport
+	if limiter := NewHostLimiter(config.HostMaxConcurrency, config.HostRequestsPerSecond); limiter != nil {
+		roundTripper = &politeTransport{next: transport, limiter: limiter}
+	}
+
+	me.client = &http.Client{
+		Timeout:   config.HTTPClientTimeout, // Set timeout to prevent hanging requests
+		Transport: roundTripper,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if err := me.redirects.check(req, via); err != nil {
+				return err
+			}
+			// Redirect targets must pass the same policy and SSRF checks as the original URL
+			return me.checkTarget(req.Context(), req.URL)
+		},
+	}
+	if config.RobotsTxt {
+		me.robots = NewRobotsChecker(config.RobotsBotName, me.client, config.RobotsCacheTTL)
+	}
+	me.images = NewImageValidator(config.ImageValidation, config.ImageMaxBytes, config.ImageValidationTimeout, me)
+	return me
+}
+
+// checkTarget applies the domain policy and SSRF checks to a URL about to be fetched
+func (me *MetaExtractor) checkTarget(ctx context.Context, target *url.URL) error {
+	if err := me.policy.Check(target.Hostname()); err != nil {
+		return err
+	}
+	return me.guard.CheckHost(ctx, target.Hostname())
+}
+
+// FetchLinkPreview fetches and extracts metadata from a given URL
+// This function runs in a goroutine to handle multiple requests concurrently
+func (me *MetaExtractor) FetchLinkPreview(ctx context.Context, targetURL string, resultChan chan<- LinkPreviewResponse) {
+	// Defer sending result to channel to ensure we always send a response
+	var result LinkPreviewResponse
+	defer func() {
+		select {
+		case resultChan <- result:
+		case <-ctx.Done():
+			// Context cancelled, don't send result
+		}
+	}()
+
+	ctx, span := tracer.Start(ctx, "fetch", trace.WithAttributes(attribute.String("url.full", targetURL)))
+	defer func() { endSpan(span, &result) }()
+
+	// Initialize result with the original URL
+	result.URL = targetURL
+
+	// Refuse URLs that name no page to fetch, and take those without a scheme as https
+	parsedURL, err := validateURL(targetURL)
+	if err != nil {
+		result.Error = fmt.Sprintf("Invalid URL: %v", err)
+		result.ErrorCode = ErrCodeInvalidURL
+		return
+	}
+	if !strings.Contains(targetURL, "://") {
+		result.URL = parsedURL.String()
+	}
+	// Internationalized domain names are resolved and fetched in punycode, and
+	// unicode in the query is escaped; url stays as requested
+	parsedURL.Host = asciiHost(parsedURL.Host)
+	parsedURL.RawQuery = normalizeEscapes(parsedURL.RawQuery)
+	targetURL = parsedURL.String()
+
+	// Record fetch latency and failures for the metrics endpoint
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		observeFetch(parsedURL.Hostname(), elapsed, &result)
+		me.domains.Record(parsedURL.Hostname(), elapsed, &result)
+	}()
+
+	// Cookies set along the way are sent back until the fetch is done
+	ctx = withCookieJar(ctx)
+
+	// Create HTTP request with context for cancellation support
+	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
+	if err != nil {
+		result.Error = fmt.Sprintf("Failed to create request: %v", err)
+		result.ErrorCode = ErrCodeInvalidURL
+		return
+	}
+
+	// Refuse to fetch excluded domains, the domains the tenant may not preview,
+	// and hosts that resolve to internal addresses
+	if err := TenantFrom(ctx).CheckDomain(req.URL.Hostname()); err != nil {
+		result.Error = fmt.Sprintf("Blocked URL: %v", err)
+		result.ErrorCode = ErrCodeBlocked
+		return
+	}
+	if err := me.checkTarget(ctx, req.URL); err != nil {
+		result.Error = fmt.Sprintf("Blocked URL: %v", err)
+		result.ErrorCode = fetchErrorCode(err)
+		return
+	}
+
+	// In robots.txt compliance mode, refuse paths the site disallows for our bot
+	if me.robots != nil {
+		robotsCtx, robotsSpan := tracer.Start(ctx, "robots.check")
+		allowed := me.robots.Allowed(robotsCtx, req.URL)
+		robotsSpan.SetAttributes(attribute.Bool("robots.allowed", allowed))
+		robotsSpan.End()
+		if !allowed {
+			result.Error = robotsError(me.robots.botName, req.URL)
+			result.ErrorCode = ErrCodeRobotsDisallowed
+			return
+		}
+	}
+
+	// Set User-Agent to mimic a real browser (some sites block requests without it),
+	// unless a profile was asked for. Some sites need their own user agent or
+	// headers; see the config file's domains section
+	override := me.overrides.Lookup(req.URL.Hostname())
+	req.Header.Set("User-Agent", me.agents.Pick(ctx, override))
+	if me.language != "" {
+		req.Header.Set("Accept-Language", me.language)
+	}
+	if override != nil {
+		override.setHeaders(req.Header)
+	}
+	if language := acceptLanguageFrom(ctx); language != "" {
+		req.Header.Set("Accept-Language", language)
+	}
+
+	// Record the redirect chain so it can be reported in the response
+	var redirects []RedirectHop
+	req = req.WithContext(withRedirectChain(req.Context(), &redirects))
+	defer func() { result.Redirects = redirects }()
+
+	// Leave hosts that asked us to slow down alone until the time they asked for is up
+	if wait := me.cooldowns.Wait(req.URL.Hostname()); wait > 0 {
+		result.Error = cooldownError(req.URL.Hostname(), wait)
+		result.ErrorCode = ErrCodeRateLimited
+		result.Retryable = true
+		result.RetryAfter = retryAfterSeconds(wait)
+		return
+	}
+
+	// Fail fast on hosts that keep timing out instead of tying up a worker
+	if ok, retryAfter := me.breaker.Allow(req.URL.Hostname()); !ok {
+		result.Error = circuitOpenError(req.URL.Hostname(), retryAfter)
+		result.ErrorCode = ErrCodeCircuitOpen
+		result.Retryable = true
+		return
+	}
+
+	// Execute the HTTP request, retrying connection resets, timeouts and 502/503/504
+	httpCtx, httpSpan := tracer.Start(req.Context(), "http.get", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("server.address", req.URL.Hostname())))
+	resp, attempts, err := me.doWithRetry(req.WithContext(httpCtx), &redirects)
+	httpSpan.SetAttributes(attribute.Int("http.attempts", attempts), attribute.Int("http.redirects", len(redirects)))
+	if err != nil {
+		httpSpan.SetStatus(codes.Error, err.Error())
+	} else {
+		httpSpan.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+	httpSpan.End()
+	me.breaker.Record(req.URL.Hostname(), (err != nil && retryableError(err)) || (err == nil && retryableStatus(resp.StatusCode)))
+	if err != nil {
+		result.Error = fmt.Sprintf("Failed to fetch URL: %v", err)
+		result.Retryable = retryableError(err)
+		result.ErrorCode = fetchErrorCode(err)
+		return
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	result.FinalURL = resp.Request.URL.String()
+
+	// Check for successful HTTP status
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+		result.ErrorCode = ErrCodeHTTPStatus
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+			result.ErrorCode = ErrCodeNotFound
+		}
+		result.Retryable = retryableStatus(resp.StatusCode) || resp.StatusCode == http.StatusTooManyRequests
+		if wait := me.cooldowns.Record(resp); wait > 0 {
+			result.ErrorCode = ErrCodeRateLimited
+			result.RetryAfter = retryAfterSeconds(wait)
+		}
+		return
+	}
+
+	// Images, PDFs and other files have no metadata to extract
+	if err := linkpreview.CheckContentType(resp.Header.Get("Content-Type")); err != nil {
+		result.Error = fmt.Sprintf("Not an HTML page: %v", err)
+		result.ErrorCode = ErrCodeNotHTML
+		return
+	}
+
+	// Stream the body into the tokenizer instead of buffering the whole page
+	_, parseSpan := tracer.Start(ctx, "parse")
+	doc, bytesRead, err := me.readMetadata(ctx, resp.Body, &result)
+	result.BytesFetched = bytesRead
+	parseSpan.SetAttributes(attribute.Int64("preview.bytes_read", result.BytesFetched))
+	parseSpan.End()
+	switch {
+	case linkpreview.CodeOf(err) == linkpreview.ErrCodeTooLarge && result.Title != "":
+		// The title was found before the limit; what's missing is rarely worth failing the preview for
+	case linkpreview.CodeOf(err) == linkpreview.ErrCodeTooLarge:
+		result.Error = fmt.Sprintf("Page too large: %v", err)
+		result.ErrorCode = ErrCodeTooLarge
+	case err != nil:
+		result.Error = fmt.Sprintf("Failed to read response body: %v", err)
+		result.ErrorCode = fetchErrorCode(err)
+	}
+
+	if result.Language == "" {
+		result.Language = contentLanguage(resp.Header.Get("Content-Language"))
+	}
+
+	// Interstitial and landing pages often redirect with a meta refresh or a
+	// script instead of HTTP; the preview is of the page they lead to
+	if hop, ok := me.redirects.clientRedirect(ctx, doc, &result, redirects); ok {
+		resp.Body.Close()
+		requested := result.URL
+		next := make(chan LinkPreviewResponse, 1)
+		me.FetchLinkPreview(context.WithValue(ctx, clientRedirectsKey{}, clientRedirectsFrom(ctx)+len(redirects)+1), hop.URL, next)
+		select {
+		case result = <-next:
+		default:
+			// ctx is done, so nothing is sent either way
+			return
+		}
+		result.URL = requested
+		result.BytesFetched += bytesRead
+		redirects = append(append(redirects, hop), result.Redirects...)
+		return
+	}
+
+	// Cookie and consent walls stand in for the page; with CONSENT_BYPASS the
+	// page behind is fetched once more as if consent had been given
+	if page, ok := me.consentTarget(ctx, &result, targetURL); ok {
+		resp.Body.Close()
+		behind := make(chan LinkPreviewResponse, 1)
+		me.FetchLinkPreview(withConsentBypass(ctx, page), page, behind)
+		var bypassed LinkPreviewResponse
+		select {
+		case bypassed = <-behind:
+		default:
+			// ctx is done, so nothing is sent either way
+			return
+		}
+		if bypassed.Error == "" && !bypassed.ConsentWall {
+			requested := result.URL
+			bypassed.BytesFetched += bytesRead
+			result = bypassed
+			result.URL, result.ConsentWall, result.ConsentBypassed = requested, true, true
+			redirects = result.Redirects
+			return
+		}
+	}
+
+	// Single-page apps ship an empty shell; render listed domains whose static preview is thin
+	if me.renderer.Wants(parsedURL.Hostname(), &result) {
+		me.renderPreview(ctx, &result)
+	}
+
+	// Drop or replace broken images before they end up in cards
+	if result.Error == "" {
+		me.images.Validate(ctx, &result)
+	}
+}
+
+// PreviewService coordinates cache lookups and pooled preview fetching
+type PreviewService struct {
+	extractor    *MetaExtractor
+	cache        *PreviewCache
+	pool         *FetchPool
+	group        singleflight.Group // Coalesces concurrent fetches of the same URL
+	fetchTimeout time.Duration
+	// Time a preview request may take in total, including waiting for a worker
+	handlerTimeout time.Duration
+	threats        *ThreatChecker  // nil unless Safe Browsing or a blocklist is configured
+	moderator      *ImageModerator // nil unless NSFW detection is configured
+	blurHash       bool            // Compute a BlurHash of each preview image
+	inlineMaxBytes int64           // Largest image inlined as a data URI; 0 disables inlining
+	imageProbe     bool            // Read undeclared image dimensions from the image header
+	fallbackCards  bool            // Give previews without an image a generated card
+	errorStatuses  bool            // Answer failed previews with errorStatus instead of 200
+	reporter       *ErrorReporter  // nil unless Sentry is configured
+
+	archive    *ArchiveFallback   // nil unless ARCHIVE_FALLBACK is set
+	shorteners *ShortenerExpander // nil unless EXPAND_SHORT_URLS is set
+
+	store    PreviewStore     // nil unless STORE_DSN is set
+	recorder *previewRecorder // Saves fetched previews to store
+	usage    *UsageTracker    // Preview requests per API key, kept in store if set
+	// Age up to which a stored preview is served instead of fetching the page; 0 never serves them
+	storeMaxAge time.Duration
+}
+
+// NewPreviewService creates a new PreviewService backed by the given extractor and cache
+func NewPreviewService(extractor *MetaExtractor, cache *PreviewCache, config *Config) *PreviewService {
+	reporter, err := NewErrorReporter(config.SentryDSN, config.SentryEnvironment, config.ErrorReportThreshold)
+	if err != nil {
+		slog.Warn("Error reporting disabled", "error", err)
+	}
+	store, err := NewPreviewStore(config)
+	if err != nil {
+		slog.Warn("Preview store disabled", "error", err)
+	}
+	return &PreviewService{
+		extractor:      extractor,
+		cache:          cache,
+		pool:           NewFetchPool(config.WorkerCount, config.FetchQueueSize),
+		fetchTimeout:   config.FetchTimeout,
+		handlerTimeout: config.HandlerTimeout,
+		threats:        NewThreatChecker(config.SafeBrowsingKey, config.ThreatBlocklistFile, config.ThreatBlocklistRefresh),
+		moderator:      NewImageModerator(config.NSFWAPIURL, config.NSFWAPIKey, extractor),
+		blurHash:       config.BlurHash,
+		inlineMaxBytes: config.InlineImageMaxBytes,
+		imageProbe:     config.ImageProbe,
+		fallbackCards:  config.FallbackCards,
+		errorStatuses:  config.ErrorStatusCodes,
+		reporter:       reporter,
+		archive:        NewArchiveFallback(extractor, config),
+		shorteners:     NewShortenerExpander(extractor, config),
+		store:          store,
+		recorder:       newPreviewRecorder(store),
+		usage:          NewUsageTracker(store),
+		storeMaxAge:    config.StoreMaxAge,
+	}
+}
+
+// Preview returns the link preview for targetURL, serving it from the cache when possible
+// Concurrent calls for the same normalized URL share a single upstream fetch.
+// The returned bool reports whether the result was a cache hit; an error is
+// returned when ctx is done before the fetch completes, or ErrPoolSaturated
+// when the fetch could not be queued
+func (ps *PreviewService) Preview(ctx context.Context, targetURL string) (LinkPreviewResponse, bool, error) {
+	ctx, span := tracer.Start(ctx, "preview", trace.WithAttributes(attribute.String("url.full", targetURL)))
+	defer span.End()
+
+	// Tenants limited to some domains may not preview pages elsewhere, nor
+	// have short links elsewhere expanded for them
+	blocked := func(targetURL, shortURL string) (LinkPreviewResponse, bool) {
+		err := TenantFrom(ctx).CheckDomain(urlHost(normalizeURL(targetURL)))
+		if err == nil {
+			return LinkPreviewResponse{}, false
+		}
+		result := LinkPreviewResponse{Error: fmt.Sprintf("Blocked URL: %v", err), ErrorCode: ErrCodeBlocked, ShortURL: shortURL}
+		result.URL = targetURL
+		return result, true
+	}
+	if result, ok := blocked(targetURL, ""); ok {
+		return result, false, nil
+	}
+
+	// Short links are previewed, cached and stored as the page they lead to
+	shortURL := ""
+	expanded, err := ps.shorteners.Expand(ctx, targetURL)
+	switch {
+	case ctx.Err() != nil:
+		return LinkPreviewResponse{}, false, ctx.Err()
+	case err != nil:
+		result := LinkPreviewResponse{
+			Error:     fmt.Sprintf("Failed to expand short URL: %v", err),
+			ErrorCode: fetchErrorCode(err),
+			Retryable: retryableError(err),
+		}
+		result.URL = targetURL
+		return result, false, nil
+	case expanded != "":
+		shortURL, targetURL = targetURL, expanded
+	}
+
+	key := normalizeURL(targetURL)
+	if shortURL != "" {
+		if result, ok := blocked(targetURL, shortURL); ok {
+			return result, false, nil
+		}
+	}
+	ps.recorder.Hit(key)
+	if cached, ok := ps.cache.Get(cacheKey(ctx, key)); ok {
+		span.SetAttributes(attribute.Bool("preview.cache_hit", true))
+		// The entry may have been cached for another spelling of the URL
+		cached.URL, cached.ShortURL = targetURL, shortURL
+		return cached, true, nil
+	}
+	span.SetAttributes(attribute.Bool("preview.cache_hit", false))
+
+	// Stored previews were fetched with the default user agent and Accept-Language
+	result, err := ps.fetch(ctx, key, targetURL, defaultVariant(ctx))
+	result.ShortURL = shortURL
+	return result, false, err
+}
+
+// Refresh fetches targetURL afresh, bypassing the cache and the preview store,
+// and caches the result when it succeeds
+func (ps *PreviewService) Refresh(ctx context.Context, targetURL string) (LinkPreviewResponse, error) {
+	ctx, span := tracer.Start(ctx, "preview.refresh", trace.WithAttributes(attribute.String("url.full", targetURL)))
+	defer span.End()
+
+	return ps.fetch(ctx, normalizeURL(targetURL), targetURL, false)
+}
+
+// fetch fetches the preview of targetURL, whose normalized form is key, and
+// caches it in the cache namespace of the tenant of ctx. Concurrent calls
+// share one fetch. With useStore, a stored preview younger than storeMaxAge
+// is served instead of fetching the page
+func (ps *PreviewService) fetch(ctx context.Context, key, targetURL string, useStore bool) (LinkPreviewResponse, error) {
+	cached := cacheKey(ctx, key)
+	// Refreshes must not be answered by a fetch that may have come from the store
+	flight := cached
+	if !useStore {
+		flight = "refresh " + cached
+	}
+	resultCh := ps.group.DoChan(flight, func() (interface{}, error) {
+		// The shared fetch must not be cancelled just because the caller that
+		// started it went away, so it gets its own timeout instead
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ps.fetchTimeout)
+		defer cancel()
+
+		if useStore {
+			if stored := ps.storedPreview(fetchCtx, key); stored != nil {
+				ps.cache.SetWithTTL(cached, *stored, ps.extractor.overrides.CacheTTL(urlHost(key)))
+				return *stored, nil
+			}
+		}
+
+		// Create channel to receive the result from the goroutine
+		// Buffered channel ensures the goroutine doesn't block when sending result
+		resultChan := make(chan LinkPreviewResponse, 1)
+
+		// Hand the fetch to the worker pool, which bounds how many run at once
+		err := ps.pool.Submit(func() {
+			ps.extractor.FetchLinkPreview(fetchCtx, targetURL, resultChan)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Check the URL against threat lists while the page is being fetched
+		threatChan := make(chan string, 1)
+		go func() {
+			threatChan <- ps.checkThreats(fetchCtx, key)
+		}()
+
+		select {
+		case result := <-resultChan:
+			if ps.archive != nil && deadLink(&result) {
+				ps.archivedPreview(fetchCtx, targetURL, &result)
+			}
+			if threatType := <-threatChan; threatType != "" {
+				result.Unsafe = true
+				result.ThreatType = threatType
+			}
+			if result.Error == "" && result.Image != "" {
+				ps.imageDimensions(fetchCtx, &result)
+				result.NSFWScore = ps.scoreImage(fetchCtx, result.baseURL(), result.Image)
+				result.BlurHash = ps.placeholder(fetchCtx, result.baseURL(), result.Image)
+			}
+			if result.Error == "" {
+				ps.inlineImages(fetchCtx, &result)
+			}
+			ps.reporter.RecordResult(fetchCtx, &result)
+			if defaultVariant(ctx) {
+				ps.recorder.Record(key, result)
+			}
+			// Only successful previews are cached so transient failures can be retried
+			if result.Error == "" {
+				ps.cache.SetWithTTL(cached, result, ps.extractor.overrides.CacheTTL(urlHost(key)))
+				ps.cacheFinalURL(ctx, key, result)
+			}
+			return result, nil
+		case <-fetchCtx.Done():
+			return nil, fetchCtx.Err()
+		}
+	})
+
+	// Wait for either the shared result or this caller's context timeout
+	select {
+	case res := <-resultCh:
+		if res.Err != nil {
+			return LinkPreviewResponse{}, res.Err
+		}
+		return res.Val.(LinkPreviewResponse), nil
+	case <-ctx.Done():
+		return LinkPreviewResponse{}, ctx.Err()
+	}
+}
+
+// cacheFinalURL also caches result, the preview of key, under the page it
+// redirected to, so requests for that page share it
+func (ps *PreviewService) cacheFinalURL(ctx context.Context, key string, result LinkPreviewResponse) {
+	if result.FinalURL == "" {
+		return
+	}
+	final := normalizeURL(result.FinalURL)
+	if final == key {
+		return
+	}
+	result.URL, result.Redirects = result.FinalURL, nil
+	ps.cache.SetWithTTL(cacheKey(ctx, final), result, ps.extractor.overrides.CacheTTL(urlHost(final)))
+}
+
+// storedPreview returns the latest stored preview of key when it is younger
+// than storeMaxAge, or nil. Lookup failures are logged and the page fetched
+func (ps *PreviewService) storedPreview(ctx context.Context, key string) *LinkPreviewResponse {
+	if ps.store == nil || ps.storeMaxAge <= 0 {
+		return nil
+	}
+	ctx, span := tracer.Start(ctx, "store.lookup")
+	defer span.End()
+
+	stored, err := ps.store.Latest(ctx, key)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		slog.WarnContext(ctx, "Preview store lookup failed", "url", key, "error", err)
+		return nil
+	}
+	if stored == nil || time.Since(stored.FetchedAt) > ps.storeMaxAge {
+		return nil
+	}
+	span.SetAttributes(attribute.Bool("store.hit", true))
+	return &stored.Preview
+}
+
+// checkThreats returns the threat type for targetURL, or "" if it isn't known to be unsafe
+// Lookup failures are logged and treated as safe so an outage doesn't block previews
+func (ps *PreviewService) checkThreats(ctx context.Context, targetURL string) string {
+	if ps.threats == nil {
+		return ""
+	}
+	ctx, span := tracer.Start(ctx, "threat.check")
+	defer span.End()
+
+	threatType, err := ps.threats.Check(ctx, targetURL)
+	span.SetAttributes(attribute.String("threat.type", threatType))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		slog.WarnContext(ctx, "Threat check failed", "url", targetURL, "error", err)
+	}
+	return threatType
+}
+
+// scoreImage returns the NSFW score of a preview image, or nil when moderation is
+// disabled or the image couldn't be classified
+func (ps *PreviewService) scoreImage(ctx context.Context, pageURL, imageURL string) *float64 {
+	if ps.moderator == nil {
+		return nil
+	}
+	ctx, span := tracer.Start(ctx, "nsfw.score")
+	defer span.End()
+
+	score, err := ps.moderator.Score(ctx, pageURL, imageURL)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		slog.WarnContext(ctx, "NSFW check failed", "image", imageURL, "error", err)
+		return nil
+	}
+	return &score
+}
+
+// placeholder returns the BlurHash of a preview image, or "" when BlurHashes are
+// disabled or the image couldn't be decoded
+func (ps *PreviewService) placeholder(ctx context.Context, pageURL, imageURL string) string {
+	if !ps.blurHash {
+		return ""
+	}
+	ctx, span := tracer.Start(ctx, "image.blurhash")
+	defer span.End()
+
+	hash, err := ps.extractor.blurHashImage(ctx, pageURL, imageURL)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		slog.WarnContext(ctx, "BlurHash failed", "image", imageURL, "error", err)
+		return ""
+	}
+	return hash
+}
+
+// Warm fetches and caches the given URLs in the background without returning results
+// At most concurrency fetches run at once; each fetch gets its own timeout
+func (ps *PreviewService) Warm(urls []string, concurrency int, timeout time.Duration) {
+	go func() {
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for _, targetURL := range urls {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(targetURL string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				ps.Preview(ctx, targetURL)
+			}(targetURL)
+		}
+		wg.Wait()
+	}()
+}
+
+// Config holds server configuration
+type Config struct {
+	AllowedOrigins  []string
+	Port            string
+	AdminToken      string
+	AdminAllowedIPs []string
+	APIKeys         []string
+	OIDCIssuer      string
+	OIDCAudience    string
+	OIDCJWKSURL     string
+	KeyRateLimit    int
+	KeyRateBurst    int
+	KeyDailyQuota   int
+	IPRateLimit     int
+	IPRateBurst     int
+	TrustedProxies  []string
+	CacheMaxEntries int
+	CacheTTL        time.Duration
+
+	// Fetch concurrency
+	FetchTimeout   time.Duration
+	WorkerCount    int
+	FetchQueueSize int
+
+	// Timeouts and limits
+	HandlerTimeout    time.Duration // Time a /preview request may take before answering 408
+	HTTPClientTimeout time.Duration // Cap on each outbound request attempt
+	MaxBodyBytes      int64         // Bytes of each page read while looking for metadata
+
+	// Answer failed previews with a 4xx or 5xx status matching error_code instead of 200
+	ErrorStatusCodes bool
+
+	// User-Agent of page fetches: a profile in linkpreview.UserAgents or a
+	// literal value, and profiles to take in turn instead
+	UserAgent         string
+	UserAgentRotation []string
+	AcceptLanguage    string // Sent with page fetches unless the request asks for another; "" sends none
+
+	// Sources allowed to fill each preview field, highest priority first
+	FieldOrder linkpreview.FieldOrder
+
+	// Headless rendering of JavaScript-heavy pages
+	RenderDomains    []string      // Domains whose thin previews are re-extracted from the rendered page
+	RenderTimeout    time.Duration // Budget for loading and running one page
+	RenderWait       time.Duration // Extra time given to scripts after the load event
+	RenderChromePath string        // Chromium binary; empty means look it up in PATH
+	RenderChromeURL  string        // DevTools URL of a running Chromium to use instead of starting one
+
+	// Headless browser pool
+	RenderBrowsers       int           // Chromium instances kept warm
+	RenderMaxConcurrency int           // Pages rendered at once across all instances
+	RenderRecycleAfter   int           // Pages an instance renders before it is replaced
+	RenderBrowserMaxAge  time.Duration // Lifetime of an instance before it is replaced
+	RenderMaxMemoryMB    int           // JavaScript heap limit of each page
+
+	PDFEnabled bool // Serve GET /pdf through the renderer
+
+	// Preview image checks
+	ImageValidation        bool          // Check preview images exist and are images before returning them
+	ImageMaxBytes          int64         // Largest preview image accepted
+	ImageValidationTimeout time.Duration // Budget for checking the images of one preview
+
+	// Largest size the image proxy resizes to
+	ImageResizeMaxWidth  int
+	ImageResizeMaxHeight int
+	ImageFormats         []string // Formats the image proxy converts to when the client accepts them, preferred first
+
+	ImageProbe          bool  // Read undeclared preview image dimensions from the image header
+	BlurHash            bool  // Include a BlurHash of the preview image
+	InlineImageMaxBytes int64 // Largest preview image or favicon inlined as a data URI; 0 disables inlining
+	FallbackCards       bool  // Draw a card image for previews without one
+
+	// Request admission
+	MaxInFlightRequests   int
+	AdmissionQueueDepth   int
+	AdmissionQueueTimeout time.Duration
+
+	// Retries of transient upstream failures
+	FetchRetries        int
+	FetchRetryBaseDelay time.Duration
+	FetchRetryMaxDelay  time.Duration
+
+	// Per-host circuit breaker
+	BreakerFailureThreshold int
+	BreakerCooldown         time.Duration
+	RetryAfterMax           time.Duration // Longest Retry-After of a 429 or 503 honored; 0 ignores them
+
+	// Adaptive per-host fetch timeouts
+	AdaptiveTimeouts   bool
+	AdaptiveTimeoutMin time.Duration
+	AdaptiveTimeoutMax time.Duration
+
+	// Outbound politeness per target host
+	HostMaxConcurrency    int
+	HostRequestsPerSecond float64
+
+	// Outbound connection pool
+	Transport TransportConfig
+
+	// DNS resolution
+	DNSServers       []string
+	DNSOverHTTPSURL  string
+	DNSCacheTTL      time.Duration
+	ReadinessDNSHost string
+	SSRFProtection   bool
+	SSRFAllowlist    []string
+	AllowedDomains   []string
+	BlockedDomains   []string
+	DomainOverrides  DomainOverrides // From the config file's domains section
+	Tenants          []*Tenant       // From the config file's tenants section
+
+	// Redirect policy
+	MaxRedirects            int
+	BlockRedirectDowngrade  bool
+	AllowCrossHostRedirects bool
+	FollowClientRedirects   bool
+
+	// Fetch the pages behind cookie and consent walls again with consent cookies
+	ConsentBypass bool
+
+	// robots.txt compliance
+	RobotsTxt      bool
+	RobotsBotName  string
+	RobotsCacheTTL time.Duration
+
+	// Media endpoints
+	MediaSigningSecret string
+
+	// S3-compatible storage for media; disabled when MediaStoreBucket is empty
+	MediaStoreEndpoint  string
+	MediaStoreBucket    string
+	MediaStoreRegion    string
+	MediaStoreAccessKey string
+	MediaStoreSecretKey string
+	MediaStoreInsecure  bool          // Connect over plain HTTP
+	MediaStorePrefix    string        // Prepended to every object key
+	MediaStorePublicURL string        // Base URL objects are served from instead of presigned URLs
+	MediaStoreURLTTL    time.Duration // Lifetime of presigned URLs
+	MediaStorePDFMaxAge time.Duration // Age after which a stored PDF is captured again
+
+	// Short links expanded before previewing, on the default shortener domains and these
+	ExpandShortURLs  bool
+	ShortenerDomains []string
+
+	// Previews of dead links built from Wayback Machine snapshots
+	ArchiveFallback bool
+	ArchiveAPIURL   string // Wayback Machine availability API
+
+	// Database recording every preview; disabled when StoreDSN is empty
+	StoreDriver string        // "sqlite" or "postgres"; guessed from StoreDSN when empty
+	StoreDSN    string        // SQLite file or Postgres connection string
+	StoreMaxAge time.Duration // Age up to which stored previews are served instead of fetched
+
+	// Retention of stored previews; zero values keep everything
+	StoreRetention       time.Duration // Age after which stored previews are deleted
+	StoreMaxRows         int           // Stored previews kept in all
+	StoreMaxRowsPerHost  int           // Stored previews kept per host
+	StoreCleanupInterval time.Duration // How often the retention limits are enforced
+
+	// Scheduled refresh of stored previews; disabled when RecrawlSchedule is empty
+	RecrawlSchedule    string        // Cron expression, or a descriptor such as "@every 1h"
+	RecrawlBatch       int           // URLs refreshed per run at most
+	RecrawlMinAge      time.Duration // Previews fetched more recently aren't refreshed
+	RecrawlMaxIdle     time.Duration // URLs not requested for this long aren't refreshed
+	RecrawlConcurrency int
+
+	// Native TLS
+	TLSCert          string
+	TLSKey           string
+	ACMEDomains      []string
+	ACMECacheDir     string
+	ACMEEmail        string
+	HSTSMaxAge       time.Duration
+	HTTPRedirectPort string
+
+	// Listeners, see parseListenSpecs; empty listens on Port only
+	Listen           string
+	ListenSocketMode os.FileMode
+
+	// Outbound proxy
+	OutboundProxy      string
+	OutboundProxyRules []string
+
+	// Monitoring
+	MetricsEnabled     bool
+	TracingEnabled     bool
+	TracingServiceName string
+
+	// Audit and access logging
+	AuditLog          string
+	AccessLog         string
+	AccessLogFormat   string
+	AccessLogRotation AccessLogRotation
+
+	// Threat detection
+	SafeBrowsingKey        string
+	ThreatBlocklistFile    string
+	ThreatBlocklistRefresh time.Duration
+
+	// NSFW image detection
+	NSFWAPIURL string
+	NSFWAPIKey string
+
+	// Error reporting
+	SentryDSN            string
+	SentryEnvironment    string
+	ErrorReportThreshold int
+
+	// Configuration reloading
+	ConfigReloadInterval time.Duration
+}
+
+// NewConfig creates a new configuration with default values
+func NewConfig() *Config {
+	// Get allowed origins from environment variable
+	allowedOrigins := setting("ALLOWED_ORIGINS")
+	var origins []string
+
+	if allowedOrigins != "" {
+		// Split by comma and trim spaces
+		for _, origin := range strings.Split(allowedOrigins, ",") {
+			origin = strings.TrimSpace(origin)
+			if origin != "" {
+				origins = append(origins, origin)
+			}
+		}
+	}
+
+	// Default to allowing common development origins if none specified
+	if len(origins) == 0 {
+		origins = []string{"https://localhost:3000", "http://localhost:3000", "http://localhost:5173"}
+	}
+
+	port := normalizePort(setting("PORT"))
+	if port == "" {
+		port = ":5465"
+	}
+
+	return &Config{
+		AllowedOrigins:  origins,
+		Port:            port,
+		AdminToken:      setting("ADMIN_TOKEN"),
+		AdminAllowedIPs: getEnvList("ADMIN_ALLOWED_IPS"),
+		APIKeys:         getEnvListWithFile("API_KEYS", "API_KEYS_FILE"),
+		OIDCIssuer:      setting("OIDC_ISSUER"),
+		OIDCAudience:    setting("OIDC_AUDIENCE"),
+		OIDCJWKSURL:     setting("OIDC_JWKS_URL"),
+		KeyRateLimit:    getEnvInt("API_KEY_RATE_LIMIT", 60),
+		KeyRateBurst:    getEnvInt("API_KEY_RATE_BURST", 0),
+		KeyDailyQuota:   getEnvInt("API_KEY_DAILY_QUOTA", 0),
+		IPRateLimit:     getEnvInt("IP_RATE_LIMIT", 0),
+		IPRateBurst:     getEnvInt("IP_RATE_BURST", 0),
+		TrustedProxies:  getEnvList("TRUSTED_PROXIES"),
+		CacheMaxEntries: getEnvInt("CACHE_MAX_ENTRIES", 1000),
+		CacheTTL:        getEnvDuration("CACHE_TTL", time.Hour),
+
+		FetchTimeout:   getEnvDuration("FETCH_TIMEOUT", 15*time.Second),
+		WorkerCount:    getEnvInt("WORKER_COUNT", 32),
+		FetchQueueSize: getEnvInt("FETCH_QUEUE_SIZE", 256),
+
+		HandlerTimeout:    getEnvDuration("HANDLER_TIMEOUT", 15*time.Second),
+		HTTPClientTimeout: getEnvDuration("HTTP_CLIENT_TIMEOUT", 10*time.Second),
+		MaxBodyBytes:      int64(getEnvInt("MAX_BODY_BYTES", linkpreview.DefaultMaxBodySize)),
+
+		ErrorStatusCodes: getEnvBool("ERROR_STATUS_CODES", false),
+
+		UserAgent:         getEnv("USER_AGENT", ""),
+		UserAgentRotation: getEnvList("USER_AGENT_ROTATION"),
+		AcceptLanguage:    getEnv("ACCEPT_LANGUAGE", ""),
+
+		FieldOrder: getFieldOrder(),
+
+		RenderDomains:    getEnvList("RENDER_DOMAINS"),
+		RenderTimeout:    getEnvDuration("RENDER_TIMEOUT", 10*time.Second),
+		RenderWait:       getEnvDuration("RENDER_WAIT", 500*time.Millisecond),
+		RenderChromePath: getEnv("RENDER_CHROME_PATH", ""),
+		RenderChromeURL:  getEnv("RENDER_CHROME_URL", ""),
+
+		RenderBrowsers:       getEnvInt("RENDER_BROWSERS", 1),
+		RenderMaxConcurrency: getEnvInt("RENDER_MAX_CONCURRENCY", 4),
+		RenderRecycleAfter:   getEnvInt("RENDER_RECYCLE_AFTER", 100),
+		RenderBrowserMaxAge:  getEnvDuration("RENDER_BROWSER_MAX_AGE", 30*time.Minute),
+		RenderMaxMemoryMB:    getEnvInt("RENDER_MAX_MEMORY_MB", 512),
+
+		PDFEnabled: getEnvBool("PDF_ENABLED", false),
+
+		ImageValidation:        getEnvBool("IMAGE_VALIDATION", false),
+		ImageMaxBytes:          int64(getEnvInt("IMAGE_MAX_BYTES", maxProxiedImageBytes)),
+		ImageValidationTimeout: getEnvDuration("IMAGE_VALIDATION_TIMEOUT", 3*time.Second),
+
+		ImageResizeMaxWidth:  getEnvInt("IMAGE_RESIZE_MAX_WIDTH", 1920),
+		ImageResizeMaxHeight: getEnvInt("IMAGE_RESIZE_MAX_HEIGHT", 1920),
+		ImageFormats:         getEnvList("IMAGE_FORMATS"),
+
+		ImageProbe:          getEnvBool("IMAGE_PROBE", false),
+		BlurHash:            getEnvBool("BLURHASH", false),
+		InlineImageMaxBytes: int64(getEnvInt("INLINE_IMAGE_MAX_BYTES", 0)),
+		FallbackCards:       getEnvBool("FALLBACK_CARDS", false),
+
+		MaxInFlightRequests:   getEnvInt("MAX_INFLIGHT_REQUESTS", 256),
+		AdmissionQueueDepth:   getEnvInt("ADMISSION_QUEUE_DEPTH", 512),
+		AdmissionQueueTimeout: getEnvDuration("ADMISSION_QUEUE_TIMEOUT", 5*time.Second),
+
+		FetchRetries:        getEnvInt("FETCH_RETRIES", 2),
+		FetchRetryBaseDelay: getEnvDuration("FETCH_RETRY_BASE_DELAY", 200*time.Millisecond),
+		FetchRetryMaxDelay:  getEnvDuration("FETCH_RETRY_MAX_DELAY", 2*time.Second),
+
+		BreakerFailureThreshold: getEnvInt("BREAKER_FAILURE_THRESHOLD", 5),
+		BreakerCooldown:         getEnvDuration("BREAKER_COOLDOWN", 30*time.Second),
+		RetryAfterMax:           getEnvDuration("RETRY_AFTER_MAX", time.Hour),
+
+		AdaptiveTimeouts:   getEnvBool("ADAPTIVE_TIMEOUTS", true),
+		AdaptiveTimeoutMin: getEnvDuration("ADAPTIVE_TIMEOUT_MIN", 2*time.Second),
+		AdaptiveTimeoutMax: getEnvDuration("ADAPTIVE_TIMEOUT_MAX", 10*time.Second),
+
+		HostMaxConcurrency:    getEnvInt("HOST_MAX_CONCURRENCY", 4),
+		HostRequestsPerSecond: getEnvFloat("HOST_REQUESTS_PER_SECOND", 5),
+
+		Transport: TransportConfig{
+			MaxIdleConns:          getEnvInt("HTTP_MAX_IDLE_CONNS", 200),
+			MaxIdleConnsPerHost:   getEnvInt("HTTP_MAX_IDLE_CONNS_PER_HOST", 10),
+			MaxConnsPerHost:       getEnvInt("HTTP_MAX_CONNS_PER_HOST", 0),
+			IdleConnTimeout:       getEnvDuration("HTTP_IDLE_CONN_TIMEOUT", 90*time.Second),
+			TLSHandshakeTimeout:   getEnvDuration("HTTP_TLS_HANDSHAKE_TIMEOUT", 10*time.Second),
+			ResponseHeaderTimeout: getEnvDuration("HTTP_RESPONSE_HEADER_TIMEOUT", 0),
+			HTTP2:                 getEnvBool("HTTP2_ENABLED", true),
+		},
+
+		DNSServers:       getEnvList("DNS_SERVERS"),
+		DNSOverHTTPSURL:  setting("DNS_OVER_HTTPS_URL"),
+		DNSCacheTTL:      getEnvDuration("DNS_CACHE_TTL", time.Minute),
+		ReadinessDNSHost: getEnv("READINESS_DNS_HOST", "example.com"),
+		SSRFProtection:   getEnvBool("SSRF_PROTECTION", true),
+		SSRFAllowlist:    getEnvList("SSRF_ALLOWLIST"),
+		AllowedDomains:   getEnvListWithFile("ALLOWED_DOMAINS", "ALLOWED_DOMAINS_FILE"),
+		BlockedDomains:   getEnvListWithFile("BLOCKED_DOMAINS", "BLOCKED_DOMAINS_FILE"),
+		DomainOverrides:  configFileDomainOverrides(),
+		Tenants:          configFileTenants(),
+
+		MaxRedirects:            getEnvInt("MAX_REDIRECTS", 10),
+		BlockRedirectDowngrade:  getEnvBool("BLOCK_REDIRECT_DOWNGRADE", true),
+		AllowCrossHostRedirects: getEnvBool("ALLOW_CROSS_HOST_REDIRECTS", true),
+		FollowClientRedirects:   getEnvBool("FOLLOW_CLIENT_REDIRECTS", true),
+
+		ConsentBypass: getEnvBool("CONSENT_BYPASS", false),
+
+		RobotsTxt:      getEnvBool("ROBOTS_TXT", false),
+		RobotsBotName:  getEnv("ROBOTS_BOT_NAME", "link-preview-api"),
+		RobotsCacheTTL: getEnvDuration("ROBOTS_CACHE_TTL", time.Hour),
+
+		MediaSigningSecret: setting("MEDIA_SIGNING_SECRET"),
+
+		MediaStoreEndpoint:  getEnv("MEDIA_STORE_ENDPOINT", "s3.amazonaws.com"),
+		MediaStoreBucket:    setting("MEDIA_STORE_BUCKET"),
+		MediaStoreRegion:    getEnv("MEDIA_STORE_REGION", "us-east-1"),
+		MediaStoreAccessKey: setting("MEDIA_STORE_ACCESS_KEY"),
+		MediaStoreSecretKey: setting("MEDIA_STORE_SECRET_KEY"),
+		MediaStoreInsecure:  getEnvBool("MEDIA_STORE_INSECURE", false),
+		MediaStorePrefix:    getEnv("MEDIA_STORE_PREFIX", "link-preview/"),
+		MediaStorePublicURL: setting("MEDIA_STORE_PUBLIC_URL"),
+		MediaStoreURLTTL:    getEnvDuration("MEDIA_STORE_URL_TTL", time.Hour),
+		MediaStorePDFMaxAge: getEnvDuration("MEDIA_STORE_PDF_MAX_AGE", time.Hour),
+
+		ExpandShortURLs:  getEnvBool("EXPAND_SHORT_URLS", true),
+		ShortenerDomains: getEnvList("SHORTENER_DOMAINS"),
+
+		ArchiveFallback: getEnvBool("ARCHIVE_FALLBACK", false),
+		ArchiveAPIURL:   getEnv("ARCHIVE_API_URL", "https://archive.org/wayback/available"),
+
+		StoreDriver: setting("STORE_DRIVER"),
+		StoreDSN:    setting("STORE_DSN"),
+		StoreMaxAge: getEnvDuration("STORE_MAX_AGE", 0),
+
+		StoreRetention:       getEnvDuration("STORE_RETENTION", 0),
+		StoreMaxRows:         getEnvInt("STORE_MAX_ROWS", 0),
+		StoreMaxRowsPerHost:  getEnvInt("STORE_MAX_ROWS_PER_HOST", 0),
+		StoreCleanupInterval: getEnvDuration("STORE_CLEANUP_INTERVAL", time.Hour),
+
+		RecrawlSchedule:    setting("RECRAWL_SCHEDULE"),
+		RecrawlBatch:       getEnvInt("RECRAWL_BATCH", 100),
+		RecrawlMinAge:      getEnvDuration("RECRAWL_MIN_AGE", time.Hour),
+		RecrawlMaxIdle:     getEnvDuration("RECRAWL_MAX_IDLE", 7*24*time.Hour),
+		RecrawlConcurrency: getEnvInt("RECRAWL_CONCURRENCY", 2),
+
+		TLSCert:          setting("TLS_CERT"),
+		TLSKey:           setting("TLS_KEY"),
+		ACMEDomains:      getEnvList("ACME_DOMAINS"),
+		ACMECacheDir:     getEnv("ACME_CACHE_DIR", "certs"),
+		ACMEEmail:        setting("ACME_EMAIL"),
+		HSTSMaxAge:       getEnvDuration("HSTS_MAX_AGE", 365*24*time.Hour),
+		HTTPRedirectPort: normalizePort(setting("HTTP_REDIRECT_PORT")),
+
+		Listen:           setting("LISTEN"),
+		ListenSocketMode: getEnvFileMode("LISTEN_SOCKET_MODE", 0o660),
+
+		OutboundProxy:      setting("OUTBOUND_PROXY"),
+		OutboundProxyRules: getEnvList("OUTBOUND_PROXY_RULES"),
+
+		MetricsEnabled: getEnvBool("METRICS_ENABLED", true),
+		// Tracing is on whenever an OTLP endpoint is configured
+		// The OTLP exporter reads its endpoint from the environment itself, so these stay env-only
+		TracingEnabled:     os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "",
+		TracingServiceName: getEnv("OTEL_SERVICE_NAME", "link-preview-api"),
+
+		AuditLog:        setting("AUDIT_LOG"),
+		AccessLog:       setting("ACCESS_LOG"),
+		AccessLogFormat: getEnv("ACCESS_LOG_FORMAT", AccessLogCombined),
+		AccessLogRotation: AccessLogRotation{
+			MaxSizeMB:  getEnvInt("ACCESS_LOG_MAX_SIZE_MB", 100),
+			MaxBackups: getEnvInt("ACCESS_LOG_MAX_BACKUPS", 7),
+			MaxAgeDays: getEnvInt("ACCESS_LOG_MAX_AGE_DAYS", 30),
+			Compress:   getEnvBool("ACCESS_LOG_COMPRESS", false),
+		},
+
+		SafeBrowsingKey:        setting("SAFE_BROWSING_API_KEY"),
+		ThreatBlocklistFile:    setting("THREAT_BLOCKLIST_FILE"),
+		ThreatBlocklistRefresh: getEnvDuration("THREAT_BLOCKLIST_REFRESH", 15*time.Minute),
+
+		NSFWAPIURL: setting("NSFW_API_URL"),
+		NSFWAPIKey: setting("NSFW_API_KEY"),
+
+		SentryDSN:            setting("SENTRY_DSN"),
+		SentryEnvironment:    getEnv("SENTRY_ENVIRONMENT", "production"),
+		ErrorReportThreshold: getEnvInt("ERROR_REPORT_THRESHOLD", 5),
+
+		ConfigReloadInterval: getEnvDuration("CONFIG_RELOAD_INTERVAL", 10*time.Second),
+	}
+}
+
+// getEnvBool reads a boolean environment variable, falling back to def when unset or invalid
+func getEnvBool(key string, def bool) bool {
+	value := strings.TrimSpace(setting(key))
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable", "key", key, "value", value, "error", err)
+		return def
+	}
+	return b
+}
+
+// getEnvList reads a comma-separated environment variable, dropping empty items
+func getEnvList(key string) []string {
+	return splitList(setting(key))
+}
+
+// getEnvListWithFile combines the comma-separated items in envKey with the items
+// listed one per line in the file named by fileEnvKey (# starts a comment)
+func getEnvListWithFile(envKey, fileEnvKey string) []string {
+	items := getEnvList(envKey)
+
+	path := strings.TrimSpace(setting(fileEnvKey))
+	if path == "" {
+		return items
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		slog.Warn("Could not read list file", "key", fileEnvKey, "path", path, "error", err)
+		return items
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Warn("Error reading list file", "key", fileEnvKey, "path", path, "error", err)
+	}
+	return items
+}
+
+// normalizePort turns "8080" into ":8080", leaving empty values and full addresses untouched
+func normalizePort(port string) string {
+	port = strings.TrimSpace(port)
+	if port == "" || strings.Contains(port, ":") {
+		return port
+	}
+	return ":" + port
+}
+
+// getEnv reads a string environment variable, falling back to def when unset
+func getEnv(key, def string) string {
+	if value := strings.TrimSpace(setting(key)); value != "" {
+		return value
+	}
+	return def
+}
+
+// getEnvInt reads an integer environment variable, falling back to def when unset or invalid
+func getEnvInt(key string, def int) int {
+	value := strings.TrimSpace(setting(key))
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable", "key", key, "value", value, "error", err)
+		return def
+	}
+	return n
+}
+
+// getEnvFloat reads a decimal environment variable, falling back to def when unset or invalid
+func getEnvFloat(key string, def float64) float64 {
+	value := strings.TrimSpace(setting(key))
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable", "key", key, "value", value, "error", err)
+		return def
+	}
+	return f
+}
+
+// getEnvDuration reads a duration environment variable (e.g. "30s", "1h"), falling back to def when unset or invalid
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	value := strings.TrimSpace(setting(key))
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable", "key", key, "value", value, "error", err)
+		return def
+	}
+	return d
+}
+
+// getEnvFileMode reads an octal file permission environment variable (e.g. "0660"), falling back to def when unset or invalid
+func getEnvFileMode(key string, def os.FileMode) os.FileMode {
+	value := strings.TrimSpace(setting(key))
+	if value == "" {
+		return def
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0o777 {
+		slog.Warn("Ignoring invalid environment variable", "key", key, "value", value, "error", err)
+		return def
+	}
+	return os.FileMode(mode)
+}
+
+// fieldSources are the sources SOURCES_* settings may name
+var fieldSources = []string{linkpreview.SourceOpenGraph, linkpreview.SourceTwitter, linkpreview.SourceJSONLD, linkpreview.SourceHTML, linkpreview.SourceHeuristic}
+
+// getFieldOrder reads the SOURCES_TITLE, SOURCES_DESCRIPTION, SOURCES_IMAGE and
+// SOURCES_SITE_NAME lists, dropping unknown sources. Unset fields keep the default order
+func getFieldOrder() linkpreview.FieldOrder {
+	order := make(linkpreview.FieldOrder)
+	for _, field := range []string{linkpreview.FieldTitle, linkpreview.FieldDescription, linkpreview.FieldImage, linkpreview.FieldSiteName} {
+		key := "SOURCES_" + strings.ToUpper(field)
+		var sources []string
+		for _, source := range getEnvList(key) {
+			source = strings.ToLower(source)
+			if !slices.Contains(fieldSources, source) {
+				slog.Warn("Ignoring unknown preview source", "key", key, "source", source, "known", strings.Join(fieldSources, ","))
+				continue
+			}
+			sources = append(sources, source)
+		}
+		if len(sources) > 0 {
+			order[field] = sources
+		}
+	}
+	if len(order) == 0 {
+		return nil
+	}
+	return order
+}
+
+// setupRoutes configures all the API routes, accepting the API keys in keys
+func setupRoutes(service *PreviewService, config *Config, reloader *ConfigReloader, keys *APIKeyStore) *gin.Engine {
+	// Create Gin router with structured request logging and panic recovery
+	gin.SetMode(setting("GIN_MODE"))
+	router := gin.New()
+	router.Use(requestIDMiddleware(), recoveryLogger(service.reporter))
+
+	// Log requests to a dedicated access log when one is configured, otherwise through slog
+	access, err := NewAccessLogger(config.AccessLog, config.AccessLogFormat, config.AccessLogRotation)
+	if err != nil {
+		slog.Warn("Access log disabled", "error", err)
+	}
+	if access != nil {
+		router.Use(access.Middleware())
+	} else {
+		router.Use(requestLogger())
+	}
+
+	// Only trust X-Forwarded-For / X-Real-IP from configured proxies so clients
+	// can't spoof their IP to dodge per-IP rate limits
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		slog.Warn("Ignoring invalid TRUSTED_PROXIES", "error", err)
+		router.SetTrustedProxies(nil)
+	}
+
+	// Trace every request, continuing traces started by the caller
+	router.Use(tracingMiddleware())
+
+	// Count requests and their latency for the metrics endpoint
+	if config.MetricsEnabled {
+		router.Use(metricsMiddleware())
+	}
+
+	// Tell browsers to only use HTTPS when the server terminates TLS itself
+	if config.TLSEnabled() && config.HSTSMaxAge > 0 {
+		router.Use(hstsMiddleware(config.HSTSMaxAge))
+	}
+
+	// Add CORS middleware with configurable allowed origins
+	// Tenants' origins are let through here and checked against their keys by requireAuth
+	origins := NewOriginList(config.AllowedOrigins)
+	origins.SetTenantOrigins(tenantOrigins(keys.Tenants()))
+	keys.OnChange(func(tenants []*Tenant) { origins.SetTenantOrigins(tenantOrigins(tenants)) })
+	router.Use(corsMiddleware(origins))
+
+	// Health check endpoint
+	router.GET("/health", ginHandler(HealthHandler()))
+
+	// Kubernetes-style probes: liveness only checks the process, readiness its dependencies
+	router.GET("/healthz", ginHandler(LivenessHandler()))
+	router.GET("/readyz", ginHandler(ReadinessHandler(service, config)))
+
+	// Main endpoint for fetching link previews
+	auth := requireAuth(keys, NewJWTValidator(config.OIDCIssuer, config.OIDCAudience, config.OIDCJWKSURL))
+	keyLimiter := NewRateLimiter(config.KeyRateLimit, config.KeyRateBurst, config.KeyDailyQuota)
+	ipLimiter := NewRateLimiter(config.IPRateLimit, config.IPRateBurst, 0)
+	signer := NewURLSigner(config.MediaSigningSecret)
+	audit, err := NewAuditLogger(config.AuditLog)
+	if err != nil {
+		slog.Warn("Audit logging disabled", "error", err)
+	}
+	admission := NewAdmissionController(config.MaxInFlightRequests, config.AdmissionQueueDepth, config.AdmissionQueueTimeout)
+	stats := NewServiceStats()
+	router.POST("/preview", auth, rateLimitByIP(ipLimiter), rateLimitByAPIKey(keyLimiter), admission.Middleware(), ginHandler(PreviewHandler(service, signer, audit, stats)))
+
+	// Media endpoints require an HMAC-signed URL
+	store, err := NewMediaStore(config)
+	if err != nil {
+		slog.Warn("Media storage disabled", "error", err)
+	} else if store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := store.Check(ctx); err != nil {
+			slog.Warn("Media store unreachable; media will be served without it until it recovers", "bucket", config.MediaStoreBucket, "error", err)
+		}
+		cancel()
+	}
+	resizer := NewImageResizer(config.ImageResizeMaxWidth, config.ImageResizeMaxHeight)
+	router.GET("/image", requireSignature(signer), admission.Middleware(), handleImageProxy(service.extractor, resizer, NewImageConverter(config.ImageFormats), store))
+
+	// Fallback card images for previews without one
+	if cards := NewCardRenderer(config.FallbackCards, service.extractor); cards != nil {
+		if signer == nil {
+			slog.Warn("FALLBACK_CARDS needs MEDIA_SIGNING_SECRET; previews won't get cards")
+		}
+		router.GET("/card", requireSignature(signer), admission.Middleware(), handleCard(cards, store))
+	}
+
+	// Sharing debugger: how a page's preview is built and what's wrong with its tags
+	router.GET("/debug", auth, rateLimitByIP(ipLimiter), rateLimitByAPIKey(keyLimiter), admission.Middleware(), handleDebug(service))
+
+	// Versions of a URL's preview recorded by the preview store
+	if service.store != nil {
+		router.GET("/history", auth, rateLimitByIP(ipLimiter), rateLimitByAPIKey(keyLimiter), handleHistory(service))
+
+		// Subscriptions to changes found by scheduled recrawls
+		webhooks := router.Group("/webhooks", auth, rateLimitByIP(ipLimiter), rateLimitByAPIKey(keyLimiter))
+		webhooks.POST("", handleAddWebhook(service.store))
+		webhooks.GET("", handleListWebhooks(service.store))
+		webhooks.DELETE("/:id", handleDeleteWebhook(service.store))
+	}
+
+	// PDF snapshots rendered in headless Chromium, authenticated and limited like previews
+	if service.extractor.renderer != nil && config.PDFEnabled {
+		router.GET("/pdf", auth, rateLimitByIP(ipLimiter), rateLimitByAPIKey(keyLimiter), admission.Middleware(), handlePDF(service.extractor, config.HandlerTimeout+config.RenderTimeout, store, config.MediaStorePDFMaxAge))
+	}
+
+	// Prometheus metrics
+	if config.MetricsEnabled {
+		router.GET("/metrics", handleMetrics(service, admission))
+	}
+
+	// Lightweight counters for dashboards without a metrics stack
+	router.GET("/stats", ginHandler(StatsHandler(stats)))
+
+	// Remaining rate-limit allowance and daily quota for the calling API key
+	router.GET("/quota", auth, handleQuota(keyLimiter))
+
+	// Apply the settings that can change without a restart when the configuration is reloaded
+	live := NewLiveConfig(config)
+	reloader.OnReload(func(config *Config) {
+		origins.Set(config.AllowedOrigins)
+		keyLimiter.SetLimits(config.KeyRateLimit, config.KeyRateBurst, config.KeyDailyQuota)
+		ipLimiter.SetLimits(config.IPRateLimit, config.IPRateBurst, 0)
+		service.extractor.policy.Update(config.AllowedDomains, config.BlockedDomains)
+		service.cache.SetTTL(config.CacheTTL)
+		live.Reloaded(config)
+	})
+
+	// Operational endpoints (require ADMIN_TOKEN and an allowed client IP)
+	registerAdminRoutes(router, service, config, keys, stats, live)
+
+	// API documentation endpoint
+	router.GET("/", func(c *gin.Context) {
+		docs := map[string]interface{}{
+			"service":     "Link Preview API",
+			"version":     "1.0.0",
+			"description": "API for fetching website metadata and link previews",
+			"endpoints": map[string]interface{}{
+				"POST /preview": map[string]interface{}{
+					"description": "Fetch link preview for a given URL",
+					"body": map[string]string{
+						"url":              "The URL to fetch preview for (required)",
+						"raw_meta":         "Include every meta and link tag of the page in raw_meta (optional)",
+						"user_agent":       "User agent profile to fetch the page as, e.g. googlebot or mobile-safari (optional)",
+						"accept_language":  "Accept-Language to fetch the page with, e.g. fr-CH,fr;q=0.9 (optional)",
+						"thumbnail_width":  "Width of the thumbnail URL returned in thumbnail (optional)",
+						"thumbnail_height": "Height of the thumbnail URL returned in thumbnail (optional)",
+					},
+					"response": map[string]string{
+						"url":              "Original URL, or the page a short link leads to",
+						"short_url":        "The short link requested, when url is the page it was expanded to (if EXPAND_SHORT_URLS is enabled)",
+						"final_url":        "The page fetched after following redirects",
+						"title":            "Page title",
+						"description":      "Page description",
+						"image":            "Preview image URL",
+						"site_name":        "Site name",
+						"language":         "Content language the page declares, e.g. en-US",
+						"raw_meta":         "Every meta content by lowercased name or property, and link href as link: plus its rel (when raw_meta is requested)",
+						"sources":          "The source of each field found, e.g. og, twitter, json-ld, html or heuristic",
+						"quality_score":    "How complete the preview is, from 0 to 1",
+						"error":            "Error message (if any)",
+						"error_code":       "Machine-readable error code (if any)",
+						"retryable":        "True when the error was transient and retrying later may succeed",
+						"retry_after":      "Seconds until the host may be fetched again, with ERR_RATE_LIMITED",
+						"request_id":       "ID of the request, on errors, to match them with server logs",
+						"redirects":        "Redirects followed while fetching (if any)",
+						"image_proxy":      "Signed image proxy URL (when MEDIA_SIGNING_SECRET is set)",
+						"image_width":      "Width of the image in pixels (when declared, or probed if IMAGE_PROBE is enabled)",
+						"image_height":     "Height of the image in pixels (when declared, or probed if IMAGE_PROBE is enabled)",
+						"image_type":       "Media type of the image (when declared, or probed if IMAGE_PROBE is enabled)",
+						"image_generated":  "True when image is a fallback card drawn by this service (if FALLBACK_CARDS is enabled)",
+						"thumbnail":        "Signed image proxy URL resized to thumbnail_width x thumbnail_height (when requested and MEDIA_SIGNING_SECRET is set)",
+						"unsafe":           "True when the URL is listed as malicious (if threat checks are enabled)",
+						"threat_type":      "Threat category when unsafe",
+						"nsfw_score":       "NSFW likelihood of the image from 0 to 1 (if NSFW detection is enabled)",
+						"blurhash":         "BlurHash of the image for a placeholder (if BLURHASH is enabled)",
+						"image_data":       "The image as a base64 data URI (if INLINE_IMAGE_MAX_BYTES is set and the image is small enough)",
+						"favicon_data":     "The favicon as a base64 data URI (if INLINE_IMAGE_MAX_BYTES is set and the favicon is small enough)",
+						"archived":         "True when the page is gone and the preview was built from a Wayback Machine snapshot (if ARCHIVE_FALLBACK is enabled)",
+						"archived_at":      "When the snapshot was captured",
+						"archive_url":      "The snapshot's Wayback Machine URL",
+						"rendered":         "True when the preview was extracted from the page rendered in headless Chromium (for RENDER_DOMAINS)",
+						"consent_wall":     "True when the page is a cookie or consent wall; its own text was left out",
+						"consent_bypassed": "True when the preview is of the page behind the consent wall (if CONSENT_BYPASS is enabled)",
+					},
+				},
+				"GET /health":          "Health check endpoint",
+				"GET /healthz":         "Liveness probe",
+				"GET /readyz":          "Readiness probe (checks cache and outbound DNS)",
+				"GET /quota":           "Remaining rate limit and daily quota for the calling API key",
+				"GET /image":           "Image proxy (requires an HMAC-signed URL)",
+				"GET /debug":           "How the preview of ?url= is built: raw head, tags, candidates per field and warnings (HTML for browsers)",
+				"GET /history":         "Versions of the preview of ?url= and what changed between them, from the preview store (when STORE_DSN is set; HTML for browsers)",
+				"POST /webhooks":       "Register a webhook notified when a recrawl finds the preview of a url or domain changed (when STORE_DSN and RECRAWL_SCHEDULE are set)",
+				"GET /webhooks":        "List your webhooks",
+				"DELETE /webhooks/:id": "Remove one of your webhooks",
+				"GET /pdf":             "PDF snapshot of the page at ?url=, rendered in headless Chromium (when PDF_ENABLED)",
+				"GET /metrics":         "Prometheus metrics (when METRICS_ENABLED)",
+				"GET /stats":           "Uptime, preview outcome ratios, average latency and top domains",
+				"GET /export":          "Stream stored previews as JSON Lines or CSV, filtered by host, since and until (admin; when STORE_DSN is set)",
+				"POST /import":         "Store previews from a JSON Lines or CSV export or dataset (admin; when STORE_DSN is set)",
+				"/admin/*":             "Operational endpoints (require admin token and an allowed IP)",
+			},
+			"examples": map[string]interface{}{
+				"request": map[string]string{
+					"url": "https://github.com",
+				},
+			},
+		}
+
+		c.JSON(http.StatusOK, docs)
+	})
+
+	return router
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// settingDoc describes one setting, or a group of related settings sharing a description
+type settingDoc struct {
+	keys    []string
+	usage   string
+	boolean bool // The flag may be given without a value to mean true
+	envOnly bool // Read by a library straight from the environment, so it has no flag
+}
+
+// settingDocs lists every setting in the order shown by the startup banner and --help
+var settingDocs = []settingDoc{
+	{keys: []string{"CONFIG_FILE"}, usage: "YAML, TOML or JSON file with these settings; environment variables take precedence"},
+	{keys: []string{"CONFIG_RELOAD_INTERVAL"}, usage: "How often CONFIG_FILE is checked for changes, 0 to reload on SIGHUP only (default: 10s)"},
+	{keys: []string{"ALLOWED_ORIGINS"}, usage: "Comma-separated list of allowed origins (default: *)"},
+	{keys: []string{"PORT"}, usage: "Server port (default: 5465)"},
+	{keys: []string{"ADMIN_TOKEN"}, usage: "Token required for /admin endpoints (disabled when unset)"},
+	{keys: []string{"ADMIN_ALLOWED_IPS"}, usage: "Comma-separated IPs/CIDRs allowed to call /admin endpoints (default: any)"},
+	{keys: []string{"API_KEYS", "API_KEYS_FILE"}, usage: "API keys accepted by /preview (default: no authentication)"},
+	{keys: []string{"OIDC_ISSUER", "OIDC_AUDIENCE", "OIDC_JWKS_URL"}, usage: "Accept JWTs from this OIDC issuer on /preview"},
+	{keys: []string{"API_KEY_RATE_LIMIT", "API_KEY_RATE_BURST"}, usage: "Requests per minute and burst per API key (default: 60)"},
+	{keys: []string{"API_KEY_DAILY_QUOTA"}, usage: "Requests per API key per UTC day (default: unlimited)"},
+	{keys: []string{"IP_RATE_LIMIT", "IP_RATE_BURST"}, usage: "Requests per minute and burst per anonymous client IP (default: unlimited)"},
+	{keys: []string{"TRUSTED_PROXIES"}, usage: "Comma-separated proxy IPs/CIDRs whose X-Forwarded-For is trusted"},
+	{keys: []string{"MAX_REDIRECTS"}, usage: "Maximum redirects followed per fetch (default: 10)"},
+	{keys: []string{"BLOCK_REDIRECT_DOWNGRADE"}, boolean: true, usage: "Refuse https → http redirects (default: true)"},
+	{keys: []string{"ALLOW_CROSS_HOST_REDIRECTS"}, boolean: true, usage: "Follow redirects to other hosts (default: true)"},
+	{keys: []string{"FOLLOW_CLIENT_REDIRECTS"}, boolean: true, usage: "Follow meta refresh and script redirects of pages (default: true)"},
+	{keys: []string{"CONSENT_BYPASS"}, boolean: true, usage: "Fetch the page behind a consent wall again with forged CONSENT/SOCS consent cookies (default: false)"},
+	{keys: []string{"ROBOTS_TXT"}, boolean: true, usage: "Refuse URLs disallowed by the target's robots.txt (default: false)"},
+	{keys: []string{"ROBOTS_BOT_NAME"}, usage: "Bot name matched against robots.txt user-agent groups (default: link-preview-api)"},
+	{keys: []string{"ROBOTS_CACHE_TTL"}, usage: "How long robots.txt files are cached (default: 1h)"},
+	{keys: []string{"MEDIA_SIGNING_SECRET"}, usage: "HMAC secret for signed media URLs; media endpoints are disabled when unset"},
+	{keys: []string{"MEDIA_STORE_BUCKET"}, usage: "S3-compatible bucket keeping proxied images, cards and PDFs, served by redirect (default: none, media isn't stored)"},
+	{keys: []string{"MEDIA_STORE_ENDPOINT", "MEDIA_STORE_REGION"}, usage: "Object storage endpoint and region, e.g. storage.googleapis.com for GCS (default: s3.amazonaws.com / us-east-1)"},
+	{keys: []string{"MEDIA_STORE_ACCESS_KEY", "MEDIA_STORE_SECRET_KEY"}, usage: "Object storage credentials (default: AWS_* or MINIO_* environment variables, else the instance role)"},
+	{keys: []string{"MEDIA_STORE_INSECURE"}, usage: "Connect to the object storage endpoint over plain HTTP (default: false)"},
+	{keys: []string{"MEDIA_STORE_PREFIX"}, usage: "Prefix of stored object keys (default: link-preview/)"},
+	{keys: []string{"MEDIA_STORE_PUBLIC_URL"}, usage: "Base URL stored media is publicly served from, e.g. a CDN, instead of presigned URLs"},
+	{keys: []string{"MEDIA_STORE_URL_TTL"}, usage: "Lifetime of presigned media URLs (default: 1h)"},
+	{keys: []string{"MEDIA_STORE_PDF_MAX_AGE"}, usage: "Age after which a stored PDF is captured again, 0 to keep it (default: 1h)"},
+	{keys: []string{"EXPAND_SHORT_URLS"}, usage: "Expand links on URL shorteners such as bit.ly and t.co and preview the page they lead to (default: true)"},
+	{keys: []string{"SHORTENER_DOMAINS"}, usage: "Comma-separated shortener domains expanded besides the built-in ones"},
+	{keys: []string{"ARCHIVE_FALLBACK"}, usage: "Build previews of pages answering 404 or 410, or whose host doesn't resolve, from their latest Wayback Machine snapshot (default: false)"},
+	{keys: []string{"ARCHIVE_API_URL"}, usage: "Wayback Machine availability API (default: https://archive.org/wayback/available)"},
+	{keys: []string{"STORE_DSN"}, usage: "SQLite file or postgres:// URL of a database recording every preview (default: none, previews aren't stored)"},
+	{keys: []string{"STORE_DRIVER"}, usage: "Preview store database, sqlite or postgres (default: guessed from STORE_DSN)"},
+	{keys: []string{"STORE_MAX_AGE"}, usage: "Serve stored previews up to this old instead of fetching the page, 0 to always fetch (default: 0)"},
+	{keys: []string{"STORE_RETENTION"}, usage: "Delete stored previews fetched longer ago than this, 0 to keep them (default: 0)"},
+	{keys: []string{"STORE_MAX_ROWS"}, usage: "Stored previews kept in all, the oldest deleted first, 0 for no limit (default: 0)"},
+	{keys: []string{"STORE_MAX_ROWS_PER_HOST"}, usage: "Stored previews kept for each host, 0 for no limit (default: 0)"},
+	{keys: []string{"STORE_CLEANUP_INTERVAL"}, usage: "How often the store retention limits are enforced (default: 1h)"},
+	{keys: []string{"RECRAWL_SCHEDULE"}, usage: "Cron expression or @every interval refreshing stored previews, most requested first (default: none)"},
+	{keys: []string{"RECRAWL_BATCH"}, usage: "URLs refreshed per scheduled run at most (default: 100)"},
+	{keys: []string{"RECRAWL_MIN_AGE"}, usage: "Refresh only previews fetched longer ago than this (default: 1h)"},
+	{keys: []string{"RECRAWL_MAX_IDLE"}, usage: "Skip URLs not requested for this long (default: 168h)"},
+	{keys: []string{"RECRAWL_CONCURRENCY"}, usage: "Refreshes run at once during a scheduled run (default: 2)"},
+	{keys: []string{"TLS_CERT", "TLS_KEY"}, usage: "Serve HTTPS with this certificate and key"},
+	{keys: []string{"ACME_DOMAINS", "ACME_EMAIL", "ACME_CACHE_DIR"}, usage: "Serve HTTPS with Let's Encrypt certificates for these domains"},
+	{keys: []string{"HSTS_MAX_AGE"}, usage: "Strict-Transport-Security max-age when serving HTTPS (default: 8760h)"},
+	{keys: []string{"HTTP_REDIRECT_PORT"}, usage: "Also listen for plain HTTP here and redirect it to HTTPS"},
+	{keys: []string{"LISTEN"}, usage: "Comma-separated [all|api|admin|redirect=]address listeners, e.g. api=:5465,admin=127.0.0.1:9090 (default: PORT)"},
+	{keys: []string{"LISTEN_SOCKET_MODE"}, usage: "Permissions of unix:/path Unix socket listeners (default: 0660)"},
+	{keys: []string{"OUTBOUND_PROXY"}, usage: "Proxy for fetches (http://, https:// or socks5://; default: HTTP_PROXY/HTTPS_PROXY)"},
+	{keys: []string{"OUTBOUND_PROXY_RULES"}, usage: "Per-domain proxies, e.g. \"example.com=socks5://10.0.0.2:1080,intranet.local=direct\""},
+	{keys: []string{"METRICS_ENABLED"}, boolean: true, usage: "Expose Prometheus metrics at /metrics (default: true)"},
+	{keys: []string{"OTEL_EXPORTER_OTLP_ENDPOINT"}, envOnly: true, usage: "Export OpenTelemetry traces via OTLP/HTTP to this endpoint (default: disabled)"},
+	{keys: []string{"OTEL_SERVICE_NAME"}, usage: "Service name reported in traces (default: link-preview-api)"},
+	{keys: []string{"AUDIT_LOG"}, usage: "Write audit records to a file path, \"stdout\" or \"syslog\" (default: disabled)"},
+	{keys: []string{"ACCESS_LOG"}, usage: "Write an access log to a file path or \"stdout\" instead of request log records (default: disabled)"},
+	{keys: []string{"ACCESS_LOG_FORMAT"}, usage: "Access log format: common, combined or json (default: combined)"},
+	{keys: []string{"ACCESS_LOG_MAX_SIZE_MB", "ACCESS_LOG_MAX_BACKUPS", "ACCESS_LOG_MAX_AGE_DAYS"}, usage: "Access log rotation (default: 100 / 7 / 30)"},
+	{keys: []string{"ACCESS_LOG_COMPRESS"}, boolean: true, usage: "Gzip rotated access logs (default: false)"},
+	{keys: []string{"SAFE_BROWSING_API_KEY"}, usage: "Flag URLs listed by Google Safe Browsing as unsafe"},
+	{keys: []string{"THREAT_BLOCKLIST_FILE"}, usage: "Flag URLs or hosts listed in this file (one per line) as unsafe"},
+	{keys: []string{"THREAT_BLOCKLIST_REFRESH"}, usage: "How often THREAT_BLOCKLIST_FILE is re-read (default: 15m)"},
+	{keys: []string{"NSFW_API_URL"}, usage: "Moderation endpoint used to score preview images (adds nsfw_score)"},
+	{keys: []string{"NSFW_API_KEY"}, usage: "Bearer token sent to the moderation endpoint"},
+	{keys: []string{"SENTRY_DSN", "SENTRY_ENVIRONMENT"}, usage: "Report panics and repeated extraction failures to Sentry"},
+	{keys: []string{"ERROR_REPORT_THRESHOLD"}, usage: "Consecutive failures of a domain before it is reported, 0 to disable (default: 5)"},
+	{keys: []string{"CACHE_MAX_ENTRIES"}, usage: "Maximum number of cached previews (default: 1000)"},
+	{keys: []string{"CACHE_TTL"}, usage: "How long previews stay cached (default: 1h)"},
+	{keys: []string{"FETCH_TIMEOUT"}, usage: "Time allowed for fetching and parsing one page, including retries (default: 15s)"},
+	{keys: []string{"WORKER_COUNT"}, usage: "Maximum concurrent upstream fetches (default: 32)"},
+	{keys: []string{"HANDLER_TIMEOUT"}, usage: "Time a preview request may take before answering 408, including waiting for a worker (default: 15s)"},
+	{keys: []string{"ERROR_STATUS_CODES"}, boolean: true, usage: "Answer failed previews with a 4xx or 5xx status matching error_code instead of 200, and timeouts with 504 instead of 408 (default: false)"},
+	{keys: []string{"HTTP_CLIENT_TIMEOUT"}, usage: "Cap on each outbound request attempt (default: 10s)"},
+	{keys: []string{"MAX_BODY_BYTES"}, usage: "Bytes of each page read while looking for metadata (default: 1048576)"},
+	{keys: []string{"USER_AGENT"}, usage: "User-Agent of page fetches: googlebot, facebookexternalhit, twitterbot, slackbot, desktop-chrome, mobile-safari or a literal value (default: desktop-chrome)"},
+	{keys: []string{"USER_AGENT_ROTATION"}, usage: "Comma-separated user agent profiles taken in turn for page fetches instead of USER_AGENT (default: none)"},
+	{keys: []string{"ACCEPT_LANGUAGE"}, usage: "Accept-Language of page fetches, e.g. en-US,en;q=0.9 (default: none sent)"},
+	{keys: []string{"SOURCES_TITLE", "SOURCES_DESCRIPTION", "SOURCES_IMAGE", "SOURCES_SITE_NAME"}, usage: "Sources that may fill each field, highest priority first: og, twitter, json-ld, html, heuristic (default: all, in that order)"},
+	{keys: []string{"RENDER_DOMAINS"}, usage: "Comma-separated domains whose thin previews are re-extracted from the page rendered in headless Chromium (default: none)"},
+	{keys: []string{"RENDER_TIMEOUT"}, usage: "Time allowed for loading and running a rendered page (default: 10s)"},
+	{keys: []string{"RENDER_WAIT"}, usage: "Extra time given to a rendered page's scripts after it loads (default: 500ms)"},
+	{keys: []string{"RENDER_CHROME_PATH"}, usage: "Chromium binary used for rendering (default: looked up in PATH)"},
+	{keys: []string{"RENDER_CHROME_URL"}, usage: "DevTools URL of a running Chromium to render with instead of starting one"},
+	{keys: []string{"RENDER_BROWSERS"}, usage: "Headless Chromium instances kept warm for rendering (default: 1)"},
+	{keys: []string{"RENDER_MAX_CONCURRENCY"}, usage: "Pages rendered at once across all browsers (default: 4)"},
+	{keys: []string{"RENDER_RECYCLE_AFTER"}, usage: "Pages a browser renders before it is replaced, 0 for never (default: 100)"},
+	{keys: []string{"RENDER_BROWSER_MAX_AGE"}, usage: "Time after which a browser is replaced, 0 for never (default: 30m)"},
+	{keys: []string{"RENDER_MAX_MEMORY_MB"}, usage: "JavaScript heap limit of each rendered page in MB, 0 for Chromium's default (default: 512)"},
+	{keys: []string{"PDF_ENABLED"}, usage: "Serve GET /pdf, PDF snapshots of pages rendered in headless Chromium (default: false)"},
+	{keys: []string{"IMAGE_VALIDATION"}, usage: "Check preview images exist, are images and are under IMAGE_MAX_BYTES, replacing or dropping broken ones (default: false)"},
+	{keys: []string{"IMAGE_MAX_BYTES"}, usage: "Largest preview image accepted by IMAGE_VALIDATION (default: 10485760)"},
+	{keys: []string{"IMAGE_VALIDATION_TIMEOUT"}, usage: "Time allowed for checking the images of one preview (default: 3s)"},
+	{keys: []string{"IMAGE_RESIZE_MAX_WIDTH", "IMAGE_RESIZE_MAX_HEIGHT"}, usage: "Largest size the image proxy resizes images to (default: 1920 / 1920)"},
+	{keys: []string{"IMAGE_PROBE"}, usage: "Read the dimensions of preview images that don't declare og:image:width/height from their first bytes (default: false)"},
+	{keys: []string{"BLURHASH"}, usage: "Include a BlurHash of each preview image in responses, for instant placeholders (default: false)"},
+	{keys: []string{"INLINE_IMAGE_MAX_BYTES"}, usage: "Largest preview image or favicon embedded in responses as a base64 data URI, 0 to disable (default: 0)"},
+	{keys: []string{"FALLBACK_CARDS"}, usage: "Give previews without an image a generated card with the site's favicon, name and the page title, served from GET /card; needs MEDIA_SIGNING_SECRET (default: false)"},
+	{keys: []string{"IMAGE_FORMATS"}, usage: "Formats the image proxy converts JPEG and PNG images to when the client accepts them, preferred first: avif, webp (default: none)"},
+	{keys: []string{"FETCH_QUEUE_SIZE"}, usage: "Fetches that may wait for a worker before requests get 503 (default: 256)"},
+	{keys: []string{"MAX_INFLIGHT_REQUESTS"}, usage: "Preview/image requests processed at once, 0 for unlimited (default: 256)"},
+	{keys: []string{"ADMISSION_QUEUE_DEPTH", "ADMISSION_QUEUE_TIMEOUT"}, usage: "Requests that may wait for a slot, and for how long (default: 512 / 5s)"},
+	{keys: []string{"FETCH_RETRIES"}, usage: "Retries for connection resets, timeouts and 502/503/504 (default: 2)"},
+	{keys: []string{"FETCH_RETRY_BASE_DELAY", "FETCH_RETRY_MAX_DELAY"}, usage: "Jittered exponential backoff bounds (default: 200ms / 2s)"},
+	{keys: []string{"BREAKER_FAILURE_THRESHOLD"}, usage: "Consecutive failures before a host's circuit opens, 0 to disable (default: 5)"},
+	{keys: []string{"BREAKER_COOLDOWN"}, usage: "How long an open circuit fails fast before probing the host again (default: 30s)"},
+	{keys: []string{"RETRY_AFTER_MAX"}, usage: "Longest Retry-After of a 429 or 503 honored, 0 to ignore them (default: 1h)"},
+	{keys: []string{"ADAPTIVE_TIMEOUTS"}, boolean: true, usage: "Derive per-host fetch timeouts from observed latency (default: true)"},
+	{keys: []string{"ADAPTIVE_TIMEOUT_MIN", "ADAPTIVE_TIMEOUT_MAX"}, usage: "Bounds for adaptive timeouts (default: 2s / 10s)"},
+	{keys: []string{"HOST_MAX_CONCURRENCY"}, usage: "Simultaneous requests to any one target host, 0 for unlimited (default: 4)"},
+	{keys: []string{"HOST_REQUESTS_PER_SECOND"}, usage: "Request rate to any one target host, e.g. 0.5, 0 for unlimited (default: 5)"},
+	{keys: []string{"HTTP_MAX_IDLE_CONNS", "HTTP_MAX_IDLE_CONNS_PER_HOST"}, usage: "Outbound keep-alive pool size (default: 200 / 10)"},
+	{keys: []string{"HTTP_MAX_CONNS_PER_HOST"}, usage: "Cap on outbound connections per host, 0 for unlimited (default: 0)"},
+	{keys: []string{"HTTP_IDLE_CONN_TIMEOUT"}, usage: "How long idle outbound connections are kept (default: 90s)"},
+	{keys: []string{"HTTP_TLS_HANDSHAKE_TIMEOUT", "HTTP_RESPONSE_HEADER_TIMEOUT"}, usage: "Outbound timeouts (default: 10s / none)"},
+	{keys: []string{"HTTP2_ENABLED"}, boolean: true, usage: "Use HTTP/2 with targets that support it (default: true)"},
+	{keys: []string{"DNS_SERVERS"}, usage: "Comma-separated DNS servers to use instead of the system resolver"},
+	{keys: []string{"DNS_OVER_HTTPS_URL"}, usage: "Resolve hostnames via DNS-over-HTTPS (e.g. https://cloudflare-dns.com/dns-query)"},
+	{keys: []string{"DNS_CACHE_TTL"}, usage: "How long DNS answers are cached in process, 0 to disable (default: 1m)"},
+	{keys: []string{"READINESS_DNS_HOST"}, usage: "Hostname /readyz resolves to verify outbound DNS, empty to skip (default: example.com)"},
+	{keys: []string{"SSRF_PROTECTION"}, boolean: true, usage: "Block fetches of internal addresses (default: true)"},
+	{keys: []string{"SSRF_ALLOWLIST"}, usage: "Comma-separated hosts, IPs or CIDRs exempt from SSRF protection"},
+	{keys: []string{"ALLOWED_DOMAINS", "ALLOWED_DOMAINS_FILE"}, usage: "Only preview these domains (default: all)"},
+	{keys: []string{"BLOCKED_DOMAINS", "BLOCKED_DOMAINS_FILE"}, usage: "Never preview these domains"},
+	{keys: []string{"LOG_FORMAT"}, usage: "Log output format, json or text (default: json)"},
+	{keys: []string{"LOG_LEVEL"}, usage: "Minimum log level: debug, info, warn or error (default: info)"},
+	{keys: []string{"GIN_MODE"}, usage: "Gin mode (debug, release, test)"},
+}
+
+// flagAliases are short flag names for frequently used settings
+var flagAliases = map[string]string{
+	"config":  "CONFIG_FILE",
+	"timeout": "FETCH_TIMEOUT",
+	"cache":   "CACHE_MAX_ENTRIES",
+}
+
+// flagSettings holds the settings given on the command line, which take
+// precedence over both the environment and the config file
+var flagSettings = map[string]string{}
+
+// settingFlag stores a flag's value under its setting key
+type settingFlag struct {
+	key     string
+	boolean bool
+}
+
+func (f settingFlag) String() string { return flagSettings[f.key] }
+
+func (f settingFlag) Set(value string) error {
+	flagSettings[f.key] = value
+	return nil
+}
+
+func (f settingFlag) IsBoolFlag() bool { return f.boolean }
+
+// flagName returns the command-line flag for a setting key, e.g. CACHE_TTL becomes cache-ttl
+func flagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+// parseFlags reads settings from command-line arguments and returns the remaining
+// positional arguments. Every setting has a flag named after it (--cache-ttl=30m
+// sets CACHE_TTL). It must run before any setting is read
+func parseFlags(name string, args []string) ([]string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		if strings.HasSuffix(name, " fetch") {
+			fmt.Fprintf(out, "Usage: %s [flags] <url>...\n\n", name)
+		} else {
+			fmt.Fprintf(out, "Usage: %s [flags]\n", name)
+			fmt.Fprintf(out, "       %s fetch [flags] <url>...\n\n", name)
+		}
+		fmt.Fprintln(out, "Every flag can also be set with the environment variable named in brackets or in")
+		fmt.Fprintln(out, "the config file. Flags take precedence over the environment, which takes")
+		fmt.Fprintln(out, "precedence over the config file.")
+		fmt.Fprintln(out, "")
+		for _, doc := range settingDocs {
+			if doc.envOnly {
+				continue
+			}
+			flags := make([]string, len(doc.keys))
+			for i, key := range doc.keys {
+				flags[i] = fmt.Sprintf("--%s [%s]", flagName(key), key)
+			}
+			fmt.Fprintf(out, "  %s\n    \t%s\n", strings.Join(flags, ", "), doc.usage)
+		}
+		fmt.Fprintln(out, "")
+		fmt.Fprintln(out, "Aliases: --config (--config-file), --timeout (--fetch-timeout), --cache (--cache-max-entries)")
+	}
+
+	for _, doc := range settingDocs {
+		if doc.envOnly {
+			continue
+		}
+		for _, key := range doc.keys {
+			fs.Var(settingFlag{key: key, boolean: doc.boolean}, flagName(key), doc.usage)
+		}
+	}
+	for alias, key := range flagAliases {
+		fs.Var(settingFlag{key: key}, alias, "alias for --"+flagName(key))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return fs.Args(), nil
+}
+
+// printSettings writes the setting descriptions to stdout, as shown by the startup banner
+func printSettings() {
+	for _, doc := range settingDocs {
+		fmt.Printf("  %s: %s\n", strings.Join(doc.keys, " / "), doc.usage)
+	}
+}
+
+// LoadSettings parses the command line and the configuration file, sets up logging
+// to logOut and returns the configuration together with the positional arguments.
+// It exits the process on invalid flags or an unreadable configuration file
+func LoadSettings(name string, args []string, logOut io.Writer) (*Config, []string) {
+	args, err := parseFlags(name, args)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		// The flag package has already printed the error and usage
+		os.Exit(2)
+	}
+
+	// Settings from the config file apply wherever flags and the environment
+	// don't set them, so the file is read before anything else, logging included
+	configErr := loadConfigFile(setting("CONFIG_FILE"))
+
+	// Structured logging comes next so configuration warnings use it too
+	setupLogging(logOut)
+	if configErr != nil {
+		slog.Error("Could not load configuration file", "error", configErr)
+		os.Exit(1)
+	}
+
+	config := NewConfig()
+	if unused := unusedFileSettings(); len(unused) > 0 {
+		slog.Warn("Ignoring unknown settings in configuration file", "keys", unused)
+	}
+	return config, args
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// Bounds on expanding short URLs
+const (
+	shortenerTimeout     = 5 * time.Second
+	shortenerCacheSize   = 10000
+	shortenerCacheMaxAge = 24 * time.Hour
+)
+
+// defaultShorteners are the URL shortener domains expanded out of the box
+var defaultShorteners = []string{
+	"bit.ly", "bitly.com", "j.mp", "t.co", "tinyurl.com", "goo.gl", "ow.ly", "buff.ly",
+	"is.gd", "v.gd", "rebrand.ly", "t.ly", "cutt.ly", "shorturl.at", "tiny.cc", "rb.gy",
+	"bl.ink", "lnkd.in", "fb.me", "amzn.to", "youtu.be", "dlvr.it", "trib.al", "wp.me", "s.id",
+}
+
+// ShortenerExpander resolves links on URL shortener domains to the page they
+// point to, so previews are fetched, cached and stored under the real URL and
+// every short link to a page shares its preview
+type ShortenerExpander struct {
+	extractor *MetaExtractor
+	client    *http.Client
+	domains   []string // Normalized domain patterns, see DomainPolicy
+
+	mu       sync.Mutex
+	expanded map[string]shortLink // By short URL
+}
+
+// shortLink is a short URL's resolved target
+type shortLink struct {
+	target   string
+	resolved time.Time
+}
+
+// NewShortenerExpander creates an expander for the defaultShorteners and
+// SHORTENER_DOMAINS, or returns nil unless EXPAND_SHORT_URLS is set. Every
+// hop goes through the domain policy and SSRF guard of extractor
+func NewShortenerExpander(extractor *MetaExtractor, config *Config) *ShortenerExpander {
+	if !config.ExpandShortURLs {
+		return nil
+	}
+	return &ShortenerExpander{
+		extractor: extractor,
+		client: &http.Client{
+			Timeout:   shortenerTimeout,
+			Transport: extractor.client.Transport,
+			// Redirects are followed one at a time, stopping at the first page off a shortener
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		domains:  normalizePatterns(append(append([]string{}, defaultShorteners...), config.ShortenerDomains...)),
+		expanded: make(map[string]shortLink),
+	}
+}
+
+// isShortener reports whether host is a URL shortener
+func (se *ShortenerExpander) isShortener(host string) bool {
+	for _, pattern := range se.domains {
+		if matchDomain(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand returns the URL rawURL, a short link, redirects to, following
+// further shorteners it leads to, or "" when rawURL isn't a short link.
+// Redirects between shorteners are allowed even when cross-host redirects
+// aren't; the redirect limit and downgrade check still apply
+func (se *ShortenerExpander) Expand(ctx context.Context, rawURL string) (string, error) {
+	if se == nil {
+		return "", nil
+	}
+	current, err := url.Parse(normalizeURL(rawURL))
+	if err != nil || !se.isShortener(current.Hostname()) {
+		return "", nil
+	}
+	short := current.String()
+	se.mu.Lock()
+	link, ok := se.expanded[short]
+	se.mu.Unlock()
+	if ok && time.Since(link.resolved) < shortenerCacheMaxAge {
+		return link.target, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "shortener.expand")
+	defer span.End()
+
+	redirects := se.extractor.redirects
+	tenant := TenantFrom(ctx)
+	for hops := 0; ; hops++ {
+		if err := tenant.CheckDomain(current.Hostname()); err != nil {
+			return "", err
+		}
+		if err := se.extractor.checkTarget(ctx, current); err != nil {
+			return "", err
+		}
+		next, err := se.follow(ctx, current)
+		if err != nil {
+			return "", err
+		}
+		if next == nil {
+			break
+		}
+		if hops >= redirects.MaxRedirects {
+			return "", &RedirectError{From: current.String(), To: next.String(), Reason: fmt.Sprintf("stopped after %d redirects", redirects.MaxRedirects)}
+		}
+		if redirects.BlockDowngrade && current.Scheme == "https" && next.Scheme == "http" {
+			return "", &RedirectError{From: current.String(), To: next.String(), Reason: "https to http downgrade"}
+		}
+		current = next
+		if !se.isShortener(current.Hostname()) {
+			if err := se.extractor.checkTarget(ctx, current); err != nil {
+				return "", err
+			}
+			break
+		}
+	}
+
+	target := normalizeURL(current.String())
+	if target == short {
+		// Not a short link after all, e.g. the shortener's home page
+		target = ""
+	}
+	se.mu.Lock()
+	if len(se.expanded) >= shortenerCacheSize {
+		clear(se.expanded)
+	}
+	se.expanded[short] = shortLink{target: target, resolved: time.Now()}
+	se.mu.Unlock()
+	return target, nil
+}
+
+// follow requests target and returns where it redirects, or nil when it
+// doesn't. HEAD is tried first; shorteners refusing it are asked with GET
+func (se *ShortenerExpander) follow(ctx context.Context, target *url.URL) (*url.URL, error) {
+	var resp *http.Response
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", linkpreview.DefaultUserAgent)
+		resp, err = se.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented && resp.StatusCode != http.StatusForbidden {
+			break
+		}
+	}
+	location := resp.Header.Get("Location")
+	if resp.StatusCode < 300 || resp.StatusCode > 399 || location == "" {
+		return nil, nil
+	}
+	next, err := target.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect location %q: %w", location, err)
+	}
+	if next.Scheme != "http" && next.Scheme != "https" {
+		return nil, fmt.Errorf("redirect to unsupported scheme %q", next.Scheme)
+	}
+	return next, nil
+}
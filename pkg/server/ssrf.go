@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// ErrCodeSSRFBlocked is reported in error_code when a URL resolves to an internal address
+const ErrCodeSSRFBlocked = string(linkpreview.ErrCodeSSRFBlocked)
+
+// SSRFGuard rejects target hosts that resolve to internal network addresses
+// so the service cannot be used to reach cloud metadata endpoints or private services
+type SSRFGuard struct {
+	enabled    bool
+	allowHosts map[string]bool // Hostnames that bypass the check
+	allowNets  []*net.IPNet    // Address ranges that bypass the check
+	resolver   *DNSResolver
+}
+
+// NewSSRFGuard creates a guard from the configured allowlist
+// Allowlist entries may be hostnames ("intranet.example.com"), IPs or CIDR ranges ("10.1.0.0/16").
+// Hostnames are resolved with resolver both for checks and when dialing
+func NewSSRFGuard(enabled bool, allowlist []string, resolver *DNSResolver) *SSRFGuard {
+	guard := &SSRFGuard{
+		enabled:    enabled,
+		allowHosts: make(map[string]bool),
+		resolver:   resolver,
+	}
+
+	for _, entry := range allowlist {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			guard.allowNets = append(guard.allowNets, ipNet)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			guard.allowNets = append(guard.allowNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		guard.allowHosts[entry] = true
+	}
+
+	return guard
+}
+
+// CheckHost resolves host and returns an error if any of its addresses is internal
+func (g *SSRFGuard) CheckHost(ctx context.Context, host string) error {
+	if !g.enabled {
+		return nil
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if g.allowHosts[host] {
+		return nil
+	}
+
+	// Literal IPs don't need resolving
+	if ip := net.ParseIP(host); ip != nil {
+		return g.CheckIP(ip)
+	}
+
+	addrs, err := g.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return linkpreview.NewError(linkpreview.ErrCodeDNS, fmt.Errorf("failed to resolve host %q: %v", host, err))
+	}
+	for _, addr := range addrs {
+		if err := g.CheckIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckIP returns an error if ip is an internal address that isn't allowlisted
+func (g *SSRFGuard) CheckIP(ip net.IP) error {
+	if !g.enabled {
+		return nil
+	}
+	for _, ipNet := range g.allowNets {
+		if ipNet.Contains(ip) {
+			return nil
+		}
+	}
+	if isInternalIP(ip) {
+		return linkpreview.NewError(linkpreview.ErrCodeSSRFBlocked, fmt.Errorf("destination address %s is not allowed", ip))
+	}
+	return nil
+}
+
+// DialContext dials addr while validating the IP actually being connected to
+// Checking at connect time closes the DNS-rebinding window where a hostname
+// passes CheckHost and then re-resolves to an internal address before dialing.
+// Hostnames are resolved through the guard's (caching) resolver and each
+// address is tried in turn until one connects
+func (g *SSRFGuard) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if g.enabled && !g.allowHosts[strings.ToLower(strings.TrimSuffix(host, "."))] {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			ipStr, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(ipStr)
+			if ip == nil {
+				return fmt.Errorf("unexpected dial address %q", address)
+			}
+			return g.CheckIP(ip)
+		}
+	}
+
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := g.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, linkpreview.NewError(linkpreview.ErrCodeDNS, err)
+	}
+	var firstErr error
+	for _, ipAddr := range addrs {
+		if (network == "tcp4" && ipAddr.IP.To4() == nil) || (network == "tcp6" && ipAddr.IP.To4() != nil) {
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ipAddr.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("no usable addresses for host %q", host)
+	}
+	return nil, firstErr
+}
+
+// internalNets are special-purpose ranges the net.IP helpers don't cover:
+// carrier-grade NAT, IETF protocol assignments, benchmarking and NAT64.
+// IPv4-mapped IPv6 addresses match the IPv4 ranges too, since
+// net.IPNet.Contains compares them in their 4-byte form
+var internalNets = parseCIDRs(
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"64:ff9b::/96",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isInternalIP reports whether ip is loopback, private (RFC1918 / ULA),
+// link-local, unspecified or in one of internalNets
+func isInternalIP(ip net.IP) bool {
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range internalNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
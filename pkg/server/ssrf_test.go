@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsInternalIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"100.64.0.1", true},
+		{"100.127.255.254", true},
+		{"192.0.0.8", true},
+		{"198.18.0.1", true},
+		{"198.19.255.255", true},
+		{"::1", true},
+		{"::", true},
+		{"fc00::1", true},
+		{"fe80::1", true},
+		{"64:ff9b::a9fe:a9fe", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"::ffff:100.64.0.1", true},
+		{"::ffff:198.18.0.1", true},
+
+		{"8.8.8.8", false},
+		{"100.63.255.255", false},
+		{"100.128.0.0", false},
+		{"192.0.1.1", false},
+		{"198.17.255.255", false},
+		{"198.20.0.0", false},
+		{"2606:4700:4700::1111", false},
+		{"64:ff9b:1::1", false},
+		{"::ffff:8.8.8.8", false},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		if ip == nil {
+			t.Fatalf("bad test IP %q", tt.ip)
+		}
+		if got := isInternalIP(ip); got != tt.want {
+			t.Errorf("isInternalIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxRecentErrors is how many failed requests ServiceStats remembers
+const maxRecentErrors = 50
+
+// ServiceStats accumulates preview counters since startup for the /stats endpoint
+type ServiceStats struct {
+	mu      sync.Mutex
+	started time.Time
+
+	total        int64
+	outcomes     map[string]int64 // Requests by audit outcome: success, error, timeout, rejected
+	cacheHits    int64
+	latencyTotal time.Duration
+	domains      map[string]int64 // Requests by target domain, bounded by domainLabel
+	recent       []RecentError    // Last maxRecentErrors failures, oldest first
+}
+
+// RecentError is a preview request that didn't succeed
+type RecentError struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	URL       string    `json:"url"`
+	Outcome   string    `json:"outcome"` // error, timeout or rejected
+	Error     string    `json:"error,omitempty"`
+	ErrorCode string    `json:"error_code,omitempty"`
+}
+
+// StatsSnapshot is the JSON body of GET /stats
+type StatsSnapshot struct {
+	UptimeSeconds    float64          `json:"uptime_seconds"`
+	Started          time.Time        `json:"started"`
+	PreviewsServed   int64            `json:"previews_served"`
+	Outcomes         map[string]int64 `json:"outcomes"`
+	SuccessRatio     float64          `json:"success_ratio"`
+	ErrorRatio       float64          `json:"error_ratio"`
+	CacheHitRatio    float64          `json:"cache_hit_ratio"`
+	AverageLatencyMS float64          `json:"average_latency_ms"`
+	TopDomains       []DomainCount    `json:"top_domains"`
+}
+
+// DomainCount is the number of previews requested for one domain
+type DomainCount struct {
+	Domain   string `json:"domain"`
+	Requests int64  `json:"requests"`
+}
+
+// NewServiceStats creates an empty stats collector starting now
+func NewServiceStats() *ServiceStats {
+	return &ServiceStats{
+		started:  time.Now(),
+		outcomes: make(map[string]int64),
+		domains:  make(map[string]int64),
+	}
+}
+
+// Record counts one preview request
+func (ss *ServiceStats) Record(domain, outcome string, cached bool, elapsed time.Duration) {
+	if ss == nil {
+		return
+	}
+	if domain != "" {
+		domain = domainLabel(domain)
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.total++
+	ss.outcomes[outcome]++
+	if cached {
+		ss.cacheHits++
+	}
+	ss.latencyTotal += elapsed
+	if domain != "" {
+		ss.domains[domain]++
+	}
+}
+
+// RecordError remembers a failed request, forgetting the oldest beyond maxRecentErrors
+func (ss *ServiceStats) RecordError(failure RecentError) {
+	if ss == nil {
+		return
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if len(ss.recent) == maxRecentErrors {
+		ss.recent = append(ss.recent[:0], ss.recent[1:]...)
+	}
+	ss.recent = append(ss.recent, failure)
+}
+
+// RecentErrors returns the last failed requests, newest first
+func (ss *ServiceStats) RecentErrors() []RecentError {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	errors := make([]RecentError, len(ss.recent))
+	for i, failure := range ss.recent {
+		errors[len(ss.recent)-1-i] = failure
+	}
+	return errors
+}
+
+// Snapshot returns the current counters with the topN most requested domains
+func (ss *ServiceStats) Snapshot(topN int) StatsSnapshot {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	snapshot := StatsSnapshot{
+		UptimeSeconds:  time.Since(ss.started).Seconds(),
+		Started:        ss.started.UTC(),
+		PreviewsServed: ss.total,
+		Outcomes:       make(map[string]int64, len(ss.outcomes)),
+		TopDomains:     make([]DomainCount, 0, len(ss.domains)),
+	}
+	for outcome, n := range ss.outcomes {
+		snapshot.Outcomes[outcome] = n
+	}
+	if ss.total > 0 {
+		snapshot.SuccessRatio = float64(ss.outcomes["success"]) / float64(ss.total)
+		snapshot.ErrorRatio = 1 - snapshot.SuccessRatio
+		snapshot.CacheHitRatio = float64(ss.cacheHits) / float64(ss.total)
+		snapshot.AverageLatencyMS = float64(ss.latencyTotal.Microseconds()) / 1000 / float64(ss.total)
+	}
+
+	for domain, n := range ss.domains {
+		snapshot.TopDomains = append(snapshot.TopDomains, DomainCount{Domain: domain, Requests: n})
+	}
+	sort.Slice(snapshot.TopDomains, func(i, j int) bool {
+		a, b := snapshot.TopDomains[i], snapshot.TopDomains[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Domain < b.Domain
+	})
+	if len(snapshot.TopDomains) > topN {
+		snapshot.TopDomains = snapshot.TopDomains[:topN]
+	}
+	return snapshot
+}
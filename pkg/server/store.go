@@ -0,0 +1,947 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bounds on recording previews in the background
+const (
+	storeQueueSize    = 1024
+	storeWriteTimeout = 5 * time.Second
+	// How often request counts are written to the store
+	requestFlushInterval = 10 * time.Second
+	// Previews deleted per statement when pruning
+	pruneBatchSize = 1000
+)
+
+// PreviewStore is a database of every preview fetched, kept for history
+// queries, analytics and re-serving previews without fetching them again
+type PreviewStore interface {
+	// Save records fetched previews, all or none of them
+	Save(ctx context.Context, previews []StoredPreview) error
+	// Latest returns the most recent successful preview of a normalized URL,
+	// or nil when none is stored
+	Latest(ctx context.Context, key string) (*StoredPreview, error)
+	// History returns up to limit successful previews of a normalized URL,
+	// most recent first
+	History(ctx context.Context, key string, limit int) ([]StoredPreview, error)
+	// CountRequests adds counts, by normalized URL, to the requests of each
+	// URL, last requested at
+	CountRequests(ctx context.Context, counts map[string]int64, at time.Time) error
+	// DueForRefresh returns up to limit URLs last fetched before fetchedBefore
+	// and requested since requestedSince, most requested first
+	DueForRefresh(ctx context.Context, fetchedBefore, requestedSince time.Time, limit int) ([]string, error)
+	// AddWebhook registers a webhook, setting its ID and creation time
+	AddWebhook(ctx context.Context, webhook *Webhook) error
+	// ListWebhooks returns the webhooks registered by owner
+	ListWebhooks(ctx context.Context, owner string) ([]Webhook, error)
+	// DeleteWebhook removes a webhook of owner, reporting whether it existed
+	DeleteWebhook(ctx context.Context, owner string, id int64) (bool, error)
+	// MatchWebhooks returns the webhooks watching a normalized URL, either
+	// the URL itself or its domain
+	MatchWebhooks(ctx context.Context, key string) ([]Webhook, error)
+	// Export calls fn with each stored preview matching filter, oldest first,
+	// stopping at the first error
+	Export(ctx context.Context, filter PreviewFilter, fn func(*StoredPreview) error) error
+	// Prune deletes the previews and URLs policy doesn't keep as of now,
+	// returning how many previews were deleted
+	Prune(ctx context.Context, policy RetentionPolicy, now time.Time) (int64, error)
+	// ListTenants returns the tenants managed through the admin API
+	ListTenants(ctx context.Context) ([]*Tenant, error)
+	// SaveTenant creates a tenant or replaces its settings
+	SaveTenant(ctx context.Context, tenant *Tenant) error
+	// DeleteTenant removes a tenant, its keys expiring at at, reporting
+	// whether it existed
+	DeleteTenant(ctx context.Context, name string, at time.Time) (bool, error)
+	// ListAPIKeys returns the API keys issued through the admin API, oldest
+	// first, expired ones included
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	// AddAPIKey records an issued key, setting its ID
+	AddAPIKey(ctx context.Context, key *APIKey) error
+	// RotateAPIKey records replacement as the successor of key id, for the
+	// same tenant, and makes key id expire at at. It reports whether key id
+	// exists and hasn't expired
+	RotateAPIKey(ctx context.Context, id int64, replacement *APIKey, at time.Time) (bool, error)
+	// ExpireAPIKey makes a key stop working at at unless it expires sooner,
+	// reporting whether it exists
+	ExpireAPIKey(ctx context.Context, id int64, at time.Time) (bool, error)
+	// AddUsage adds the counts of records to the usage of their key and hour
+	AddUsage(ctx context.Context, records []UsageRecord) error
+	// Usage returns the usage recorded in the hours from since until until
+	Usage(ctx context.Context, since, until time.Time) ([]UsageRecord, error)
+	// Ping checks the database can be reached
+	Ping(ctx context.Context) error
+	// Close releases the database connections
+	Close() error
+}
+
+// StoredPreview is a preview as recorded in a PreviewStore
+type StoredPreview struct {
+	ID        int64               `json:"id"`
+	URL       string              `json:"url"` // Normalized URL the preview was requested for
+	FetchedAt time.Time           `json:"fetched_at"`
+	Preview   LinkPreviewResponse `json:"preview"`
+}
+
+// PreviewFilter selects stored previews; zero fields match every preview
+type PreviewFilter struct {
+	Host           string    // Previews of pages on this host
+	Since          time.Time // Fetched at or after
+	Until          time.Time // Fetched before
+	SuccessfulOnly bool      // Leave out failed fetches
+}
+
+// NewPreviewStore opens the database at STORE_DSN and brings its schema up to
+// date, or returns nil when no database is configured. STORE_DRIVER picks
+// "sqlite" or "postgres"; by default postgres:// DSNs use Postgres and
+// anything else is a SQLite file
+func NewPreviewStore(config *Config) (PreviewStore, error) {
+	if config.StoreDSN == "" {
+		return nil, nil
+	}
+	driver := strings.ToLower(config.StoreDriver)
+	if driver == "" {
+		driver = "sqlite"
+		if strings.HasPrefix(config.StoreDSN, "postgres://") || strings.HasPrefix(config.StoreDSN, "postgresql://") {
+			driver = "postgres"
+		}
+	}
+	var d *sqlDialect
+	switch driver {
+	case "sqlite", "sqlite3":
+		if sqliteDriver == "" {
+			return nil, errors.New("this build has no SQLite support; build with CGO_ENABLED=1 or use Postgres")
+		}
+		d = sqliteDialect
+	case "postgres", "postgresql":
+		d = postgresDialect
+	default:
+		return nil, fmt.Errorf("unknown STORE_DRIVER %q; use sqlite or postgres", config.StoreDriver)
+	}
+
+	dsn := config.StoreDSN
+	if d.options != "" {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + d.options
+	}
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	store := &sqlStore{db: db, dialect: d}
+	if err := store.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating preview store: %w", err)
+	}
+	return store, nil
+}
+
+// sqlDialect is what differs between the SQL databases a store can use
+type sqlDialect struct {
+	driver string
+	// Fills the {id} and {time} column types in migrations
+	types *strings.Replacer
+	// Serializes migrations of concurrently starting servers, if supported
+	lock string
+	// Numbered placeholders ($1, $2...) instead of ?
+	numbered bool
+	// Connection options appended to the DSN
+	options string
+}
+
+var sqliteDialect = &sqlDialect{
+	driver: sqliteDriver,
+	types:  strings.NewReplacer("{id}", "INTEGER PRIMARY KEY AUTOINCREMENT", "{time}", "TIMESTAMP"),
+	// WAL lets reads, such as a long export, run alongside writes. SQLite
+	// allows one writer at a time: transactions take the write lock up front
+	// and wait for it rather than failing with SQLITE_BUSY
+	options: "_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate",
+}
+
+var postgresDialect = &sqlDialect{
+	driver:   postgresDriver,
+	types:    strings.NewReplacer("{id}", "BIGSERIAL PRIMARY KEY", "{time}", "TIMESTAMPTZ"),
+	lock:     "SELECT pg_advisory_xact_lock(7465)",
+	numbered: true,
+}
+
+// storeMigrations are applied in order, each once; version n is storeMigrations[n-1].
+// Append new migrations and never edit applied ones
+var storeMigrations = []string{
+	// 1: Every fetched preview, searchable by URL, host and time
+	`CREATE TABLE previews (
+		id {id},
+		url TEXT NOT NULL,
+		host TEXT NOT NULL,
+		fetched_at {time} NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		image TEXT NOT NULL DEFAULT '',
+		site_name TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		error_code TEXT NOT NULL DEFAULT '',
+		data TEXT NOT NULL
+	);
+	CREATE INDEX previews_url ON previews (url, fetched_at);
+	CREATE INDEX previews_host ON previews (host, fetched_at);
+	CREATE INDEX previews_fetched_at ON previews (fetched_at);`,
+
+	// 2: How often and when each URL was requested and last fetched
+	`CREATE TABLE urls (
+		url TEXT PRIMARY KEY,
+		host TEXT NOT NULL,
+		requests BIGINT NOT NULL DEFAULT 0,
+		last_requested {time},
+		last_fetched {time}
+	);
+	CREATE INDEX urls_last_fetched ON urls (last_fetched);
+	INSERT INTO urls (url, host, last_fetched) SELECT url, MIN(host), MAX(fetched_at) FROM previews GROUP BY url;`,
+
+	// 3: Webhooks notified when the preview of a URL or domain changes
+	`CREATE TABLE webhooks (
+		id {id},
+		owner TEXT NOT NULL DEFAULT '',
+		url TEXT NOT NULL DEFAULT '',
+		domain TEXT NOT NULL DEFAULT '',
+		callback_url TEXT NOT NULL,
+		secret TEXT NOT NULL DEFAULT '',
+		created_at {time} NOT NULL
+	);
+	CREATE INDEX webhooks_owner ON webhooks (owner);
+	CREATE INDEX webhooks_url ON webhooks (url);
+	CREATE INDEX webhooks_domain ON webhooks (domain);`,
+
+	// 4: Tenants and API keys managed through the admin API; keys are stored as SHA-256 digests
+	`CREATE TABLE tenants (
+		name TEXT PRIMARY KEY,
+		settings TEXT NOT NULL,
+		updated_at {time} NOT NULL
+	);
+	CREATE TABLE api_keys (
+		id {id},
+		key_hash TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		tenant TEXT NOT NULL DEFAULT '',
+		label TEXT NOT NULL DEFAULT '',
+		created_at {time} NOT NULL,
+		expires_at {time}
+	);
+	CREATE INDEX api_keys_tenant ON api_keys (tenant);`,
+
+	// 5: Preview requests per API key and hour, for usage reports
+	`CREATE TABLE key_usage (
+		hour {time} NOT NULL,
+		api_key TEXT NOT NULL,
+		tenant TEXT NOT NULL DEFAULT '',
+		requests BIGINT NOT NULL DEFAULT 0,
+		cache_hits BIGINT NOT NULL DEFAULT 0,
+		errors BIGINT NOT NULL DEFAULT 0,
+		bytes_fetched BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (hour, api_key, tenant)
+	);`,
+}
+
+// sqlStore is a PreviewStore in SQLite or Postgres
+type sqlStore struct {
+	db      *sql.DB
+	dialect *sqlDialect
+}
+
+// rebind rewrites the ? placeholders of query for the dialect
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// migrate applies the migrations the database hasn't seen yet, in one transaction
+func (s *sqlStore) migrate(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if s.dialect.lock != "" {
+		if _, err := tx.ExecContext(ctx, s.dialect.lock); err != nil {
+			return err
+		}
+	}
+	create := s.dialect.types.Replace(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at {time} NOT NULL)`)
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return err
+	}
+	var current int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+	if current > len(storeMigrations) {
+		return fmt.Errorf("database schema version %d is newer than this server's %d", current, len(storeMigrations))
+	}
+	for i := current; i < len(storeMigrations); i++ {
+		version := i + 1
+		if _, err := tx.ExecContext(ctx, s.dialect.types.Replace(storeMigrations[i])); err != nil {
+			return fmt.Errorf("version %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)"), version, time.Now().UTC()); err != nil {
+			return err
+		}
+		slog.Info("Applied preview store migration", "version", version)
+	}
+	return tx.Commit()
+}
+
+// Save records fetched previews in one transaction
+func (s *sqlStore) Save(ctx context.Context, previews []StoredPreview) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert := s.rebind(`INSERT INTO previews
+		(url, host, fetched_at, title, description, image, site_name, error, error_code, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	// Previews may be saved out of order, e.g. when imported
+	touch := s.rebind(`INSERT INTO urls (url, host, last_fetched) VALUES (?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET last_fetched = excluded.last_fetched
+		WHERE urls.last_fetched IS NULL OR urls.last_fetched < excluded.last_fetched`)
+	for _, preview := range previews {
+		data, err := json.Marshal(preview.Preview)
+		if err != nil {
+			return err
+		}
+		p, host, fetchedAt := preview.Preview, urlHost(preview.URL), preview.FetchedAt.UTC()
+		_, err = tx.ExecContext(ctx, insert,
+			preview.URL, host, fetchedAt, p.Title, p.Description, p.Image, p.SiteName, p.Error, p.ErrorCode, string(data))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, touch, preview.URL, host, fetchedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CountRequests adds counts to the requests of each URL, last requested at
+func (s *sqlStore) CountRequests(ctx context.Context, counts map[string]int64, at time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := s.rebind(`INSERT INTO urls (url, host, requests, last_requested) VALUES (?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET requests = urls.requests + excluded.requests, last_requested = excluded.last_requested`)
+	for key, n := range counts {
+		if _, err := tx.ExecContext(ctx, query, key, urlHost(key), n, at.UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DueForRefresh returns up to limit URLs last fetched before fetchedBefore and
+// requested since requestedSince, most requested first
+func (s *sqlStore) DueForRefresh(ctx context.Context, fetchedBefore, requestedSince time.Time, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT url FROM urls
+		WHERE last_fetched < ? AND last_requested >= ?
+		ORDER BY requests DESC, last_requested DESC LIMIT ?`), fetchedBefore.UTC(), requestedSince.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var urls []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, rows.Err()
+}
+
+// webhookColumns are the columns of a Webhook, as scanned by queryWebhooks
+const webhookColumns = "id, owner, url, domain, callback_url, secret, created_at"
+
+// AddWebhook registers a webhook, setting its ID and creation time
+func (s *sqlStore) AddWebhook(ctx context.Context, webhook *Webhook) error {
+	webhook.CreatedAt = time.Now().UTC()
+	return s.db.QueryRowContext(ctx, s.rebind(`INSERT INTO webhooks
+		(owner, url, domain, callback_url, secret, created_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING id`),
+		webhook.Owner, webhook.URL, webhook.Domain, webhook.CallbackURL, webhook.Secret, webhook.CreatedAt).Scan(&webhook.ID)
+}
+
+// ListWebhooks returns the webhooks registered by owner, oldest first
+func (s *sqlStore) ListWebhooks(ctx context.Context, owner string) ([]Webhook, error) {
+	return s.queryWebhooks(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE owner = ? ORDER BY id", owner)
+}
+
+// DeleteWebhook removes a webhook of owner, reporting whether it existed
+func (s *sqlStore) DeleteWebhook(ctx context.Context, owner string, id int64) (bool, error) {
+	res, err := s.db.ExecContext(ctx, s.rebind("DELETE FROM webhooks WHERE owner = ? AND id = ?"), owner, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// MatchWebhooks returns the webhooks watching key or a domain it belongs to
+func (s *sqlStore) MatchWebhooks(ctx context.Context, key string) ([]Webhook, error) {
+	// The host and each parent domain: a.example.com, example.com, com
+	args := []any{key}
+	for host := urlHost(key); host != ""; {
+		args = append(args, host)
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			break
+		}
+		host = parent
+	}
+	query := "SELECT " + webhookColumns + " FROM webhooks WHERE url = ? OR domain IN (?" + strings.Repeat(", ?", len(args)-2) + ")"
+	if len(args) == 1 {
+		query = "SELECT " + webhookColumns + " FROM webhooks WHERE url = ?"
+	}
+	return s.queryWebhooks(ctx, query, args...)
+}
+
+// queryWebhooks runs a query selecting webhookColumns
+func (s *sqlStore) queryWebhooks(ctx context.Context, query string, args ...any) ([]Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.Owner, &w.URL, &w.Domain, &w.CallbackURL, &w.Secret, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// ListTenants returns the stored tenants, by name
+func (s *sqlStore) ListTenants(ctx context.Context) ([]*Tenant, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, settings FROM tenants ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tenants := []*Tenant{}
+	for rows.Next() {
+		var name, settings string
+		if err := rows.Scan(&name, &settings); err != nil {
+			return nil, err
+		}
+		tenant := &Tenant{}
+		if err := json.Unmarshal([]byte(settings), tenant); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", name, err)
+		}
+		tenant.Name = name
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
+
+// SaveTenant creates a tenant or replaces its settings
+func (s *sqlStore) SaveTenant(ctx context.Context, tenant *Tenant) error {
+	settings, err := json.Marshal(tenant)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, s.rebind(`INSERT INTO tenants (name, settings, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET settings = excluded.settings, updated_at = excluded.updated_at`),
+		tenant.Name, string(settings), time.Now().UTC())
+	return err
+}
+
+// DeleteTenant removes a tenant and makes its keys expire at at
+func (s *sqlStore) DeleteTenant(ctx context.Context, name string, at time.Time) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, s.rebind("DELETE FROM tenants WHERE name = ?"), name)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, s.rebind("UPDATE api_keys SET expires_at = ? WHERE tenant = ? AND (expires_at IS NULL OR expires_at > ?)"),
+		at.UTC(), name, at.UTC())
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// apiKeyColumns are the columns of an APIKey, as scanned by ListAPIKeys
+const apiKeyColumns = "id, key_hash, prefix, tenant, label, created_at, expires_at"
+
+// ListAPIKeys returns the stored API keys, oldest first
+func (s *sqlStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Hash, &k.Prefix, &k.Tenant, &k.Label, &k.CreatedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			k.ExpiresAt = &expiresAt.Time
+		}
+		if len(k.Hash) >= 12 {
+			k.Fingerprint = k.Hash[:12]
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// AddAPIKey records an issued key, setting its ID
+func (s *sqlStore) AddAPIKey(ctx context.Context, key *APIKey) error {
+	return s.insertAPIKey(ctx, s.db, key)
+}
+
+// insertAPIKey inserts key with db, which may be a transaction
+func (s *sqlStore) insertAPIKey(ctx context.Context, db interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, key *APIKey) error {
+	var expiresAt any
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.UTC()
+	}
+	return db.QueryRowContext(ctx, s.rebind(`INSERT INTO api_keys
+		(key_hash, prefix, tenant, label, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING id`),
+		key.Hash, key.Prefix, key.Tenant, key.Label, key.CreatedAt.UTC(), expiresAt).Scan(&key.ID)
+}
+
+// RotateAPIKey records replacement for the tenant and label of key id and
+// makes key id expire at at, in one transaction
+func (s *sqlStore) RotateAPIKey(ctx context.Context, id int64, replacement *APIKey, at time.Time) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, s.rebind("SELECT tenant, label FROM api_keys WHERE id = ? AND (expires_at IS NULL OR expires_at > ?)"),
+		id, time.Now().UTC()).Scan(&replacement.Tenant, &replacement.Label)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := s.insertAPIKey(ctx, tx, replacement); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind("UPDATE api_keys SET expires_at = ? WHERE id = ?"), at.UTC(), id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ExpireAPIKey makes a key stop working at at unless it expires sooner
+func (s *sqlStore) ExpireAPIKey(ctx context.Context, id int64, at time.Time) (bool, error) {
+	var exists int
+	err := s.db.QueryRowContext(ctx, s.rebind("SELECT 1 FROM api_keys WHERE id = ?"), id).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = s.db.ExecContext(ctx, s.rebind("UPDATE api_keys SET expires_at = ? WHERE id = ? AND (expires_at IS NULL OR expires_at > ?)"),
+		at.UTC(), id, at.UTC())
+	return true, err
+}
+
+// AddUsage adds records to the usage of their key and hour, in one transaction
+func (s *sqlStore) AddUsage(ctx context.Context, records []UsageRecord) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := s.rebind(`INSERT INTO key_usage (hour, api_key, tenant, requests, cache_hits, errors, bytes_fetched)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (hour, api_key, tenant) DO UPDATE SET
+			requests = key_usage.requests + excluded.requests,
+			cache_hits = key_usage.cache_hits + excluded.cache_hits,
+			errors = key_usage.errors + excluded.errors,
+			bytes_fetched = key_usage.bytes_fetched + excluded.bytes_fetched`)
+	for _, r := range records {
+		if _, err := tx.ExecContext(ctx, query, r.Hour.UTC(), r.Key, r.Tenant, r.Requests, r.CacheHits, r.Errors, r.BytesFetched); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Usage returns the usage recorded in the hours from since until until
+func (s *sqlStore) Usage(ctx context.Context, since, until time.Time) ([]UsageRecord, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT hour, api_key, tenant, requests, cache_hits, errors, bytes_fetched
+		FROM key_usage WHERE hour >= ? AND hour < ?`), since.Truncate(time.Hour).UTC(), until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []UsageRecord
+	for rows.Next() {
+		var r UsageRecord
+		if err := rows.Scan(&r.Hour, &r.Key, &r.Tenant, &r.Requests, &r.CacheHits, &r.Errors, &r.BytesFetched); err != nil {
+			return nil, err
+		}
+		r.Hour = r.Hour.UTC()
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// urlHost returns the host name of rawURL, or "" if it can't be parsed
+func urlHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// Latest returns the most recent successful preview of key, or nil
+func (s *sqlStore) Latest(ctx context.Context, key string) (*StoredPreview, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT id, url, fetched_at, data FROM previews
+		WHERE url = ? AND error = '' ORDER BY fetched_at DESC, id DESC LIMIT 1`), key)
+	preview, err := scanStoredPreview(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return preview, err
+}
+
+// History returns up to limit successful previews of key, most recent first
+func (s *sqlStore) History(ctx context.Context, key string, limit int) ([]StoredPreview, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT id, url, fetched_at, data FROM previews
+		WHERE url = ? AND error = '' ORDER BY fetched_at DESC, id DESC LIMIT ?`), key, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var previews []StoredPreview
+	for rows.Next() {
+		preview, err := scanStoredPreview(rows)
+		if err != nil {
+			return nil, err
+		}
+		previews = append(previews, *preview)
+	}
+	return previews, rows.Err()
+}
+
+// Export calls fn with each stored preview matching filter, oldest first
+func (s *sqlStore) Export(ctx context.Context, filter PreviewFilter, fn func(*StoredPreview) error) error {
+	query := "SELECT id, url, fetched_at, data FROM previews WHERE 1 = 1"
+	var args []any
+	if filter.Host != "" {
+		query += " AND host = ?"
+		args = append(args, strings.ToLower(filter.Host))
+	}
+	if !filter.Since.IsZero() {
+		query += " AND fetched_at >= ?"
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query += " AND fetched_at < ?"
+		args = append(args, filter.Until.UTC())
+	}
+	if filter.SuccessfulOnly {
+		query += " AND error = ''"
+	}
+	rows, err := s.db.QueryContext(ctx, s.rebind(query+" ORDER BY id"), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		preview, err := scanStoredPreview(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(preview); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Prune deletes the previews older than policy.MaxAge, then the oldest beyond
+// policy.MaxRowsPerHost for each host and beyond policy.MaxRows in all, and
+// the URLs neither requested nor fetched within policy.MaxAge
+func (s *sqlStore) Prune(ctx context.Context, policy RetentionPolicy, now time.Time) (int64, error) {
+	var deleted int64
+	if policy.MaxAge > 0 {
+		cutoff := now.Add(-policy.MaxAge).UTC()
+		n, err := s.deletePreviews(ctx, "fetched_at < ?", cutoff)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		_, err = s.db.ExecContext(ctx, s.rebind(`DELETE FROM urls
+			WHERE (last_requested IS NULL OR last_requested < ?) AND (last_fetched IS NULL OR last_fetched < ?)`), cutoff, cutoff)
+		if err != nil {
+			return deleted, err
+		}
+	}
+	if policy.MaxRowsPerHost > 0 {
+		rows, err := s.db.QueryContext(ctx, s.rebind("SELECT host FROM previews GROUP BY host HAVING COUNT(*) > ?"), policy.MaxRowsPerHost)
+		if err != nil {
+			return deleted, err
+		}
+		var hosts []string
+		for rows.Next() {
+			var host string
+			if err := rows.Scan(&host); err != nil {
+				rows.Close()
+				return deleted, err
+			}
+			hosts = append(hosts, host)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return deleted, err
+		}
+		for _, host := range hosts {
+			n, err := s.deleteBeyond(ctx, policy.MaxRowsPerHost, "host = ?", host)
+			deleted += n
+			if err != nil {
+				return deleted, err
+			}
+		}
+	}
+	if policy.MaxRows > 0 {
+		n, err := s.deleteBeyond(ctx, policy.MaxRows, "1 = 1")
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteBeyond deletes the previews matching where, but for the keep most recently fetched
+func (s *sqlStore) deleteBeyond(ctx context.Context, keep int, where string, args ...any) (int64, error) {
+	// The last preview kept marks where deleting starts
+	var lastID int64
+	var lastFetched time.Time
+	err := s.db.QueryRowContext(ctx, s.rebind("SELECT id, fetched_at FROM previews WHERE "+where+
+		" ORDER BY fetched_at DESC, id DESC LIMIT 1 OFFSET ?"), append(args, keep-1)...).Scan(&lastID, &lastFetched)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return s.deletePreviews(ctx, where+" AND (fetched_at < ? OR (fetched_at = ? AND id < ?))",
+		append(args, lastFetched, lastFetched, lastID)...)
+}
+
+// deletePreviews deletes the previews matching where, pruneBatchSize at a
+// time so other writers aren't held up for long
+func (s *sqlStore) deletePreviews(ctx context.Context, where string, args ...any) (int64, error) {
+	query := s.rebind("DELETE FROM previews WHERE id IN (SELECT id FROM previews WHERE " + where + " LIMIT ?)")
+	args = append(args, pruneBatchSize)
+	var deleted int64
+	for {
+		res, err := s.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return deleted, err
+		}
+		n, err := res.RowsAffected()
+		deleted += n
+		if err != nil || n < pruneBatchSize {
+			return deleted, err
+		}
+	}
+}
+
+// Ping checks the database can be reached
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close releases the database connections
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// scanStoredPreview reads the id, url, fetched_at and data columns of a previews row
+func scanStoredPreview(row interface{ Scan(...any) error }) (*StoredPreview, error) {
+	var preview StoredPreview
+	var data string
+	if err := row.Scan(&preview.ID, &preview.URL, &preview.FetchedAt, &data); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &preview.Preview); err != nil {
+		return nil, fmt.Errorf("stored preview %d: %w", preview.ID, err)
+	}
+	return &preview, nil
+}
+
+// previewRecorder saves previews to a PreviewStore from a background
+// goroutine, so recording never holds up a response. Previews arriving while
+// storeQueueSize of them are waiting are dropped. Requests are counted in
+// memory and written every requestFlushInterval
+type previewRecorder struct {
+	store   PreviewStore
+	queue   chan StoredPreview
+	stop    chan struct{}
+	stopped chan struct{}
+
+	mu       sync.Mutex
+	requests map[string]int64 // Requests by URL since the last flush
+}
+
+// newPreviewRecorder starts recording into store, or returns nil when store is nil
+func newPreviewRecorder(store PreviewStore) *previewRecorder {
+	if store == nil {
+		return nil
+	}
+	pr := &previewRecorder{
+		store:    store,
+		queue:    make(chan StoredPreview, storeQueueSize),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		requests: make(map[string]int64),
+	}
+	go pr.run()
+	return pr
+}
+
+// Record queues a preview of the normalized URL key, fetched now, to be saved
+func (pr *previewRecorder) Record(key string, result LinkPreviewResponse) {
+	if pr == nil {
+		return
+	}
+	select {
+	case pr.queue <- StoredPreview{URL: key, FetchedAt: time.Now(), Preview: result}:
+	default:
+		slog.Warn("Preview not recorded: store queue full", "url", key)
+	}
+}
+
+// Hit counts a request for the normalized URL key
+func (pr *previewRecorder) Hit(key string) {
+	if pr == nil {
+		return
+	}
+	pr.mu.Lock()
+	pr.requests[key]++
+	pr.mu.Unlock()
+}
+
+// run saves queued previews and request counts until Close, then saves those
+// still pending
+func (pr *previewRecorder) run() {
+	defer close(pr.stopped)
+	ticker := time.NewTicker(requestFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case preview := <-pr.queue:
+			pr.save(preview)
+		case <-ticker.C:
+			pr.flushRequests()
+		case <-pr.stop:
+			for {
+				select {
+				case preview := <-pr.queue:
+					pr.save(preview)
+				default:
+					pr.flushRequests()
+					return
+				}
+			}
+		}
+	}
+}
+
+// flushRequests writes the requests counted since the last flush. Counts that
+// can't be written are dropped rather than retried
+func (pr *previewRecorder) flushRequests() {
+	pr.mu.Lock()
+	counts := pr.requests
+	pr.requests = make(map[string]int64)
+	pr.mu.Unlock()
+	if len(counts) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeWriteTimeout)
+	defer cancel()
+	if err := pr.store.CountRequests(ctx, counts, time.Now()); err != nil {
+		slog.Warn("Could not record request counts", "urls", len(counts), "error", err)
+	}
+}
+
+// save writes one preview, logging failures
+func (pr *previewRecorder) save(preview StoredPreview) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeWriteTimeout)
+	defer cancel()
+	if err := pr.store.Save(ctx, []StoredPreview{preview}); err != nil {
+		slog.Warn("Could not record preview", "url", preview.URL, "error", err)
+	}
+}
+
+// Close saves the queued previews, waiting at most timeout, and closes the store
+func (pr *previewRecorder) Close(timeout time.Duration) {
+	if pr == nil {
+		return
+	}
+	close(pr.stop)
+	select {
+	case <-pr.stopped:
+	case <-time.After(timeout):
+		slog.Warn("Closing preview store with previews still queued", "queued", len(pr.queue))
+	}
+	pr.store.Close()
+}
@@ -0,0 +1,7 @@
+//go:build !cgo
+
+package server
+
+// sqliteDriver is empty: the SQLite driver needs cgo, so without it only
+// Postgres preview stores are available
+const sqliteDriver = ""
@@ -0,0 +1,6 @@
+package server
+
+import _ "github.com/lib/pq"
+
+// postgresDriver is the database/sql driver for Postgres preview stores
+const postgresDriver = "postgres"
@@ -0,0 +1,8 @@
+//go:build cgo
+
+package server
+
+import _ "github.com/mattn/go-sqlite3"
+
+// sqliteDriver is the database/sql driver for SQLite preview stores
+const sqliteDriver = "sqlite3"
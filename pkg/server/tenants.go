@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tenant is one of the products served by a shared deployment: its API keys
+// and the limits and settings applied to requests made with them. Zero fields
+// fall back to the deployment-wide settings
+type Tenant struct {
+	Name           string   `json:"name"`
+	Keys           []string `json:"-"`
+	RateLimit      int      `json:"rate_limit,omitempty"`      // Requests per minute per key
+	RateBurst      int      `json:"rate_burst,omitempty"`      // Bucket capacity; defaults to RateLimit
+	DailyQuota     int      `json:"daily_quota,omitempty"`     // Requests per UTC day per key
+	AllowedOrigins []string `json:"allowed_origins,omitempty"` // Browser origins the keys may be used from
+	AllowedDomains []string `json:"allowed_domains,omitempty"` // Domains that may be previewed, as in ALLOWED_DOMAINS
+	CacheNamespace string   `json:"cache_namespace,omitempty"` // Cached previews are shared within a namespace; defaults to Name
+
+	limiter *RateLimiter  // nil when the deployment's key limits apply
+	origins *OriginList   // nil when any origin may use the keys
+	domains *DomainPolicy // nil when the deployment's domain policy is enough
+}
+
+// init builds the limiter and policies enforcing the tenant's settings. The
+// limiter of previous, the tenant's settings before a change, is kept with
+// the new limits so usage so far still counts
+func (t *Tenant) init(previous *Tenant) {
+	if t.CacheNamespace == "" {
+		t.CacheNamespace = t.Name
+	}
+	if t.RateLimit > 0 || t.DailyQuota > 0 {
+		if previous != nil && previous.limiter != nil {
+			t.limiter = previous.limiter
+			t.limiter.SetLimits(t.RateLimit, t.RateBurst, t.DailyQuota)
+		} else {
+			t.limiter = NewRateLimiter(t.RateLimit, t.RateBurst, t.DailyQuota)
+		}
+	}
+	if len(t.AllowedOrigins) > 0 {
+		t.origins = NewOriginList(t.AllowedOrigins)
+	}
+	if len(t.AllowedDomains) > 0 {
+		t.domains = NewDomainPolicy(t.AllowedDomains, nil)
+	}
+}
+
+// OriginAllowed reports whether a browser request from origin may use the
+// tenant's keys. Requests without an Origin header aren't from browsers
+func (t *Tenant) OriginAllowed(origin string) bool {
+	return t.origins == nil || origin == "" || t.origins.Allowed(origin)
+}
+
+// CheckDomain returns a *PolicyError when the tenant may not preview pages on
+// host. A nil tenant may preview any page
+func (t *Tenant) CheckDomain(host string) error {
+	if t == nil || t.domains == nil {
+		return nil
+	}
+	if err := t.domains.Check(host); err != nil {
+		return &PolicyError{Domain: strings.ToLower(host), Reason: "not in the allowed domains of tenant " + t.Name}
+	}
+	return nil
+}
+
+// tenantOrigins are the allowed origins of tenants, which CORS must let
+// through in addition to the deployment's allowed origins
+func tenantOrigins(tenants []*Tenant) []string {
+	var origins []string
+	for _, t := range tenants {
+		origins = append(origins, t.AllowedOrigins...)
+	}
+	return origins
+}
+
+type tenantKey struct{}
+
+// WithTenant attaches the tenant a request is made for to ctx
+func WithTenant(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant attached to ctx, or nil
+func TenantFrom(ctx context.Context) *Tenant {
+	tenant, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return tenant
+}
+
+// cacheKey namespaces the cache key of a preview for the tenant of ctx, and
+// keeps previews fetched with a requested user agent profile or
+// Accept-Language apart
+func cacheKey(ctx context.Context, key string) string {
+	key = languageKey(profileKey(key, userAgentProfileFrom(ctx)), acceptLanguageFrom(ctx))
+	if tenant := TenantFrom(ctx); tenant != nil {
+		return namespacedKey(tenant.CacheNamespace, key)
+	}
+	return key
+}
+
+// defaultVariant reports whether ctx asks for previews as fetched by
+// default, the ones the preview store keeps
+func defaultVariant(ctx context.Context) bool {
+	return userAgentProfileFrom(ctx) == "" && acceptLanguageFrom(ctx) == ""
+}
+
+// profileKey is the cache key of a preview fetched with a user agent profile
+// asked for by the request; "" is the profile of requests that asked for none
+func profileKey(key, profile string) string {
+	if profile == "" {
+		return key
+	}
+	return key + "#ua=" + profile
+}
+
+// namespacedKey is the cache key of a preview in a cache namespace; the
+// empty namespace is the one of requests without a tenant
+func namespacedKey(namespace, key string) string {
+	if namespace == "" {
+		return key
+	}
+	return namespace + "|" + key
+}
+
+// parseTenants decodes the config file's "tenants" section, a list of tables
+// each with a name, its keys and the settings to override
+func parseTenants(value any) ([]*Tenant, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of tenants")
+	}
+	tenants := make([]*Tenant, 0, len(list))
+	names := make(map[string]bool)
+	for i, item := range list {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("entry %d is not a table", i+1)
+		}
+		tenant := &Tenant{}
+		for key, value := range entry {
+			s, err := settingString(value)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %s: %v", i+1, key, err)
+			}
+			switch strings.ToLower(strings.ReplaceAll(key, "-", "_")) {
+			case "name":
+				tenant.Name = strings.TrimSpace(s)
+			case "keys":
+				tenant.Keys = splitList(s)
+			case "rate_limit":
+				tenant.RateLimit, err = strconv.Atoi(s)
+			case "rate_burst":
+				tenant.RateBurst, err = strconv.Atoi(s)
+			case "daily_quota":
+				tenant.DailyQuota, err = strconv.Atoi(s)
+			case "allowed_origins":
+				tenant.AllowedOrigins = splitList(s)
+			case "allowed_domains":
+				tenant.AllowedDomains = splitList(s)
+			case "cache_namespace":
+				tenant.CacheNamespace = strings.TrimSpace(s)
+			default:
+				return nil, fmt.Errorf("entry %d: unknown setting %q", i+1, key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %s: %v", i+1, key, err)
+			}
+		}
+		if tenant.Name == "" {
+			return nil, fmt.Errorf("entry %d has no name", i+1)
+		}
+		if names[tenant.Name] {
+			return nil, fmt.Errorf("tenant %q is listed twice", tenant.Name)
+		}
+		names[tenant.Name] = true
+		if len(tenant.Keys) == 0 {
+			return nil, fmt.Errorf("tenant %q has no keys", tenant.Name)
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, nil
+}
+
+// splitList splits a comma-separated setting, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThreatChecker flags URLs listed by Google Safe Browsing or a local blocklist feed
+type ThreatChecker struct {
+	safeBrowsingKey string
+	safeBrowsingURL string
+	client          *http.Client
+
+	blocklistPath string
+	mu            sync.RWMutex
+	blocklist     map[string]bool // Exact URLs and bare hostnames
+	loadedAt      time.Time
+}
+
+// safeBrowsingEndpoint is the Safe Browsing v4 Lookup API
+const safeBrowsingEndpoint = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+
+// NewThreatChecker creates a checker using the Safe Browsing API key and/or a blocklist file
+// The blocklist file lists one URL or hostname per line and is reloaded every refresh interval.
+// Returns nil when neither source is configured
+func NewThreatChecker(safeBrowsingKey, blocklistPath string, refresh time.Duration) *ThreatChecker {
+	if safeBrowsingKey == "" && blocklistPath == "" {
+		return nil
+	}
+
+	tc := &ThreatChecker{
+		safeBrowsingKey: safeBrowsingKey,
+		safeBrowsingURL: safeBrowsingEndpoint,
+		client:          &http.Client{Timeout: 5 * time.Second},
+		blocklistPath:   blocklistPath,
+	}
+
+	if blocklistPath != "" {
+		if err := tc.loadBlocklist(); err != nil {
+			slog.Warn("Could not load threat blocklist", "path", blocklistPath, "error", err)
+		}
+		if refresh > 0 {
+			go func() {
+				for range time.Tick(refresh) {
+					if err := tc.loadBlocklist(); err != nil {
+						slog.Warn("Could not reload threat blocklist", "path", blocklistPath, "error", err)
+					}
+				}
+			}()
+		}
+	}
+
+	return tc
+}
+
+// Check returns the threat type for targetURL, or "" when it isn't known to be unsafe
+// Lookup failures are reported as errors; callers should treat them as "unknown"
+func (tc *ThreatChecker) Check(ctx context.Context, targetURL string) (string, error) {
+	if tc.inBlocklist(targetURL) {
+		return "BLOCKLISTED", nil
+	}
+	if tc.safeBrowsingKey == "" {
+		return "", nil
+	}
+	return tc.lookupSafeBrowsing(ctx, targetURL)
+}
+
+// inBlocklist reports whether the URL or its host appears in the local feed
+func (tc *ThreatChecker) inBlocklist(targetURL string) bool {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	if len(tc.blocklist) == 0 {
+		return false
+	}
+	if tc.blocklist[strings.TrimSuffix(targetURL, "/")] {
+		return true
+	}
+	if parsed, err := url.Parse(targetURL); err == nil {
+		return tc.blocklist[strings.ToLower(parsed.Hostname())]
+	}
+	return false
+}
+
+// loadBlocklist replaces the in-memory feed with the contents of the blocklist file
+func (tc *ThreatChecker) loadBlocklist() error {
+	file, err := os.Open(tc.blocklistPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "://") {
+			entries[strings.TrimSuffix(line, "/")] = true
+		} else {
+			entries[strings.ToLower(line)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	tc.mu.Lock()
+	tc.blocklist = entries
+	tc.loadedAt = time.Now()
+	tc.mu.Unlock()
+	return nil
+}
+
+// lookupSafeBrowsing queries the Safe Browsing Lookup API for targetURL
+func (tc *ThreatChecker) lookupSafeBrowsing(ctx context.Context, targetURL string) (string, error) {
+	payload := map[string]interface{}{
+		"client": map[string]string{
+			"clientId":      "link-preview-api",
+			"clientVersion": "1.0.0",
+		},
+		"threatInfo": map[string]interface{}{
+			"threatTypes":      []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"},
+			"platformTypes":    []string{"ANY_PLATFORM"},
+			"threatEntryTypes": []string{"URL"},
+			"threatEntries":    []map[string]string{{"url": targetURL}},
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tc.safeBrowsingURL+"?key="+url.QueryEscape(tc.safeBrowsingKey), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := tc.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("safe browsing lookup failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("safe browsing lookup failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Matches []struct {
+			ThreatType string `json:"threatType"`
+		} `json:"matches"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid safe browsing response: %v", err)
+	}
+	if len(result.Matches) > 0 {
+		return result.Matches[0].ThreatType, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"strconv"
+
+	_ "image/gif" // Decoders for the formats preview images come in
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxDecodePixels caps the size of images decoded for resizing, so a small
+// file declaring huge dimensions can't exhaust memory
+const maxDecodePixels = 50_000_000
+
+// thumbnailJPEGQuality is the quality of resized images encoded as JPEG
+const thumbnailJPEGQuality = 85
+
+// ImageResizer scales proxied images down to the size a client asks for, so
+// a 300px card doesn't download a 4MB hero image
+type ImageResizer struct {
+	maxWidth  int // Largest width a client may ask for
+	maxHeight int // Largest height a client may ask for
+}
+
+// NewImageResizer creates a resizer accepting sizes up to maxWidth x maxHeight
+func NewImageResizer(maxWidth, maxHeight int) *ImageResizer {
+	return &ImageResizer{maxWidth: maxWidth, maxHeight: maxHeight}
+}
+
+// Size reads the requested size from the "w" and "h" query parameters. Zero
+// means the dimension isn't constrained; both zero means no resizing
+func (ir *ImageResizer) Size(query url.Values) (width, height int, err error) {
+	if width, err = ir.dimension(query, "w", ir.maxWidth); err != nil {
+		return 0, 0, err
+	}
+	if height, err = ir.dimension(query, "h", ir.maxHeight); err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
+
+func (ir *ImageResizer) dimension(query url.Values, name string, max int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("query parameter '%s' must be a positive number of pixels", name)
+	}
+	if n > max {
+		return 0, fmt.Errorf("query parameter '%s' must be at most %d", name, max)
+	}
+	return n, nil
+}
+
+// Resize scales data down to fit within width x height, keeping its aspect
+// ratio, and returns the encoded result with its content type: JPEG for opaque
+// images and PNG for those with transparency. Images already small enough are
+// returned unchanged with an empty content type
+func (ir *ImageResizer) Resize(data []byte, width, height int) ([]byte, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("unsupported image: %v", err)
+	}
+	if config.Width*config.Height > maxDecodePixels {
+		return nil, "", errors.New("image dimensions are too large to resize")
+	}
+	targetWidth, targetHeight := fitWithin(config.Width, config.Height, width, height)
+	if targetWidth >= config.Width && targetHeight >= config.Height {
+		return data, "", nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %v", err)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	return encodeThumbnail(dst)
+}
+
+// fitWithin returns the size of a w x h image scaled to fit within maxW x maxH,
+// either of which may be zero for no limit. Images are never scaled up
+func fitWithin(w, h, maxW, maxH int) (int, int) {
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && float64(h)*scale > float64(maxH) {
+		scale = float64(maxH) / float64(h)
+	}
+	return max(1, int(float64(w)*scale+0.5)), max(1, int(float64(h)*scale+0.5))
+}
+
+// encodeThumbnail encodes img as JPEG if it is opaque, otherwise as PNG
+func encodeThumbnail(img *image.NRGBA) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if img.Opaque() {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: thumbnailJPEGQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/png", nil
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestResizeRefusesOversizedImages(t *testing.T) {
+	ir := NewImageResizer(2000, 2000)
+	_, _, err := ir.Resize(oversizedGIF(10000, 10000), 100, 100)
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("Resize of a 10000x10000 header = %v, want a too large error", err)
+	}
+}
+
+func TestResize(t *testing.T) {
+	opaque := encodePNG(t, filledImage(400, 200, func(x, y int) color.NRGBA {
+		return color.NRGBA{uint8(x), uint8(y), 0, 255}
+	}))
+	transparent := encodePNG(t, filledImage(400, 200, func(x, y int) color.NRGBA {
+		return color.NRGBA{255, 0, 0, uint8(x)}
+	}))
+	tests := []struct {
+		name                  string
+		data                  []byte
+		width, height         int
+		wantType              string
+		wantWidth, wantHeight int
+	}{
+		{"width only", opaque, 100, 0, "image/jpeg", 100, 50},
+		{"height only", opaque, 0, 50, "image/jpeg", 100, 50},
+		{"fits the tighter side", opaque, 100, 100, "image/jpeg", 100, 50},
+		{"transparency kept", transparent, 200, 0, "image/png", 200, 100},
+		{"never scaled up", opaque, 800, 800, "", 400, 200},
+	}
+	for _, tt := range tests {
+		data, contentType, err := NewImageResizer(2000, 2000).Resize(tt.data, tt.width, tt.height)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if contentType != tt.wantType {
+			t.Errorf("%s: content type = %q, want %q", tt.name, contentType, tt.wantType)
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: decoding the result: %v", tt.name, err)
+			continue
+		}
+		if config.Width != tt.wantWidth || config.Height != tt.wantHeight {
+			t.Errorf("%s: size = %dx%d, want %dx%d", tt.name, config.Width, config.Height, tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
+
+func TestImageResizerSize(t *testing.T) {
+	ir := NewImageResizer(1000, 800)
+	tests := []struct {
+		query         string
+		width, height int
+		wantErr       bool
+	}{
+		{"", 0, 0, false},
+		{"w=300", 300, 0, false},
+		{"w=300&h=200", 300, 200, false},
+		{"w=1000&h=800", 1000, 800, false},
+		{"w=1001", 0, 0, true},
+		{"h=801", 0, 0, true},
+		{"w=0", 0, 0, true},
+		{"w=-5", 0, 0, true},
+		{"w=abc", 0, 0, true},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		width, height, err := ir.Size(query)
+		if (err != nil) != tt.wantErr || width != tt.width || height != tt.height {
+			t.Errorf("Size(%q) = %d, %d, %v; want %d, %d, error %v", tt.query, width, height, err, tt.width, tt.height, tt.wantErr)
+		}
+	}
+}
+
+func TestFitWithin(t *testing.T) {
+	tests := []struct {
+		w, h, maxW, maxH int
+		wantW, wantH     int
+	}{
+		{1600, 900, 800, 0, 800, 450},
+		{1600, 900, 0, 300, 533, 300},
+		{1600, 900, 800, 300, 533, 300},
+		{100, 50, 800, 600, 100, 50},
+		{10000, 1, 100, 0, 100, 1},
+	}
+	for _, tt := range tests {
+		if w, h := fitWithin(tt.w, tt.h, tt.maxW, tt.maxH); w != tt.wantW || h != tt.wantH {
+			t.Errorf("fitWithin(%d, %d, %d, %d) = %d, %d; want %d, %d", tt.w, tt.h, tt.maxW, tt.maxH, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans for the preview pipeline
+// It is a no-op until SetupTracing installs an exporting provider
+var tracer = otel.Tracer("link-preview-api")
+
+// SetupTracing installs an OpenTelemetry tracer provider exporting spans over OTLP/HTTP
+// The exporter is configured by the standard OTEL_EXPORTER_OTLP_* variables and
+// sampling by OTEL_TRACES_SAMPLER / OTEL_TRACES_SAMPLER_ARG. It returns a function
+// flushing buffered spans, to be called on shutdown
+func SetupTracing(config *Config) (func(context.Context) error, error) {
+	// Always understand incoming traceparent headers, even when not exporting,
+	// so trace IDs can still be propagated and logged
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !config.TracingEnabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", config.TracingServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(5*time.Second)),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// tracingMiddleware starts a server span for each request, continuing the trace
+// from an incoming traceparent header when present
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("client.address", c.ClientIP()),
+				attribute.String("request.id", c.GetString("request_id")),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+}
+
+// endSpan records the outcome of a preview on span and ends it
+func endSpan(span trace.Span, result *LinkPreviewResponse) {
+	if result.Error != "" {
+		span.SetStatus(codes.Error, result.Error)
+		if result.ErrorCode != "" {
+			span.SetAttributes(attribute.String("preview.error_code", result.ErrorCode))
+		}
+	}
+	span.End()
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportConfig tunes the connection pool used for outbound fetches
+type TransportConfig struct {
+	MaxIdleConns          int           // Idle connections kept across all hosts
+	MaxIdleConnsPerHost   int           // Idle connections kept per host
+	MaxConnsPerHost       int           // Total connections per host; 0 means unlimited
+	IdleConnTimeout       time.Duration // How long an idle connection is kept
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration // 0 means no limit beyond the client timeout
+	HTTP2                 bool          // Negotiate HTTP/2 with servers that support it
+}
+
+// newTransport builds the shared outbound transport
+// dial and proxy are supplied by the caller so SSRF checks and proxy rules apply
+func newTransport(tc TransportConfig, dial func(ctx context.Context, network, addr string) (net.Conn, error), proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dial,
+		MaxIdleConns:          tc.MaxIdleConns,
+		MaxIdleConnsPerHost:   tc.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       tc.MaxConnsPerHost,
+		IdleConnTimeout:       tc.IdleConnTimeout,
+		TLSHandshakeTimeout:   tc.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: tc.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		// A custom DialContext disables HTTP/2 unless it is requested explicitly
+		ForceAttemptHTTP2: tc.HTTP2,
+	}
+	if !tc.HTTP2 {
+		// A non-nil, empty map turns off the transport's automatic HTTP/2 support
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds on usage reporting
+const (
+	// Usage older than this is forgotten when there is no store to keep it
+	usageMemoryRetention = 31 * 24 * time.Hour
+	// Longest range a usage report covers
+	maxUsageRange = 366 * 24 * time.Hour
+)
+
+// UsageCounts is what a client used the preview endpoint for
+type UsageCounts struct {
+	Requests     int64 `json:"requests"`
+	CacheHits    int64 `json:"cache_hits"`
+	Errors       int64 `json:"errors"`        // Requests that failed, timed out or were rejected
+	BytesFetched int64 `json:"bytes_fetched"` // Bytes downloaded from the pages previewed
+}
+
+// add adds other to the counts
+func (uc *UsageCounts) add(other UsageCounts) {
+	uc.Requests += other.Requests
+	uc.CacheHits += other.CacheHits
+	uc.Errors += other.Errors
+	uc.BytesFetched += other.BytesFetched
+}
+
+// UsageRecord is the usage of one API key during one hour
+type UsageRecord struct {
+	Hour   time.Time // Start of the hour, in UTC
+	Key    string    // Fingerprint of the API key, as in the audit log; "" for requests without one
+	Tenant string    // Tenant of the key, if any
+	UsageCounts
+}
+
+// usageBucket identifies a UsageRecord
+type usageBucket struct {
+	hour   time.Time
+	key    string
+	tenant string
+}
+
+// UsageTracker counts preview requests per API key and hour for billing and
+// capacity planning. With a preview store, counts are added to it every
+// requestFlushInterval so they survive restarts and add up across instances;
+// without one, the last usageMemoryRetention of them are kept in memory
+type UsageTracker struct {
+	store   PreviewStore
+	stop    chan struct{}
+	stopped chan struct{}
+
+	mu      sync.Mutex
+	buckets map[usageBucket]*UsageCounts // Not yet flushed to store
+	pruned  time.Time                    // Last time old buckets were forgotten
+}
+
+// NewUsageTracker creates a tracker keeping usage in store, or in memory when store is nil
+func NewUsageTracker(store PreviewStore) *UsageTracker {
+	ut := &UsageTracker{store: store, buckets: make(map[usageBucket]*UsageCounts), pruned: time.Now()}
+	if store != nil {
+		ut.stop, ut.stopped = make(chan struct{}), make(chan struct{})
+		go ut.run()
+	}
+	return ut
+}
+
+// Record counts one preview request made with key, an API key fingerprint,
+// for tenant. outcome is the audit outcome and bytes what was downloaded
+func (ut *UsageTracker) Record(key, tenant, outcome string, cached bool, bytes int64) {
+	if ut == nil {
+		return
+	}
+	now := time.Now().UTC()
+	bucket := usageBucket{hour: now.Truncate(time.Hour), key: key, tenant: tenant}
+
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	counts := ut.buckets[bucket]
+	if counts == nil {
+		counts = &UsageCounts{}
+		ut.buckets[bucket] = counts
+	}
+	counts.Requests++
+	if cached {
+		counts.CacheHits++
+	}
+	if outcome != "success" {
+		counts.Errors++
+	}
+	counts.BytesFetched += bytes
+
+	if ut.store == nil && now.Sub(ut.pruned) > time.Hour {
+		ut.pruned = now
+		for b := range ut.buckets {
+			if now.Sub(b.hour) > usageMemoryRetention {
+				delete(ut.buckets, b)
+			}
+		}
+	}
+}
+
+// Usage returns the usage recorded in the hours from since until until,
+// stored and not yet stored
+func (ut *UsageTracker) Usage(ctx context.Context, since, until time.Time) ([]UsageRecord, error) {
+	var records []UsageRecord
+	if ut.store != nil {
+		stored, err := ut.store.Usage(ctx, since, until)
+		if err != nil {
+			return nil, err
+		}
+		records = stored
+	}
+	ut.mu.Lock()
+	for bucket, counts := range ut.buckets {
+		if !bucket.hour.Before(since.Truncate(time.Hour)) && bucket.hour.Before(until) {
+			records = append(records, UsageRecord{Hour: bucket.hour, Key: bucket.key, Tenant: bucket.tenant, UsageCounts: *counts})
+		}
+	}
+	ut.mu.Unlock()
+	return records, nil
+}
+
+// run flushes the counts every requestFlushInterval until Close, and once more then
+func (ut *UsageTracker) run() {
+	defer close(ut.stopped)
+	ticker := time.NewTicker(requestFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ut.flush()
+		case <-ut.stop:
+			ut.flush()
+			return
+		}
+	}
+}
+
+// flush adds the counts so far to the store. Counts that can't be written
+// are kept for the next flush
+func (ut *UsageTracker) flush() {
+	ut.mu.Lock()
+	buckets := ut.buckets
+	ut.buckets = make(map[usageBucket]*UsageCounts)
+	ut.mu.Unlock()
+	if len(buckets) == 0 {
+		return
+	}
+	records := make([]UsageRecord, 0, len(buckets))
+	for bucket, counts := range buckets {
+		records = append(records, UsageRecord{Hour: bucket.hour, Key: bucket.key, Tenant: bucket.tenant, UsageCounts: *counts})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeWriteTimeout)
+	defer cancel()
+	if err := ut.store.AddUsage(ctx, records); err != nil {
+		slog.Warn("Could not record usage; retrying at the next flush", "records", len(records), "error", err)
+		ut.mu.Lock()
+		for bucket, counts := range buckets {
+			if current := ut.buckets[bucket]; current != nil {
+				counts.add(*current)
+			}
+			ut.buckets[bucket] = counts
+		}
+		ut.mu.Unlock()
+	}
+}
+
+// Close writes the counts not yet stored, waiting at most timeout
+func (ut *UsageTracker) Close(timeout time.Duration) {
+	if ut == nil || ut.store == nil {
+		return
+	}
+	close(ut.stop)
+	select {
+	case <-ut.stopped:
+	case <-time.After(timeout):
+		slog.Warn("Usage not recorded before shutdown")
+	}
+}
+
+// KeyUsage is the usage of one API key over a report's range
+type KeyUsage struct {
+	Key    string `json:"key,omitempty"` // Fingerprint of the API key; empty for requests without one
+	Tenant string `json:"tenant,omitempty"`
+	UsageCounts
+	CacheHitRatio float64 `json:"cache_hit_ratio"`
+	ErrorRate     float64 `json:"error_rate"`
+}
+
+// UsagePoint is the usage matching a report's filters during one hour or day
+type UsagePoint struct {
+	Time time.Time `json:"time"`
+	UsageCounts
+}
+
+// UsageReport is the JSON body of GET /admin/usage
+type UsageReport struct {
+	Since  time.Time    `json:"since"`
+	Until  time.Time    `json:"until"`
+	Total  KeyUsage     `json:"total"`
+	Keys   []KeyUsage   `json:"keys"`             // Most requests first
+	Series []UsagePoint `json:"series,omitempty"` // With granularity=hour or day
+}
+
+// parseUsageRange reads a report range such as "24h", "7d" or "30d"
+func parseUsageRange(value string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(value)
+	}
+	if err != nil || d <= 0 || d > maxUsageRange {
+		return 0, fmt.Errorf("range must be a duration such as 24h or 7d, at most %dd", int(maxUsageRange.Hours()/24))
+	}
+	return d, nil
+}
+
+// handleUsage reports usage per API key over ?range= (24h by default),
+// optionally only of the key ?key= (the key or its fingerprint) or the
+// tenant ?tenant=, and broken down by ?granularity=hour or day
+func handleUsage(usage *UsageTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		length, err := parseUsageRange(c.DefaultQuery("range", "24h"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'range': " + err.Error()})
+			return
+		}
+		var step time.Duration
+		switch c.Query("granularity") {
+		case "":
+		case "hour":
+			step = time.Hour
+		case "day":
+			step = 24 * time.Hour
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'granularity' must be hour or day"})
+			return
+		}
+		key := c.Query("key")
+		if _, err := hex.DecodeString(key); err != nil || len(key) != 12 {
+			key = keyFingerprint(key)
+		}
+		tenant, hasTenant := c.GetQuery("tenant")
+
+		until := time.Now().UTC()
+		since := until.Add(-length)
+		records, err := usage.Usage(c.Request.Context(), since, until)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read usage: " + err.Error()})
+			return
+		}
+
+		report := UsageReport{Since: since, Until: until, Keys: []KeyUsage{}}
+		byKey := make(map[[2]string]*KeyUsage)
+		series := make(map[time.Time]*UsageCounts)
+		for _, record := range records {
+			if (key != "" && record.Key != key) || (hasTenant && record.Tenant != tenant) {
+				continue
+			}
+			report.Total.add(record.UsageCounts)
+			id := [2]string{record.Key, record.Tenant}
+			if byKey[id] == nil {
+				byKey[id] = &KeyUsage{Key: record.Key, Tenant: record.Tenant}
+			}
+			byKey[id].add(record.UsageCounts)
+			if step > 0 {
+				t := record.Hour.Truncate(step)
+				if series[t] == nil {
+					series[t] = &UsageCounts{}
+				}
+				series[t].add(record.UsageCounts)
+			}
+		}
+		for _, usage := range byKey {
+			usage.ratios()
+			report.Keys = append(report.Keys, *usage)
+		}
+		sort.Slice(report.Keys, func(i, j int) bool {
+			if report.Keys[i].Requests != report.Keys[j].Requests {
+				return report.Keys[i].Requests > report.Keys[j].Requests
+			}
+			return report.Keys[i].Key < report.Keys[j].Key
+		})
+		report.Total.ratios()
+		if step > 0 {
+			report.Series = []UsagePoint{}
+			for t, counts := range series {
+				report.Series = append(report.Series, UsagePoint{Time: t, UsageCounts: *counts})
+			}
+			sort.Slice(report.Series, func(i, j int) bool { return report.Series[i].Time.Before(report.Series[j].Time) })
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// ratios computes the cache hit ratio and error rate from the counts
+func (ku *KeyUsage) ratios() {
+	if ku.Requests > 0 {
+		ku.CacheHitRatio = float64(ku.CacheHits) / float64(ku.Requests)
+		ku.ErrorRate = float64(ku.Errors) / float64(ku.Requests)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// resolveUserAgent returns the user agent of a profile in
+// linkpreview.UserAgents, or value itself when it names none
+func resolveUserAgent(value string) string {
+	if ua, ok := linkpreview.UserAgents[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return ua
+	}
+	return strings.TrimSpace(value)
+}
+
+// userAgentProfiles lists the profile names, for error messages
+func userAgentProfiles() string {
+	return strings.Join(slices.Sorted(maps.Keys(linkpreview.UserAgents)), ", ")
+}
+
+// UserAgentPicker chooses the User-Agent of page fetches and renders: the
+// profile a request asked for, else the domain's from the config file, else
+// the next of USER_AGENT_ROTATION, else USER_AGENT
+type UserAgentPicker struct {
+	fixed    string   // USER_AGENT, resolved
+	rotation []string // User agents taken in turn
+	next     atomic.Uint64
+}
+
+// NewUserAgentPicker creates a picker for USER_AGENT and USER_AGENT_ROTATION,
+// dropping rotation entries that aren't profiles
+func NewUserAgentPicker(config *Config) *UserAgentPicker {
+	p := &UserAgentPicker{fixed: defaultUserAgent(config)}
+	for _, name := range config.UserAgentRotation {
+		ua, ok := linkpreview.UserAgents[strings.ToLower(name)]
+		if !ok {
+			slog.Warn("Ignoring unknown user agent profile in USER_AGENT_ROTATION", "profile", name, "known", userAgentProfiles())
+			continue
+		}
+		p.rotation = append(p.rotation, ua)
+	}
+	return p
+}
+
+// defaultUserAgent is the user agent set by USER_AGENT, or the built-in one
+func defaultUserAgent(config *Config) string {
+	if config.UserAgent == "" {
+		return linkpreview.DefaultUserAgent
+	}
+	return resolveUserAgent(config.UserAgent)
+}
+
+// Pick returns the user agent of a fetch for ctx of a page matching
+// override, which may be nil
+func (p *UserAgentPicker) Pick(ctx context.Context, override *DomainOverride) string {
+	if profile := userAgentProfileFrom(ctx); profile != "" {
+		return linkpreview.UserAgents[profile]
+	}
+	if override != nil && override.UserAgent != "" {
+		return override.UserAgent
+	}
+	if len(p.rotation) > 0 {
+		return p.rotation[(p.next.Add(1)-1)%uint64(len(p.rotation))]
+	}
+	return p.fixed
+}
+
+// Default returns the user agent of fetches that no profile, domain or
+// rotation applies to
+func (p *UserAgentPicker) Default() string {
+	return p.fixed
+}
+
+type userAgentProfileKey struct{}
+
+// WithUserAgentProfile asks for the pages of the preview request of ctx to be
+// fetched as profile, a name in linkpreview.UserAgents
+func WithUserAgentProfile(ctx context.Context, profile string) context.Context {
+	return context.WithValue(ctx, userAgentProfileKey{}, profile)
+}
+
+// userAgentProfileFrom returns the profile attached to ctx, or ""
+func userAgentProfileFrom(ctx context.Context) string {
+	profile, _ := ctx.Value(userAgentProfileKey{}).(string)
+	return profile
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxURLLength caps the length of the URLs previewed, well above what real
+// pages use and what most browsers and CDNs accept
+const maxURLLength = 2048
+
+// refusedSchemes are schemes that name no page to fetch, with the reason given
+var refusedSchemes = map[string]string{
+	"javascript": "javascript: URLs run scripts and have no page to fetch",
+	"data":       "data: URLs hold their content inline and have no page to fetch",
+	"file":       "file: URLs name files on this server",
+	"ftp":        "ftp: URLs are not fetched",
+}
+
+// validateURL checks a URL before anything is fetched for it: at most
+// maxURLLength bytes, without control characters, http or https, with a
+// host and without credentials. URLs without a scheme, such as "example.com/page", are taken as
+// https; the URL to fetch is returned
+func validateURL(rawURL string) (*url.URL, error) {
+	if rawURL == "" {
+		return nil, errors.New("the URL is empty")
+	}
+	if len(rawURL) > maxURLLength {
+		return nil, fmt.Errorf("the URL is %d bytes long, longer than the %d allowed", len(rawURL), maxURLLength)
+	}
+	if strings.ContainsFunc(rawURL, func(r rune) bool { return r < ' ' || r == 0x7f }) {
+		return nil, errors.New("the URL contains control characters")
+	}
+	if !strings.Contains(rawURL, "://") && !hasScheme(rawURL) {
+		rawURL = "https://" + rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("the URL can't be parsed: %v", err)
+	}
+	if reason, ok := refusedSchemes[strings.ToLower(parsed.Scheme)]; ok {
+		return nil, errors.New(reason)
+	}
+	if scheme := strings.ToLower(parsed.Scheme); scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q; only http and https URLs are previewed", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return nil, errors.New("the URL has no host")
+	}
+	if parsed.User != nil {
+		return nil, errors.New("the URL contains credentials; previews are only made of public pages")
+	}
+	return parsed, nil
+}
+
+// hasScheme reports whether rawURL, which has no "://", starts with a scheme
+// such as "javascript:" or "mailto:" rather than a host and port, as in
+// "example.com:8080/page"
+func hasScheme(rawURL string) bool {
+	scheme, rest, ok := strings.Cut(rawURL, ":")
+	if !ok || scheme == "" || strings.ContainsAny(scheme, "/?#") {
+		return false
+	}
+	port := rest
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		port = rest[:i]
+	}
+	if port == "" {
+		return true
+	}
+	for _, r := range port {
+		if r < '0' || r > '9' {
+			return true
+		}
+	}
+	return false
+}
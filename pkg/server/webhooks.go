@@ -0,0 +1,325 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"link-preview-api/pkg/linkpreview"
+)
+
+// Bounds on webhook subscriptions and deliveries
+const (
+	maxWebhooksPerOwner   = 100
+	webhookTimeout        = 10 * time.Second
+	webhookAttempts       = 3
+	maxConcurrentWebhooks = 16
+)
+
+// Webhook is a subscription to changes of the preview of a URL or of any
+// page on a domain and its subdomains
+type Webhook struct {
+	ID          int64     `json:"id"`
+	Owner       string    `json:"-"` // Identity of the subscriber, from its API key or JWT
+	URL         string    `json:"url,omitempty"`
+	Domain      string    `json:"domain,omitempty"`
+	CallbackURL string    `json:"callback_url"`
+	Secret      string    `json:"-"` // Signs deliveries
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WebhookRequest is the body of a webhook registration
+type WebhookRequest struct {
+	URL         string `json:"url"`    // Page to watch
+	Domain      string `json:"domain"` // Or domain to watch
+	CallbackURL string `json:"callback_url" binding:"required"`
+	Secret      string `json:"secret"` // Generated when empty
+}
+
+// WebhookEvent is the body POSTed to a webhook's callback URL
+type WebhookEvent struct {
+	Event      string              `json:"event"` // Always "preview.changed"
+	WebhookID  int64               `json:"webhook_id"`
+	URL        string              `json:"url"`
+	DetectedAt time.Time           `json:"detected_at"`
+	Changes    []FieldChange       `json:"changes"`
+	Preview    LinkPreviewResponse `json:"preview"`
+}
+
+// WebhookNotifier tells subscribers when a refresh finds a preview changed.
+// Deliveries are signed with the webhook's secret in X-Signature-256 and
+// retried on failure; at most maxConcurrentWebhooks are in flight, and
+// further ones are dropped
+type WebhookNotifier struct {
+	store      PreviewStore
+	client     *http.Client
+	retry      RetryPolicy
+	deliveries chan struct{} // One per delivery in flight
+}
+
+// NewWebhookNotifier creates a notifier for the webhooks in store, or returns
+// nil when there is no store. Callback URLs go through the SSRF guard of
+// extractor like page fetches
+func NewWebhookNotifier(store PreviewStore, extractor *MetaExtractor, config *Config) *WebhookNotifier {
+	if store == nil {
+		return nil
+	}
+	return &WebhookNotifier{
+		store: store,
+		client: &http.Client{
+			Timeout:   webhookTimeout,
+			Transport: newTransport(config.Transport, extractor.guard.DialContext, nil),
+			// A callback answering with a redirect is a failed delivery
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		retry:      RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second},
+		deliveries: make(chan struct{}, maxConcurrentWebhooks),
+	}
+}
+
+// Notify delivers the changes between before and after, the new preview of
+// the normalized URL key, to the webhooks watching it
+func (wn *WebhookNotifier) Notify(ctx context.Context, key string, before, after LinkPreviewResponse) {
+	if wn == nil {
+		return
+	}
+	now := time.Now()
+	changes := versionChanges(newPreviewVersion(before, now), newPreviewVersion(after, now))
+	if len(changes) == 0 {
+		return
+	}
+	webhooks, err := wn.store.MatchWebhooks(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "Could not look up webhooks", "url", key, "error", err)
+		return
+	}
+	for _, webhook := range webhooks {
+		event := WebhookEvent{
+			Event:      "preview.changed",
+			WebhookID:  webhook.ID,
+			URL:        key,
+			DetectedAt: now.UTC(),
+			Changes:    changes,
+			Preview:    after,
+		}
+		select {
+		case wn.deliveries <- struct{}{}:
+		default:
+			slog.Warn("Webhook delivery dropped: too many in flight", "webhook", webhook.ID, "url", key)
+			continue
+		}
+		go func() {
+			defer func() { <-wn.deliveries }()
+			if err := wn.deliver(webhook, event); err != nil {
+				slog.Warn("Webhook delivery failed", "webhook", webhook.ID, "callback", webhook.CallbackURL, "error", err)
+			}
+		}()
+	}
+}
+
+// deliver POSTs event to the callback of webhook, retrying with backoff while
+// webhookRetryable
+func (wn *WebhookNotifier) deliver(webhook Webhook, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for attempt := 1; ; attempt++ {
+		err = wn.post(webhook, body, signature)
+		if err == nil || attempt >= webhookAttempts || !webhookRetryable(err) {
+			return err
+		}
+		time.Sleep(wn.retry.backoff(attempt))
+	}
+}
+
+// webhookStatusError is a delivery the callback answered with an error status
+type webhookStatusError struct {
+	status int
+}
+
+func (e *webhookStatusError) Error() string {
+	return "callback answered " + strconv.Itoa(e.status)
+}
+
+// webhookRetryable reports whether a failed delivery may succeed if tried
+// again: the callback answered 5xx or 429, or couldn't be reached for a
+// reason other than DNS or the SSRF guard
+func webhookRetryable(err error) bool {
+	var statusErr *webhookStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status >= 500 || statusErr.status == http.StatusTooManyRequests
+	}
+	return linkpreview.CodeOf(err) == ""
+}
+
+// post makes one delivery attempt
+func (wn *WebhookNotifier) post(webhook Webhook, body []byte, signature string) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "link-preview-api-webhooks")
+	req.Header.Set("X-Webhook-ID", strconv.FormatInt(webhook.ID, 10))
+	req.Header.Set("X-Signature-256", signature)
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &webhookStatusError{status: resp.StatusCode}
+	}
+	return nil
+}
+
+// webhookOwner identifies the caller owning webhooks: a hash of its API key,
+// its JWT subject, or "" when authentication is disabled
+func webhookOwner(c *gin.Context) string {
+	if key := c.GetString("api_key"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:])
+	}
+	if subject := c.GetString("jwt_subject"); subject != "" {
+		return "sub:" + subject
+	}
+	return ""
+}
+
+// callerWebhookOwner returns the webhook owner of the caller, or answers 401
+// and returns false when the caller is anonymous: without authentication
+// every caller would share, list and delete the same webhooks
+func callerWebhookOwner(c *gin.Context) (string, bool) {
+	owner := webhookOwner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Webhooks require an API key or JWT; enable API_KEYS or OIDC_ISSUER"})
+		return "", false
+	}
+	return owner, true
+}
+
+// handleAddWebhook registers a webhook for the caller. The secret signing its
+// deliveries is only ever returned here
+func handleAddWebhook(store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		owner, ok := callerWebhookOwner(c)
+		if !ok {
+			return
+		}
+		var req WebhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		webhook, err := newWebhook(req, owner)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook: " + err.Error()})
+			return
+		}
+		existing, err := store.ListWebhooks(c.Request.Context(), webhook.Owner)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read webhooks: " + err.Error()})
+			return
+		}
+		if len(existing) >= maxWebhooksPerOwner {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Too many webhooks: at most %d per client", maxWebhooksPerOwner)})
+			return
+		}
+		if err := store.AddWebhook(c.Request.Context(), webhook); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save webhook: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, struct {
+			*Webhook
+			Secret string `json:"secret"`
+		}{webhook, webhook.Secret})
+	}
+}
+
+// newWebhook validates a registration and builds the webhook it asks for
+func newWebhook(req WebhookRequest, owner string) (*Webhook, error) {
+	req.URL = strings.TrimSpace(req.URL)
+	// Stored as MatchWebhooks compares it: lowercased, in punycode, subdomains implied
+	if domain := strings.TrimPrefix(strings.Trim(strings.TrimSpace(req.Domain), "."), "*."); domain != "" {
+		req.Domain = normalizeDomain(domain)
+	} else {
+		req.Domain = ""
+	}
+	if (req.URL == "") == (req.Domain == "") {
+		return nil, errors.New("exactly one of 'url' and 'domain' is required")
+	}
+	callback, err := url.Parse(strings.TrimSpace(req.CallbackURL))
+	if err != nil || (callback.Scheme != "http" && callback.Scheme != "https") || callback.Host == "" {
+		return nil, errors.New("'callback_url' must be an absolute http or https URL")
+	}
+	webhook := &Webhook{Owner: owner, Domain: req.Domain, CallbackURL: callback.String(), Secret: req.Secret}
+	if req.URL != "" {
+		webhook.URL = normalizeURL(req.URL)
+	}
+	if webhook.Secret == "" {
+		secret := make([]byte, 24)
+		rand.Read(secret)
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+	return webhook, nil
+}
+
+// handleListWebhooks lists the caller's webhooks
+func handleListWebhooks(store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		owner, ok := callerWebhookOwner(c)
+		if !ok {
+			return
+		}
+		webhooks, err := store.ListWebhooks(c.Request.Context(), owner)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read webhooks: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+	}
+}
+
+// handleDeleteWebhook removes one of the caller's webhooks
+func handleDeleteWebhook(store PreviewStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		owner, ok := callerWebhookOwner(c)
+		if !ok {
+			return
+		}
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+			return
+		}
+		deleted, err := store.DeleteWebhook(c.Request.Context(), owner, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook: " + err.Error()})
+			return
+		}
+		if !deleted {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
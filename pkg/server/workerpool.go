@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrPoolSaturated is returned when every worker is busy and the queue is full
+var ErrPoolSaturated = errors.New("fetch queue is full")
+
+// FetchPool runs preview fetches on a fixed number of workers fed by a bounded queue
+// This caps the number of concurrent outbound connections (and the file descriptors
+// and memory they hold) no matter how many requests arrive at once
+type FetchPool struct {
+	jobs    chan func()
+	workers int
+	active  atomic.Int64 // Jobs currently running
+}
+
+// PoolStats is a point-in-time snapshot of the fetch pool
+type PoolStats struct {
+	Workers       int   `json:"workers"`
+	Active        int64 `json:"active"`
+	Queued        int   `json:"queued"`
+	QueueCapacity int   `json:"queue_capacity"`
+}
+
+// NewFetchPool starts workers goroutines consuming a queue of queueSize pending jobs
+func NewFetchPool(workers, queueSize int) *FetchPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	pool := &FetchPool{
+		jobs:    make(chan func(), queueSize),
+		workers: workers,
+	}
+	for i := 0; i < workers; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+// Submit queues job for execution, failing fast with ErrPoolSaturated when no worker
+// is free and the queue is full
+func (p *FetchPool) Submit(job func()) error {
+	select {
+	case p.jobs <- job:
+		return nil
+	default:
+		return ErrPoolSaturated
+	}
+}
+
+// Stats returns the current worker and queue usage
+func (p *FetchPool) Stats() PoolStats {
+	return PoolStats{
+		Workers:       p.workers,
+		Active:        p.active.Load(),
+		Queued:        len(p.jobs),
+		QueueCapacity: cap(p.jobs),
+	}
+}
+
+func (p *FetchPool) work() {
+	for job := range p.jobs {
+		p.active.Add(1)
+		job()
+		p.active.Add(-1)
+	}
+}